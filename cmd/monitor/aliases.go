@@ -0,0 +1,184 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// idKeys are the properties that may carry an incident identifier, in the
+// order getID prefers them. The feed is not consistent about which one it
+// sends, so the same incident can show up under different keys.
+var idKeys = []string{"id", "globalId", "globalid", "ogc_fid", "ogcId", "uid"}
+
+// idCandidates lists the distinct identifiers in p, in idKeys order.
+func idCandidates(p map[string]any) []string {
+	var out []string
+	for _, k := range idKeys {
+		id := idString(p[k])
+		if id == "" {
+			continue
+		}
+		dup := false
+		for _, o := range out {
+			dup = dup || o == id
+		}
+		if !dup {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// isTracked reports whether id already has per-incident history.
+func (ms *MonitorState) isTracked(id string) bool {
+	_, a := ms.firstSeen[id]
+	_, b := ms.status[id]
+	return a || b
+}
+
+// canonicalID returns the ID an incident is tracked under: a known alias
+// target, else the first tracked candidate, else getID. It does not record
+// anything; resolveID does.
+func (ms *MonitorState) canonicalID(p map[string]any) string {
+	cands := idCandidates(p)
+	for _, c := range cands {
+		if t, ok := ms.aliasOf[c]; ok {
+			return t
+		}
+	}
+	for _, c := range cands {
+		if ms.isTracked(c) {
+			return c
+		}
+	}
+	if len(cands) == 0 {
+		return ""
+	}
+	return cands[0]
+}
+
+// resolveID picks the canonical ID for p and records its other identifiers
+// as aliases. When two candidates were tracked as separate incidents (keys
+// flipped before the alias was known), the younger one is merged into the
+// older so it is not announced again. changed reports new aliases or merges,
+// which the state file has to keep.
+func (ms *MonitorState) resolveID(st perMuniState, seen perMuniSeen, p map[string]any) (id string, changed bool) {
+	cands := idCandidates(p)
+	id = ms.canonicalID(p)
+	for _, c := range cands {
+		if c == id {
+			continue
+		}
+		if ms.isTracked(c) {
+			if t, ok := ms.firstSeen[c]; ok && t.Before(ms.firstSeenOr(id, t)) {
+				id, c = c, id
+			}
+			ms.mergeIncident(st, seen, id, c)
+			changed = true
+		}
+		if ms.aliasOf[c] != id {
+			slog.Debug("identificador alternativo associado", "incident_id", id, "alias", c)
+			ms.aliasOf[c] = id
+			changed = true
+		}
+	}
+	return id, changed
+}
+
+func (ms *MonitorState) firstSeenOr(id string, def time.Time) time.Time {
+	if t, ok := ms.firstSeen[id]; ok {
+		return t
+	}
+	return def
+}
+
+// mergeIncident folds the history of drop into keep and forgets drop.
+func (ms *MonitorState) mergeIncident(st perMuniState, seen perMuniSeen, keep, drop string) {
+	slog.Debug("ocorrência duplicada fundida", "incident_id", keep, "alias", drop)
+	if t, ok := ms.firstSeen[drop]; ok {
+		if k, ok := ms.firstSeen[keep]; !ok || t.Before(k) {
+			ms.firstSeen[keep] = t
+		}
+	}
+	if _, ok := ms.status[keep]; !ok {
+		if s, ok := ms.status[drop]; ok {
+			ms.status[keep] = s
+		}
+	}
+	if _, ok := ms.means[keep]; !ok {
+		if m, ok := ms.means[drop]; ok {
+			ms.means[keep] = m
+		}
+	}
+	if m, ok := ms.maxMeans[drop]; ok {
+		ms.maxMeans[keep] = ms.maxMeans[keep].maxOf(m)
+		delete(ms.maxMeans, drop)
+	}
+	delete(ms.meansHist, drop)
+	if _, ok := ms.extra[keep]; !ok {
+		if s, ok := ms.extra[drop]; ok {
+			ms.extra[keep] = s
+		}
+	}
+	if _, ok := ms.annotations[keep]; !ok {
+		if a, ok := ms.annotations[drop]; ok {
+			ms.annotations[keep] = a
+			delete(ms.annotations, drop) // keep the open Grafana region
+		}
+	}
+	if h, ok := ms.history[drop]; ok {
+		if _, ok := ms.history[keep]; !ok {
+			ms.history[keep] = h
+		}
+		delete(ms.history, drop)
+	}
+	if _, ok := ms.spans[keep]; !ok {
+		if sp, ok := ms.spans[drop]; ok {
+			ms.spans[keep] = sp
+		}
+	}
+	if _, ok := ms.positions[keep]; !ok {
+		if pt, ok := ms.positions[drop]; ok {
+			ms.positions[keep] = pt
+		}
+	}
+	if _, ok := ms.burned[keep]; !ok {
+		if f, ok := ms.burned[drop]; ok {
+			ms.burned[keep] = f
+		}
+	}
+	if _, ok := ms.important[keep]; !ok {
+		if b, ok := ms.important[drop]; ok {
+			ms.important[keep] = b
+		}
+	}
+	if _, ok := ms.roads[keep]; !ok {
+		if r, ok := ms.roads[drop]; ok {
+			ms.roads[keep] = r
+		}
+	}
+	if tl, ok := ms.timeline[drop]; ok {
+		if _, ok := ms.timeline[keep]; !ok {
+			ms.timeline[keep] = tl
+		}
+		delete(ms.timeline, drop)
+	}
+	for muni, set := range st {
+		if _, ok := set[drop]; ok {
+			set[keep] = struct{}{}
+			if ts, ok := seen[muni][drop]; ok && seen[muni][keep].Before(ts) {
+				seen[muni][keep] = ts
+			}
+			delete(set, drop)
+			delete(seen[muni], drop)
+		}
+	}
+	for a, t := range ms.aliasOf {
+		if t == drop {
+			ms.aliasOf[a] = keep
+		}
+	}
+	ms.forgetID(st, seen, "", drop)
+	ms.aliasOf[drop] = keep
+	delete(ms.aliasOf, keep)
+}
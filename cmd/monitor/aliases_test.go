@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// keyedAs is incident() sent with the identifiers in ids (property -> value)
+// instead of its "id".
+func keyedAs(status string, man int, ids map[string]any) map[string]any {
+	f := incident("", status, man)
+	delete(f, "id")
+	for k, v := range ids {
+		f[k] = v
+	}
+	return f
+}
+
+// captureDebugLog sends slog output at debug level to the returned buffer
+// for the rest of the test.
+func captureDebugLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestIDFlipBetweenPolls(t *testing.T) {
+	cfg, srv, clk, ms := newTestMonitor(t, nil)
+	logs := captureDebugLog(t)
+
+	srv.setFeed(keyedAs("Despacho", 8, map[string]any{"id": "2025050001", "globalId": "G-77"}))
+	mustRun(t, cfg, ms)
+	if got := titles(srv.take()); len(got) != 2 {
+		t.Fatalf("first poll: %q", got)
+	}
+	if !strings.Contains(logs.String(), "identificador alternativo associado") || !strings.Contains(logs.String(), "alias=G-77") {
+		t.Errorf("no debug line for the alias:\n%s", logs)
+	}
+
+	// next poll only has globalId, with a new status: the same incident
+	clk.advance(time.Minute)
+	srv.setFeed(keyedAs("Em Curso", 8, map[string]any{"globalId": "G-77"}))
+	mustRun(t, cfg, ms)
+	if got := titles(srv.take()); !slices.Equal(got, []string{"Despacho → Em Curso — Sertã — Mato"}) {
+		t.Errorf("after the flip: %q", got)
+	}
+
+	// and back, after a restart: the alias map comes from the state file
+	clk.advance(time.Minute)
+	ms = NewMonitorState()
+	srv.setFeed(keyedAs("Em Curso", 8, map[string]any{"globalid": "G-77"}))
+	mustRun(t, cfg, ms)
+	if got := titles(srv.take()); len(got) != 0 {
+		t.Errorf("after a restart: %q", got)
+	}
+	if id := ms.CanonicalID(map[string]any{"globalId": "G-77"}); id != "2025050001" {
+		t.Errorf("G-77 resolves to %q after a restart", id)
+	}
+	if s, _ := ms.Status("G-77"); s != "" {
+		t.Errorf("the alias is tracked on its own with status %q", s)
+	}
+}
+
+// TestIDFlipBeforeAliasKnown: the incident showed up under each key alone
+// before a poll carried both, and CLEAN_FINISHED=0 kept both tracked. The
+// two are merged into the older one and neither is announced again.
+func TestIDFlipBeforeAliasKnown(t *testing.T) {
+	cfg, srv, clk, ms := newTestMonitor(t, map[string]string{"CLEAN_FINISHED": "0"})
+	logs := captureDebugLog(t)
+
+	srv.setFeed(keyedAs("Em Curso", 8, map[string]any{"id": "2025050001"}))
+	mustRun(t, cfg, ms)
+	clk.advance(time.Minute)
+	srv.setFeed(keyedAs("Em Curso", 8, map[string]any{"globalId": "G-77"}))
+	mustRun(t, cfg, ms)
+	srv.take()
+
+	clk.advance(time.Minute)
+	srv.setFeed(keyedAs("Em Curso", 8, map[string]any{"id": "2025050001", "globalId": "G-77"}))
+	mustRun(t, cfg, ms)
+	if got := titles(srv.take()); len(got) != 0 {
+		t.Errorf("after the merge: %q", got)
+	}
+	if !strings.Contains(logs.String(), "ocorrência duplicada fundida") {
+		t.Errorf("no debug line for the merge:\n%s", logs)
+	}
+	if first, _ := ms.FirstSeen("2025050001"); !first.Equal(testStart) {
+		t.Errorf("first seen %v, want the older %v", first, testStart)
+	}
+	if _, ok := ms.Status("G-77"); ok {
+		t.Error("the younger ID is still tracked")
+	}
+
+	clk.advance(time.Minute)
+	srv.setFeed(keyedAs("Em Resolução", 8, map[string]any{"globalId": "G-77"}))
+	mustRun(t, cfg, ms)
+	if got := titles(srv.take()); !slices.Equal(got, []string{"Em Curso → Em Resolução — Sertã — Mato"}) {
+		t.Errorf("status change under the alias: %q", got)
+	}
+}
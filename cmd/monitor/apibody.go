@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// readAPIBody reads a JSON response from the fogos.pt API (or FEATURES_SOURCE).
+// defaultHeaders asks for gzip/deflate itself, which turns off the transparent
+// decompression in net/http, so it is undone here. The Content-Type must be
+// JSON (or absent) and the decompressed body at most limit bytes. The bytes
+// on the wire are added to bombeiros_api_received_bytes_total.
+func readAPIBody(resp *http.Response, limit int64) ([]byte, error) {
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil || !strings.Contains(mt, "json") {
+			return nil, fmt.Errorf("Content-Type %q não é JSON", ct)
+		}
+	}
+	wire := &countingReader{r: resp.Body}
+	defer func() { apiReceivedBytes.Add(float64(wire.n)) }()
+	var r io.Reader = wire
+	switch enc := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); enc {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(wire)
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	case "deflate":
+		// Usually zlib-wrapped, but some servers send raw deflate.
+		br := bufio.NewReader(wire)
+		if hdr, err := br.Peek(2); err == nil && (uint16(hdr[0])<<8|uint16(hdr[1]))%31 == 0 && hdr[0]&0x0f == 8 {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, fmt.Errorf("deflate: %w", err)
+			}
+			defer zr.Close()
+			r = zr
+		} else {
+			fr := flate.NewReader(br)
+			defer fr.Close()
+			r = fr
+		}
+	default:
+		return nil, fmt.Errorf("Content-Encoding %q não suportado", enc)
+	}
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("resposta maior que o limite de %d MB (API_MAX_BODY_MB)", limit>>20)
+	}
+	return body, nil
+}
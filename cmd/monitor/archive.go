@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// archiveRecord is what ARCHIVE_DIR keeps of an incident once it concludes:
+// <dir>/YYYY/MM/DD/<id>.json, dated by the conclusion in BOMBEIROS_TZ. The
+// live state drops the incident as usual (CLEAN_FINISHED, STATE_TTL_HOURS);
+// the record stays for the weekly summary and later statistics.
+type archiveRecord struct {
+	ID            string         `json:"id"`
+	Concelho      string         `json:"concelho"`
+	Natureza      string         `json:"natureza,omitempty"`
+	First         *time.Time     `json:"first,omitempty"`
+	Concluded     time.Time      `json:"concluded"`
+	ActiveSec     int64          `json:"active_s,omitempty"`
+	Reactivations int            `json:"reactivations,omitempty"`
+	Means         Means          `json:"means"`
+	MaxMeans      Means          `json:"means_max"`
+	BurnedHa      float64        `json:"burned_ha,omitempty"`
+	Position      *geoPoint      `json:"position,omitempty"`
+	Timeline      []statusStep   `json:"timeline,omitempty"`
+	Properties    map[string]any `json:"properties"`
+}
+
+// archiveRecord collects what is known of id as it concludes; call it after
+// the conclusion has been recorded.
+func (ms *MonitorState) archiveRecord(id string, f Feature, now time.Time) archiveRecord {
+	rec := archiveRecord{
+		ID:            id,
+		Concelho:      getMunicipio(f.Properties),
+		Natureza:      getPropStr(f.Properties, "natureza"),
+		Concluded:     now.Truncate(time.Second),
+		ActiveSec:     ms.spans[id].ActiveSec,
+		Reactivations: ms.spans[id].Reactivations,
+		Means:         meansFromProps(f.Properties),
+		MaxMeans:      ms.maxMeans[id],
+		BurnedHa:      ms.burned[id],
+		Timeline:      slices.Clone(ms.timeline[id]),
+		Properties:    f.Properties,
+	}
+	if t, ok := ms.firstSeen[id]; ok {
+		rec.First = &t
+	}
+	if p, ok := ms.positions[id]; ok {
+		rec.Position = &p
+	}
+	return rec
+}
+
+// archivePath is where rec goes under dir.
+func archivePath(dir string, rec archiveRecord, loc *time.Location) string {
+	day := rec.Concluded.In(loc)
+	name := strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(rec.ID) + ".json"
+	return filepath.Join(dir, day.Format("2006"), day.Format("01"), day.Format("02"), name)
+}
+
+// archiveConcluded writes the records of this cycle's conclusions. It is
+// best effort: a failure is logged and the cycle goes on. A reactivated
+// incident that concludes again on the same day replaces its record.
+func archiveConcluded(cfg *Config, recs []archiveRecord) {
+	if cfg.ArchiveDir == "" {
+		return
+	}
+	for _, rec := range recs {
+		path := archivePath(cfg.ArchiveDir, rec, cfg.loc)
+		b, err := json.MarshalIndent(rec, "", "  ")
+		if err == nil {
+			if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+				err = os.WriteFile(path, b, 0644)
+			}
+		}
+		if err != nil {
+			slog.Warn("arquivo: registo não gravado", "incident_id", rec.ID, "path", path, "err", err)
+			continue
+		}
+		slog.Debug("arquivo: ocorrência concluída gravada", "incident_id", rec.ID, "path", path)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CAP 1.2 (OASIS Common Alerting Protocol) output, one alert per incident.
+// The first message for an ID is an Alert, a change of status or severity
+// an Update referencing the previous message, and conclusion (or the ID
+// leaving the feed) a Cancel. History lives in memory, so after a restart the
+// first message for an ongoing incident is an Alert again.
+
+type capAlert struct {
+	XMLName    xml.Name `xml:"urn:oasis:names:tc:emergency:cap:1.2 alert"`
+	Identifier string   `xml:"identifier"`
+	Sender     string   `xml:"sender"`
+	Sent       string   `xml:"sent"`
+	Status     string   `xml:"status"`
+	MsgType    string   `xml:"msgType"`
+	Scope      string   `xml:"scope"`
+	References string   `xml:"references,omitempty"`
+	Info       capInfo  `xml:"info"`
+}
+
+type capInfo struct {
+	Language    string     `xml:"language"`
+	Category    string     `xml:"category"`
+	Event       string     `xml:"event"`
+	Urgency     string     `xml:"urgency"`
+	Severity    string     `xml:"severity"`
+	Certainty   string     `xml:"certainty"`
+	SenderName  string     `xml:"senderName,omitempty"`
+	Headline    string     `xml:"headline"`
+	Description string     `xml:"description"`
+	Web         string     `xml:"web,omitempty"`
+	Parameters  []capParam `xml:"parameter"`
+	Area        capArea    `xml:"area"`
+}
+
+type capParam struct {
+	Name  string `xml:"valueName"`
+	Value string `xml:"value"`
+}
+
+type capArea struct {
+	AreaDesc string   `xml:"areaDesc"`
+	Polygons []string `xml:"polygon,omitempty"`
+	Circles  []string `xml:"circle,omitempty"`
+}
+
+// capEntry is the last message produced for one incident.
+type capEntry struct {
+	seq      int
+	status   string
+	severity string
+	ref      string // sender,identifier,sent of the last message
+	doc      []byte
+	gone     time.Time // set once cancelled; dropped a day later
+}
+
+// capStore is written by the poll goroutine and read by /cap/{id}.xml.
+type capStore struct {
+	mu   sync.RWMutex
+	byID map[string]*capEntry
+}
+
+var capAlerts = &capStore{byID: map[string]*capEntry{}}
+
+func (s *capStore) get(id string) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.byID[id]
+	if !ok {
+		return nil, false
+	}
+	return e.doc, true
+}
+
+// update produces new messages for views that appeared or changed and a
+// Cancel for those that concluded or left the filtered set. Changed documents
+// are also written to CAP_DIR.
+func (s *capStore) update(cfg *Config, views []incidentView, now time.Time) {
+	if !cfg.CAP && cfg.CAPDir == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	active := make(map[string]bool, len(views))
+	for _, v := range views {
+		if v.ID == "" {
+			continue
+		}
+		active[v.ID] = true
+		e := s.byID[v.ID]
+		concluded := isConcludedStatus(v.Status)
+		sev := capSeverity(v)
+		var msgType string
+		switch {
+		case e == nil || !e.gone.IsZero():
+			if concluded {
+				continue
+			}
+			// Keep the sequence across a reactivation so identifiers stay unique.
+			next := &capEntry{}
+			if e != nil {
+				next.seq = e.seq
+			}
+			e = next
+			s.byID[v.ID] = e
+			msgType = "Alert"
+		case concluded:
+			msgType = "Cancel"
+		case e.status != v.Status || e.severity != sev:
+			msgType = "Update"
+		default:
+			continue
+		}
+		s.emit(cfg, e, v, msgType, sev, now)
+	}
+	for id, e := range s.byID {
+		switch {
+		case !e.gone.IsZero():
+			if now.Sub(e.gone) > 24*time.Hour {
+				delete(s.byID, id)
+			}
+		case !active[id]:
+			v := incidentView{ID: id, Status: "Fora do feed"}
+			if last, err := capParse(e.doc); err == nil {
+				v = last
+				v.Status = "Fora do feed"
+			}
+			s.emit(cfg, e, v, "Cancel", "Minor", now)
+		}
+	}
+}
+
+// emit renders the next message for e; callers hold s.mu.
+func (s *capStore) emit(cfg *Config, e *capEntry, v incidentView, msgType, sev string, now time.Time) {
+	sent := capTime(now)
+	ident := "pt.fogos." + v.ID
+	if e.seq > 0 {
+		ident = fmt.Sprintf("%s.%d", ident, e.seq)
+	}
+	a := capAlert{
+		Identifier: ident,
+		Sender:     cfg.CAPSender,
+		Sent:       sent,
+		Status:     "Actual",
+		MsgType:    msgType,
+		Scope:      "Public",
+		Info:       capInfoFor(v, sev),
+	}
+	if msgType != "Alert" {
+		a.References = e.ref
+	}
+	doc, err := xml.MarshalIndent(a, "", "  ")
+	if err != nil {
+		slog.Error("CAP", "incident_id", v.ID, "err", err)
+		return
+	}
+	e.doc = append([]byte(xml.Header), doc...)
+	e.seq++
+	e.status, e.severity = v.Status, sev
+	e.ref = cfg.CAPSender + "," + ident + "," + sent
+	if msgType == "Cancel" {
+		e.gone = now
+	}
+	if cfg.CAPDir != "" {
+		if err := os.MkdirAll(cfg.CAPDir, 0755); err == nil {
+			err = os.WriteFile(filepath.Join(cfg.CAPDir, v.ID+".xml"), e.doc, 0644)
+		}
+		if err != nil {
+			slog.Error("erro a gravar CAP", "incident_id", v.ID, "err", err)
+		}
+	}
+}
+
+func capInfoFor(v incidentView, sev string) capInfo {
+	place := v.Concelho
+	if v.Freguesia != "" {
+		place = v.Freguesia + ", " + v.Concelho
+	}
+	info := capInfo{
+		Language:    "pt-PT",
+		Category:    "Fire",
+		Event:       v.Natureza,
+		Urgency:     "Immediate",
+		Severity:    sev,
+		Certainty:   "Observed",
+		SenderName:  "Bombeiros Monitor (dados fogos.pt / ANEPC)",
+		Headline:    fmt.Sprintf("%s: %s (%s)", v.Concelho, v.Natureza, v.Status),
+		Description: fmt.Sprintf("Estado: %s\nMeios: %d operacionais, %d terrestres, %d aéreos", v.Status, v.Means.Man, v.Means.Terrain, v.Means.Aerial),
+		Web:         v.FogosURL,
+		Parameters: []capParam{
+			{"fogosId", v.ID},
+			{"status", v.Status},
+			{"man", fmt.Sprint(v.Means.Man)},
+			{"terrain", fmt.Sprint(v.Means.Terrain)},
+			{"aerial", fmt.Sprint(v.Means.Aerial)},
+		},
+		Area: capArea{AreaDesc: place},
+	}
+	if !strings.Contains(strings.ToLower(stripAccents(v.Natureza)), "incendio") {
+		info.Category = "Safety"
+	}
+	if info.Event == "" {
+		info.Event = "Ocorrência"
+	}
+	if s := strings.ToLower(stripAccents(v.Status)); !strings.Contains(s, "curso") && !strings.Contains(s, "despacho") && !strings.Contains(s, "chegada") {
+		info.Urgency = "Expected"
+	}
+	if v.Perimeter != nil && len(v.Perimeter.Coordinates) > 0 {
+		var pts []string
+		for _, c := range v.Perimeter.Coordinates[0] {
+			pts = append(pts, fmt.Sprintf("%.5f,%.5f", c[1], c[0]))
+		}
+		info.Area.Polygons = []string{strings.Join(pts, " ")}
+	}
+	if v.Coordinates != nil {
+		info.Area.Circles = []string{fmt.Sprintf("%.5f,%.5f 0", v.Coordinates.Lat, v.Coordinates.Lon)}
+	}
+	return info
+}
+
+// capSeverity maps status and committed means to a CAP severity.
+func capSeverity(v incidentView) string {
+	s := strings.ToLower(stripAccents(v.Status))
+	switch {
+	case strings.Contains(s, "conclus") || strings.Contains(s, "vigil"):
+		return "Minor"
+	case strings.Contains(s, "resolu"):
+		return "Moderate"
+	case v.Means.Man >= 100 || v.Means.Aerial >= 4:
+		return "Extreme"
+	case v.Means.Man >= 30 || v.Means.Aerial > 0:
+		return "Severe"
+	default:
+		return "Moderate"
+	}
+}
+
+func isConcludedStatus(status string) bool {
+	return strings.Contains(strings.ToLower(stripAccents(status)), "conclus")
+}
+
+// capTime formats t as CAP wants it: no fractional seconds, UTC as -00:00.
+func capTime(t time.Time) string {
+	return strings.Replace(t.UTC().Format("2006-01-02T15:04:05-07:00"), "+00:00", "-00:00", 1)
+}
+
+// capParse recovers the incident fields from a previous message so a Cancel
+// for an ID that left the feed still carries its event and area.
+func capParse(doc []byte) (incidentView, error) {
+	var a capAlert
+	if err := xml.Unmarshal(doc, &a); err != nil {
+		return incidentView{}, err
+	}
+	v := incidentView{Natureza: a.Info.Event, Concelho: a.Info.Area.AreaDesc}
+	for _, p := range a.Info.Parameters {
+		if p.Name == "fogosId" {
+			v.ID = p.Value
+		}
+	}
+	if v.ID != "" {
+		v.FogosURL = "https://fogos.pt/fogo/" + v.ID
+	}
+	if len(a.Info.Area.Circles) > 0 {
+		var c latLon
+		if _, err := fmt.Sscanf(a.Info.Area.Circles[0], "%f,%f", &c.Lat, &c.Lon); err == nil {
+			v.Coordinates = &c
+		}
+	}
+	return v, nil
+}
+
+// capHandler serves GET /cap/{id}.xml.
+func capHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := strings.CutSuffix(r.PathValue("file"), ".xml")
+	doc, found := capAlerts.get(id)
+	if !ok || !found {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/cap+xml; charset=utf-8")
+	_, _ = w.Write(doc)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// capSchema is the order of the elements the CAP 1.2 XSD allows in alert,
+// info and area (each an xs:sequence), and the ones it requires.
+var capSchema = map[string]struct{ order, required []string }{
+	"alert": {
+		order:    []string{"identifier", "sender", "sent", "status", "msgType", "source", "scope", "restriction", "addresses", "code", "note", "references", "incidents", "info"},
+		required: []string{"identifier", "sender", "sent", "status", "msgType", "scope"},
+	},
+	"info": {
+		order:    []string{"language", "category", "event", "responseType", "urgency", "severity", "certainty", "audience", "eventCode", "effective", "onset", "expires", "senderName", "headline", "description", "instruction", "web", "contact", "parameter", "resource", "area"},
+		required: []string{"category", "event", "urgency", "severity", "certainty"},
+	},
+	"area": {
+		order:    []string{"areaDesc", "polygon", "circle", "geocode", "altitude", "ceiling"},
+		required: []string{"areaDesc"},
+	},
+}
+
+// capChildren returns the names of the child elements of every alert, info
+// and area in doc, and the namespace of the root.
+func capChildren(t *testing.T, doc []byte) (map[string][]string, string) {
+	t.Helper()
+	dec := xml.NewDecoder(strings.NewReader(string(doc)))
+	children := map[string][]string{}
+	var stack []string
+	ns := ""
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch e := tok.(type) {
+		case xml.StartElement:
+			if len(stack) == 0 {
+				ns = e.Name.Space
+			} else if parent := stack[len(stack)-1]; capSchema[parent].order != nil {
+				children[parent] = append(children[parent], e.Name.Local)
+			}
+			stack = append(stack, e.Name.Local)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return children, ns
+}
+
+// checkCAP checks doc against the structure of the CAP 1.2 XSD: known
+// elements in schema order, required ones present, CAP date-times.
+func checkCAP(t *testing.T, doc []byte) capAlert {
+	t.Helper()
+	children, ns := capChildren(t, doc)
+	if ns != "urn:oasis:names:tc:emergency:cap:1.2" {
+		t.Errorf("namespace %q", ns)
+	}
+	for parent, schema := range capSchema {
+		got := children[parent]
+		if got == nil {
+			t.Errorf("no <%s>", parent)
+			continue
+		}
+		last := -1
+		for _, name := range got {
+			i := slices.Index(schema.order, name)
+			if i < 0 {
+				t.Errorf("<%s> has unknown element <%s>", parent, name)
+			} else if i < last {
+				t.Errorf("<%s> children out of order: %q", parent, got)
+			} else {
+				last = i
+			}
+		}
+		for _, name := range schema.required {
+			if !slices.Contains(got, name) {
+				t.Errorf("<%s> lacks <%s>", parent, name)
+			}
+		}
+	}
+	var a capAlert
+	if err := xml.Unmarshal(doc, &a); err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d[-+]\d\d:\d\d$`).MatchString(a.Sent) || strings.HasSuffix(a.Sent, "+00:00") {
+		t.Errorf("sent %q is not a CAP date-time", a.Sent)
+	}
+	if strings.ContainsAny(a.Identifier, " ,<&") || strings.ContainsAny(a.Sender, " ,<&") {
+		t.Errorf("identifier %q / sender %q with characters CAP forbids", a.Identifier, a.Sender)
+	}
+	return a
+}
+
+func TestCAPElements(t *testing.T) {
+	cfg, _ := testConfig(t, map[string]string{"CAP": "1", "CAP_SENDER": "protecao-civil.cm-serta.pt"})
+	s := &capStore{byID: map[string]*capEntry{}}
+	ring := [][2]float64{{-8.1, 39.8}, {-8.09, 39.8}, {-8.09, 39.81}, {-8.1, 39.8}}
+	s.update(cfg, []incidentView{{
+		ID: "2025050001", Concelho: "Sertã", Freguesia: "Cernache do Bonjardim", Natureza: "Incêndio em Mato",
+		Status: "Em Curso", Means: Means{Man: 40, Terrain: 10, Aerial: 1},
+		Coordinates: &latLon{Lat: 39.8, Lon: -8.1}, FogosURL: "https://fogos.pt/fogo/2025050001",
+		Perimeter: &geoPolygon{Type: "Polygon", Coordinates: [][][2]float64{ring}},
+	}}, testStart)
+	doc, ok := s.get("2025050001")
+	if !ok {
+		t.Fatal("no alert")
+	}
+	a := checkCAP(t, doc)
+	if a.MsgType != "Alert" || a.Identifier != "pt.fogos.2025050001" || a.Sender != cfg.CAPSender || a.Sent != "2025-08-14T15:20:00-00:00" {
+		t.Errorf("alert %+v", a)
+	}
+	info := a.Info
+	if info.Category != "Fire" || info.Event != "Incêndio em Mato" || info.Severity != "Severe" || info.Urgency != "Immediate" {
+		t.Errorf("info %+v", info)
+	}
+	if got := info.Area.Polygons; len(got) != 1 || got[0] != "39.80000,-8.10000 39.80000,-8.09000 39.81000,-8.09000 39.80000,-8.10000" {
+		t.Errorf("polygon %q", got)
+	}
+	if got := info.Area.Circles; len(got) != 1 || got[0] != "39.80000,-8.10000 0" {
+		t.Errorf("circle %q", got)
+	}
+	if info.Area.AreaDesc != "Cernache do Bonjardim, Sertã" {
+		t.Errorf("areaDesc %q", info.Area.AreaDesc)
+	}
+}
+
+// capGet fetches /cap/{id}.xml through capHandler.
+func capGet(t *testing.T, id string) (int, []byte) {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /cap/{file}", capHandler)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cap/"+id+".xml", nil))
+	return rec.Code, rec.Body.Bytes()
+}
+
+func TestCAPMsgTypes(t *testing.T) {
+	capAlerts = &capStore{byID: map[string]*capEntry{}}
+	t.Cleanup(func() { capAlerts = &capStore{byID: map[string]*capEntry{}} })
+	cfg, srv, clk, ms := newTestMonitor(t, map[string]string{"CAP": "1"})
+
+	poll := func(status string, man int) capAlert {
+		t.Helper()
+		srv.setFeed(incident("2025050001", status, man))
+		mustRun(t, cfg, ms)
+		code, doc := capGet(t, "2025050001")
+		if code != http.StatusOK {
+			t.Fatalf("%s: GET /cap: %d", status, code)
+		}
+		clk.advance(time.Minute)
+		return checkCAP(t, doc)
+	}
+
+	first := poll("Despacho", 8)
+	if first.MsgType != "Alert" || first.References != "" {
+		t.Errorf("first message: %s references %q", first.MsgType, first.References)
+	}
+	if same := poll("Despacho", 8); same.Identifier != first.Identifier {
+		t.Errorf("unchanged incident got a new message %q", same.Identifier)
+	}
+
+	update := poll("Em Curso", 8)
+	if update.MsgType != "Update" {
+		t.Errorf("status change: msgType %s", update.MsgType)
+	}
+	if want := first.Sender + "," + first.Identifier + "," + first.Sent; update.References != want {
+		t.Errorf("update references %q, want %q", update.References, want)
+	}
+	// more means raise the severity: also an Update
+	if sev := poll("Em Curso", 120); sev.MsgType != "Update" || sev.Info.Severity != "Extreme" {
+		t.Errorf("severity change: %s %s", sev.MsgType, sev.Info.Severity)
+	}
+
+	cancel := poll("Conclusão", 0)
+	if cancel.MsgType != "Cancel" || cancel.References == "" {
+		t.Errorf("conclusion: %s references %q", cancel.MsgType, cancel.References)
+	}
+	ids := []string{first.Identifier, update.Identifier, cancel.Identifier}
+	if len(slices.Compact(slices.Sorted(slices.Values(ids)))) != len(ids) {
+		t.Errorf("identifiers not unique: %q", ids)
+	}
+
+	// a concluded incident leaving the feed sends no second Cancel
+	srv.setFeed()
+	mustRun(t, cfg, ms)
+	if _, doc := capGet(t, "2025050001"); checkCAP(t, doc).Identifier != cancel.Identifier {
+		t.Error("new message after the Cancel")
+	}
+	if code, _ := capGet(t, "2025050002"); code != http.StatusNotFound {
+		t.Errorf("unknown ID: %d", code)
+	}
+}
+
+func TestCAPCancelWhenLeavingFeed(t *testing.T) {
+	cfg, _ := testConfig(t, map[string]string{"CAP": "1"})
+	s := &capStore{byID: map[string]*capEntry{}}
+	s.update(cfg, []incidentView{{ID: "2025050001", Concelho: "Sertã", Natureza: "Mato", Status: "Em Curso", Coordinates: &latLon{Lat: 39.8, Lon: -8.1}}}, testStart)
+	s.update(cfg, nil, testStart.Add(time.Minute))
+	doc, _ := s.get("2025050001")
+	a := checkCAP(t, doc)
+	if a.MsgType != "Cancel" || a.Info.Event != "Mato" || a.Info.Area.AreaDesc != "Sertã" || len(a.Info.Area.Circles) != 1 {
+		t.Errorf("cancel after leaving the feed: %+v", a)
+	}
+	s.update(cfg, nil, testStart.Add(25*time.Hour))
+	if _, ok := s.get("2025050001"); ok {
+		t.Error("cancelled entry kept after a day")
+	}
+}
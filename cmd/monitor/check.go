@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	checkPass = "OK"
+	checkWarn = "AVISO"
+	checkFail = "FALHA"
+)
+
+type checkResult struct {
+	name   string
+	result string
+	detail string
+}
+
+// ntfyTopicRe mirrors the topic names ntfy accepts.
+var ntfyTopicRe = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)
+
+// cmdCheck validates the configuration and probes the fogos API and the ntfy
+// server without sending notifications or touching the state file.
+func cmdCheck(name string, args []string) {
+	cfg, _, _ := loadCommandConfig(name, args, nil)
+	setConfig(cfg)
+	var results []checkResult
+	add := func(name, result, detail string) {
+		results = append(results, checkResult{name, result, detail})
+	}
+
+	for _, m := range cfg.Municipios {
+		if d, ok := lookupMunicipio(m); ok {
+			add("município "+m, checkPass, d)
+		} else {
+			add("município "+m, checkWarn, "nome desconhecido; nenhuma ocorrência vai corresponder")
+		}
+	}
+
+	if probs := catalogProblems(); len(probs) > 0 {
+		add("idioma "+cfg.lang, checkFail, strings.Join(probs, "; "))
+	} else {
+		add("idioma "+cfg.lang, checkPass, cfg.Lang)
+	}
+
+	if dotEnv.path != "" {
+		add(".env", checkPass, fmt.Sprintf("%s: %d variáveis", dotEnv.path, dotEnv.applied))
+	}
+	for _, p := range dotEnv.problems {
+		add(".env", checkWarn, p)
+	}
+	if unknown := unknownEnvVars(); len(unknown) > 0 {
+		add("variáveis", checkWarn, "desconhecidas (erro de escrita?): "+strings.Join(unknown, ", "))
+	}
+
+	switch q := strings.TrimSpace(cfg.QuietHours); {
+	case q == "":
+		add("QUIET_HOURS", checkPass, "desligado")
+	case cfg.quiet.enabled:
+		add("QUIET_HOURS", checkPass, fmt.Sprintf("%02d:00–%02d:00", cfg.quiet.startH, cfg.quiet.endH))
+	default:
+		add("QUIET_HOURS", checkFail, fmt.Sprintf("%q inválido (esperado ex.: 23-7)", q))
+	}
+
+	switch {
+	case !cfg.hasCenter() && cfg.RadiusKm > 0:
+		add("CENTER/RADIUS", checkWarn, "RADIUS_KM definido sem CENTER_LAT/CENTER_LON; filtro ignorado")
+	case !cfg.hasCenter():
+		add("CENTER/RADIUS", checkPass, "desligado")
+	case cfg.CenterLat < -90 || cfg.CenterLat > 90 || cfg.CenterLon < -180 || cfg.CenterLon > 180:
+		add("CENTER/RADIUS", checkFail, fmt.Sprintf("coordenadas fora do intervalo: %g,%g", cfg.CenterLat, cfg.CenterLon))
+	case cfg.RadiusKm <= 0:
+		add("CENTER/RADIUS", checkWarn, "centro definido sem RADIUS_KM; filtro ignorado")
+	default:
+		add("CENTER/RADIUS", checkPass, fmt.Sprintf("%g km à volta de %.4f,%.4f", cfg.RadiusKm, cfg.CenterLat, cfg.CenterLon))
+	}
+
+	client := cfg.httpClient
+	switch {
+	case cfg.InsecureSkipVerify:
+		add("TLS", checkWarn, "INSECURE_SKIP_VERIFY ligado; certificados não verificados")
+	case cfg.HTTPCAFile != "":
+		add("TLS", checkPass, "CAs do sistema + "+cfg.HTTPCAFile)
+	}
+	if u, err := url.Parse(fogosActiveURL); err == nil {
+		if p, _ := http.ProxyFromEnvironment(&http.Request{URL: u}); p != nil {
+			add("proxy", checkPass, p.Redacted())
+		}
+	}
+	for _, src := range cfg.sources {
+		start := time.Now()
+		feedName := "origem " + src.name
+		switch {
+		case src.url == fogosActiveURL:
+			feedName = "API fogos.pt"
+		case src.name == sourceFogos && src.url == cfg.FeaturesSource:
+			feedName = "FEATURES_SOURCE"
+		}
+		if n, err := checkSource(client, cfg, src); err != nil {
+			add(feedName, checkFail, err.Error())
+		} else {
+			add(feedName, checkPass, fmt.Sprintf("%d ocorrências ativas em %s", n, time.Since(start).Round(time.Millisecond)))
+		}
+	}
+
+	switch {
+	case strings.TrimSpace(cfg.NtfyTopic) == "":
+		add("NTFY_TOPIC", checkWarn, "vazio; notificações desligadas")
+	case !ntfyTopicRe.MatchString(cfg.NtfyTopic):
+		add("NTFY_TOPIC", checkFail, fmt.Sprintf("%q: só letras, dígitos, - e _ (máx. 64)", cfg.NtfyTopic))
+	default:
+		add("NTFY_TOPIC", checkPass, cfg.NtfyTopic)
+	}
+	ntfyServers := ntfyServersFor(cfg, cfg.NtfyURL)
+	if cfg.GotifyOnly {
+		ntfyServers = nil
+	}
+	for _, srv := range ntfyServers {
+		if err := checkNtfy(client, srv.URL); err != nil {
+			add("servidor ntfy", checkFail, err.Error())
+		} else {
+			add("servidor ntfy", checkPass, srv.label())
+		}
+	}
+	if cfg.SMTPHost != "" {
+		if err := checkSMTP(cfg); err != nil {
+			add("servidor SMTP", checkFail, err.Error())
+		} else {
+			add("servidor SMTP", checkPass, fmt.Sprintf("%s:%d, %d destinatários", cfg.SMTPHost, cfg.SMTPPort, len(cfg.smtpTo)))
+		}
+	}
+	if cfg.GotifyURL != "" {
+		if err := checkGotify(client, cfg.GotifyURL); err != nil {
+			add("servidor Gotify", checkFail, err.Error())
+		} else {
+			add("servidor Gotify", checkPass, gotifyLabel(cfg))
+		}
+	}
+	if cfg.NtfyDryRun {
+		add("NTFY_DRYRUN", checkWarn, "ligado; nada será publicado")
+	}
+	if cfg.StateBackend == stateBackendRedis {
+		if detail, err := redisStoreFor(cfg.RedisURL, cfg.RedisPrefix).check(); err != nil {
+			add("STATE_BACKEND redis", checkFail, err.Error())
+		} else {
+			add("STATE_BACKEND redis", checkPass, detail)
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	failed := false
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.result, r.name, r.detail)
+		failed = failed || r.result == checkFail
+	}
+	_ = tw.Flush()
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// checkSource reads one SOURCES entry and returns how many incidents it
+// parsed.
+func checkSource(client *http.Client, cfg *Config, src feedSource) (int, error) {
+	parser := feedParsers[src.name]
+	if !isHTTPSource(src.url) {
+		body, err := readLocalSource(src.url)
+		if err != nil {
+			return 0, err
+		}
+		feats, err := parser.parse(body)
+		if err != nil {
+			return 0, fmt.Errorf("resposta inválida: %w", err)
+		}
+		return len(feats), nil
+	}
+	req, err := http.NewRequest("GET", src.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header = defaultHeaders(cfg)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return 0, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	body, err := readAPIBody(resp, int64(cfg.APIMaxBodyMB)<<20)
+	if err != nil {
+		return 0, err
+	}
+	feats, err := parser.parse(body)
+	if err != nil {
+		return 0, fmt.Errorf("resposta inválida: %w", err)
+	}
+	return len(feats), nil
+}
+
+// checkNtfy asks the ntfy server for /v1/health.
+func checkNtfy(client *http.Client, base string) error {
+	u, err := url.Parse(strings.TrimSpace(base))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("NTFY_URL %q inválido", base)
+	}
+	resp, err := client.Get(strings.TrimRight(u.String(), "/") + "/v1/health")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("HTTP %d em /v1/health", resp.StatusCode)
+	}
+	var h struct {
+		Healthy *bool `json:"healthy"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&h); err != nil || h.Healthy == nil {
+		return fmt.Errorf("resposta de /v1/health não parece ntfy")
+	}
+	if !*h.Healthy {
+		return fmt.Errorf("servidor reporta healthy=false")
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// version is set at build time: go build -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
+// command is a CLI subcommand. run receives its own name (for usage) and the
+// arguments after it.
+type command struct {
+	name  string
+	usage string
+	run   func(name string, args []string)
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "vigiar o feed em ciclo (por omissão)", func(name string, args []string) { cmdRun(name, args, false) }},
+		{"once", "executar um único ciclo e sair", func(name string, args []string) { cmdRun(name, args, true) }},
+		{"check", "validar a configuração e testar a API e o ntfy", cmdCheck},
+		{"test-notify", "enviar uma mensagem de exemplo de cada tipo", cmdTestNotify},
+		{"simulate", "injetar uma ocorrência fictícia num ciclo real", cmdSimulate},
+		{"replay", "reproduzir snapshots de SNAPSHOT_DIR (notificações em dry-run)", cmdReplay},
+		{"service", "install|uninstall|start|stop: serviço Windows", cmdService},
+		{"state", "show|export|forget|prune|verify|migrate: inspecionar e manter o ficheiro de estado", cmdState},
+		{"health", "sair com 0 se a instância em execução estiver pronta (HEALTHCHECK)", cmdHealth},
+		{"version", "mostrar a versão", cmdVersion},
+	}
+}
+
+func main() {
+	args := os.Args[1:]
+	loadDotEnv()
+	if runningAsService() {
+		runAsService(args)
+		return
+	}
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		for _, c := range commands {
+			if c.name == args[0] {
+				c.run(c.name, args[1:])
+				return
+			}
+		}
+		if args[0] == "help" {
+			printUsage(os.Stdout)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "comando desconhecido: %s\n\n", args[0])
+		printUsage(os.Stderr)
+		os.Exit(2)
+	}
+	// No subcommand: behave like `run` so existing service units keep working.
+	cmdRun("run", args, false)
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Uso: %s <comando> [opções]\n\nComandos:\n", progName())
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(w, "\nSem comando equivale a \"run\". Use \"%s <comando> -h\" para as opções.\n", progName())
+}
+
+func progName() string {
+	return strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+}
+
+// loadCommandConfig parses args with the config flags plus any command-specific
+// ones added by extra and loads the configuration. It exits
+// on invalid configuration and returns the positional arguments left over.
+func loadCommandConfig(name string, args []string, extra func(fs *flag.FlagSet)) (*Config, *configLoader, []string) {
+	fs := flag.NewFlagSet(progName()+" "+name, flag.ExitOnError)
+	loader := newConfigLoader(fs)
+	if extra != nil {
+		extra(fs)
+	}
+	_ = fs.Parse(args)
+	cfg, err := loader.load()
+	if err != nil {
+		slog.Error("configuração inválida", "err", err)
+		os.Exit(1)
+	}
+	return cfg, loader, fs.Args()
+}
+
+func cmdVersion(name string, args []string) {
+	rev, at := "", ""
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				rev = s.Value
+			case "vcs.time":
+				at = s.Value
+			}
+		}
+	}
+	fmt.Printf("bombeiros-monitor %s", version)
+	if rev != "" {
+		if len(rev) > 12 {
+			rev = rev[:12]
+		}
+		fmt.Printf(" (%s %s)", rev, at)
+	}
+	fmt.Printf(" %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// cmdTestNotify sends one sample of each notification type through the
+// configured channel so templates, tags and priorities can be checked on a
+// phone. With -selftest it instead runs the delivery self-test of NTFY_TEST.
+func cmdTestNotify(name string, args []string) {
+	var selfTest *bool
+	cfg, _, _ := loadCommandConfig(name, args, func(fs *flag.FlagSet) {
+		selfTest = fs.Bool("selftest", false, "publicar uma mensagem e confirmar que chega ao tópico (como NTFY_TEST=1)")
+	})
+	setConfig(cfg)
+	setupLogging(os.Stderr, cfg)
+	if strings.TrimSpace(cfg.NtfyTopic) == "" {
+		fmt.Fprintln(os.Stderr, "NTFY_TOPIC vazio: nada a enviar")
+		os.Exit(1)
+	}
+	if *selfTest {
+		if ntfySelfTest(cfg) != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	now := cfg.now().In(cfg.loc).Format("02/01 15:04")
+	samples := []Notification{
+		{Type: notifyNew, Title: tr("test.new"), Body: tr("test.new.body", now), Tags: adjustTagsForNature(cfg.NtfyTags, map[string]any{"natureza": "Incêndio Rural"}), Priority: cfg.NtfyPriority},
+		{Type: notifyStatus, Title: tr("test.status"), Body: tr("test.time", now), Tags: "arrows_counterclockwise", Priority: "3"},
+		{Type: notifyMeans, Title: tr("test.means"), Body: tr("test.means.body"), Tags: "fire_engine", Priority: "3"},
+		{Type: notifyExtra, Title: tr("test.extra"), Body: tr("test.extra.body"), Tags: "memo", Priority: "3"},
+		{Type: notifySummary, Title: tr("test.summary"), Body: tr("test.summary.body"), Tags: "bar_chart", Priority: "2"},
+		{Type: notifyTest, Title: tr("test.monitor"), Body: now, Tags: "white_check_mark", Priority: "3"},
+	}
+	failed := 0
+	for _, n := range samples {
+		if err := postNtfyExt(cfg.NtfyURL, cfg.NtfyTopic, n); err != nil {
+			fmt.Printf("%-8s FALHOU  %v\n", n.Type, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%-8s ok\n", n.Type)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
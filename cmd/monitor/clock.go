@@ -0,0 +1,16 @@
+package main
+
+import "time"
+
+// Clock is where the poll cycle reads the time. finalize sets the system
+// clock; a test can swap in its own to run runOnce at a chosen instant.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// now is the current time on c's clock.
+func (c *Config) now() time.Time { return c.clock.Now() }
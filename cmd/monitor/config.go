@@ -0,0 +1,828 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	_ "time/tzdata" // Windows and slim containers have no zoneinfo for BOMBEIROS_TZ
+
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every runtime option. It is built once at startup from, in
+// increasing precedence, built-in defaults, the optional YAML CONFIG_FILE,
+// environment variables and command-line flags, and is never mutated after
+// being published with setConfig.
+//
+// Each field's env tag names the environment variable(s) it reads; the YAML
+// key is the lower-cased variable name and the flag is the same with dashes
+// (NTFY_TOPIC -> ntfy_topic / --ntfy-topic).
+type Config struct {
+	// Core
+	Municipios             []string      `env:"MUNICIPIOS,MUNICIPIO" help:"municípios a monitorizar (lista separada por vírgulas ou ;)"`
+	PollInterval           time.Duration `env:"POLL_SECONDS" default:"30" parse:"poll" help:"intervalo entre leituras (segundos ou duração, 0 = execução única)"`
+	StateFile              string        `env:"STATE_FILE" default:"last_ids.json" help:"ficheiro de estado"`
+	StateTTL               time.Duration `env:"STATE_TTL_HOURS" parse:"ttl" help:"retenção de IDs no estado (horas ou duração, 0 = sem limite)"`
+	StateBackups           int           `env:"STATE_BACKUPS" default:"2" help:"gerações anteriores do ficheiro de estado guardadas como .1, .2... (0 = nenhuma)"`
+	StateFlushSeconds      int           `env:"STATE_FLUSH_SECONDS" default:"60" help:"gravar o estado no máximo uma vez a cada N segundos (0 = a cada alteração)"`
+	StateBackend           string        `env:"STATE_BACKEND" default:"file" help:"onde guardar o estado: file (STATE_FILE) ou redis (partilhado entre réplicas)"`
+	RedisURL               string        `env:"REDIS_URL" secret:"true" help:"redis://[:senha@]host:6379/0 para STATE_BACKEND=redis"`
+	RedisPrefix            string        `env:"REDIS_PREFIX" default:"bombeiros" help:"prefixo das chaves no Redis"`
+	RedisLockTTLSeconds    int           `env:"REDIS_LOCK_TTL_SECONDS" help:"validade do bloqueio entre réplicas (0 = 3× POLL_SECONDS, mínimo 30)"`
+	CleanFinished          bool          `env:"CLEAN_FINISHED" default:"true" help:"remover do estado IDs que deixaram de estar ativos"`
+	ArchiveDir             string        `env:"ARCHIVE_DIR" help:"gravar cada ocorrência concluída em <pasta>/AAAA/MM/DD/<id>.json"`
+	UseTray                bool          `env:"USE_TRAY" default:"true" help:"Windows: correr na área de notificação"`
+	Tray                   bool          `env:"TRAY" help:"Linux/macOS: correr na área de notificação (binário com -tags tray)"`
+	MaxConsecutiveFailures int           `env:"MAX_CONSECUTIVE_FAILURES" help:"sair com código 2 após N ciclos falhados seguidos (0 = nunca)"`
+
+	// Fogos API
+	FogosAPIKey               string `env:"FOGOS_API_KEY" secret:"true" help:"token opcional da API fogos.pt"`
+	APIFailureNotifyThreshold int    `env:"API_FAILURE_NOTIFY_THRESHOLD" default:"5" help:"avisar após N falhas seguidas da API (0 = desligado)"`
+	FeaturesSource            string `env:"FEATURES_SOURCE" help:"origem das ocorrências: URL, file:<caminho> ou - (stdin); vazio = API fogos.pt"`
+	Sources                   string `env:"SOURCES" default:"fogos" help:"origens lidas em paralelo (fogos, prociv), cada uma com =URL opcional; fogos.pt prevalece nos duplicados"`
+	APIMaxBodyMB              int    `env:"API_MAX_BODY_MB" default:"20" help:"tamanho máximo (descomprimido) de uma resposta da API, em MB"`
+	SnapshotDir               string `env:"SNAPSHOT_DIR" help:"guardar cada resposta da API neste diretório (para replay)"`
+	DebugDir                  string `env:"DEBUG_DIR" default:"debug" help:"diretório para respostas da API guardadas para diagnóstico"`
+	SnapshotOnError           bool   `env:"SNAPSHOT_ON_ERROR" default:"true" help:"guardar em DEBUG_DIR as respostas que não se conseguem ler"`
+	SnapshotEvery             int    `env:"SNAPSHOT_EVERY" help:"guardar também em DEBUG_DIR uma resposta a cada N leituras (0 = desligado)"`
+	DebugDirMaxMB             int    `env:"DEBUG_DIR_MAX_MB" default:"50" help:"tamanho máximo de DEBUG_DIR; as respostas mais antigas são apagadas (0 = sem limite)"`
+	FeedCache                 bool   `env:"FEED_CACHE" default:"true" help:"guardar a última resposta válida e mostrá-la (sem notificar) enquanto a API falha"`
+	FeedCacheMaxHours         int    `env:"FEED_CACHE_MAX_HOURS" default:"24" help:"não usar a cache se tiver mais de N horas (0 = sem limite)"`
+
+	// Outgoing HTTP (API, ntfy, IPMA, Open-Meteo, Grafana); proxies come from HTTPS_PROXY/NO_PROXY
+	HTTPTimeoutSeconds int    `env:"HTTP_TIMEOUT_SECONDS" default:"20" help:"tempo máximo de cada pedido HTTP, em segundos"`
+	HTTPCAFile         string `env:"HTTP_CA_FILE" help:"ficheiro PEM com CAs adicionais (proxy corporativo com inspeção TLS)"`
+	InsecureSkipVerify bool   `env:"INSECURE_SKIP_VERIFY" help:"não verificar certificados TLS (inseguro; só para diagnóstico)"`
+
+	// Filters
+	Districts           string  `env:"DISTRICTS" help:"filtrar por distritos"`
+	Regioes             string  `env:"REGIOES" help:"filtrar por regiões"`
+	Subregioes          string  `env:"SUBREGIOES" help:"filtrar por sub-regiões"`
+	Freguesias          string  `env:"FREGUESIAS" help:"filtrar por freguesias"`
+	IncludeNatureza     string  `env:"INCLUDE_NATUREZA" help:"incluir naturezas (nome, substring)"`
+	IncludeNaturezaCode string  `env:"INCLUDE_NATUREZA_CODE" help:"incluir naturezaCode"`
+	ExcludeNaturezaCode string  `env:"EXCLUDE_NATUREZA_CODE" help:"excluir naturezaCode"`
+	IncludeStatus       string  `env:"INCLUDE_STATUS" help:"incluir estados (nome, substring)"`
+	ExcludeStatus       string  `env:"EXCLUDE_STATUS" help:"excluir estados (nome, substring)"`
+	ExcludeStatusCodes  string  `env:"EXCLUDE_STATUS_CODES" help:"excluir statusCode numéricos"`
+	CenterLat           float64 `env:"CENTER_LAT" help:"latitude do centro (graus decimais)"`
+	CenterLon           float64 `env:"CENTER_LON" help:"longitude do centro (graus decimais)"`
+	RadiusKm            float64 `env:"RADIUS_KM" parse:"radius" help:"raio em km à volta do centro (0 = desligado)"`
+	GeoBBox             string  `env:"GEO_BBOX" default:"36.8,-9.7,42.3,-6" help:"área plausível das ocorrências, latMin,lonMin,latMax,lonMax (off = sem verificação)"`
+	GazetteerFile       string  `env:"GAZETTEER_FILE" help:"lugares com coordenadas (GeoNames PT.txt ou nome;lat;lon) para \"Perto de\" sem localidade"`
+
+	// ntfy
+	NtfyURL                    string  `env:"NTFY_URL" default:"https://ntfy.sh" help:"servidor ntfy"`
+	NtfyURLs                   string  `env:"NTFY_URLS" secret:"true" help:"vários servidores ntfy (CSV, cada um url ou url|token); substitui NTFY_URL"`
+	NtfyTopic                  string  `env:"NTFY_TOPIC" default:"bombeiros-serta" help:"tópico ntfy"`
+	NtfyPriority               string  `env:"NTFY_PRIORITY" default:"5" help:"prioridade base (1-5)"`
+	NtfyTags                   string  `env:"NTFY_TAGS" default:"fire,rotating_light" help:"tags base (CSV)"`
+	NtfyDryRun                 bool    `env:"NTFY_DRYRUN" help:"não publicar; apenas registar"`
+	NtfySummaryThreshold       int     `env:"NTFY_SUMMARY_THRESHOLD" help:"agregar novos incidentes a partir de N por ciclo (0 = desligado)"`
+	NtfyStatusSummaryThreshold int     `env:"NTFY_STATUS_SUMMARY_THRESHOLD" help:"agrupar mudanças de estado quando há mais de N por ciclo (0 = desligado)"`
+	NotifyConcurrency          int     `env:"NOTIFY_CONCURRENCY" default:"3" help:"notificações enviadas em paralelo em segundo plano (0 = envio síncrono no ciclo)"`
+	NtfyRatePerMinute          int     `env:"NTFY_RATE_PER_MINUTE" help:"máximo de publicações no ntfy por minuto; o excesso fica em fila (0 = sem limite)"`
+	NtfyRateBurst              int     `env:"NTFY_RATE_BURST" default:"10" help:"publicações seguidas permitidas antes de aplicar NTFY_RATE_PER_MINUTE"`
+	NtfyBacklogCollapse        int     `env:"NTFY_BACKLOG_COLLAPSE" default:"20" help:"com mais de N notificações em fila, agrupá-las numa só (0 = nunca)"`
+	NtfyDedupSeconds           int     `env:"NTFY_DEDUP_SECONDS" default:"120" help:"não repetir a mesma mensagem de uma ocorrência dentro de N segundos (0 = desligado)"`
+	NtfyReplace                bool    `env:"NTFY_REPLACE" help:"as atualizações de uma ocorrência substituem a notificação anterior em vez de se acumularem (ntfy 2.14+)"`
+	QuietHours                 string  `env:"QUIET_HOURS" help:"horas de silêncio, ex.: 23-7"`
+	QuietDigest                bool    `env:"QUIET_DIGEST" help:"nas horas de silêncio, adiar as notificações de ocorrências para um resumo no fim"`
+	QuietDigestAlways          bool    `env:"QUIET_DIGEST_ALWAYS" help:"com QUIET_DIGEST, enviar \"Noite calma\" quando nada mudou"`
+	QuietExemptKm              float64 `env:"QUIET_EXEMPT_KM" help:"nas horas de silêncio, ocorrências a menos de N km do centro saem na mesma, com a prioridade normal e a tag warning (0 = desligado)"`
+	QuietExemptNoCoords        bool    `env:"QUIET_EXEMPT_NO_COORDS" help:"com QUIET_EXEMPT_KM, tratar as ocorrências sem coordenadas como próximas"`
+	NotifyOnlyStatus           string  `env:"NOTIFY_ONLY_STATUS" help:"só notificar ocorrências nestes estados (substring, CSV); o resto continua a ser acompanhado"`
+	NotifyOnlyWithinKm         float64 `env:"NOTIFY_ONLY_WITHIN_KM" help:"só notificar ocorrências a menos de N km do centro (0 = desligado)"`
+	NtfyTest                   bool    `env:"NTFY_TEST" help:"enviar notificação de teste no arranque"`
+	NtfyJSON                   bool    `env:"NTFY_JSON" help:"publicar em modo JSON"`
+	NtfyMarkdown               bool    `env:"NTFY_MARKDOWN" help:"ativar markdown"`
+	NtfyIconURL                string  `env:"NTFY_ICON_URL" help:"URL do ícone"`
+	NtfyEmail                  string  `env:"NTFY_EMAIL" help:"reencaminhar para email"`
+	NtfyEmailMinPriority       int     `env:"NTFY_EMAIL_MIN_PRIORITY" default:"5" help:"só reencaminhar para email mensagens com pelo menos esta prioridade (1-5)"`
+	NtfyEmailTypes             string  `env:"NTFY_EMAIL_TYPES" help:"só reencaminhar para email estes tipos (CSV, ex.: new,status; vazio = todos)"`
+	NtfyCache                  string  `env:"NTFY_CACHE" help:"cabeçalho Cache do ntfy (ex.: no)"`
+	NtfyFirebase               string  `env:"NTFY_FIREBASE" help:"cabeçalho Firebase do ntfy (ex.: no)"`
+	NtfyActions                bool    `env:"NTFY_ACTIONS" default:"true" help:"adicionar botões de ação"`
+	NtfyAttachArea             bool    `env:"NTFY_ATTACH_AREA" help:"anexar ficheiro KML da área"`
+	NtfyClickGeo               bool    `env:"NTFY_CLICK_GEO" help:"usar geo: em vez do Google Maps no clique"`
+	GotifyURL                  string  `env:"GOTIFY_URL" help:"servidor Gotify onde publicar também as notificações (vazio = desligado)"`
+	GotifyToken                string  `env:"GOTIFY_TOKEN" secret:"true" help:"token da aplicação no Gotify"`
+	GotifyOnly                 bool    `env:"GOTIFY_ONLY" help:"publicar só no Gotify, sem ntfy"`
+	SMTPHost                   string  `env:"SMTP_HOST" help:"servidor SMTP para enviar alguns eventos por email (vazio = desligado)"`
+	SMTPPort                   int     `env:"SMTP_PORT" default:"587" help:"porta do servidor SMTP"`
+	SMTPTLS                    string  `env:"SMTP_TLS" default:"starttls" help:"starttls, ssl (TLS direto, normalmente porta 465) ou none"`
+	SMTPUser                   string  `env:"SMTP_USER" help:"utilizador SMTP (vazio = sem autenticação)"`
+	SMTPPass                   string  `env:"SMTP_PASS" secret:"true" help:"palavra-passe SMTP"`
+	SMTPFrom                   string  `env:"SMTP_FROM" help:"remetente dos emails"`
+	SMTPTo                     string  `env:"SMTP_TO" help:"destinatários dos emails (CSV)"`
+	ChannelEventsNtfy          string  `env:"CHANNEL_EVENTS_NTFY" help:"só publicar no ntfy estes eventos (CSV, como EMAIL_EVENTS; vazio = todos)"`
+	ChannelEventsGotify        string  `env:"CHANNEL_EVENTS_GOTIFY" help:"só publicar no Gotify estes eventos (CSV, como EMAIL_EVENTS; vazio = todos)"`
+	EmailEvents                string  `env:"EMAIL_EVENTS" default:"daily_summary,weekly_summary,conclusion" help:"eventos enviados por email (CSV: daily_summary, weekly_summary, conclusion ou tipos de notificação)"`
+	ShareTemplate              string  `env:"SHARE_TEMPLATE" default:"{emoji} {natureza} — {local}, {status}, {meios} — {url}" help:"linha para partilhar no fim das mensagens de novo/estado (vazio = sem linha)"`
+	ShareURL                   string  `env:"SHARE_URL" default:"https://wa.me/?text={text}" help:"link do botão Partilhar, com {text} no lugar da linha (vazio = sem botão)"`
+	AnepcURL                   string  `env:"ANEPC_URL" help:"link para a ocorrência ANEPC, com {id} no lugar do número (vazio = sem botão)"`
+	MinMan                     int     `env:"MIN_MAN" help:"limiar de operacionais para tag/prioridade (0 = desligado)"`
+	MinTerrain                 int     `env:"MIN_TERRAIN" help:"limiar de meios terrestres (0 = desligado)"`
+	MinAerial                  int     `env:"MIN_AERIAL" help:"limiar de meios aéreos (0 = desligado)"`
+	MinAquatic                 int     `env:"MIN_AQUATIC" help:"limiar de meios aquáticos (0 = desligado)"`
+	NotifyMeansChanges         bool    `env:"NOTIFY_MEANS_CHANGES" default:"true" help:"notificar alterações de meios"`
+	NotifyExtraChanges         bool    `env:"NOTIFY_EXTRA_CHANGES" default:"true" help:"notificar alterações do campo extra"`
+	NotifyRoadClosures         bool    `env:"NOTIFY_ROAD_CLOSURES" default:"true" help:"notificar estradas cortadas/reabertas indicadas no extra"`
+	NotifyBurnedArea           bool    `env:"NOTIFY_BURNED_AREA" default:"true" help:"notificar a área ardida do ICNF quando aparece ou muda"`
+	BurnedAreaDeltaHa          float64 `env:"BURNED_AREA_DELTA_HA" default:"5" help:"variação da área ardida (ha) desde a última mensagem que volta a notificar"`
+	MoveThresholdKm            float64 `env:"MOVE_THRESHOLD_KM" default:"1" help:"deslocação do ponto (km) que atualiza a localização guardada (0 = desligado)"`
+	NotifyMoved                bool    `env:"NOTIFY_MOVED" help:"notificar (prioridade baixa) quando a localização muda mais do que MOVE_THRESHOLD_KM"`
+	SummaryHourly              bool    `env:"SUMMARY_HOURLY" default:"true" help:"sumário horário"`
+	SummaryDaily               bool    `env:"SUMMARY_DAILY" default:"true" help:"sumário diário (08:00)"`
+	SummaryTrendMin            int     `env:"SUMMARY_TREND_MIN" default:"3" help:"variação do total de ativos entre sumários que acrescenta a tag seta (0 = desligado)"`
+	SummaryWeekly              bool    `env:"SUMMARY_WEEKLY" help:"sumário semanal (ocorrências, conclusões, maior área, pico de ativos)"`
+	SummaryWeeklyAt            string  `env:"SUMMARY_WEEKLY_AT" default:"dom 20:00" help:"dia e hora do sumário semanal, ex.: dom 20:00 ou sun 20:00"`
+	PanicNotify                bool    `env:"PANIC_NOTIFY" help:"avisar por ntfy quando um ciclo entra em pânico"`
+	ReloadNotify               bool    `env:"RELOAD_NOTIFY" help:"confirmar por ntfy cada recarregamento da configuração"`
+	Lang                       string  `env:"BOMBEIROS_LANG" default:"pt" help:"idioma das notificações: pt ou en"`
+	TZ                         string  `env:"BOMBEIROS_TZ" default:"Europe/Lisbon" help:"fuso horário das horas nas notificações, horas de silêncio e sumários"`
+	TagsMap                    string  `env:"TAGS_MAP" help:"ficheiro JSON com as tags ntfy por evento (ex.: {\"terrain_threshold\": \"fire_engine\"})"`
+	OutputJSON                 bool    `env:"OUTPUT_JSON" help:"execução única: escrever o resultado do ciclo em JSON no stdout"`
+
+	// Detail
+	DetailFetch bool `env:"DETAIL_FETCH" help:"consultar o detalhe de cada ocorrência nova ou com mudança de estado"`
+	DetailTTL   int  `env:"DETAIL_TTL" default:"10" help:"minutos de cache do detalhe (0 = sem cache)"`
+
+	// KML
+	SaveKMLDir string `env:"SAVE_KML_DIR" help:"guardar KML e calcular área/perímetro"`
+
+	// Logging & metrics
+	LogLevel       string `env:"LOG_LEVEL" default:"info" help:"debug, info, warn ou error"`
+	LogFormat      string `env:"LOG_FORMAT" default:"text" help:"text ou json"`
+	Debug          bool   `env:"DEBUG" help:"atalho para LOG_LEVEL=debug"`
+	LogFile        string `env:"LOG_FILE" help:"gravar também o registo neste ficheiro (- = não; por omissão monitor.log junto ao executável se a consola estiver escondida no Windows)"`
+	LogFileMaxMB   int    `env:"LOG_FILE_MAX_MB" default:"10" help:"rodar LOG_FILE ao atingir N MB"`
+	LogFileKeep    int    `env:"LOG_FILE_KEEP" default:"5" help:"ficheiros anteriores guardados como .1, .2... (0 = nenhum)"`
+	MetricsDisable bool   `env:"METRICS_DISABLE" help:"desligar métricas e servidor HTTP"`
+	MetricsAddr    string `env:"METRICS_ADDR" default:":2112" help:"endereço do servidor de métricas"`
+	Dashboard      bool   `env:"DASHBOARD" help:"servir um mapa das ocorrências em / no servidor de métricas"`
+
+	// HTTP API
+	APICacheControl string `env:"API_CACHE_CONTROL" default:"no-cache" help:"cabeçalho Cache-Control de /api/ (vazio = não enviar)"`
+	APICORSOrigin   string `env:"API_CORS_ORIGIN" help:"Access-Control-Allow-Origin de /api/ (ex.: * ou https://painel.exemplo)"`
+	MetricsPerID    bool   `env:"BOMBEIROS_METRICS_PER_ID" help:"label id nas métricas por incidente"`
+	MetricsLabels   string `env:"METRICS_LABELS" default:"district,concelho,regiao,natureza,status" help:"labels de bombeiros_active_incidents (CSV de district, concelho, regiao, natureza, status; none = só o total)"`
+
+	// Mute
+	MuteToken     string        `env:"MUTE_TOKEN" secret:"true" help:"token para POST /api/incidents/{id}/mute e /unmute (vazio = desligado)"`
+	MuteTTL       time.Duration `env:"MUTE_TTL_HOURS" parse:"ttl" help:"duração do silêncio (horas ou duração, 0 = até reativar)"`
+	PublicBaseURL string        `env:"PUBLIC_BASE_URL" help:"URL pública do servidor HTTP, para a ação Silenciar no ntfy"`
+
+	// IPMA
+	IPMARisk     bool `env:"IPMA_RISK" help:"incluir o risco de incêndio rural do IPMA nas notificações e no sumário diário"`
+	IPMARiskBump int  `env:"IPMA_RISK_BUMP" help:"classe de risco IPMA (1-5) a partir da qual sobe a prioridade (0 = desligado)"`
+
+	// Weather
+	WeatherEnrich  bool    `env:"WEATHER_ENRICH" help:"acrescentar a meteorologia no local (Open-Meteo) a novas ocorrências e escaladas"`
+	WeatherWindKmh float64 `env:"WEATHER_WIND_KMH" default:"30" help:"vento (km/h) a partir do qual sobe a prioridade (0 = desligado)"`
+
+	// Grafana
+	GrafanaURL   string `env:"GRAFANA_URL" help:"URL do Grafana para anotações de início/fim de ocorrências"`
+	GrafanaToken string `env:"GRAFANA_TOKEN" secret:"true" help:"token de service account do Grafana"`
+
+	// CAP
+	CAP       bool   `env:"CAP" help:"servir alertas CAP 1.2 em /cap/{id}.xml"`
+	CAPDir    string `env:"CAP_DIR" help:"gravar também os alertas CAP nesta pasta"`
+	CAPSender string `env:"CAP_SENDER" default:"bombeiros-monitor" help:"campo sender dos alertas CAP"`
+
+	// HTTP auth
+	HTTPAuthToken    string `env:"HTTP_AUTH_TOKEN" secret:"true" help:"token exigido no servidor HTTP (Bearer ou ?token=)"`
+	HTTPBasicUser    string `env:"HTTP_BASIC_USER" help:"utilizador para autenticação básica no servidor HTTP"`
+	HTTPBasicPass    string `env:"HTTP_BASIC_PASS" secret:"true" help:"palavra-passe para autenticação básica"`
+	MetricsPublic    bool   `env:"METRICS_PUBLIC" help:"deixar /metrics sem autenticação (para o Prometheus)"`
+	MetricsBasicUser string `env:"METRICS_BASIC_USER" help:"utilizador para autenticação básica em /metrics"`
+	MetricsBasicPass string `env:"METRICS_BASIC_PASS" secret:"true" help:"palavra-passe para /metrics"`
+	MetricsTLSCert   string `env:"METRICS_TLS_CERT" help:"certificado PEM para servir o servidor HTTP em HTTPS"`
+	MetricsTLSKey    string `env:"METRICS_TLS_KEY" help:"chave privada PEM de METRICS_TLS_CERT"`
+
+	// Derived in finalize; not configuration knobs.
+	lang                string
+	loc                 *time.Location
+	tags                map[string]string
+	wantedSet           map[string][]string
+	wantedFlat          []string
+	quiet               quietWindow
+	weekly              weeklySchedule
+	districts           map[string]struct{}
+	regioes             map[string]struct{}
+	subregioes          map[string]struct{}
+	freguesias          map[string]struct{}
+	includeNatureza     map[string]struct{}
+	includeNaturezaCode map[string]struct{}
+	excludeNaturezaCode map[string]struct{}
+	includeStatus       map[string]struct{}
+	notifyOnlyStatus    map[string]struct{}
+	excludeStatus       map[string]struct{}
+	excludeStatusCodes  map[int]struct{}
+	emailTypes          map[string]struct{}
+	emailEvents         map[string]struct{}
+	channelEvents       map[string]map[string]struct{} // by channel; empty = everything
+	smtpTo              []string
+	ntfyServers         []ntfyServer
+	sources             []feedSource
+	geoBox              *geoBox
+	gazetteer           *gazetteer
+	activeLabels        []string
+	httpTransport       *http.Transport
+	httpClient          *http.Client
+	weatherClient       *http.Client
+	clock               Clock
+}
+
+var currentConfig atomic.Pointer[Config]
+
+// conf returns the active configuration (defaults if none was published yet).
+func conf() *Config {
+	if c := currentConfig.Load(); c != nil {
+		return c
+	}
+	c, err := newConfigLoader(flag.NewFlagSet("defaults", flag.ContinueOnError)).build(false)
+	if err != nil {
+		panic(err) // built-in defaults are always valid
+	}
+	currentConfig.CompareAndSwap(nil, c)
+	return currentConfig.Load()
+}
+
+// setConfig publishes cfg as the active configuration.
+func setConfig(cfg *Config) {
+	currentConfig.Store(cfg)
+}
+
+// configField describes one Config field and where its value comes from.
+type configField struct {
+	index  int
+	envs   []string
+	key    string // YAML key
+	flag   string
+	def    string
+	parse  string
+	secret bool
+	help   string
+	kind   reflect.Type
+}
+
+var configFields = func() []configField {
+	t := reflect.TypeOf(Config{})
+	var out []configField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		env := sf.Tag.Get("env")
+		if env == "" {
+			continue
+		}
+		envs := strings.Split(env, ",")
+		out = append(out, configField{
+			index:  i,
+			envs:   envs,
+			key:    strings.ToLower(envs[0]),
+			flag:   strings.ReplaceAll(strings.ToLower(envs[0]), "_", "-"),
+			def:    sf.Tag.Get("default"),
+			parse:  sf.Tag.Get("parse"),
+			secret: sf.Tag.Get("secret") == "true",
+			help:   sf.Tag.Get("help"),
+			kind:   sf.Type,
+		})
+	}
+	return out
+}()
+
+// configLoader registers one flag per Config field on a FlagSet and, after
+// the set is parsed, merges defaults, file, environment and flags.
+type configLoader struct {
+	fs         *flag.FlagSet
+	configPath *string
+	flags      map[string]*configFlag
+}
+
+// configFlag records a raw flag value; booleans may be given without a value.
+type configFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *configFlag) String() string     { return f.value }
+func (f *configFlag) Set(v string) error { f.value = v; return nil }
+func (f *configFlag) IsBoolFlag() bool   { return f.isBool }
+
+func newConfigLoader(fs *flag.FlagSet) *configLoader {
+	l := &configLoader{
+		fs:         fs,
+		configPath: fs.String("config", "", "ficheiro YAML de configuração (ou CONFIG_FILE)"),
+		flags:      map[string]*configFlag{},
+	}
+	for _, f := range configFields {
+		cf := &configFlag{isBool: f.kind.Kind() == reflect.Bool}
+		l.flags[f.flag] = cf
+		fs.Var(cf, f.flag, fmt.Sprintf("%s (%s)", f.help, f.envs[0]))
+	}
+	return l
+}
+
+// load builds the configuration from defaults, CONFIG_FILE, the environment and
+// the flags that were explicitly set.
+func (l *configLoader) load() (*Config, error) {
+	return l.build(true)
+}
+
+func (l *configLoader) build(external bool) (*Config, error) {
+	cfg := &Config{}
+	v := reflect.ValueOf(cfg).Elem()
+	for _, f := range configFields {
+		if f.def == "" {
+			continue
+		}
+		if err := setConfigField(v.Field(f.index), f, f.def); err != nil {
+			return nil, err
+		}
+	}
+	if external {
+		path := strings.TrimSpace(*l.configPath)
+		if path == "" {
+			path = getenv("CONFIG_FILE", "")
+		}
+		if path != "" {
+			if err := applyConfigFile(v, path); err != nil {
+				return nil, err
+			}
+		}
+		for _, f := range configFields {
+			for _, name := range f.envs {
+				if val := strings.TrimSpace(os.Getenv(name)); val != "" {
+					if err := setConfigField(v.Field(f.index), f, val); err != nil {
+						return nil, err
+					}
+					break
+				}
+			}
+		}
+		var flagErr error
+		l.fs.Visit(func(fl *flag.Flag) {
+			for _, f := range configFields {
+				if f.flag == fl.Name && flagErr == nil {
+					flagErr = setConfigField(v.Field(f.index), f, l.flags[f.flag].value)
+				}
+			}
+		})
+		if flagErr != nil {
+			return nil, flagErr
+		}
+	}
+	if err := cfg.finalize(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyConfigFile merges the YAML file at path. Unknown keys are rejected so
+// typos are caught at startup.
+func applyConfigFile(v reflect.Value, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("CONFIG_FILE: %w", err)
+	}
+	var raw map[string]any
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return fmt.Errorf("CONFIG_FILE %s: %w", path, err)
+	}
+	byKey := map[string]configField{}
+	for _, f := range configFields {
+		byKey[f.key] = f
+	}
+	for k, val := range raw {
+		f, ok := byKey[strings.ToLower(k)]
+		if !ok {
+			return fmt.Errorf("CONFIG_FILE %s: opção desconhecida %q", path, k)
+		}
+		if val == nil {
+			continue
+		}
+		var s string
+		switch t := val.(type) {
+		case []any:
+			parts := make([]string, 0, len(t))
+			for _, p := range t {
+				parts = append(parts, fmt.Sprint(p))
+			}
+			s = strings.Join(parts, ",")
+		default:
+			s = fmt.Sprint(t)
+		}
+		if err := setConfigField(v.Field(f.index), f, s); err != nil {
+			return fmt.Errorf("CONFIG_FILE %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// setConfigField parses s according to the field's type and parse tag.
+func setConfigField(v reflect.Value, f configField, s string) error {
+	s = strings.TrimSpace(s)
+	name := f.envs[0]
+	switch f.parse {
+	case "poll":
+		d, err := parsePollInterval(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case "ttl":
+		d, err := parseTTL(name, s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case "radius":
+		r, err := parseRadiusKm(s)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(r)
+		return nil
+	}
+	switch f.kind.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		v.SetBool(parseBoolish(s))
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("%s=%q: esperado número inteiro", name, s)
+		}
+		v.SetInt(int64(n))
+	case reflect.Int64: // time.Duration without a parse tag: Go duration syntax
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%s=%q: esperada duração (ex.: 30s, 5m)", name, s)
+		}
+		v.SetInt(int64(d))
+	case reflect.Float64:
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(x) || math.IsInf(x, 0) {
+			return fmt.Errorf("%s=%q: esperado número", name, s)
+		}
+		v.SetFloat(x)
+	case reflect.Slice:
+		v.Set(reflect.ValueOf(splitList(s)))
+	default:
+		return fmt.Errorf("%s: tipo não suportado %s", name, f.kind)
+	}
+	return nil
+}
+
+// parseBoolish treats 0/false/no/off as false and any other non-empty value as
+// true, matching the historical "set to enable" environment convention.
+func parseBoolish(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "0", "false", "no", "off", "n", "nao", "não":
+		return false
+	}
+	return true
+}
+
+// splitList splits a comma-separated list, or a semicolon-separated one when
+// it contains any ';' (so names with commas can be listed).
+func splitList(v string) []string {
+	sep := ","
+	if strings.Contains(v, ";") {
+		sep = ";"
+	}
+	parts := strings.Split(v, sep)
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// finalize validates cross-field settings and precomputes lookups used on hot paths.
+func (c *Config) finalize() error {
+	if len(c.Municipios) == 0 {
+		c.Municipios = slices.Clone(defaultMunicipios)
+	}
+	c.wantedSet, c.wantedFlat = makeWantedSet(c.Municipios)
+	c.lang = normLang(c.Lang)
+	loc, err := time.LoadLocation(c.TZ)
+	if err != nil {
+		return fmt.Errorf("BOMBEIROS_TZ=%q: fuso horário desconhecido (ex.: Europe/Lisbon, Atlantic/Azores, UTC)", c.TZ)
+	}
+	c.loc = loc
+	c.clock = systemClock{}
+	switch strings.ToLower(c.LogFormat) {
+	case "text", "json":
+	default:
+		return fmt.Errorf("LOG_FORMAT=%q: esperado text ou json", c.LogFormat)
+	}
+	switch strings.ToLower(c.LogLevel) {
+	case "", "debug", "info", "warn", "warning", "error":
+	default:
+		return fmt.Errorf("LOG_LEVEL=%q: esperado debug, info, warn ou error", c.LogLevel)
+	}
+	if c.LogFileMaxMB <= 0 || c.LogFileKeep < 0 {
+		return fmt.Errorf("LOG_FILE_MAX_MB tem de ser positivo e LOG_FILE_KEEP não pode ser negativo")
+	}
+	if err := validateSource("FEATURES_SOURCE", c.FeaturesSource); err != nil {
+		return err
+	}
+	if c.sources, err = parseSources(c.Sources, c.FeaturesSource); err != nil {
+		return err
+	}
+	if c.geoBox, err = parseGeoBox(c.GeoBBox); err != nil {
+		return err
+	}
+	if c.GazetteerFile != "" {
+		if c.gazetteer, err = loadGazetteer(c.GazetteerFile); err != nil {
+			return fmt.Errorf("GAZETTEER_FILE: %w", err)
+		}
+	}
+	if c.NotifyOnlyWithinKm > 0 && !c.hasCenter() {
+		return fmt.Errorf("NOTIFY_ONLY_WITHIN_KM precisa de CENTER_LAT e CENTER_LON")
+	}
+	if c.QuietExemptKm < 0 {
+		return fmt.Errorf("QUIET_EXEMPT_KM=%g: valor negativo", c.QuietExemptKm)
+	}
+	if c.QuietExemptKm > 0 && !c.hasCenter() {
+		return fmt.Errorf("QUIET_EXEMPT_KM precisa de CENTER_LAT e CENTER_LON")
+	}
+	c.tags, err = loadTagsMap(c.TagsMap)
+	if err != nil {
+		return err
+	}
+	if (c.HTTPBasicUser == "") != (c.HTTPBasicPass == "") {
+		return fmt.Errorf("HTTP_BASIC_USER e HTTP_BASIC_PASS têm de ser definidos em conjunto")
+	}
+	if (c.MetricsBasicUser == "") != (c.MetricsBasicPass == "") {
+		return fmt.Errorf("METRICS_BASIC_USER e METRICS_BASIC_PASS têm de ser definidos em conjunto")
+	}
+	if (c.MetricsTLSCert == "") != (c.MetricsTLSKey == "") {
+		return fmt.Errorf("METRICS_TLS_CERT e METRICS_TLS_KEY têm de ser definidos em conjunto")
+	}
+	if c.MetricsTLSCert != "" {
+		if _, err := tls.LoadX509KeyPair(c.MetricsTLSCert, c.MetricsTLSKey); err != nil {
+			return fmt.Errorf("METRICS_TLS_CERT/METRICS_TLS_KEY: %w", err)
+		}
+	}
+	switch c.StateBackend = strings.ToLower(strings.TrimSpace(c.StateBackend)); c.StateBackend {
+	case stateBackendFile:
+	case stateBackendRedis:
+		if _, err := redis.ParseURL(c.RedisURL); err != nil {
+			return fmt.Errorf("REDIS_URL: %v", err)
+		}
+		if strings.TrimSpace(c.RedisPrefix) == "" {
+			return fmt.Errorf("REDIS_PREFIX vazio")
+		}
+		if c.RedisLockTTLSeconds < 0 || (c.RedisLockTTLSeconds > 0 && time.Duration(c.RedisLockTTLSeconds)*time.Second <= c.PollInterval) {
+			return fmt.Errorf("REDIS_LOCK_TTL_SECONDS=%d: tem de ser maior do que POLL_SECONDS", c.RedisLockTTLSeconds)
+		}
+	default:
+		return fmt.Errorf("STATE_BACKEND=%q: esperado file ou redis", c.StateBackend)
+	}
+	if c.StateBackups < 0 {
+		return fmt.Errorf("STATE_BACKUPS=%d: valor negativo", c.StateBackups)
+	}
+	if c.StateFlushSeconds < 0 {
+		return fmt.Errorf("STATE_FLUSH_SECONDS=%d: valor negativo", c.StateFlushSeconds)
+	}
+	if c.NtfyDedupSeconds < 0 {
+		return fmt.Errorf("NTFY_DEDUP_SECONDS=%d: valor negativo", c.NtfyDedupSeconds)
+	}
+	if c.NtfyRatePerMinute < 0 || c.NtfyRateBurst < 0 || c.NtfyBacklogCollapse < 0 {
+		return fmt.Errorf("NTFY_RATE_PER_MINUTE, NTFY_RATE_BURST e NTFY_BACKLOG_COLLAPSE não podem ser negativos")
+	}
+	if c.APIMaxBodyMB < 1 {
+		return fmt.Errorf("API_MAX_BODY_MB=%d: tem de ser pelo menos 1", c.APIMaxBodyMB)
+	}
+	if c.SnapshotEvery < 0 || c.DebugDirMaxMB < 0 {
+		return fmt.Errorf("SNAPSHOT_EVERY e DEBUG_DIR_MAX_MB não podem ser negativos")
+	}
+	if c.BurnedAreaDeltaHa < 0 {
+		return fmt.Errorf("BURNED_AREA_DELTA_HA=%g: valor negativo", c.BurnedAreaDeltaHa)
+	}
+	if c.MoveThresholdKm < 0 {
+		return fmt.Errorf("MOVE_THRESHOLD_KM=%g: valor negativo", c.MoveThresholdKm)
+	}
+	if c.NotifyConcurrency < 0 {
+		return fmt.Errorf("NOTIFY_CONCURRENCY=%d: valor negativo (use 0 para envio síncrono)", c.NotifyConcurrency)
+	}
+	if c.weekly, err = parseWeeklySchedule(c.SummaryWeeklyAt); err != nil {
+		return err
+	}
+	c.quiet = parseQuietHours(c.QuietHours)
+	if strings.TrimSpace(c.QuietHours) != "" && !c.quiet.enabled {
+		slog.Warn("QUIET_HOURS inválido; ignorado", "value", c.QuietHours)
+	}
+	if c.QuietDigest && (!c.quiet.enabled || c.quiet.startH == c.quiet.endH) {
+		slog.Warn("QUIET_DIGEST precisa de QUIET_HOURS com início e fim distintos; ignorado")
+		c.QuietDigest = false
+	}
+	c.districts = parseStrSet(c.Districts)
+	c.regioes = parseStrSet(c.Regioes)
+	c.subregioes = parseStrSet(c.Subregioes)
+	c.freguesias = parseStrSet(c.Freguesias)
+	c.includeNatureza = parseStrSet(c.IncludeNatureza)
+	c.includeNaturezaCode = parseStrSet(c.IncludeNaturezaCode)
+	c.excludeNaturezaCode = parseStrSet(c.ExcludeNaturezaCode)
+	c.includeStatus = parseStrSet(c.IncludeStatus)
+	c.notifyOnlyStatus = parseStrSet(c.NotifyOnlyStatus)
+	c.excludeStatus = parseStrSet(c.ExcludeStatus)
+	c.excludeStatusCodes = parseIntSet(c.ExcludeStatusCodes)
+	if c.NtfyEmailMinPriority < 1 || c.NtfyEmailMinPriority > 5 {
+		return fmt.Errorf("NTFY_EMAIL_MIN_PRIORITY=%d: esperado 1 a 5", c.NtfyEmailMinPriority)
+	}
+	if c.ntfyServers, err = parseNtfyURLs(c.NtfyURLs); err != nil {
+		return err
+	}
+	if c.GotifyURL != "" {
+		if u, err := url.Parse(c.GotifyURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("GOTIFY_URL=%q: URL inválido", c.GotifyURL)
+		}
+		if c.GotifyToken == "" {
+			return fmt.Errorf("GOTIFY_URL precisa de GOTIFY_TOKEN")
+		}
+	} else if c.GotifyOnly {
+		return fmt.Errorf("GOTIFY_ONLY precisa de GOTIFY_URL")
+	}
+	c.smtpTo = splitList(c.SMTPTo)
+	c.emailEvents = parseStrSet(c.EmailEvents)
+	if c.SMTPHost != "" {
+		switch c.SMTPTLS = strings.ToLower(strings.TrimSpace(c.SMTPTLS)); c.SMTPTLS {
+		case smtpStartTLS, smtpSSL, smtpPlain:
+		default:
+			return fmt.Errorf("SMTP_TLS=%q: esperado starttls, ssl ou none", c.SMTPTLS)
+		}
+		if c.SMTPPort < 1 || c.SMTPPort > 65535 {
+			return fmt.Errorf("SMTP_PORT=%d: porta inválida", c.SMTPPort)
+		}
+		if c.SMTPFrom == "" || len(c.smtpTo) == 0 {
+			return fmt.Errorf("SMTP_HOST precisa de SMTP_FROM e SMTP_TO")
+		}
+		if err := checkEventNames("EMAIL_EVENTS", c.emailEvents); err != nil {
+			return err
+		}
+	}
+	c.channelEvents = map[string]map[string]struct{}{
+		channelNtfy:   parseStrSet(c.ChannelEventsNtfy),
+		channelGotify: parseStrSet(c.ChannelEventsGotify),
+	}
+	if err := checkEventNames("CHANNEL_EVENTS_NTFY", c.channelEvents[channelNtfy]); err != nil {
+		return err
+	}
+	if err := checkEventNames("CHANNEL_EVENTS_GOTIFY", c.channelEvents[channelGotify]); err != nil {
+		return err
+	}
+	if c.activeLabels, err = parseActiveLabels(c.MetricsLabels); err != nil {
+		return err
+	}
+	c.emailTypes = parseStrSet(c.NtfyEmailTypes)
+	for t := range c.emailTypes {
+		if !slices.Contains(notificationTypes, t) {
+			return fmt.Errorf("NTFY_EMAIL_TYPES: tipo desconhecido %q (tipos: %s)", t, strings.Join(notificationTypes, ", "))
+		}
+	}
+	if c.FeedCacheMaxHours < 0 {
+		return fmt.Errorf("FEED_CACHE_MAX_HOURS=%d: não pode ser negativo", c.FeedCacheMaxHours)
+	}
+	if c.HTTPTimeoutSeconds < 1 {
+		return fmt.Errorf("HTTP_TIMEOUT_SECONDS=%d: tem de ser pelo menos 1", c.HTTPTimeoutSeconds)
+	}
+	return c.setupHTTPClients()
+}
+
+// statePath returns STATE_FILE, relative paths resolved against the working directory.
+func (c *Config) statePath() string {
+	if filepath.IsAbs(c.StateFile) {
+		return c.StateFile
+	}
+	return filepath.Join(".", c.StateFile)
+}
+
+// hasCenter reports whether CENTER_LAT/CENTER_LON were configured.
+func (c *Config) hasCenter() bool {
+	return c.CenterLat != 0
+}
+
+// print writes the effective configuration as YAML (loadable as CONFIG_FILE),
+// with secrets redacted.
+func (c *Config) print(w io.Writer) error {
+	v := reflect.ValueOf(c).Elem()
+	fmt.Fprintln(w, "# configuração efetiva (segredos ocultados)")
+	for _, f := range configFields {
+		fv := v.Field(f.index)
+		var out any
+		switch {
+		case f.secret:
+			out = ""
+			if fv.String() != "" {
+				out = "***"
+			}
+		case f.kind == reflect.TypeOf(time.Duration(0)):
+			d := time.Duration(fv.Int())
+			if d == 0 {
+				out = 0
+			} else {
+				out = d.String()
+			}
+		default:
+			out = fv.Interface()
+		}
+		b, err := yaml.Marshal(map[string]any{f.key: out})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parsePollInterval parses POLL_SECONDS: a plain integer is seconds (legacy
+// form), otherwise a Go duration such as "45s" or "2m". "0" is the documented
+// single-shot value; any other zero or negative value is rejected.
+func parsePollInterval(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 30 * time.Second, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("POLL_SECONDS=%q: valor negativo (use 0 para execução única)", s)
+		}
+		return time.Duration(n) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("POLL_SECONDS=%q: esperado número de segundos ou duração (ex.: 45s, 2m)", s)
+	}
+	if d < time.Second {
+		return 0, fmt.Errorf("POLL_SECONDS=%q: intervalo tem de ser pelo menos 1s (use 0 para execução única)", s)
+	}
+	return d, nil
+}
+
+// parseTTL parses the hours-or-duration fields (STATE_TTL_HOURS,
+// MUTE_TTL_HOURS): a plain number is hours (fractions allowed), otherwise a
+// Go duration such as "72h" or "90m". Zero disables. name is the variable
+// reported in errors.
+func parseTTL(name, s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if h, err := strconv.ParseFloat(s, 64); err == nil {
+		if h < 0 || math.IsNaN(h) || math.IsInf(h, 0) {
+			return 0, fmt.Errorf("%s=%q: valor inválido", name, s)
+		}
+		return time.Duration(h * float64(time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s=%q: esperado número de horas ou duração (ex.: 72h)", name, s)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s=%q: valor negativo", name, s)
+	}
+	return d, nil
+}
+
+// parseRadiusKm parses RADIUS_KM as a non-negative number of kilometres,
+// optionally suffixed with "km". Zero disables the radius filter.
+func parseRadiusKm(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.ToLower(s), "km")), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("RADIUS_KM=%q: esperado número de quilómetros (ex.: 25)", s)
+	}
+	if v < 0 {
+		return 0, fmt.Errorf("RADIUS_KM=%q: valor negativo", s)
+	}
+	return v, nil
+}
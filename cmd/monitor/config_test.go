@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTTL(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"":    0,
+		"0":   0,
+		"72":  72 * time.Hour,
+		"1.5": 90 * time.Minute,
+		"90m": 90 * time.Minute,
+		"72h": 72 * time.Hour,
+	} {
+		got, err := parseTTL("STATE_TTL_HOURS", in)
+		if err != nil || got != want {
+			t.Errorf("parseTTL(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+}
+
+func TestTTLErrorNamesTheVariable(t *testing.T) {
+	for _, name := range []string{"STATE_TTL_HOURS", "MUTE_TTL_HOURS"} {
+		for _, bad := range []string{"-1", "dois dias", "-3h"} {
+			t.Run(name+"="+bad, func(t *testing.T) {
+				base := map[string]string{"STATE_TTL_HOURS": "", "MUTE_TTL_HOURS": ""}
+				base[name] = bad
+				testConfig(t, nil)
+				for k, v := range base {
+					t.Setenv(k, v)
+				}
+				_, err := newConfigLoader(flag.NewFlagSet("test", flag.ContinueOnError)).build(true)
+				if err == nil {
+					t.Fatal("no error")
+				}
+				if !strings.HasPrefix(err.Error(), name+"=") {
+					t.Errorf("error %q does not name %s", err, name)
+				}
+			})
+		}
+	}
+}
@@ -5,3 +5,6 @@ package main
 
 // hideConsoleWindow is a no-op on non-Windows platforms.
 func hideConsoleWindow() {}
+
+// alertBox is a no-op on non-Windows platforms; the error is in the log.
+func alertBox(title, text string) {}
@@ -2,7 +2,10 @@
 
 package main
 
-import "syscall"
+import (
+	"syscall"
+	"unsafe"
+)
 
 // hideConsoleWindow detaches from the console and hides any visible console window.
 func hideConsoleWindow() {
@@ -22,3 +25,14 @@ func hideConsoleWindow() {
 		showWindow.Call(hwnd, uintptr(SW_HIDE))
 	}
 }
+
+// alertBox shows a message box; the tray has no console to explain why the
+// program closed.
+func alertBox(title, text string) {
+	user32 := syscall.NewLazyDLL("user32.dll")
+	messageBox := user32.NewProc("MessageBoxW")
+	t, _ := syscall.UTF16PtrFromString(title)
+	m, _ := syscall.UTF16PtrFromString(text)
+	const MB_ICONWARNING = 0x30
+	messageBox.Call(0, uintptr(unsafe.Pointer(m)), uintptr(unsafe.Pointer(t)), MB_ICONWARNING)
+}
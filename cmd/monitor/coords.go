@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// latLonKeys are the key pairs tried for a point given as an object, in
+// order.
+var latLonKeys = [][2]string{{"lat", "lng"}, {"latitude", "longitude"}, {"lat", "lon"}}
+
+// nestedPointKeys are the properties some records put the point under, as
+// an object ({"lat": .., "lng": ..} or a GeoJSON Point), a [lon, lat] array
+// or a "lat,lon" string.
+var nestedPointKeys = []string{"location", "point", "position", "coords", "coordinates", "geo"}
+
+// validLatLon rejects points outside the valid ranges and the 0,0 that some
+// records use for "unknown".
+func validLatLon(lat, lon float64) bool {
+	if math.IsNaN(lat) || math.IsNaN(lon) || (lat == 0 && lon == 0) {
+		return false
+	}
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// coordsFromProps finds a point among the properties of a plain record: the
+// top-level pairs of latLonKeys first, then nestedPointKeys. Values may be
+// numbers or numeric strings.
+func coordsFromProps(p map[string]any) (lat, lon float64, ok bool) {
+	if lat, lon, ok := latLonFromMap(p); ok {
+		return lat, lon, true
+	}
+	for _, k := range nestedPointKeys {
+		if lat, lon, ok := pointFrom(p[k]); ok {
+			return lat, lon, true
+		}
+	}
+	return 0, 0, false
+}
+
+func latLonFromMap(m map[string]any) (lat, lon float64, ok bool) {
+	for _, k := range latLonKeys {
+		la, okLat := toFloat(m[k[0]])
+		lo, okLon := toFloat(m[k[1]])
+		if okLat && okLon && validLatLon(la, lo) {
+			return la, lo, true
+		}
+	}
+	return 0, 0, false
+}
+
+func pointFrom(v any) (lat, lon float64, ok bool) {
+	switch t := v.(type) {
+	case map[string]any:
+		if lat, lon, ok := latLonFromMap(t); ok {
+			return lat, lon, true
+		}
+		return getCoords(t)
+	case []any:
+		return lonLatPair(t)
+	case string:
+		// Written by hand, so lat first: "39.8,-8.1".
+		a, b, found := strings.Cut(t, ",")
+		la, okLat := toFloat(a)
+		lo, okLon := toFloat(b)
+		if found && okLat && okLon && validLatLon(la, lo) {
+			return la, lo, true
+		}
+	}
+	return 0, 0, false
+}
+
+// lonLatPair reads a GeoJSON-ordered [lon, lat] array.
+func lonLatPair(coords []any) (lat, lon float64, ok bool) {
+	if len(coords) < 2 {
+		return 0, 0, false
+	}
+	lo, okLon := toFloat(coords[0])
+	la, okLat := toFloat(coords[1])
+	if !okLon || !okLat || !validLatLon(la, lo) {
+		return 0, 0, false
+	}
+	return la, lo, true
+}
+
+// pointGeometry is a GeoJSON Point for lat/lon.
+func pointGeometry(lat, lon float64) map[string]any {
+	return map[string]any{"type": "Point", "coordinates": []any{lon, lat}}
+}
+
+// normalizeGeometry gives features without a usable geometry one built from
+// coordinates found in their properties, so map links and the radius filter
+// work for them too.
+func normalizeGeometry(features []Feature) {
+	for i := range features {
+		f := &features[i]
+		if _, _, ok := getCoords(f.Geometry); ok {
+			continue
+		}
+		if lat, lon, ok := coordsFromProps(f.Properties); ok {
+			f.Geometry = pointGeometry(lat, lon)
+		}
+	}
+}
+
+// geoBox is GEO_BBOX, the area incidents are expected in.
+type geoBox struct {
+	minLat, minLon, maxLat, maxLon float64
+}
+
+func (b *geoBox) contains(lat, lon float64) bool {
+	return lat >= b.minLat && lat <= b.maxLat && lon >= b.minLon && lon <= b.maxLon
+}
+
+// parseGeoBox reads "latMin,lonMin,latMax,lonMax". "off" (or "0", "none")
+// turns the check off and returns nil.
+func parseGeoBox(s string) (*geoBox, error) {
+	s = strings.TrimSpace(s)
+	switch strings.ToLower(s) {
+	case "", "off", "0", "none":
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("GEO_BBOX=%q: esperado latMin,lonMin,latMax,lonMax", s)
+	}
+	var v [4]float64
+	for i, p := range parts {
+		x, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("GEO_BBOX=%q: %q não é um número", s, strings.TrimSpace(p))
+		}
+		v[i] = x
+	}
+	b := &geoBox{minLat: v[0], minLon: v[1], maxLat: v[2], maxLon: v[3]}
+	if b.minLat >= b.maxLat || b.minLon >= b.maxLon || b.minLat < -90 || b.maxLat > 90 || b.minLon < -180 || b.maxLon > 180 {
+		return nil, fmt.Errorf("GEO_BBOX=%q: caixa inválida (latMin < latMax em -90..90, lonMin < lonMax em -180..180)", s)
+	}
+	return b, nil
+}
+
+// checkGeometry compares each point with GEO_BBOX. A point outside it whose
+// swapped pair falls inside had latitude and longitude swapped at the source:
+// it is fixed and the feature gets "coordsSwapped", which adds a note to its
+// messages. A point implausible both ways is dropped, so the incident is
+// handled as one without coordinates.
+func checkGeometry(cfg *Config, features []Feature) {
+	box := cfg.geoBox
+	if box == nil {
+		return
+	}
+	for i := range features {
+		f := &features[i]
+		lat, lon, ok := getCoords(f.Geometry)
+		if !ok || box.contains(lat, lon) {
+			continue
+		}
+		id := getID(f.Properties)
+		if box.contains(lon, lat) {
+			f.Geometry = pointGeometry(lon, lat)
+			if f.Properties == nil {
+				f.Properties = map[string]any{}
+			}
+			f.Properties["coordsSwapped"] = true
+			geometryFixes.WithLabelValues("swapped").Inc()
+			slog.Debug("coordenadas trocadas corrigidas", "id", id, "lat", lon, "lon", lat)
+			continue
+		}
+		f.Geometry = nil
+		geometryFixes.WithLabelValues("dropped").Inc()
+		slog.Debug("coordenadas fora de GEO_BBOX ignoradas", "id", id, "lat", lat, "lon", lon)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestCoordShapes decodes one plain record per shape the coordinates come in
+// and checks the point its geometry ends up with.
+func TestCoordShapes(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		fields string // coordinate fields of the record
+		ok     bool
+	}{
+		{"lat lng", `"lat":39.8,"lng":-8.1`, true},
+		{"latitude longitude", `"latitude":39.8,"longitude":-8.1`, true},
+		{"lat lon", `"lat":39.8,"lon":-8.1`, true},
+		{"strings", `"lat":"39.8","lng":" -8.1 "`, true},
+		{"location object", `"location":{"lat":39.8,"lng":-8.1}`, true},
+		{"location strings", `"location":{"lat":"39.8","lon":"-8.1"}`, true},
+		{"location GeoJSON", `"location":{"type":"Point","coordinates":[-8.1,39.8]}`, true},
+		{"point array", `"point":[-8.1,39.8]`, true},
+		{"point string array", `"point":["-8.1","39.8"]`, true},
+		{"coordinates string", `"coordinates":"39.8,-8.1"`, true},
+		{"geo object", `"geo":{"latitude":39.8,"longitude":-8.1}`, true},
+		// a broken top-level pair does not hide a good nested one
+		{"bad top level", `"lat":"n/d","lng":"n/d","location":{"lat":39.8,"lng":-8.1}`, true},
+		{"out of range", `"lat":139.8,"lng":-8.1`, false},
+		{"lon out of range", `"location":{"lat":39.8,"lng":-188.1}`, false},
+		{"zero", `"lat":0,"lng":0`, false},
+		{"short array", `"point":[-8.1]`, false},
+		{"none", `"morada":"Sertã"`, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"success":true,"data":[{"id":"2025050001","concelho":"Sertã","status":"Em Curso",%s}]}`, c.fields)
+			features, err := toFeatures([]byte(body))
+			if err != nil || len(features) != 1 {
+				t.Fatalf("toFeatures: %d features, %v", len(features), err)
+			}
+			lat, lon, ok := getCoords(features[0].Geometry)
+			if ok != c.ok || ok && (lat != 39.8 || lon != -8.1) {
+				t.Errorf("getCoords = %v, %v, %v; want ok=%v", lat, lon, ok, c.ok)
+			}
+		})
+	}
+}
+
+// TestSwappedCoords: a pair that is valid either way round can only be told
+// apart with GEO_BBOX. Swapped, Sertã lands in the Indian Ocean off
+// Tanzania.
+func TestSwappedCoords(t *testing.T) {
+	cfg, srv, _, ms := newTestMonitor(t, map[string]string{"RADIUS_KM": "30"})
+	swapped := incident("2025050001", "Em Curso", 20)
+	swapped["lat"], swapped["lng"] = -8.1, 39.8
+	// implausible both ways: dropped, so the incident has no point at all
+	garbage := incident("2025050002", "Em Curso", 20)
+	garbage["lat"], garbage["lng"] = -33.9, 18.4
+	srv.setFeed(swapped, garbage)
+
+	features, err := toFeatures(srv.feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGeometry(cfg, features)
+	if lat, lon, ok := getCoords(features[0].Geometry); !ok || lat != 39.8 || lon != -8.1 || features[0].Properties["coordsSwapped"] != true {
+		t.Errorf("swapped pair: %v, %v, %v, %v", lat, lon, ok, features[0].Properties["coordsSwapped"])
+	}
+	if _, _, ok := getCoords(features[1].Geometry); ok {
+		t.Errorf("garbage kept: %v", features[1].Geometry)
+	}
+
+	// the fixed incident is within RADIUS_KM and its message says it was fixed
+	mustRun(t, cfg, ms)
+	for _, m := range srv.take() {
+		if m.Title == "Novo em Sertã — Mato (14-08 16:20)" && strings.Contains(m.Message, "ID: 2025050001") {
+			if !strings.Contains(m.Message, tr("coords.swapped")) || !strings.Contains(m.Click, "39.8") {
+				t.Errorf("message for the swapped pair:\n%s\nclick %s", m.Message, m.Click)
+			}
+			return
+		}
+	}
+	t.Error("no message for the swapped pair")
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	_ "embed"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+//go:embed assets/dashboard.html
+var dashboardHTML string
+
+var dashboardTmpl = template.Must(template.New("dashboard").Parse(dashboardHTML))
+
+// dashboardHandler serves the embedded map page; it refreshes from
+// /api/incidents once per poll interval.
+func dashboardHandler(poll time.Duration) http.Handler {
+	if poll <= 0 {
+		poll = 30 * time.Second
+	}
+	data := struct{ PollMillis int64 }{poll.Milliseconds()}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		if err := dashboardTmpl.Execute(w, data); err != nil {
+			slog.Error("dashboard", "err", err)
+		}
+	})
+}
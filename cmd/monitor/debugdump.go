@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// Responses that failed to parse are saved as invalid-<UTC time>.json, so
+// replay, which reads fogos-*.json, skips them.
+const invalidSnapshotPrefix = "invalid-"
+
+// debugBodyPreview is how much of a bad response goes into the debug log.
+const debugBodyPreview = 300
+
+// pollCount numbers the HTTP fetches for SNAPSHOT_EVERY.
+var pollCount atomic.Int64
+
+// checkResponse parses an HTTP response body and keeps copies in DEBUG_DIR:
+// every SNAPSHOT_EVERY-th poll, and any body that fails to parse when
+// SNAPSHOT_ON_ERROR is set. A parse error names the saved file.
+func checkResponse(cfg *Config, body []byte, now time.Time) ([]Feature, error) {
+	feats, err := toFeatures(body)
+	if n := cfg.SnapshotEvery; n > 0 && pollCount.Add(1)%int64(n) == 0 && err == nil {
+		if _, werr := saveDebugBody(cfg, snapshotPrefix, body, now); werr != nil {
+			slog.Warn("erro a gravar snapshot", "dir", cfg.DebugDir, "err", werr)
+		}
+	}
+	if err == nil {
+		return feats, nil
+	}
+	slog.Debug("resposta da API inválida", "bytes", len(body), "body", previewBody(body, debugBodyPreview))
+	if !cfg.SnapshotOnError {
+		return nil, err
+	}
+	path, werr := saveDebugBody(cfg, invalidSnapshotPrefix, body, now)
+	if werr != nil {
+		slog.Warn("erro a gravar resposta inválida", "dir", cfg.DebugDir, "err", werr)
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w (resposta gravada em %s)", err, path)
+}
+
+// saveDebugBody writes body to DEBUG_DIR as <prefix><UTC time>.json and then
+// trims the directory to DEBUG_DIR_MAX_MB.
+func saveDebugBody(cfg *Config, prefix string, body []byte, at time.Time) (string, error) {
+	dir := cfg.DebugDir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, prefix+at.UTC().Format(snapshotTimeLayout)+".json")
+	if err := os.WriteFile(path, body, 0644); err != nil {
+		return "", err
+	}
+	pruneDebugDir(dir, int64(cfg.DebugDirMaxMB)<<20)
+	return path, nil
+}
+
+// pruneDebugDir deletes the oldest saved responses until the directory's
+// .json files fit in limit bytes (0 = no limit). The newest file is kept
+// whatever its size.
+func pruneDebugDir(dir string, limit int64) {
+	if limit <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	type file struct {
+		path string
+		size int64
+		mod  time.Time
+	}
+	var files []file
+	var total int64
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, file{filepath.Join(dir, e.Name()), info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].mod.Before(files[j].mod) })
+	for i := 0; total > limit && i < len(files)-1; i++ {
+		if err := os.Remove(files[i].path); err != nil {
+			slog.Warn("erro a apagar resposta antiga", "file", files[i].path, "err", err)
+			continue
+		}
+		total -= files[i].size
+	}
+}
+
+// previewBody is the first n bytes of body, cut on a rune boundary.
+func previewBody(body []byte, n int) string {
+	if len(body) <= n {
+		return string(body)
+	}
+	for n > 0 && !utf8.RuneStart(body[n]) {
+		n--
+	}
+	return string(body[:n]) + "…"
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// notifyDedupState remembers the incident messages posted in the last
+// NTFY_DEDUP_SECONDS, so a feed that briefly reverts a status and applies it
+// again does not send the same message twice. Only messages tied to an
+// incident are checked; summaries and alerts always go out.
+type notifyDedupState struct {
+	mu   sync.Mutex
+	sent map[uint64]time.Time // dedupKey -> when
+}
+
+var notifyDedup = &notifyDedupState{sent: map[uint64]time.Time{}}
+
+// dedupKey hashes what makes two messages the same: topic, type, incident
+// and title, and the status, means and extra of the incidents. The body is
+// left out, since its "há 5 min" and share lines change on every poll.
+func dedupKey(topic string, n Notification) uint64 {
+	h := fnv.New64a()
+	parts := []string{topic, n.Type, n.IncidentID, n.Title}
+	for _, f := range n.Incidents {
+		p := f.Properties
+		parts = append(parts, getPropStr(p, "status"), fmt.Sprint(meansFromProps(p)), getPropStr(p, "extra"))
+	}
+	for _, s := range parts {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// duplicate reports whether the same message went to topic within window.
+func (d *notifyDedupState) duplicate(topic string, n Notification, window time.Duration, now time.Time) bool {
+	if window <= 0 || n.IncidentID == "" {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for k, at := range d.sent {
+		if now.Sub(at) >= window {
+			delete(d.sent, k)
+		}
+	}
+	_, ok := d.sent[dedupKey(topic, n)]
+	return ok
+}
+
+// record marks n as sent to topic at now. It is called once the message
+// went out, so one held back by a pause, a mute or dry-run does not stop
+// the same message later.
+func (d *notifyDedupState) record(topic string, n Notification, now time.Time) {
+	if n.IncidentID == "" {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sent[dedupKey(topic, n)] = now
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestNotifyDedup: a status the feed reverts and applies again a few
+// minutes later is sent once, while a message held back by a pause does not
+// count as sent.
+func TestNotifyDedup(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		paused bool // during the second poll
+		want   [][]string
+	}{
+		{"reapplied", false, [][]string{
+			{"Em Curso → Em Resolução — Sertã — Mato"},
+			{"Em Resolução → Em Curso — Sertã — Mato"},
+			nil,
+		}},
+		{"first one paused", true, [][]string{
+			nil,
+			{"Em Resolução → Em Curso — Sertã — Mato"},
+			{"Em Curso → Em Resolução — Sertã — Mato"},
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			notifyDedup = &notifyDedupState{sent: map[uint64]time.Time{}}
+			t.Cleanup(func() { notifyDedup = &notifyDedupState{sent: map[uint64]time.Time{}} })
+			cfg, srv, clk, ms := newTestMonitor(t, map[string]string{"NTFY_DEDUP_SECONDS": "900"})
+			srv.setFeed(incident("2025050001", "Em Curso", 20))
+			mustRun(t, cfg, ms)
+			srv.take()
+			for i, status := range []string{"Em Resolução", "Em Curso", "Em Resolução"} {
+				clk.advance(4 * time.Minute)
+				if c.paused && i == 0 {
+					notifyPause.pause(0)
+				}
+				srv.setFeed(incident("2025050001", status, 20))
+				mustRun(t, cfg, ms)
+				notifyPause.resume()
+				if got := titles(srv.take()); !slices.Equal(got, c.want[i]) {
+					t.Errorf("poll %d: %q, want %q", i+2, got, c.want[i])
+				}
+			}
+
+			// after NTFY_DEDUP_SECONDS it goes out again
+			for _, status := range []string{"Em Curso", "Em Resolução"} {
+				clk.advance(15 * time.Minute)
+				srv.setFeed(incident("2025050001", status, 20))
+				mustRun(t, cfg, ms)
+			}
+			if got := titles(srv.take()); !slices.Contains(got, "Em Curso → Em Resolução — Sertã — Mato") {
+				t.Errorf("after the window: %q", got)
+			}
+		})
+	}
+}
+
+// TestNotifyDedupKey: the same title with other means is another message.
+func TestNotifyDedupKey(t *testing.T) {
+	n := func(man int) Notification {
+		return Notification{Type: notifyMeans, IncidentID: "2025050001", Title: "Atualização de meios — Sertã",
+			Incidents: []Feature{{Properties: incident("2025050001", "Em Curso", man)}}}
+	}
+	if dedupKey("teste", n(20)) == dedupKey("teste", n(40)) {
+		t.Error("other means, same key")
+	}
+	a, b := n(20), n(20)
+	a.Body, b.Body = "Início: há 5 min", "Início: há 9 min"
+	if dedupKey("teste", a) != dedupKey("teste", b) {
+		t.Error("the body changed the key")
+	}
+	if dedupKey("teste", a) == dedupKey("outro", a) {
+		t.Error("other topic, same key")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// fogosDetailURL is the per-incident endpoint; it carries fields the active
+// list leaves out (full extra text, fireRisk, status history).
+const fogosDetailURL = "https://api-dev.fogos.pt/fires?id="
+
+type detailEntry struct {
+	props map[string]any
+	at    time.Time
+}
+
+// detailCache is owned by the poll goroutine.
+var detailCache = map[string]detailEntry{}
+
+// mergeDetail adds the detail fields for id to p (DETAIL_FETCH). Fields the
+// list already has are kept, except a longer extra text. Errors are logged
+// and the notification goes out with what the list had.
+func mergeDetail(cfg *Config, p map[string]any, id string, now time.Time) {
+	if id == "" {
+		return
+	}
+	ttl := time.Duration(cfg.DetailTTL) * time.Minute
+	for k, e := range detailCache {
+		if now.Sub(e.at) > ttl {
+			delete(detailCache, k)
+		}
+	}
+	e, ok := detailCache[id]
+	if !ok {
+		d, err := fetchDetail(cfg, id)
+		if err != nil {
+			slog.Warn("detalhe da ocorrência indisponível", "incident_id", id, "err", err)
+			return
+		}
+		e = detailEntry{props: d, at: now}
+		if ttl > 0 {
+			detailCache[id] = e
+		}
+	}
+	for k, v := range e.props {
+		cur, has := p[k]
+		switch {
+		case !has || cur == nil || cur == "":
+			p[k] = v
+		case k == "extra":
+			if s, ok := v.(string); ok && len(strings.TrimSpace(s)) > len(strings.TrimSpace(getPropStr(p, "extra"))) {
+				p[k] = s
+			}
+		}
+	}
+}
+
+func fetchDetail(cfg *Config, id string) (map[string]any, error) {
+	resp, err := doGet(cfg, fogosDetailURL+url.QueryEscape(id))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := readAPIBody(resp, 4<<20)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Success bool           `json:"success"`
+		Data    map[string]any `json:"data"`
+	}
+	if err := decodeJSON(body, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Data == nil {
+		return nil, fmt.Errorf("resposta sem data")
+	}
+	if props, ok := doc.Data["properties"].(map[string]any); ok {
+		return props, nil
+	}
+	return doc.Data, nil
+}
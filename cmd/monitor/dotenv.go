@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// A .env file lets a Windows install keep its settings next to the
+// executable instead of in system environment variables. It is read once,
+// before any configuration: ENV_FILE if set, else .env in the working
+// directory, else .env next to the executable. Variables already in the real
+// environment win. Changes need a restart; a reload does not re-read it.
+
+// dotEnv remembers what loadDotEnv did, to be logged once logging is set up.
+var dotEnv struct {
+	path     string   // file loaded, "" if none
+	applied  int      // variables taken from it
+	problems []string // unreadable file or bad lines
+}
+
+// loadDotEnv sets the variables from the .env file that are not already set.
+func loadDotEnv() {
+	path, explicit := strings.TrimSpace(os.Getenv("ENV_FILE")), true
+	if path == "" {
+		explicit = false
+		path = dotEnvCandidate()
+		if path == "" {
+			return
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if explicit || !os.IsNotExist(err) {
+			dotEnv.problems = append(dotEnv.problems, err.Error())
+		}
+		return
+	}
+	defer f.Close()
+	dotEnv.path = path
+	vars, problems := parseDotEnv(f)
+	for _, p := range problems {
+		dotEnv.problems = append(dotEnv.problems, fmt.Sprintf("%s:%s", path, p))
+	}
+	for _, kv := range vars {
+		if _, set := os.LookupEnv(kv[0]); set {
+			continue
+		}
+		if err := os.Setenv(kv[0], kv[1]); err == nil {
+			dotEnv.applied++
+		}
+	}
+}
+
+// dotEnvCandidate is the first existing default .env, or "".
+func dotEnvCandidate() string {
+	paths := []string{".env"}
+	if exe, err := os.Executable(); err == nil {
+		paths = append(paths, filepath.Join(filepath.Dir(exe), ".env"))
+	}
+	for _, p := range paths {
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+			return p
+		}
+	}
+	return ""
+}
+
+// parseDotEnv reads KEY=VALUE lines. Blank lines and lines starting with #
+// are skipped, as is an "export " prefix. Values may be in double quotes
+// (with \n, \t, \" and \\ escapes) or single quotes (taken literally); an
+// unquoted value ends at " #". Later lines override earlier ones.
+func parseDotEnv(r io.Reader) (vars [][2]string, problems []string) {
+	sc := bufio.NewScanner(r)
+	n := 0
+	for sc.Scan() {
+		n++
+		line := strings.TrimSpace(sc.Text())
+		if n == 1 {
+			line = strings.TrimPrefix(line, "\ufeff") // Notepad's BOM
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, val, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t\"'") {
+			problems = append(problems, fmt.Sprintf("%d: linha inválida (esperado CHAVE=valor)", n))
+			continue
+		}
+		val, err := dotEnvValue(strings.TrimSpace(val))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%d: %s: %v", n, key, err))
+			continue
+		}
+		vars = append(vars, [2]string{key, val})
+	}
+	if err := sc.Err(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return vars, problems
+}
+
+func dotEnvValue(v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	switch q := v[0]; q {
+	case '"', '\'':
+		end := -1
+		for i := 1; i < len(v); i++ {
+			if q == '"' && v[i] == '\\' {
+				i++
+				continue
+			}
+			if v[i] == q {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return "", fmt.Errorf("aspas por fechar")
+		}
+		if rest := strings.TrimSpace(v[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("texto depois das aspas")
+		}
+		inner := v[1:end]
+		if q == '\'' {
+			return inner, nil
+		}
+		return strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(inner), nil
+	}
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	return v, nil
+}
+
+// unknownEnvVars lists the BOMBEIROS_, NTFY_ and FOGOS_ variables that no
+// option reads, most likely typos (NTFY_TOPC silently leaves the default
+// topic in place).
+func unknownEnvVars() []string {
+	known := map[string]bool{}
+	for _, f := range configFields {
+		for _, name := range f.envs {
+			known[name] = true
+		}
+	}
+	var out []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if known[name] {
+			continue
+		}
+		for _, prefix := range []string{"BOMBEIROS_", "NTFY_", "FOGOS_"} {
+			if strings.HasPrefix(name, prefix) {
+				out = append(out, name)
+				break
+			}
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// reportEnvironment logs the .env outcome and the unrecognized variables.
+func reportEnvironment() {
+	if dotEnv.path != "" {
+		slog.Info("variáveis lidas de .env", "path", dotEnv.path, "applied", dotEnv.applied)
+	}
+	for _, p := range dotEnv.problems {
+		slog.Warn(".env: " + p)
+	}
+	for _, name := range unknownEnvVars() {
+		slog.Warn("variável de ambiente desconhecida (erro de escrita?)", "name", name)
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SMTP_HOST sends some events as HTML emails (with a plain-text part) to
+// SMTP_TO, for readers who want a daily email rather than push messages.
+// EMAIL_EVENTS picks the events: daily_summary, weekly_summary, conclusion
+// or any notification type. Email is a Notifier like ntfy and Gotify, but
+// Send only queues: the emails are sent by their own worker, so a slow or
+// failing mail server never holds up the other channels.
+
+// SMTP_TLS modes.
+const (
+	smtpStartTLS = "starttls"
+	smtpSSL      = "ssl"
+	smtpPlain    = "none"
+)
+
+const (
+	emailQueueSize = 32
+	emailAttempts  = 3
+	emailTimeout   = 30 * time.Second
+)
+
+// emailRetryDelay is the wait before attempt i+1.
+var emailRetryDelay = []time.Duration{10 * time.Second, 60 * time.Second}
+
+// emailWanted reports whether EMAIL_EVENTS selects n.
+func emailWanted(cfg *Config, n Notification) bool {
+	return cfg.SMTPHost != "" && eventSelected(cfg.emailEvents, n)
+}
+
+// mailer sends queued emails one at a time, retrying each a few times.
+type mailer struct {
+	jobs chan Notification
+	wg   sync.WaitGroup
+
+	mu     sync.Mutex // guards closed and the send on jobs
+	closed bool
+}
+
+// mail is nil outside serve; the other commands send no email.
+var mail *mailer
+
+func startMailer() *mailer {
+	m := &mailer{jobs: make(chan Notification, emailQueueSize)}
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		for n := range m.jobs {
+			m.deliver(n)
+		}
+	}()
+	return m
+}
+
+// emailNotifier is the email channel: notifiersFor adds it for the messages
+// EMAIL_EVENTS selects, so the filters, digest, dedup, dry-run, mutes and
+// pause of postNtfyExt apply to email as to ntfy and Gotify.
+type emailNotifier struct {
+	cfg *Config
+	m   *mailer
+}
+
+func (e emailNotifier) Name() string { return channelEmail }
+
+func (e emailNotifier) Targets() string { return "email " + strings.Join(e.cfg.smtpTo, ", ") }
+
+// Send queues the email for the mailer's worker and returns at once; the
+// worker records the outcome. A full queue drops it.
+func (e emailNotifier) Send(ctx context.Context, ev Event) error {
+	n := ev.src
+	n.Title, n.Body, n.Markdown = ev.Title, ev.Body, ev.Markdown
+	var err error
+	e.m.mu.Lock()
+	switch {
+	case e.m.closed:
+		err = errors.New("a terminar; email descartado")
+	default:
+		select {
+		case e.m.jobs <- n:
+		default:
+			err = errors.New("fila de email cheia; email descartado")
+		}
+	}
+	e.m.mu.Unlock()
+	if err != nil {
+		slog.Warn(err.Error(), "type", n.Type, "subject", n.Title)
+		countChannelDelivery(channelEmail, "", n.Type, resultError, err)
+	}
+	return err
+}
+
+func (m *mailer) deliver(n Notification) {
+	for i := range emailAttempts {
+		cfg := conf()
+		if cfg.SMTPHost == "" {
+			return // turned off by a reload
+		}
+		err := sendEmail(cfg, n)
+		if err == nil {
+			slog.Info("email enviado", "type", n.Type, "subject", n.Title)
+			countChannelDelivery(channelEmail, cfg.SMTPHost, n.Type, resultOK, nil)
+			return
+		}
+		if i == emailAttempts-1 {
+			slog.Error("email não enviado", "type", n.Type, "subject", n.Title, "attempts", emailAttempts, "err", err)
+			countChannelDelivery(channelEmail, cfg.SMTPHost, n.Type, resultError, err)
+			return
+		}
+		slog.Warn("erro a enviar email; nova tentativa", "type", n.Type, "err", err, "retry_in", emailRetryDelay[i])
+		time.Sleep(emailRetryDelay[i])
+	}
+}
+
+// drain stops accepting emails and waits up to timeout for the queued ones.
+func (m *mailer) drain(timeout time.Duration) bool {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.jobs)
+	}
+	m.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// sendEmail delivers one message over SMTP.
+func sendEmail(cfg *Config, n Notification) error {
+	msg, err := buildEmail(cfg, n, cfg.now())
+	if err != nil {
+		return err
+	}
+	c, err := smtpConnect(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.Mail(cfg.SMTPFrom); err != nil {
+		return err
+	}
+	for _, to := range cfg.smtpTo {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("%s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// smtpConnect opens an SMTP session with SMTP_TLS applied and, with
+// SMTP_USER, authenticated.
+func smtpConnect(cfg *Config) (*smtp.Client, error) {
+	addr := net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort))
+	tlsConf := &tls.Config{ServerName: cfg.SMTPHost, MinVersion: tls.VersionTLS12, InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.httpTransport != nil && cfg.httpTransport.TLSClientConfig != nil {
+		tlsConf.RootCAs = cfg.httpTransport.TLSClientConfig.RootCAs // HTTP_CA_FILE
+	}
+	dialer := &net.Dialer{Timeout: emailTimeout}
+	var conn net.Conn
+	var err error
+	if cfg.SMTPTLS == smtpSSL {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConf)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(emailTimeout))
+	c, err := smtp.NewClient(conn, cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if cfg.SMTPTLS == smtpStartTLS {
+		if err := c.StartTLS(tlsConf); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("STARTTLS: %w", err)
+		}
+	}
+	if cfg.SMTPUser != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.SMTPUser, cfg.SMTPPass, cfg.SMTPHost)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// checkSMTP connects and logs in without sending anything, for `check`.
+func checkSMTP(cfg *Config) error {
+	c, err := smtpConnect(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.Quit()
+}
+
+// buildEmail renders n as a multipart/alternative message: the plain body,
+// then HTML made from its markdown rendering.
+func buildEmail(cfg *Config, n Notification, now time.Time) ([]byte, error) {
+	var rnd [12]byte
+	if _, err := rand.Read(rnd[:]); err != nil {
+		return nil, err
+	}
+	boundary := "bombeiros-" + hex.EncodeToString(rnd[:])
+	md := n.Markdown
+	if md == "" {
+		md = markdownBody(n.Body)
+	}
+	page := fmt.Sprintf("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"></head>\n<body style=\"font-family:sans-serif\">\n<h2>%s</h2>\n%s</body></html>\n",
+		html.EscapeString(n.Title), markdownHTML(md))
+
+	var b bytes.Buffer
+	hdr := func(k, v string) { fmt.Fprintf(&b, "%s: %s\r\n", k, v) }
+	hdr("From", cfg.SMTPFrom)
+	hdr("To", strings.Join(cfg.smtpTo, ", "))
+	hdr("Subject", mime.QEncoding.Encode("utf-8", n.Title))
+	hdr("Date", now.Format(time.RFC1123Z))
+	hdr("Message-ID", fmt.Sprintf("<%s@%s>", hex.EncodeToString(rnd[:]), cfg.SMTPHost))
+	hdr("MIME-Version", "1.0")
+	hdr("Content-Type", `multipart/alternative; boundary="`+boundary+`"`)
+	b.WriteString("\r\n")
+	for _, part := range []struct{ ct, body string }{
+		{"text/plain", n.Body},
+		{"text/html", page},
+	} {
+		fmt.Fprintf(&b, "--%s\r\nContent-Type: %s; charset=utf-8\r\nContent-Transfer-Encoding: base64\r\n\r\n", boundary, part.ct)
+		enc := base64.StdEncoding.EncodeToString([]byte(part.body))
+		for len(enc) > 76 {
+			b.WriteString(enc[:76] + "\r\n")
+			enc = enc[76:]
+		}
+		b.WriteString(enc + "\r\n")
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+var (
+	mdBold = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	mdLink = regexp.MustCompile(`https?://[^\s<]+`)
+)
+
+// markdownHTML converts the markdown the notifications use (see
+// markdown.go): paragraphs with hard breaks, bold, blockquotes and tables.
+func markdownHTML(md string) string {
+	inline := func(s string) string {
+		s = html.EscapeString(s)
+		s = mdLink.ReplaceAllString(s, `<a href="$0">$0</a>`)
+		return mdBold.ReplaceAllString(s, "<strong>$1</strong>")
+	}
+	var b strings.Builder
+	for _, block := range strings.Split(md, "\n\n") {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+		for i, l := range lines {
+			lines[i] = strings.TrimRight(l, " ")
+		}
+		switch {
+		case lines[0] == "":
+			continue
+		case strings.HasPrefix(lines[0], ">"):
+			for i, l := range lines {
+				lines[i] = inline(strings.TrimSpace(strings.TrimPrefix(l, ">")))
+			}
+			fmt.Fprintf(&b, "<blockquote>%s</blockquote>\n", strings.Join(lines, "<br>\n"))
+		case strings.HasPrefix(lines[0], "|"):
+			b.WriteString("<table border=\"1\" cellpadding=\"4\" style=\"border-collapse:collapse\">\n")
+			for i, l := range lines {
+				cells := strings.Split(strings.Trim(l, "|"), "|")
+				if i == 1 && slices.IndexFunc(cells, func(c string) bool { return strings.Trim(c, " -:") != "" }) < 0 {
+					continue // the |---| separator
+				}
+				tag := "td"
+				if i == 0 {
+					tag = "th"
+				}
+				b.WriteString("<tr>")
+				for _, c := range cells {
+					fmt.Fprintf(&b, "<%s>%s</%s>", tag, inline(strings.TrimSpace(c)), tag)
+				}
+				b.WriteString("</tr>\n")
+			}
+			b.WriteString("</table>\n")
+		default:
+			for i, l := range lines {
+				lines[i] = inline(l)
+			}
+			fmt.Fprintf(&b, "<p>%s</p>\n", strings.Join(lines, "<br>\n"))
+		}
+	}
+	return b.String()
+}
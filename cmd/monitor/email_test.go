@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEmailSendAfterDrain(t *testing.T) {
+	cfg, _, _, _ := newTestMonitor(t, map[string]string{
+		"SMTP_HOST": "127.0.0.1", "SMTP_FROM": "monitor@example.org", "SMTP_TO": "cb@example.org",
+	})
+	m := startMailer()
+	if !m.drain(time.Second) {
+		t.Fatal("drain timed out")
+	}
+	n := Notification{Type: notifySummary, Title: "Sumário diário", event: eventDailySummary}
+	if err := (emailNotifier{cfg: cfg, m: m}).Send(context.Background(), Event{Type: n.Type, Title: n.Title, src: n}); err == nil {
+		t.Error("queued after drain")
+	}
+}
+
+// TestEmailChannel: email goes through notifiersFor, so the filters and the
+// quiet-hours digest apply to it as to ntfy.
+func TestEmailChannel(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		env  map[string]string
+		want []string // subjects queued
+	}{
+		{"selected", nil, []string{"Novo em Sertã — Mato (14-08 16:20)"}},
+		{"NOTIFY_ONLY_STATUS", map[string]string{"NOTIFY_ONLY_STATUS": "Resolução"}, nil},
+		{"QUIET_DIGEST", map[string]string{"QUIET_HOURS": "16-17", "QUIET_DIGEST": "1"}, nil},
+		{"dry-run", map[string]string{"NTFY_DRYRUN": "1"}, nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			env := map[string]string{
+				"SMTP_HOST": "127.0.0.1", "SMTP_FROM": "monitor@example.org", "SMTP_TO": "cb@example.org",
+				"EMAIL_EVENTS": "new",
+			}
+			for k, v := range c.env {
+				env[k] = v
+			}
+			digest = &quietDigest{}
+			t.Cleanup(func() { digest = &quietDigest{} })
+			// no worker: the test reads the queue
+			mail = &mailer{jobs: make(chan Notification, emailQueueSize)}
+			t.Cleanup(func() { mail = nil })
+			cfg, srv, _, ms := newTestMonitor(t, env)
+			srv.setFeed(incident("2025050001", "Em Curso", 20))
+			mustRun(t, cfg, ms)
+			close(mail.jobs)
+			var got []string
+			for n := range mail.jobs {
+				got = append(got, n.Title)
+			}
+			if !slices.Equal(got, c.want) {
+				t.Errorf("emails %q, want %q", got, c.want)
+			}
+		})
+	}
+}
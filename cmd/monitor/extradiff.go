@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// extraFragments splits an extra text into sentences: every line, and within
+// a line after '.', '!', '?' or ';' followed by a space. VOST updates tend to
+// rewrite one sentence of a paragraph, so that is the unit compared.
+func extraFragments(s string) []string {
+	var out []string
+	add := func(f string) {
+		if f = strings.Join(strings.Fields(f), " "); f != "" {
+			out = append(out, f)
+		}
+	}
+	for _, line := range strings.Split(s, "\n") {
+		start := 0
+		for i := 0; i < len(line); i++ {
+			switch line[i] {
+			case '.', '!', '?', ';':
+				if i+1 == len(line) || line[i+1] == ' ' {
+					add(line[start : i+1])
+					start = i + 1
+				}
+			}
+		}
+		add(line[start:])
+	}
+	return out
+}
+
+// diffExtra returns the sentences of old missing from cur and those of cur
+// missing from old, each in text order (longest common subsequence).
+func diffExtra(old, cur string) (removed, added []string) {
+	a, b := extraFragments(old), extraFragments(cur)
+	// lcs[i][j] is the common length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			removed = append(removed, a[i])
+			i++
+		default:
+			added = append(added, b[j])
+			j++
+		}
+	}
+	return append(removed, a[i:]...), append(added, b[j:]...)
+}
+
+// extraChange renders an extra update as "+ sentence" / "− sentence" lines,
+// or the whole new text when there was none before or the diff would be
+// longer than it. added is what parseExtraTags should look at, so a road
+// closure still mentioned from an earlier update does not tag again.
+func extraChange(old, cur string) (text, added string) {
+	cur = strings.TrimSpace(cur)
+	if strings.TrimSpace(old) == "" {
+		return cur, cur
+	}
+	removed, addedFr := diffExtra(old, cur)
+	lines := make([]string, 0, len(removed)+len(addedFr))
+	for _, f := range removed {
+		lines = append(lines, "− "+f)
+	}
+	for _, f := range addedFr {
+		lines = append(lines, "+ "+f)
+	}
+	text = strings.Join(lines, "\n")
+	added = strings.Join(addedFr, " ")
+	if text == "" || utf8.RuneCountInString(text) > utf8.RuneCountInString(cur) {
+		text = cur
+	}
+	return text, added
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtraFragments(t *testing.T) {
+	got := extraFragments("Ponto de situação às 18h30.  Estrada N238 cortada ao km 12.5; desvio pela EM526!\nSem feridos a registar\n\nN.º de frentes: 2?")
+	want := []string{
+		"Ponto de situação às 18h30.",
+		"Estrada N238 cortada ao km 12.5;",
+		"desvio pela EM526!",
+		"Sem feridos a registar",
+		"N.º de frentes: 2?",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("extraFragments:\n got %q\nwant %q", got, want)
+	}
+}
+
+// VOST updates as they come: a paragraph where one sentence is rewritten at
+// a time.
+const (
+	vost1 = "Incêndio em povoamento florestal com duas frentes ativas. EN2 cortada entre Sertã e Pedrógão Pequeno. Meios aéreos a operar na zona."
+	vost2 = "Incêndio em povoamento florestal com uma frente ativa. EN2 cortada entre Sertã e Pedrógão Pequeno. Meios aéreos a operar na zona."
+	vost3 = "Incêndio em povoamento florestal com uma frente ativa. EN2 cortada entre Sertã e Pedrógão Pequeno.\nPonto de situação às 18h: 120 operacionais no terreno."
+	vost4 = "Incêndio em povoamento florestal com uma frente ativa. EN2 reaberta ao trânsito.\nPonto de situação às 18h: 120 operacionais no terreno."
+)
+
+func TestExtraChange(t *testing.T) {
+	for _, c := range []struct {
+		name, old, cur string
+		text, added    string
+	}{
+		{"first extra", "", vost1, vost1, vost1},
+		{"one sentence rewritten", vost1, vost2,
+			"− Incêndio em povoamento florestal com duas frentes ativas.\n+ Incêndio em povoamento florestal com uma frente ativa.",
+			"Incêndio em povoamento florestal com uma frente ativa."},
+		{"one sentence replaced by a line", vost2, vost3,
+			"− Meios aéreos a operar na zona.\n+ Ponto de situação às 18h: 120 operacionais no terreno.",
+			"Ponto de situação às 18h: 120 operacionais no terreno."},
+		{"road reopened", vost3, vost4,
+			"− EN2 cortada entre Sertã e Pedrógão Pequeno.\n+ EN2 reaberta ao trânsito.",
+			"EN2 reaberta ao trânsito."},
+		{"only reflowed", vost1, strings.ReplaceAll(vost1, ". ", ".\n"), strings.ReplaceAll(vost1, ". ", ".\n"), ""},
+		// the diff would be longer than the new text
+		{"rewritten", vost1, "Dado como dominado às 21h.", "Dado como dominado às 21h.", "Dado como dominado às 21h."},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			text, added := extraChange(c.old, c.cur)
+			if text != c.text {
+				t.Errorf("text:\n%s\nwant:\n%s", text, c.text)
+			}
+			if added != c.added {
+				t.Errorf("added = %q, want %q", added, c.added)
+			}
+		})
+	}
+}
+
+// TestExtraChangeNotifications: only the changed sentences are sent, and a
+// road closure still mentioned from an earlier update does not tag again.
+func TestExtraChangeNotifications(t *testing.T) {
+	cfg, srv, clk, ms := newTestMonitor(t, nil)
+	feed := func(extra string) map[string]any {
+		f := incident("2025050001", "Em Curso", 20)
+		f["extra"] = extra
+		return f
+	}
+	srv.setFeed(feed(vost1))
+	mustRun(t, cfg, ms)
+	srv.take()
+
+	for _, c := range []struct {
+		extra, body string
+		tag         string // among the tags
+		notTag      string
+	}{
+		{vost2, "ID: 2025050001\nExtra alterado:\n− Incêndio em povoamento florestal com duas frentes ativas.\n+ Incêndio em povoamento florestal com uma frente ativa.", "", "no_entry"},
+		{vost3, "ID: 2025050001\nExtra alterado:\n− Meios aéreos a operar na zona.\n+ Ponto de situação às 18h: 120 operacionais no terreno.", "", "no_entry"},
+		{vost4, "ID: 2025050001\nExtra alterado:\n− EN2 cortada entre Sertã e Pedrógão Pequeno.\n+ EN2 reaberta ao trânsito.", "white_check_mark", "no_entry"},
+	} {
+		clk.advance(time.Minute)
+		srv.setFeed(feed(c.extra))
+		mustRun(t, cfg, ms)
+		var extra []posted
+		for _, m := range srv.take() {
+			if m.Title == "Atualização — Sertã" {
+				extra = append(extra, m)
+			}
+		}
+		if len(extra) != 1 {
+			t.Fatalf("%.30q: %d extra updates", c.extra, len(extra))
+		}
+		if !strings.HasPrefix(extra[0].Message, c.body) {
+			t.Errorf("body:\n%s\nwant it to start with:\n%s", extra[0].Message, c.body)
+		}
+		if c.tag != "" && !extra[0].hasTag(c.tag) {
+			t.Errorf("%.30q: tags %v lack %s", c.extra, extra[0].Tags, c.tag)
+		}
+		if extra[0].hasTag(c.notTag) {
+			t.Errorf("%.30q: tags %v have %s", c.extra, extra[0].Tags, c.notTag)
+		}
+	}
+}
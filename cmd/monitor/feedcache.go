@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// feedCacheRewrite refreshes the file's timestamp even when the feed has not
+// changed, so a restart during an outage knows roughly how old it is.
+const feedCacheRewrite = 10 * time.Minute
+
+// feedCacheFile is the last good feed, kept on disk next to STATE_FILE.
+type feedCacheFile struct {
+	Fetched time.Time         `json:"fetched"`
+	Feed    FeatureCollection `json:"feed"`
+}
+
+// feedCacheState remembers the last successfully parsed feed so that a cycle
+// whose fetch fails can still publish the incident list and gauges. Owned by
+// the poll goroutine.
+type feedCacheState struct {
+	path       string
+	loaded     bool
+	file       feedCacheFile
+	sum        uint64    // hash of the feed last written
+	written    time.Time // when the file was last written
+	staleSince time.Time // first fetch served from the cache; zero while fresh
+	served     int       // cycles served from the cache in this outage
+}
+
+var feedCache = &feedCacheState{}
+
+func feedCachePath(statePath string) string {
+	return strings.TrimSuffix(statePath, ".json") + "_feed.json"
+}
+
+func (c *feedCacheState) load(path string) {
+	if c.loaded && c.path == path {
+		return
+	}
+	c.loaded, c.path = true, path
+	c.file, c.sum, c.written = feedCacheFile{}, 0, time.Time{}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	// decodeJSON keeps numbers as json.Number, as in a live fetch.
+	if err := decodeJSON(b, &c.file); err != nil {
+		slog.Warn("cache da API inválida; ignorada", "path", path, "err", err)
+		c.file = feedCacheFile{}
+	}
+}
+
+// store records a good fetch and, with FEED_CACHE, writes it to disk when it
+// changed (or every feedCacheRewrite). It also ends an outage.
+func (c *feedCacheState) store(cfg *Config, features []Feature, now time.Time) {
+	dataStale.Set(0)
+	if c.served > 0 {
+		slog.Info("API recuperada; fim dos dados em cache",
+			"offline", now.Sub(c.staleSince).Round(time.Second).String(),
+			"cycles", c.served,
+			"cache_age", now.Sub(c.file.Fetched).Round(time.Second).String())
+	}
+	c.staleSince, c.served = time.Time{}, 0
+	if !cfg.FeedCache {
+		return
+	}
+	c.load(feedCachePath(cfg.statePath()))
+	c.file = feedCacheFile{Fetched: now, Feed: FeatureCollection{Type: "FeatureCollection", Features: features}}
+	b, err := json.Marshal(c.file.Feed)
+	if err != nil {
+		return
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(b)
+	sum := h.Sum64()
+	if sum == c.sum && now.Sub(c.written) < feedCacheRewrite {
+		return
+	}
+	b, _ = json.Marshal(c.file)
+	if err := os.WriteFile(c.path, b, 0644); err != nil {
+		slog.Warn("erro a gravar cache da API", "path", c.path, "err", err)
+		return
+	}
+	c.sum, c.written = sum, now
+}
+
+// fallback returns the cached feed and when it was fetched. ok is false when
+// FEED_CACHE is off, nothing was cached (zero fetched) or the copy is older
+// than FEED_CACHE_MAX_HOURS.
+func (c *feedCacheState) fallback(cfg *Config, now time.Time) (features []Feature, fetched time.Time, ok bool) {
+	if !cfg.FeedCache {
+		return nil, time.Time{}, false
+	}
+	c.load(feedCachePath(cfg.statePath()))
+	fetched = c.file.Fetched
+	if fetched.IsZero() {
+		return nil, fetched, false
+	}
+	if limit := time.Duration(cfg.FeedCacheMaxHours) * time.Hour; limit > 0 && now.Sub(fetched) > limit {
+		return nil, fetched, false
+	}
+	return c.file.Feed.Features, fetched, true
+}
+
+// serveCachedFeed runs after a failed fetch, with ms unlocked. The last good
+// feed keeps the incident list, the HTTP API and the gauges populated, but it
+// is not compared with the state: nothing in it is news, so no notification
+// can come out of it and the state is left for the next real fetch.
+func serveCachedFeed(cfg *Config, ms *MonitorState, store StateStore, now time.Time) {
+	dataStale.Set(1)
+	first := feedCache.staleSince.IsZero()
+	if first {
+		feedCache.staleSince = now
+	}
+	features, fetched, ok := feedCache.fallback(cfg, now)
+	switch {
+	case !ok && first && !fetched.IsZero():
+		slog.Warn("cache da API demasiado antiga; não usada", "fetched", fetched.Format(time.RFC3339))
+	case ok && feedCache.served == 0:
+		slog.Warn("API indisponível; a usar os últimos dados obtidos", "fetched", fetched.Format(time.RFC3339), "count", len(features))
+	}
+	if !ok {
+		return
+	}
+	feedCache.served++
+	unlock := ms.lock()
+	defer unlock()
+	if st, seen, err := ms.loadForCycle(store); err == nil {
+		ms.cycleState, ms.cycleSeen = st, seen
+	}
+	recovered, ok := ms.takeRecovered()
+	unlock()
+	if ok {
+		dispatch(cfg.NtfyURL, cfg.NtfyTopic, recovered)
+	}
+	filtered := filterFeatures(cfg, features)
+	setActiveGauges(cfg, ms, filtered, now)
+	lastCycleFiltered = filtered
+	incidents.publish(buildIncidentViews(cfg, ms, filtered, now), fetched)
+}
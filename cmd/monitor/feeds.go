@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sourceFogos is the fogos.pt API, the primary source.
+const sourceFogos = "fogos"
+
+// feedParser maps one source's response into Features shaped like the
+// fogos.pt ones (id, natureza, status, concelho, man, dateTime...). Adding a
+// source means implementing it and listing it in feedParsers.
+type feedParser interface {
+	// defaultURL is fetched when SOURCES names the source without a URL.
+	defaultURL() string
+	parse(body []byte) ([]Feature, error)
+}
+
+var feedParsers = map[string]feedParser{
+	sourceFogos:  fogosParser{},
+	sourceProciv: procivParser{},
+}
+
+type fogosParser struct{}
+
+func (fogosParser) defaultURL() string { return fogosActiveURL }
+
+func (fogosParser) parse(body []byte) ([]Feature, error) { return toFeatures(body) }
+
+// feedSource is one SOURCES entry.
+type feedSource struct {
+	name string
+	url  string // http(s) URL, file:<path> or -
+}
+
+// parseSources reads SOURCES: comma-separated names, each optionally
+// followed by =URL. fogos defaults to FEATURES_SOURCE, if set. fogos always
+// comes first, as it wins when two sources report the same incident; the
+// others keep their order.
+func parseSources(v, featuresSource string) ([]feedSource, error) {
+	var out []feedSource
+	for _, item := range splitList(v) {
+		name, u, _ := strings.Cut(item, "=")
+		name, u = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(u)
+		p, ok := feedParsers[name]
+		if !ok {
+			return nil, fmt.Errorf("SOURCES: origem desconhecida %q (origens: %s)", name, strings.Join(slices.Sorted(maps.Keys(feedParsers)), ", "))
+		}
+		if slices.ContainsFunc(out, func(s feedSource) bool { return s.name == name }) {
+			return nil, fmt.Errorf("SOURCES: %q repetida", name)
+		}
+		if u == "" && name == sourceFogos {
+			u = featuresSource
+		}
+		if u == "" {
+			u = p.defaultURL()
+		}
+		if err := validateSource("SOURCES "+name, u); err != nil {
+			return nil, err
+		}
+		out = append(out, feedSource{name: name, url: u})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("SOURCES vazio")
+	}
+	slices.SortStableFunc(out, func(a, b feedSource) int {
+		switch {
+		case a.name == sourceFogos:
+			return -1
+		case b.name == sourceFogos:
+			return 1
+		}
+		return 0
+	})
+	return out, nil
+}
+
+// fetchActiveFeatures fetches every source in parallel and merges the
+// results. It fails only when all sources fail; a partial failure is logged
+// and shows in bombeiros_source_up.
+func fetchActiveFeatures(ctx context.Context, cfg *Config) ([]Feature, error) {
+	sources := cfg.sources
+	results := make([][]Feature, len(sources))
+	errs := make([]error, len(sources))
+	var wg sync.WaitGroup
+	for i, src := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = fetchSource(ctx, cfg, src)
+		}()
+	}
+	wg.Wait()
+
+	var failed []error
+	for i, src := range sources {
+		if errs[i] != nil {
+			sourceUp.WithLabelValues(src.name).Set(0)
+			failed = append(failed, fmt.Errorf("%s: %w", src.name, errs[i]))
+			continue
+		}
+		sourceUp.WithLabelValues(src.name).Set(1)
+		sourceIncidents.WithLabelValues(src.name).Set(float64(len(results[i])))
+	}
+	switch {
+	case len(failed) == 0:
+	case len(failed) == len(sources) && len(sources) == 1:
+		return nil, errs[0]
+	case len(failed) == len(sources):
+		return nil, errors.Join(failed...)
+	default:
+		for _, err := range failed {
+			slog.Warn("origem indisponível; a continuar com as restantes", "err", err)
+		}
+	}
+	return mergeSources(sources, results), nil
+}
+
+// fetchSource reads one source and parses it with its feedParser. Only
+// fogos.pt responses go to SNAPSHOT_DIR and DEBUG_DIR, since replay reads
+// that format.
+func fetchSource(ctx context.Context, cfg *Config, src feedSource) ([]Feature, error) {
+	parser := feedParsers[src.name]
+	data, err := readSource(ctx, cfg, src)
+	if err != nil {
+		return nil, err
+	}
+	_, span := tracer.Start(ctx, "parse", trace.WithAttributes(
+		attribute.String("source", src.name), attribute.Int("bytes", len(data))))
+	var features []Feature
+	defer func() {
+		span.SetAttributes(attribute.Int("features", len(features)))
+		endSpan(span, err)
+	}()
+	if !isHTTPSource(src.url) || src.name != sourceFogos {
+		features, err = parser.parse(data)
+		return features, err
+	}
+	apiPayloadBytes.Set(float64(len(data)))
+	if dir := cfg.SnapshotDir; dir != "" {
+		if err := saveSnapshot(dir, data, cfg.now()); err != nil {
+			slog.Warn("erro a gravar snapshot", "dir", dir, "err", err)
+		}
+	}
+	features, err = checkResponse(cfg, data, cfg.now())
+	return features, err
+}
+
+// readSource reads the raw document of one source.
+func readSource(ctx context.Context, cfg *Config, src feedSource) (data []byte, err error) {
+	_, span := tracer.Start(ctx, "fetch", trace.WithAttributes(attribute.String("source", src.name)))
+	defer func() { endSpan(span, err) }()
+	if !isHTTPSource(src.url) {
+		return readLocalSource(src.url)
+	}
+	resp, err := doGet(cfg, src.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	data, err = readAPIBody(resp, int64(cfg.APIMaxBodyMB)<<20)
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %w", src.url, err)
+	}
+	return data, nil
+}
+
+// mergeSources concatenates the results in source order, tagging each
+// feature with its source. A feature with the ANEPC number of one from an
+// earlier source is dropped, so fogos.pt wins. The other identifiers (id,
+// ogc_fid, uid...) are each source's own numbering and never match across
+// sources. Duplicates within one source are left to the alias handling.
+func mergeSources(sources []feedSource, results [][]Feature) []Feature {
+	n := 0
+	for _, r := range results {
+		n += len(r)
+	}
+	out := make([]Feature, 0, n)
+	seen := map[string]bool{}
+	for i, src := range sources {
+		var nums []string
+		for _, f := range results[i] {
+			num := anepcNumber(f.Properties)
+			if num != "" && seen[num] {
+				continue
+			}
+			if num != "" {
+				nums = append(nums, num)
+			}
+			if f.Properties == nil {
+				f.Properties = map[string]any{}
+			}
+			f.Properties["source"] = src.name
+			out = append(out, f)
+		}
+		for _, num := range nums {
+			seen[num] = true
+		}
+	}
+	return out
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestMergeSources: only the ANEPC number matches an incident across
+// sources; a ProCiv number equal to some fogos.pt id or ogc_fid is another
+// incident.
+func TestMergeSources(t *testing.T) {
+	sources := []feedSource{{name: sourceFogos}, {name: sourceProciv}}
+	fogos := []Feature{
+		{Properties: map[string]any{"id": "2025050001", "ogc_fid": 17.0}},
+		{Properties: map[string]any{"id": "2025050002", "sadoId": "2025090000123"}},
+		{Properties: map[string]any{"id": "2025050003"}},
+	}
+	prociv := []Feature{
+		{Properties: map[string]any{"id": "17", "sadoId": "17"}},
+		{Properties: map[string]any{"id": "2025090000123", "sadoId": "2025090000123"}},
+		{Properties: map[string]any{"id": "2025050003", "sadoId": "2025050003"}},
+	}
+	got := mergeSources(sources, [][]Feature{fogos, prociv})
+	var ids []string
+	for _, f := range got {
+		ids = append(ids, f.Properties["source"].(string)+":"+getID(f.Properties))
+	}
+	want := []string{"fogos:2025050001", "fogos:2025050002", "fogos:2025050003", "prociv:17", "prociv:2025050003"}
+	if !slices.Equal(ids, want) {
+		t.Errorf("merged = %q, want %q", ids, want)
+	}
+}
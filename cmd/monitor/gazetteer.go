@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GAZETTEER_FILE names populated places with coordinates, so an incident
+// that only carries its concelho can still say "Perto de: Cernache do
+// Bonjardim (2.3 km)". No places ship with the binary: without the file the
+// line is simply left out.
+//
+// Two formats are read: the GeoNames dump (PT.txt from
+// download.geonames.org/export/dump, tab-separated; only feature class P is
+// kept), or one place per line as name;lat;lon (comma or tab also work).
+
+// gazetteerMaxKm is how far the nearest place may be to be named.
+const gazetteerMaxKm = 10.0
+
+// gazetteerCell is the grid step in degrees. A 10 km radius spans at most
+// one cell of latitude and two of longitude at Portuguese latitudes.
+const gazetteerCell = 0.1
+
+type gazPlace struct {
+	name     string
+	lat, lon float64
+}
+
+// gazetteer indexes places by grid cell for nearest-place lookups.
+type gazetteer struct {
+	cells map[[2]int][]gazPlace
+	n     int
+}
+
+func gazCell(lat, lon float64) [2]int {
+	return [2]int{int(math.Floor(lat / gazetteerCell)), int(math.Floor(lon / gazetteerCell))}
+}
+
+// loadGazetteer reads path. Lines that are not places are skipped; a file
+// with none at all is an error, since it is most likely the wrong file.
+func loadGazetteer(path string) (*gazetteer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	g := &gazetteer{cells: map[[2]int][]gazPlace{}}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20) // GeoNames alternate names run long
+	for sc.Scan() {
+		if p, ok := parseGazetteerLine(sc.Text()); ok {
+			c := gazCell(p.lat, p.lon)
+			g.cells[c] = append(g.cells[c], p)
+			g.n++
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if g.n == 0 {
+		return nil, fmt.Errorf("%s: nenhum lugar reconhecido", path)
+	}
+	return g, nil
+}
+
+func parseGazetteerLine(line string) (gazPlace, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return gazPlace{}, false
+	}
+	var name, lat, lon string
+	if cols := strings.Split(line, "\t"); len(cols) >= 8 {
+		// GeoNames: id, name, asciiname, alternatenames, lat, lon, class, code, ...
+		if cols[6] != "P" {
+			return gazPlace{}, false
+		}
+		name, lat, lon = cols[1], cols[4], cols[5]
+	} else {
+		sep := ";"
+		switch {
+		case strings.Contains(line, "\t"):
+			sep = "\t"
+		case !strings.Contains(line, ";"):
+			sep = ","
+		}
+		cols := strings.Split(line, sep)
+		if len(cols) < 3 {
+			return gazPlace{}, false
+		}
+		n := len(cols)
+		name, lat, lon = strings.Join(cols[:n-2], sep), cols[n-2], cols[n-1]
+	}
+	la, err1 := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	lo, err2 := strconv.ParseFloat(strings.TrimSpace(lon), 64)
+	name = strings.TrimSpace(name)
+	if err1 != nil || err2 != nil || name == "" || !validLatLon(la, lo) {
+		return gazPlace{}, false
+	}
+	return gazPlace{name: name, lat: la, lon: lo}, true
+}
+
+// nearest is the closest place to lat, lon within gazetteerMaxKm.
+func (g *gazetteer) nearest(lat, lon float64) (gazPlace, float64, bool) {
+	var best gazPlace
+	bestKm := math.Inf(1)
+	c := gazCell(lat, lon)
+	for dLat := -1; dLat <= 1; dLat++ {
+		for dLon := -2; dLon <= 2; dLon++ {
+			for _, p := range g.cells[[2]int{c[0] + dLat, c[1] + dLon}] {
+				if km := haversineKm(lat, lon, p.lat, p.lon); km < bestKm {
+					best, bestKm = p, km
+				}
+			}
+		}
+	}
+	if bestKm > gazetteerMaxKm {
+		return gazPlace{}, 0, false
+	}
+	return best, bestKm, true
+}
+
+// nearLine renders "Perto de: <place> (2.3 km)" for an incident the feed
+// does not place more precisely than its concelho, or "" when it has a
+// localidade or detailLocation, no coordinates, or no place close enough.
+func nearLine(cfg *Config, f Feature) string {
+	if cfg.gazetteer == nil || getPropStr(f.Properties, "localidade", "detailLocation") != "" {
+		return ""
+	}
+	lat, lon, ok := getCoords(f.Geometry)
+	if !ok {
+		return ""
+	}
+	p, km, ok := cfg.gazetteer.nearest(lat, lon)
+	if !ok {
+		return ""
+	}
+	return tr("info.near", p.name, km)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// GOTIFY_URL publishes every message to a Gotify server as well, through its
+// /message endpoint with an application token (GOTIFY_TOKEN). It goes out
+// as a Notifier, after the same filters, dedup, dry-run, mute, pause and
+// quiet-hours handling as ntfy; GOTIFY_ONLY leaves ntfy out.
+
+// gotifyPriority maps the ntfy scale (1-5) onto Gotify's 0-10, where the
+// Android app plays a sound from 4 and shows a heads-up from 8.
+func gotifyPriority(ntfy string) int {
+	p, err := strconv.Atoi(strings.TrimSpace(ntfy))
+	if err != nil {
+		p = 3
+	}
+	switch {
+	case p <= 1:
+		return 1
+	case p == 2:
+		return 3
+	case p == 3:
+		return 5
+	case p == 4:
+		return 8
+	default:
+		return 10
+	}
+}
+
+// gotifyLabel names the server in logs and metrics: its host.
+func gotifyLabel(cfg *Config) string {
+	if u, err := url.Parse(cfg.GotifyURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return cfg.GotifyURL
+}
+
+// gotifyNotifier publishes to GOTIFY_URL.
+type gotifyNotifier struct {
+	cfg *Config
+}
+
+func (g gotifyNotifier) Name() string { return channelGotify }
+
+func (g gotifyNotifier) Targets() string { return "gotify " + gotifyLabel(g.cfg) }
+
+// Send posts ev, as markdown whenever it has a markdown rendering; the click
+// URL becomes the notification's tap action.
+func (g gotifyNotifier) Send(ctx context.Context, ev Event) error {
+	cfg, typ := g.cfg, ev.Type
+	server := gotifyLabel(cfg)
+	body, markdown := ev.Body, ev.Markdown != ""
+	if markdown {
+		body = ev.Markdown
+	}
+	payload := map[string]any{
+		"title":    ev.Title,
+		"message":  body,
+		"priority": gotifyPriority(ev.Priority),
+	}
+	extras := map[string]any{}
+	if markdown {
+		extras["client::display"] = map[string]string{"contentType": "text/markdown"}
+	}
+	if strings.TrimSpace(ev.Click) != "" {
+		extras["client::notification"] = map[string]any{"click": map[string]string{"url": ev.Click}}
+	}
+	if len(extras) > 0 {
+		payload["extras"] = extras
+	}
+	b, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(cfg.GotifyURL, "/")+"/message", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("X-Gotify-Key", cfg.GotifyToken)
+	resp, err := cfg.httpClient.Do(req)
+	if err != nil {
+		slog.Error("gotify erro", "type", typ, "server", server, "err", err)
+		countChannelDelivery(channelGotify, server, typ, resultError, err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := fmt.Errorf("gotify HTTP %d (%s): %s", resp.StatusCode, server, strings.TrimSpace(string(msg)))
+		slog.Error("gotify HTTP", "type", typ, "server", server, "status", resp.StatusCode, "body", strings.TrimSpace(string(msg)))
+		countChannelDelivery(channelGotify, server, typ, resultError, err)
+		return err
+	}
+	countChannelDelivery(channelGotify, server, typ, resultOK, nil)
+	return nil
+}
+
+// checkGotify asks the server's /health, which needs no token.
+func checkGotify(client *http.Client, base string) error {
+	resp, err := client.Get(strings.TrimRight(base, "/") + "/health")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// grafanaTrack is called on every status event. It opens an annotation for
+// incidents that have none yet (new ones, or ones whose earlier attempt failed)
+// and closes the region on conclusion. Errors are logged and retried on the
+// next status event for the incident. It runs with ms unlocked and takes mu
+// only to read and record the annotation, not across the requests.
+func (ms *MonitorState) grafanaTrack(cfg *Config, id string, f Feature, status string, now time.Time) {
+	if cfg.GrafanaURL == "" || id == "" {
+		return
+	}
+	p := f.Properties
+	tags := []string{"bombeiros", getMunicipio(p), getPropStr(p, "natureza")}
+	text := fmt.Sprintf("%s %s: %s", id, getMunicipio(p), status)
+	ms.mu.RLock()
+	annID, open := ms.annotations[id]
+	start, seen := ms.firstSeen[id]
+	ms.mu.RUnlock()
+	if !isConcludedStatus(status) {
+		if open {
+			return
+		}
+		newID, err := grafanaPost(cfg, "POST", "/api/annotations", map[string]any{
+			"time": now.UnixMilli(),
+			"tags": nonEmptyTags(tags),
+			"text": text,
+		})
+		if err == nil && newID == 0 {
+			err = fmt.Errorf("resposta sem id")
+		}
+		if err != nil {
+			slog.Warn("Grafana: anotação não criada", "incident_id", id, "err", err)
+			return
+		}
+		ms.mu.Lock()
+		ms.annotations[id] = newID
+		ms.mu.Unlock()
+		return
+	}
+	var err error
+	if open {
+		// Turn the start marker into a region ending now.
+		_, err = grafanaPost(cfg, "PATCH", fmt.Sprintf("/api/annotations/%d", annID), map[string]any{
+			"timeEnd": now.UnixMilli(),
+			"text":    text,
+		})
+	} else {
+		// The start was never recorded: post the whole region at once.
+		if !seen {
+			start = now
+		}
+		_, err = grafanaPost(cfg, "POST", "/api/annotations", map[string]any{
+			"time":    start.UnixMilli(),
+			"timeEnd": now.UnixMilli(),
+			"tags":    nonEmptyTags(tags),
+			"text":    text,
+		})
+	}
+	if err != nil {
+		slog.Warn("Grafana: anotação não fechada", "incident_id", id, "err", err)
+		return
+	}
+	ms.mu.Lock()
+	delete(ms.annotations, id)
+	ms.mu.Unlock()
+}
+
+// grafanaPost sends body to the Grafana HTTP API and returns the annotation
+// id from the response, if any.
+func grafanaPost(cfg *Config, method, path string, body any) (int64, error) {
+	b, _ := json.Marshal(body)
+	req, err := http.NewRequest(method, strings.TrimRight(cfg.GrafanaURL, "/")+path, bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.GrafanaToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.GrafanaToken)
+	}
+	resp, err := cfg.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode >= 400 {
+		return 0, fmt.Errorf("http %d %s %s: %s", resp.StatusCode, method, path, strings.TrimSpace(string(msg)))
+	}
+	var out struct {
+		ID int64 `json:"id"`
+	}
+	_ = json.Unmarshal(msg, &out)
+	return out.ID, nil
+}
+
+func nonEmptyTags(tags []string) []string {
+	out := tags[:0:0]
+	for _, t := range tags {
+		if strings.TrimSpace(t) != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
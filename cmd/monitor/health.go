@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// healthState tracks the outcome of the last fetch for the /readyz probe.
+// runOnce writes it from the poll goroutine; the HTTP handlers read it.
+type healthState struct {
+	mu          sync.Mutex
+	lastSuccess time.Time
+	lastErr     string
+	lastErrAt   time.Time
+}
+
+var health = &healthState{}
+
+func (h *healthState) recordFetch(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.lastErr = err.Error()
+		h.lastErrAt = conf().now()
+		return
+	}
+	h.lastSuccess = conf().now()
+}
+
+type readyStatus struct {
+	Ready       bool   `json:"ready"`
+	LastSuccess string `json:"last_success,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+	LastErrorAt string `json:"last_error_at,omitempty"`
+}
+
+// status reports ready when the last successful fetch is newer than maxAge.
+func (h *healthState) status(maxAge time.Duration) readyStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st := readyStatus{
+		Ready:     !h.lastSuccess.IsZero() && conf().now().Sub(h.lastSuccess) <= maxAge,
+		LastError: h.lastErr,
+	}
+	if !h.lastSuccess.IsZero() {
+		st.LastSuccess = h.lastSuccess.UTC().Format(time.RFC3339)
+	}
+	if !h.lastErrAt.IsZero() {
+		st.LastErrorAt = h.lastErrAt.UTC().Format(time.RFC3339)
+	}
+	if !st.Ready && st.LastError == "" {
+		st.LastError = "sem nenhuma leitura bem-sucedida da API"
+	}
+	return st
+}
+
+// instanceHeader marks /healthz answers as coming from this monitor, so a
+// second instance can tell it from an unrelated service on the same port.
+const instanceHeader = "X-Bombeiros-Monitor"
+
+// healthzHandler is the liveness probe: the process is up if it can answer.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(instanceHeader, fmt.Sprintf("%s pid=%d", version, os.Getpid()))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// readyzHandler is the readiness probe: ready while the last fetch succeeded
+// within 3 poll intervals.
+func readyzHandler(poll time.Duration) http.HandlerFunc {
+	if poll <= 0 {
+		poll = 30 * time.Second
+	}
+	maxAge := 3 * poll
+	return func(w http.ResponseWriter, r *http.Request) {
+		st := health.status(maxAge)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if st.Ready {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(st)
+	}
+}
+
+// runningInstance asks /healthz on METRICS_ADDR whether another monitor is
+// listening there and returns its PID.
+func runningInstance(cfg *Config) (string, bool) {
+	u, client, err := localServerURL(cfg, "/healthz")
+	if err != nil {
+		return "", false
+	}
+	client.Timeout = 2 * time.Second
+	resp, err := client.Get(u)
+	if err != nil {
+		return "", false
+	}
+	resp.Body.Close()
+	v := resp.Header.Get(instanceHeader)
+	if v == "" {
+		return "", false
+	}
+	_, pid, ok := strings.Cut(v, "pid=")
+	if !ok {
+		pid = "?"
+	}
+	return pid, true
+}
+
+// feedAlertState sends a single "feed down" message after a run of failed
+// fetches and a single "recovered" message once it comes back.
+type feedAlertState struct {
+	failures  int
+	firstFail time.Time
+	notified  bool
+}
+
+var feedAlert = &feedAlertState{}
+
+// track updates bombeiros_api_up and the failure counter, and notifies on the
+// down/up edges. Only called from the poll goroutine.
+func (f *feedAlertState) track(err error) {
+	if err == nil {
+		apiUp.Set(1)
+		apiConsecutiveFailures.Set(0)
+		if f.notified {
+			down := conf().now().Sub(f.firstFail)
+			postNtfyExt(conf().NtfyURL, conf().NtfyTopic, Notification{
+				Type:     notifyFeed,
+				Title:    tr("feed.up.title"),
+				Body:     tr("feed.up.body", int(down.Minutes())),
+				Tags:     "white_check_mark",
+				Priority: "3",
+			})
+		}
+		*f = feedAlertState{}
+		return
+	}
+	apiUp.Set(0)
+	if f.failures == 0 {
+		f.firstFail = conf().now()
+	}
+	f.failures++
+	apiConsecutiveFailures.Set(float64(f.failures))
+
+	cfg := conf()
+	threshold := cfg.APIFailureNotifyThreshold
+	if threshold <= 0 || f.notified || f.failures < threshold {
+		return
+	}
+	f.notified = true
+	postNtfyExt(cfg.NtfyURL, cfg.NtfyTopic, Notification{
+		Type:     notifyFeed,
+		Title:    tr("feed.down.title", int(cfg.now().Sub(f.firstFail).Minutes())),
+		Body:     tr("feed.down.body", f.failures, err),
+		Tags:     "warning",
+		Priority: "4",
+	})
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// The poll loop touches a heartbeat file next to the state file after every
+// successful cycle, so `monitor health` can answer without the HTTP server
+// (METRICS_DISABLE and no dashboard, mute API or CAP feed).
+
+func heartbeatPath(statePath string) string {
+	return strings.TrimSuffix(statePath, ".json") + "_heartbeat"
+}
+
+// touchHeartbeat records a successful cycle. Best effort: a failure only
+// makes `monitor health` report the instance as not ready.
+func touchHeartbeat(cfg *Config, now time.Time) {
+	path := heartbeatPath(cfg.statePath())
+	if err := os.WriteFile(path, []byte(now.UTC().Format(time.RFC3339)+"\n"), 0644); err != nil {
+		slog.Debug("heartbeat não gravado", "path", path, "err", err)
+	}
+}
+
+// readHeartbeat returns the time of the last successful cycle: the file's
+// contents, or its mtime if they don't parse.
+func readHeartbeat(path string) (time.Time, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(b))); err == nil {
+		return t, nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// cmdHealth is meant for a container HEALTHCHECK: it exits 0 while the
+// running instance is ready and 1 otherwise. With the HTTP server enabled it
+// asks /readyz; otherwise it checks the heartbeat file. Both allow 3 poll
+// intervals since the last successful fetch.
+func cmdHealth(name string, args []string) {
+	cfg, _, _ := loadCommandConfig(name, args, nil)
+	var err error
+	if httpServerEnabled(cfg) {
+		err = healthHTTP(cfg)
+	} else {
+		err = healthHeartbeat(cfg, time.Now())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "não pronto:", err)
+		os.Exit(1)
+	}
+	fmt.Println("ok")
+}
+
+// httpServerEnabled reports whether serve starts the metrics/HTTP server.
+func httpServerEnabled(cfg *Config) bool {
+	return !cfg.MetricsDisable || cfg.Dashboard || cfg.MuteToken != "" || cfg.CAP
+}
+
+func healthMaxAge(cfg *Config) time.Duration {
+	poll := cfg.PollInterval
+	if poll <= 0 {
+		poll = 30 * time.Second
+	}
+	return 3 * poll
+}
+
+func healthHeartbeat(cfg *Config, now time.Time) error {
+	path := heartbeatPath(cfg.statePath())
+	last, err := readHeartbeat(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("sem nenhum ciclo bem-sucedido (%s não existe)", path)
+	}
+	if err != nil {
+		return err
+	}
+	if age := now.Sub(last); age > healthMaxAge(cfg) {
+		return fmt.Errorf("último ciclo bem-sucedido há %s", age.Round(time.Second))
+	}
+	return nil
+}
+
+// healthHTTP asks the local /readyz, with the credentials the server
+// requires.
+func healthHTTP(cfg *Config) error {
+	u, client, err := localServerURL(cfg, "/readyz")
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	switch {
+	case cfg.HTTPAuthToken != "":
+		req.Header.Set("Authorization", "Bearer "+cfg.HTTPAuthToken)
+	case cfg.HTTPBasicUser != "":
+		req.SetBasicAuth(cfg.HTTPBasicUser, cfg.HTTPBasicPass)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var st readyStatus
+	_ = json.NewDecoder(resp.Body).Decode(&st)
+	if resp.StatusCode != http.StatusOK {
+		if st.LastError != "" {
+			return fmt.Errorf("/readyz: %s: %s", resp.Status, st.LastError)
+		}
+		return fmt.Errorf("/readyz: %s", resp.Status)
+	}
+	return nil
+}
+
+// localServerURL is the URL of path on this configuration's HTTP server and
+// a client for it. A wildcard METRICS_ADDR is reached on the loopback; with
+// METRICS_TLS_CERT the certificate is not verified, since it is issued for
+// the public name.
+func localServerURL(cfg *Config, path string) (string, *http.Client, error) {
+	host, port, err := net.SplitHostPort(cfg.MetricsAddr)
+	if err != nil {
+		return "", nil, fmt.Errorf("METRICS_ADDR inválido: %w", err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	scheme := "http"
+	client := &http.Client{Timeout: 5 * time.Second}
+	if cfg.MetricsTLSCert != "" {
+		scheme = "https"
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	return scheme + "://" + net.JoinHostPort(host, port) + path, client, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requireAuth wraps the HTTP server so every route except /healthz needs
+// HTTP_AUTH_TOKEN or HTTP_BASIC_USER/PASS. /metrics is left open with
+// METRICS_PUBLIC, and the mute endpoints check MUTE_TOKEN themselves (the ntfy
+// action only carries that one). METRICS_BASIC_USER/PASS guard /metrics on
+// their own, whatever METRICS_PUBLIC says; the general credentials are
+// accepted there too. With no credential set h is returned unchanged.
+func requireAuth(h http.Handler, cfg *Config) http.Handler {
+	general := cfg.HTTPAuthToken != "" || cfg.HTTPBasicUser != ""
+	if !general && cfg.MetricsBasicUser == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Path
+		if p == "/metrics" && cfg.MetricsBasicUser != "" {
+			if basicAuthOK(r, cfg.MetricsBasicUser, cfg.MetricsBasicPass) || authorized(r, cfg) {
+				h.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="bombeiros-metrics", charset="UTF-8"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		open := !general || p == "/healthz" ||
+			(p == "/metrics" && cfg.MetricsPublic) ||
+			(cfg.MuteToken != "" && strings.HasPrefix(p, "/api/incidents/") &&
+				(strings.HasSuffix(p, "/mute") || strings.HasSuffix(p, "/unmute")))
+		if open || authorized(r, cfg) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if cfg.HTTPBasicUser != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="bombeiros-monitor", charset="UTF-8"`)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+}
+
+func authorized(r *http.Request, cfg *Config) bool {
+	if cfg.HTTPAuthToken != "" && validToken(r, cfg.HTTPAuthToken) {
+		return true
+	}
+	if cfg.HTTPBasicUser != "" {
+		return basicAuthOK(r, cfg.HTTPBasicUser, cfg.HTTPBasicPass)
+	}
+	return false
+}
+
+// basicAuthOK checks the request's basic auth against user and pass.
+func basicAuthOK(r *http.Request, user, pass string) bool {
+	u, p, ok := r.BasicAuth()
+	// Compare both halves so the timing does not reveal which one was wrong.
+	uok := subtle.ConstantTimeCompare([]byte(u), []byte(user))
+	pok := subtle.ConstantTimeCompare([]byte(p), []byte(pass))
+	return ok && uok&pok == 1
+}
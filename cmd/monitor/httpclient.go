@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// weatherTimeout caps the Open-Meteo request: the weather line is optional.
+const weatherTimeout = 4 * time.Second
+
+// newHTTPTransport builds the transport shared by every outgoing request
+// (fogos.pt, ntfy, IPMA, Open-Meteo, Grafana). Proxies come from
+// HTTPS_PROXY/HTTP_PROXY/NO_PROXY; HTTP_CA_FILE is trusted on top of the
+// system roots.
+func newHTTPTransport(c *Config) (*http.Transport, error) {
+	tlsConf := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.HTTPCAFile != "" {
+		pem, err := os.ReadFile(c.HTTPCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("HTTP_CA_FILE: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("HTTP_CA_FILE=%q: nenhum certificado PEM válido", c.HTTPCAFile)
+		}
+		tlsConf.RootCAs = pool
+	}
+	tlsConf.InsecureSkipVerify = c.InsecureSkipVerify
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSClientConfig:       tlsConf,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		// The feed host is hit every POLL_SECONDS: keep its connection
+		// open between polls instead of redoing the TLS handshake.
+		MaxIdleConns:        20,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+	}, nil
+}
+
+// setupHTTPClients builds c.httpClient and c.weatherClient on a new transport.
+func (c *Config) setupHTTPClients() error {
+	tr, err := newHTTPTransport(c)
+	if err != nil {
+		return err
+	}
+	c.useTransport(tr)
+	return nil
+}
+
+func (c *Config) useTransport(tr *http.Transport) {
+	c.useRoundTripper(tr)
+	c.httpTransport = tr
+}
+
+// useRoundTripper sends every outgoing request (feed, detail, ntfy, IPMA,
+// Open-Meteo) through rt instead of the network, as with an httptest
+// server's Client().Transport. A reload builds a real transport again.
+func (c *Config) useRoundTripper(rt http.RoundTripper) {
+	timeout := time.Duration(c.HTTPTimeoutSeconds) * time.Second
+	c.httpTransport = nil // nothing to keep or close on reload
+	c.httpClient = &http.Client{Transport: rt, Timeout: timeout}
+	c.weatherClient = &http.Client{Transport: rt, Timeout: min(timeout, weatherTimeout)}
+}
+
+// keepHTTPTransport is called on reload: when the TLS options did not change
+// the running transport is kept so its pooled connections survive; otherwise
+// the old one's idle connections are closed.
+func (c *Config) keepHTTPTransport(old *Config) {
+	if old.httpTransport == nil {
+		return
+	}
+	if old.HTTPCAFile == c.HTTPCAFile && old.InsecureSkipVerify == c.InsecureSkipVerify {
+		c.useTransport(old.httpTransport)
+		return
+	}
+	old.httpTransport.CloseIdleConnections()
+}
+
+// warnInsecureTLS logs, loudly, that certificates are not being checked.
+func warnInsecureTLS(cfg *Config) {
+	if cfg.InsecureSkipVerify {
+		slog.Warn("INSECURE_SKIP_VERIFY=1: certificados TLS NÃO são verificados; qualquer intermediário pode ler e alterar o tráfego (API, ntfy). Usar só para diagnóstico; preferir HTTP_CA_FILE")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Connections used by doGet, for bombeiros_http_conn_reuse_ratio.
+var traceConns, traceReused atomic.Int64
+
+// requestTrace times the phases of one request. The callbacks can run on
+// other goroutines (parallel dials), hence the mutex.
+type requestTrace struct {
+	mu       sync.Mutex
+	dns      time.Time
+	connect  map[string]time.Time // by address; dials can race
+	tls      time.Time
+	wrote    time.Time
+	gotFirst bool
+}
+
+// withTrace attaches an httptrace.ClientTrace that feeds the
+// bombeiros_http_* histograms. Without metrics the request is left alone.
+func withTrace(cfg *Config, req *http.Request) *http.Request {
+	if cfg.MetricsDisable {
+		return req
+	}
+	t := &requestTrace{connect: map[string]time.Time{}}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dns = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if info.Err == nil && !t.dns.IsZero() {
+				httpDNSDuration.Observe(time.Since(t.dns).Seconds())
+			}
+		},
+		ConnectStart: func(network, addr string) {
+			t.mu.Lock()
+			t.connect[network+" "+addr] = time.Now()
+			t.mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if start, ok := t.connect[network+" "+addr]; ok && err == nil {
+				httpConnectDuration.Observe(time.Since(start).Seconds())
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tls = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if err == nil && !t.tls.IsZero() {
+				httpTLSDuration.Observe(time.Since(t.tls).Seconds())
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			n := traceConns.Add(1)
+			r := traceReused.Load()
+			if info.Reused {
+				r = traceReused.Add(1)
+			}
+			httpConnReuseRatio.Set(float64(r) / float64(n))
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.mu.Lock()
+			t.wrote = time.Now()
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if !t.gotFirst && !t.wrote.IsZero() {
+				t.gotFirst = true
+				httpTTFBDuration.Observe(time.Since(t.wrote).Seconds())
+			}
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
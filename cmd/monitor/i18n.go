@@ -0,0 +1,388 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// messages holds the notification and summary texts per language, keyed by
+// message ID. Values are fmt formats. "pt" is the reference: a language
+// missing a key falls back to it. Adding a language means adding a map here
+// with the same keys and verbs (`check` reports any mismatch).
+var messages = map[string]map[string]string{
+	"pt": {
+		"new.title":         "Novo em %s — %s",
+		"new.body":          "ID: %s\nMunicípio: %s\nEstado: %s\nMeios: %s",
+		"new.many":          "Novos incidentes (%d)",
+		"total.active":      "Total ativo no alvo: %d",
+		"status.new":        "Novo",
+		"status.body":       "ID: %s\nMeios: %s",
+		"status.reactive":   "Reativado: %s",
+		"status.reactive.n": "Reativado (%dª vez): %s",
+		"status.many":       "Mudanças de estado (%d)",
+		"means.title":       "Atualização de meios — %s",
+		"means.summary":     "Operacionais=%s, Terrestres=%s, Aéreos=%s, Aquáticos=%s",
+		"means.aircraft":    "Aeronaves: Combate=%s, Coordenação=%s, Aviões=%s",
+		"means.man":         "Operacionais: %d → %d",
+		"means.terrain":     "Terrestres: %d → %d",
+		"means.aerial":      "Aéreos: %d → %d",
+		"means.aquatic":     "Aquáticos: %d → %d",
+		"md.kind":           "Meio",
+		"md.before":         "Antes",
+		"md.after":          "Agora",
+		"md.man":            "Operacionais",
+		"md.terrain":        "Terrestres",
+		"md.aerial":         "Aéreos",
+		"md.aquatic":        "Aquáticos",
+		"extra.title":       "Atualização — %s",
+		"extra.body":        "ID: %s\nExtra: %s",
+		"extra.line":        "Extra: %s",
+		"extra.changes":     "ID: %s\nExtra alterado:\n%s",
+		"road.closed":       "%[2]s cortadas (%[3]s)",
+		"road.closed.1":     "%[2]s cortada (%[3]s)",
+		"road.open":         "%[2]s reabertas",
+		"road.open.1":       "%[2]s reaberta",
+		"list.and":          " e ",
+		"important.on":      "Marcado como importante — %s",
+		"important.off":     "Deixou de estar marcado como importante — %s",
+		"important.line":    "Marcado como importante",
+		"backlog.title":     "%d notificações agrupadas",
+		"backlog.title.1":   "%d notificação em espera",
+		"backlog.more":      "… e mais %d",
+		"icnf.area":         "Área ardida (ICNF): %.1f ha",
+		"icnf.mato":         "mato %.1f",
+		"icnf.forest":       "povoamento %.1f",
+		"icnf.farm":         "agrícola %.1f",
+		"icnf.cause":        "Causa (ICNF): %s",
+		"icnf.fogacho":      "Fogacho (ICNF)",
+		"icnf.title":        "Área ardida — %s: %.1f ha",
+		"icnf.prev":         "Antes: %.1f ha",
+		"moved.title":       "Localização atualizada (+%.1f km) — %s",
+		"moved.coords":      "Coordenadas: %.5f, %.5f",
+		"icnf.summary":      "Área ardida (ICNF): %[2].1f ha em %[1]d ocorrências",
+		"icnf.summary.1":    "Área ardida (ICNF): %[2].1f ha em %[1]d ocorrência",
+		"area.line":         "Área: %.2f km², Perímetro: %.1f km",
+		"area.url":          "Área URL: ",
+		"fogos.line":        "Fogos: %s",
+		"anepc.prefix":      "Ocorrência ANEPC: ",
+		"coords.swapped":    "Coordenadas corrigidas (latitude e longitude vinham trocadas)",
+		"distance.line":     "Distância: %.1f km a %s",
+		"weather.line":      "Meteo: %.0f°C, HR %.0f%%, vento %.0f km/h %s",
+		"ipma.line":         "Risco de incêndio (IPMA): %s",
+		"ipma.heading":      "Risco de incêndio (IPMA):",
+		"rcm.1":             "Reduzido",
+		"rcm.2":             "Moderado",
+		"rcm.3":             "Elevado",
+		"rcm.4":             "Muito Elevado",
+		"rcm.5":             "Máximo",
+		"info.localidade":   "Localidade: %s",
+		"info.detail":       "Detalhe: %s",
+		"info.freguesia":    "Freguesia: %s",
+		"info.dico":         "DICO: %s",
+		"info.regiao":       "Região: %s / %s",
+		"info.updated":      "Atualizado: %s",
+		"info.firerisk":     "Risco de incêndio: %s",
+		"info.altitude":     "Altitude: %.0f m",
+		"info.near":         "Perto de: %s (%.1f km)",
+		"info.source":       "Fonte: %s",
+		"time.now":          "agora",
+		"time.ago":          "há %dm",
+		"summary.hourly":    "Sumário horário (%02d:00)",
+		"summary.daily":     "Sumário diário (%s)",
+		"summary.ondemand":  "Sumário (%s)",
+		"summary.active":    "Ativos: %d",
+		"summary.groups":    "Concelhos: %s\nNatureza: %s\nEstados: %s",
+		"summary.none":      "(n/a)",
+		"summary.means":     "Meios: %d operacionais, %d veículos, %d aéreos",
+		"summary.aquatic":   ", %d aquáticos",
+		"summary.byconc":    "Operacionais por concelho: %s",
+		"summary.conc.man":  "%s: %d",
+		"despacho.median":   "Tempo mediano em Despacho: %[2]s (%[1]d ocorrências)",
+		"despacho.median.1": "Tempo em Despacho: %[2]s (%[1]d ocorrência)",
+		"timeline.line":     "Cronologia: %s",
+		"means.max":         "Máximo: %d op., %d veículos, %d meios aéreos",
+		"means.max.aquatic": ", %d meios aquáticos",
+		"means.trend":       "Op. (2 h): %s %s",
+		"weekly.title":      "Sumário semanal (%s – %s)",
+		"weekly.total":      "Ocorrências: %d",
+		"weekly.bymuni":     "Concelhos: %s",
+		"weekly.bynat":      "Natureza: %s",
+		"weekly.concluded":  "Concluídas: %d",
+		"weekly.ttc":        "Tempo até conclusão: média %s, p90 %s",
+		"weekly.largest":    "Maior área: %.2f km² — %s (%s)",
+		"weekly.peak":       "Pico de ativos em simultâneo: %d",
+		"weekly.muni":       "Concelho",
+		"weekly.nat":        "Natureza",
+		"weekly.count":      "Ocorrências",
+		"digest.title":      "Fim das horas de silêncio",
+		"digest.lead":       "Durante a noite: %s",
+		"digest.new":        "%d novos incidentes",
+		"digest.new.1":      "%d novo incidente",
+		"digest.status":     "%d transições de estado",
+		"digest.status.1":   "%d transição de estado",
+		"digest.done":       "%d concluídos",
+		"digest.done.1":     "%d concluído",
+		"digest.updates":    "%d outras atualizações",
+		"digest.updates.1":  "%d outra atualização",
+		"digest.more":       "… e mais %d",
+		"digest.calm.title": "Noite calma",
+		"digest.calm.body":  "Sem alterações entre as %02d:00 e as %02d:00.",
+		"action.map":        "Abrir Mapa",
+		"action.fogos":      "Abrir Fogos",
+		"action.area":       "Abrir área",
+		"action.mute":       "Silenciar",
+		"action.share":      "Partilhar",
+		"share.man":         "%d op.",
+		"share.heli":        "%d heli",
+		"share.plane":       "%[1]d aviões",
+		"share.plane.1":     "%[1]d avião",
+		"feed.down.title":   "Feed fogos.pt indisponível há %dm",
+		"feed.down.body":    "Falhas consecutivas: %d\nÚltimo erro: %v",
+		"feed.up.title":     "Feed recuperado",
+		"feed.up.body":      "fogos.pt voltou a responder após %dm indisponível",
+		"schema.title":      "Possível alteração da API: campo '%s' ausente",
+		"schema.body":       "O campo '%s' falta em mais de %d%% das ocorrências há %d leituras seguidas. Meios, estados ou filtros podem estar errados.",
+		"panic.title":       "Erro interno no monitor",
+		"panic.body":        "Ciclo abortado: %v\nO monitor continua a correr.",
+		"reload.ok":         "Configuração recarregada",
+		"state.recovered":   "Ficheiro de estado danificado",
+		"state.rec.body":    "%s: %v.\nEstado recuperado de %s; as alterações mais recentes podem ter sido perdidas. Verifique o disco.",
+		"reload.ok.body":    "Municípios: %s",
+		"reload.fail":       "Configuração rejeitada",
+		"reload.fail.body":  "Mantida a configuração anterior.\nErro: %s",
+		"test.started":      "[teste] monitor iniciado",
+		"selftest.body":     "Autoteste de entrega %[1]s; pode ignorar",
+		"test.new":          "[teste] Sertã: Incêndio Rural (Em Curso)",
+		"test.new.body":     "Hora: %s\nLocal: Cernache do Bonjardim\nMeios: 12 operacionais, 3 terrestres, 1 aéreo",
+		"test.status":       "[teste] Sertã: Em Curso → Em Resolução",
+		"test.time":         "Hora: %s",
+		"test.means":        "[teste] Sertã: meios atualizados",
+		"test.means.body":   "Operacionais: 12 → 20\nAéreos: 1 → 2",
+		"test.extra":        "[teste] Sertã: atualização",
+		"test.extra.body":   "Extra: reacendimento controlado",
+		"test.summary":      "[teste] Sumário horário",
+		"test.summary.body": "Sertã: 1 ativa\nOleiros: 0 ativas",
+		"test.monitor":      "[teste] monitor",
+	},
+	"en": {
+		"new.title":         "New in %s — %s",
+		"new.body":          "ID: %s\nMunicipality: %s\nStatus: %s\nResources: %s",
+		"new.many":          "New incidents (%d)",
+		"total.active":      "Total active in the area: %d",
+		"status.new":        "New",
+		"status.body":       "ID: %s\nResources: %s",
+		"status.reactive":   "Reactivated: %s",
+		"status.reactive.n": "Reactivated (%d times): %s",
+		"status.many":       "Status changes (%d)",
+		"means.title":       "Resources update — %s",
+		"means.summary":     "Personnel=%s, Ground=%s, Aerial=%s, Water=%s",
+		"means.aircraft":    "Aircraft: Firefighting=%s, Coordination=%s, Planes=%s",
+		"means.man":         "Personnel: %d → %d",
+		"means.terrain":     "Ground: %d → %d",
+		"means.aerial":      "Aerial: %d → %d",
+		"means.aquatic":     "Water: %d → %d",
+		"md.kind":           "Resource",
+		"md.before":         "Before",
+		"md.after":          "Now",
+		"md.man":            "Personnel",
+		"md.terrain":        "Ground",
+		"md.aerial":         "Aerial",
+		"md.aquatic":        "Water",
+		"extra.title":       "Update — %s",
+		"extra.body":        "ID: %s\nExtra: %s",
+		"extra.line":        "Extra: %s",
+		"extra.changes":     "ID: %s\nExtra changed:\n%s",
+		"road.closed":       "%[2]s closed (%[3]s)",
+		"road.closed.1":     "%[2]s closed (%[3]s)",
+		"road.open":         "%[2]s reopened",
+		"road.open.1":       "%[2]s reopened",
+		"list.and":          " and ",
+		"important.on":      "Marked important — %s",
+		"important.off":     "No longer marked important — %s",
+		"important.line":    "Marked important",
+		"backlog.title":     "%d notifications grouped",
+		"backlog.title.1":   "%d notification waiting",
+		"backlog.more":      "… and %d more",
+		"icnf.area":         "Burned area (ICNF): %.1f ha",
+		"icnf.mato":         "shrubland %.1f",
+		"icnf.forest":       "forest %.1f",
+		"icnf.farm":         "farmland %.1f",
+		"icnf.cause":        "Cause (ICNF): %s",
+		"icnf.fogacho":      "Small fire (ICNF fogacho)",
+		"icnf.title":        "Burned area — %s: %.1f ha",
+		"icnf.prev":         "Before: %.1f ha",
+		"moved.title":       "Location updated (+%.1f km) — %s",
+		"moved.coords":      "Coordinates: %.5f, %.5f",
+		"icnf.summary":      "Burned area (ICNF): %[2].1f ha in %[1]d incidents",
+		"icnf.summary.1":    "Burned area (ICNF): %[2].1f ha in %[1]d incident",
+		"area.line":         "Area: %.2f km², Perimeter: %.1f km",
+		"area.url":          "Area URL: ",
+		"fogos.line":        "Fogos: %s",
+		"anepc.prefix":      "ANEPC occurrence: ",
+		"coords.swapped":    "Coordinates corrected (latitude and longitude came swapped)",
+		"distance.line":     "Distance: %.1f km %s",
+		"weather.line":      "Weather: %.0f°C, RH %.0f%%, wind %.0f km/h %s",
+		"ipma.line":         "Fire risk (IPMA): %s",
+		"ipma.heading":      "Fire risk (IPMA):",
+		"rcm.1":             "Low",
+		"rcm.2":             "Moderate",
+		"rcm.3":             "High",
+		"rcm.4":             "Very High",
+		"rcm.5":             "Maximum",
+		"info.localidade":   "Locality: %s",
+		"info.detail":       "Detail: %s",
+		"info.freguesia":    "Parish: %s",
+		"info.dico":         "DICO: %s",
+		"info.regiao":       "Region: %s / %s",
+		"info.updated":      "Updated: %s",
+		"info.firerisk":     "Fire risk: %s",
+		"info.altitude":     "Altitude: %.0f m",
+		"info.near":         "Near: %s (%.1f km)",
+		"info.source":       "Source: %s",
+		"time.now":          "now",
+		"time.ago":          "%dm ago",
+		"summary.hourly":    "Hourly summary (%02d:00)",
+		"summary.daily":     "Daily summary (%s)",
+		"summary.ondemand":  "Summary (%s)",
+		"summary.active":    "Active: %d",
+		"summary.groups":    "Municipalities: %s\nType: %s\nStatus: %s",
+		"summary.none":      "(n/a)",
+		"summary.means":     "Means: %d personnel, %d vehicles, %d aircraft",
+		"summary.aquatic":   ", %d boats",
+		"summary.byconc":    "Personnel by municipality: %s",
+		"summary.conc.man":  "%s: %d",
+		"despacho.median":   "Median time in Despacho: %[2]s (%[1]d incidents)",
+		"despacho.median.1": "Time in Despacho: %[2]s (%[1]d incident)",
+		"timeline.line":     "Timeline: %s",
+		"means.max":         "Peak: %d personnel, %d vehicles, %d aircraft",
+		"means.max.aquatic": ", %d boats",
+		"means.trend":       "Personnel (2 h): %s %s",
+		"weekly.title":      "Weekly summary (%s – %s)",
+		"weekly.total":      "Incidents: %d",
+		"weekly.bymuni":     "Municipalities: %s",
+		"weekly.bynat":      "Type: %s",
+		"weekly.concluded":  "Concluded: %d",
+		"weekly.ttc":        "Time to conclusion: mean %s, p90 %s",
+		"weekly.largest":    "Largest area: %.2f km² — %s (%s)",
+		"weekly.peak":       "Peak simultaneous active: %d",
+		"weekly.muni":       "Municipality",
+		"weekly.nat":        "Type",
+		"weekly.count":      "Incidents",
+		"digest.title":      "Quiet hours over",
+		"digest.lead":       "Overnight: %s",
+		"digest.new":        "%d new incidents",
+		"digest.new.1":      "%d new incident",
+		"digest.status":     "%d status changes",
+		"digest.status.1":   "%d status change",
+		"digest.done":       "%d concluded",
+		"digest.done.1":     "%d concluded",
+		"digest.updates":    "%d other updates",
+		"digest.updates.1":  "%d other update",
+		"digest.more":       "… and %d more",
+		"digest.calm.title": "Quiet night",
+		"digest.calm.body":  "No changes between %02d:00 and %02d:00.",
+		"action.map":        "Open map",
+		"action.fogos":      "Open Fogos",
+		"action.area":       "Open area",
+		"action.mute":       "Mute",
+		"action.share":      "Share",
+		"share.man":         "%d ff.",
+		"share.heli":        "%d heli",
+		"share.plane":       "%[1]d planes",
+		"share.plane.1":     "%[1]d plane",
+		"feed.down.title":   "fogos.pt feed down for %dm",
+		"feed.down.body":    "Consecutive failures: %d\nLast error: %v",
+		"feed.up.title":     "Feed recovered",
+		"feed.up.body":      "fogos.pt is responding again after %dm down",
+		"schema.title":      "Possible API change: field '%s' missing",
+		"schema.body":       "Field '%s' has been missing from over %d%% of incidents for %d polls in a row. Means, statuses or filters may be wrong.",
+		"panic.title":       "Internal monitor error",
+		"panic.body":        "Cycle aborted: %v\nThe monitor keeps running.",
+		"reload.ok":         "Configuration reloaded",
+		"state.recovered":   "State file damaged",
+		"state.rec.body":    "%s: %v.\nState recovered from %s; the latest changes may be lost. Check the disk.",
+		"reload.ok.body":    "Municipalities: %s",
+		"reload.fail":       "Configuration rejected",
+		"reload.fail.body":  "Previous configuration kept.\nError: %s",
+		"test.started":      "[test] monitor started",
+		"selftest.body":     "Delivery self-test %[1]s; safe to ignore",
+		"test.new":          "[test] Sertã: Rural fire (Em Curso)",
+		"test.new.body":     "Time: %s\nPlace: Cernache do Bonjardim\nResources: 12 personnel, 3 ground, 1 aerial",
+		"test.status":       "[test] Sertã: Em Curso → Em Resolução",
+		"test.time":         "Time: %s",
+		"test.means":        "[test] Sertã: resources updated",
+		"test.means.body":   "Personnel: 12 → 20\nAerial: 1 → 2",
+		"test.extra":        "[test] Sertã: update",
+		"test.extra.body":   "Extra: controlled rekindle",
+		"test.summary":      "[test] Hourly summary",
+		"test.summary.body": "Sertã: 1 active\nOleiros: 0 active",
+		"test.monitor":      "[test] monitor",
+	},
+}
+
+// normLang maps BOMBEIROS_LANG values such as "en_GB.UTF-8" to a
+// catalog; anything unknown uses Portuguese.
+func normLang(v string) string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if i := strings.IndexAny(v, "_-.@"); i >= 0 {
+		v = v[:i]
+	}
+	if _, ok := messages[v]; ok {
+		return v
+	}
+	return "pt"
+}
+
+// tr formats message key in the configured language.
+func tr(key string, args ...any) string {
+	f, ok := messages[conf().lang][key]
+	if !ok {
+		f = messages["pt"][key]
+	}
+	if len(args) == 0 {
+		return f
+	}
+	return fmt.Sprintf(f, args...)
+}
+
+// trn is tr with n as the first argument, using the "<key>.1" form when n is 1.
+func trn(key string, n int, args ...any) string {
+	if n == 1 {
+		key += ".1"
+	}
+	return tr(key, append([]any{n}, args...)...)
+}
+
+var fmtVerbRe = regexp.MustCompile(`%[-+# 0]*[0-9]*(?:\.[0-9]+)?[a-zA-Z%]`)
+
+// catalogProblems lists keys missing from a language and formats whose verbs
+// differ from the Portuguese reference.
+func catalogProblems() []string {
+	var out []string
+	ref := messages["pt"]
+	for lang, m := range messages {
+		if lang == "pt" {
+			continue
+		}
+		for key, f := range ref {
+			g, ok := m[key]
+			if !ok {
+				out = append(out, fmt.Sprintf("%s: falta %q", lang, key))
+				continue
+			}
+			if !slices.Equal(fmtVerbRe.FindAllString(f, -1), fmtVerbRe.FindAllString(g, -1)) {
+				out = append(out, fmt.Sprintf("%s: %q com verbos diferentes de pt", lang, key))
+			}
+		}
+		for key := range m {
+			if _, ok := ref[key]; !ok {
+				out = append(out, fmt.Sprintf("%s: %q não existe em pt", lang, key))
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCatalogMatchesPortuguese(t *testing.T) {
+	for _, p := range catalogProblems() {
+		t.Error(p)
+	}
+}
+
+func TestCatalogVerbMismatch(t *testing.T) {
+	messages["xx"] = map[string]string{}
+	defer delete(messages, "xx")
+	for key, f := range messages["pt"] {
+		messages["xx"][key] = f
+	}
+	messages["xx"]["feed.down.body"] = "%s failures: %d"
+
+	got := catalogProblems()
+	if len(got) != 1 || !strings.Contains(got[0], `"feed.down.body"`) {
+		t.Errorf("catalogProblems() = %q, want one verb mismatch for feed.down.body", got)
+	}
+}
+
+func TestNormLang(t *testing.T) {
+	for in, want := range map[string]string{
+		"":            "pt",
+		"pt":          "pt",
+		"PT_pt":       "pt",
+		"en":          "en",
+		" en ":        "en",
+		"en_GB.UTF-8": "en",
+		"en-US":       "en",
+		"en@euro":     "en",
+		"de_DE.UTF-8": "pt",
+		"C":           "pt",
+	} {
+		if got := normLang(in); got != want {
+			t.Errorf("normLang(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLangIgnoresSystemLocale(t *testing.T) {
+	t.Setenv("LANG", "en_GB.UTF-8")
+	cfg, _ := testConfig(t, map[string]string{"BOMBEIROS_LANG": ""})
+	if cfg.lang != "pt" {
+		t.Errorf("LANG=en_GB.UTF-8 switched the catalog to %q", cfg.lang)
+	}
+
+	cfg, _ = testConfig(t, map[string]string{"BOMBEIROS_LANG": "en"})
+	if cfg.lang != "en" || tr("feed.up.title") != messages["en"]["feed.up.title"] {
+		t.Errorf("BOMBEIROS_LANG=en: lang %q, tr %q", cfg.lang, tr("feed.up.title"))
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// burnedArea is the ICNF burned-area estimate in hectares.
+type burnedArea struct {
+	Total, Mato, Povoamento, Agricola float64
+}
+
+// icnfObject returns the "icnf" sub-object of the feed properties, if any.
+func icnfObject(p map[string]any) map[string]any {
+	m, _ := p["icnf"].(map[string]any)
+	return m
+}
+
+// icnfNumber reads a hectare figure sent as a number or as a string, with a
+// decimal point or comma.
+func icnfNumber(m map[string]any, keys ...string) float64 {
+	for _, k := range keys {
+		v, ok := m[k]
+		if !ok {
+			continue
+		}
+		if s, ok := v.(string); ok {
+			v = strings.Replace(strings.TrimSpace(s), ",", ".", 1)
+		}
+		if f, ok := toFloat(v); ok && f > 0 && !math.IsInf(f, 0) {
+			return f
+		}
+	}
+	return 0
+}
+
+// icnfBurnedArea parses the burned area, either nested under "burnArea" or
+// as flat area* fields. ok is false when nothing above zero was sent; a
+// missing total is the sum of the parts.
+func icnfBurnedArea(p map[string]any) (a burnedArea, ok bool) {
+	m := icnfObject(p)
+	if m == nil {
+		return a, false
+	}
+	if b, isMap := m["burnArea"].(map[string]any); isMap {
+		a = burnedArea{
+			Total:      icnfNumber(b, "total"),
+			Mato:       icnfNumber(b, "mato"),
+			Povoamento: icnfNumber(b, "povoamento"),
+			Agricola:   icnfNumber(b, "agricola", "agric"),
+		}
+	} else {
+		a = burnedArea{
+			Total:      icnfNumber(m, "areatotal", "area_total", "areaTotal"),
+			Mato:       icnfNumber(m, "areamato", "area_mato", "areaMato"),
+			Povoamento: icnfNumber(m, "areapov", "area_povoamento", "areaPovoamento"),
+			Agricola:   icnfNumber(m, "areaagric", "area_agricola", "areaAgricola"),
+		}
+	}
+	if a.Total == 0 {
+		a.Total = a.Mato + a.Povoamento + a.Agricola
+	}
+	return a, a.Total > 0
+}
+
+// line renders "Área ardida (ICNF): 12.4 ha (mato 10.1, povoamento 2.3)",
+// leaving out the parts that are zero.
+func (a burnedArea) line() string {
+	var parts []string
+	for _, x := range []struct {
+		key string
+		ha  float64
+	}{{"icnf.mato", a.Mato}, {"icnf.forest", a.Povoamento}, {"icnf.farm", a.Agricola}} {
+		if x.ha > 0 {
+			parts = append(parts, tr(x.key, x.ha))
+		}
+	}
+	s := tr("icnf.area", a.Total)
+	if len(parts) > 0 {
+		s += " (" + strings.Join(parts, ", ") + ")"
+	}
+	return s
+}
+
+// icnfCause joins the ICNF cause classification, most general first, e.g.
+// "Negligente — Queimadas". Empty until ICNF classifies the fire.
+func icnfCause(p map[string]any) string {
+	m := icnfObject(p)
+	if m == nil {
+		return ""
+	}
+	var parts []string
+	for _, k := range []string{"causafamilia", "tipocausa", "causa"} {
+		s := strings.TrimSpace(getPropStr(m, k))
+		if s == "" || s == "0" {
+			continue
+		}
+		dup := false
+		for _, q := range parts {
+			dup = dup || strings.EqualFold(q, s)
+		}
+		if !dup {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, " — ")
+}
+
+// burnedSince sums the latest ICNF burned area of the incidents that started,
+// concluded or were still active since from.
+func (ms *MonitorState) burnedSince(from time.Time) (ha float64, n int) {
+	for id, h := range ms.history {
+		if h.BurnedHa <= 0 {
+			continue
+		}
+		if !h.First.Before(from) || !h.Concluded.Before(from) || ms.isTracked(id) {
+			ha += h.BurnedHa
+			n++
+		}
+	}
+	return ha, n
+}
+
+// burnedEvent is an incident whose ICNF burned area first appeared or moved
+// by more than BURNED_AREA_DELTA_HA since the last message.
+type burnedEvent struct {
+	disp, id string
+	prev     float64
+	area     burnedArea
+	f        Feature
+}
+
+// burnedAreaChanged reports whether cur is worth a message against the last
+// notified total (0 = never notified).
+func burnedAreaChanged(prev, cur, delta float64) bool {
+	if prev == 0 {
+		return cur > 0
+	}
+	return math.Abs(cur-prev) > delta
+}
+
+func (ev burnedEvent) notification(cfg *Config) Notification {
+	p := ev.f.Properties
+	body := fmt.Sprintf("ID: %s\n%s", ev.id, ev.area.line())
+	if ev.prev > 0 {
+		body += "\n" + tr("icnf.prev", ev.prev)
+	}
+	if c := icnfCause(p); c != "" {
+		body += "\n" + tr("icnf.cause", c)
+	}
+	if isFireIncident(p) && ev.id != "" {
+		body += "\n" + tr("fogos.line", "https://fogos.pt/fogo/"+ev.id)
+	}
+	return Notification{
+		Type:       notifyBurned,
+		Title:      tr("icnf.title", ev.disp, ev.area.Total),
+		Body:       body,
+		Tags:       adjustTagsForNature(cfg.NtfyTags, p),
+		Priority:   "3",
+		Click:      mapsURLForFeature(ev.f, ev.disp),
+		IncidentID: ev.id,
+		Incidents:  []Feature{ev.f},
+	}
+}
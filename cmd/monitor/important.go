@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+)
+
+// isImportant reads the VOST "important" flag.
+func isImportant(p map[string]any) bool {
+	return truthy(p["important"])
+}
+
+// truthy reads a feed flag, which may come as a boolean, a string or a number.
+func truthy(v any) bool {
+	switch t := v.(type) {
+	case bool:
+		return t
+	case string:
+		s := strings.ToLower(strings.TrimSpace(t))
+		return s == "true" || s == "1"
+	}
+	f, ok := toFloat(v)
+	return ok && f != 0
+}
+
+// importantEvent is an incident gaining or losing the important flag.
+type importantEvent struct {
+	disp, id string
+	on       bool
+	f        Feature
+}
+
+// notification renders "Marcado como importante" (priority 5) or "Deixou de
+// estar marcado como importante" (priority 3).
+func (ev importantEvent) notification(cfg *Config) Notification {
+	p := ev.f.Properties
+	body := tr("status.body", ev.id, meansSummaryFromPropsPT(p))
+	if isFireIncident(p) && ev.id != "" {
+		body += "\n" + tr("fogos.line", "https://fogos.pt/fogo/"+ev.id)
+	}
+	n := Notification{Type: notifyImportant, Body: body, Click: mapsURLForFeature(ev.f, ev.disp), IncidentID: ev.id, Incidents: []Feature{ev.f}}
+	tags := adjustTagsForNature(cfg.NtfyTags, p)
+	if ev.on {
+		n.Title, n.Tags, n.Priority = tr("important.on", ev.disp), addTagsCSV(tags, tagFor("important")), "5"
+	} else {
+		n.Title, n.Tags, n.Priority = tr("important.off", ev.disp), tags, "3"
+	}
+	return n
+}
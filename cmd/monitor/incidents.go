@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// incidentView is the JSON shape of one filtered incident served over HTTP.
+type incidentView struct {
+	ID          string        `json:"id"`
+	Concelho    string        `json:"concelho"`
+	Freguesia   string        `json:"freguesia,omitempty"`
+	Natureza    string        `json:"natureza"`
+	Status      string        `json:"status"`
+	Means       Means         `json:"means"`
+	MaxMeans    *Means        `json:"maxMeans,omitempty"`
+	MeansHist   []meansSample `json:"meansHistory,omitempty"`
+	Coordinates *latLon       `json:"coordinates,omitempty"`
+	FirstSeen   string        `json:"firstSeen,omitempty"`
+	Updated     string        `json:"updated,omitempty"`
+	AgeMin      int           `json:"ageMinutes"`
+	FogosURL    string        `json:"fogosURL,omitempty"`
+	Perimeter   *geoPolygon   `json:"perimeter,omitempty"`
+	Timeline    []statusStep  `json:"timeline,omitempty"`
+	ClosedRoads []string      `json:"closedRoads,omitempty"`
+	Source      string        `json:"source,omitempty"`
+}
+
+type latLon struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// geoPolygon is a GeoJSON Polygon geometry.
+type geoPolygon struct {
+	Type        string         `json:"type"`
+	Coordinates [][][2]float64 `json:"coordinates"`
+}
+
+// incidentSnapshot holds the views from the last completed cycle. runOnce
+// publishes; HTTP handlers read. Requests never reach the upstream API.
+type incidentSnapshot struct {
+	mu    sync.RWMutex
+	views []incidentView
+	at    time.Time
+}
+
+var incidents = &incidentSnapshot{}
+
+func (s *incidentSnapshot) publish(views []incidentView, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.views, s.at = views, at
+}
+
+func (s *incidentSnapshot) get() ([]incidentView, time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.views, s.at
+}
+
+// buildIncidentViews runs at the end of runOnce, with ms unlocked; it reads
+// the state through the accessors.
+func buildIncidentViews(cfg *Config, ms *MonitorState, filtered []Feature, now time.Time) []incidentView {
+	views := make([]incidentView, 0, len(filtered))
+	for _, f := range filtered {
+		p := f.Properties
+		id := ms.CanonicalID(p)
+		v := incidentView{
+			ID:        id,
+			Concelho:  getMunicipio(p),
+			Freguesia: getPropStr(p, "freguesia"),
+			Natureza:  getPropStr(p, "natureza"),
+			Status:    getPropStr(p, "status"),
+			Means:     meansFromProps(p),
+			Source:    getPropStr(p, "source"),
+		}
+		if lat, lon, ok := getCoords(f.Geometry); ok {
+			v.Coordinates = &latLon{Lat: lat, Lon: lon}
+		}
+		if m, ok := p["updated"].(map[string]any); ok {
+			if sec, ok := toFloat(m["sec"]); ok && sec > 0 {
+				v.Updated = time.Unix(int64(sec), 0).UTC().Format(time.RFC3339)
+			}
+		}
+		if t, ok := ms.FirstSeen(id); ok {
+			v.FirstSeen = t.UTC().Format(time.RFC3339)
+			v.AgeMin = int(now.Sub(t).Minutes())
+		}
+		if m, ok := ms.MaxMeans(id); ok {
+			v.MaxMeans = &m
+		}
+		v.MeansHist = ms.MeansHistory(id)
+		v.Timeline = ms.Timeline(id)
+		v.ClosedRoads = ms.ClosedRoads(id)
+		if id != "" {
+			v.FogosURL = "https://fogos.pt/fogo/" + id
+			v.Perimeter = savedPerimeter(cfg.SaveKMLDir, id)
+		}
+		views = append(views, v)
+	}
+	return views
+}
+
+// savedPerimeter reads the KML saved for id under SAVE_KML_DIR, if any.
+func savedPerimeter(dir, id string) *geoPolygon {
+	if dir == "" {
+		return nil
+	}
+	b, err := os.ReadFile(filepath.Join(dir, id+".kml"))
+	if err != nil {
+		return nil
+	}
+	ring := kmlCoords(string(b))
+	if len(ring) < 3 {
+		return nil
+	}
+	if ring[0] != ring[len(ring)-1] {
+		ring = append(ring, ring[0])
+	}
+	return &geoPolygon{Type: "Polygon", Coordinates: [][][2]float64{ring}}
+}
+
+// registerIncidentAPI adds GET /api/incidents and /api/incidents/{id}, with
+// API_CACHE_CONTROL and API_CORS_ORIGIN applied to every /api/ response.
+func registerIncidentAPI(mux *http.ServeMux, cfg *Config) {
+	headers := func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if cfg.APICacheControl != "" {
+				w.Header().Set("Cache-Control", cfg.APICacheControl)
+			}
+			if cfg.APICORSOrigin != "" {
+				w.Header().Set("Access-Control-Allow-Origin", cfg.APICORSOrigin)
+				w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+				if cfg.APICORSOrigin != "*" {
+					w.Header().Add("Vary", "Origin")
+				}
+			}
+			h(w, r)
+		}
+	}
+	mux.HandleFunc("GET /api/incidents", headers(incidentsHandler))
+	mux.HandleFunc("GET /api/incidents/{id}", headers(incidentHandler))
+	mux.HandleFunc("OPTIONS /api/", headers(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+// incidentsHandler serves the last snapshot as a JSON array.
+func incidentsHandler(w http.ResponseWriter, r *http.Request) {
+	views, at := incidents.get()
+	if views == nil {
+		views = []incidentView{}
+	}
+	writeJSON(w, at, views)
+}
+
+// incidentHandler serves one incident of the last snapshot, or 404.
+func incidentHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	views, at := incidents.get()
+	for _, v := range views {
+		if v.ID == id {
+			writeJSON(w, at, v)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": "ocorrência não está ativa"})
+}
+
+func writeJSON(w http.ResponseWriter, at time.Time, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if !at.IsZero() {
+		w.Header().Set("Last-Modified", at.UTC().Format(http.TimeFormat))
+	}
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ipmaRCMURL is IPMA's open-data rural fire risk (RCM) forecast for today,
+// one class per concelho keyed by DICO.
+const ipmaRCMURL = "https://api.ipma.pt/open-data/forecast/meteorology/rcm/rcm-d0.json"
+
+const (
+	ipmaRefresh    = 6 * time.Hour
+	ipmaRetryAfter = 30 * time.Minute
+)
+
+// defaultDICO covers the default municipalities; others are learned from the
+// dico property of incidents in the feed.
+var defaultDICO = map[string]string{
+	"belmonte":          "0501",
+	"castelobranco":     "0502",
+	"covilha":           "0503",
+	"fundao":            "0504",
+	"idanhaanova":       "0505",
+	"oleiros":           "0506",
+	"penamacor":         "0507",
+	"proencaanova":      "0508",
+	"serta":             "0509",
+	"viladerei":         "0510",
+	"vilavelhaderodao":  "0511",
+	"pampilhosadaserra": "0612",
+	"castanheiradepera": "1007",
+	"figueirodosvinhos": "1008",
+	"pedrogaogrande":    "1013",
+	"ferreiradozezere":  "1411",
+	"sardoal":           "1417",
+}
+
+type ipmaRCM struct {
+	DataPrev string `json:"dataPrev"`
+	Local    map[string]struct {
+		Data struct {
+			RCM int `json:"rcm"`
+		} `json:"data"`
+	} `json:"local"`
+}
+
+// ipmaCacheFile is what is kept on disk next to STATE_FILE.
+type ipmaCacheFile struct {
+	Fetched time.Time         `json:"fetched"`
+	RCM     ipmaRCM           `json:"rcm"`
+	DICO    map[string]string `json:"dico"` // learned: normalized concelho -> DICO
+}
+
+// ipmaState is owned by the poll goroutine.
+type ipmaState struct {
+	path        string
+	loaded      bool
+	lastAttempt time.Time
+	cache       ipmaCacheFile
+}
+
+var ipma = &ipmaState{}
+
+func (s *ipmaState) load(path string) {
+	if s.loaded && s.path == path {
+		return
+	}
+	s.loaded, s.path = true, path
+	s.cache = ipmaCacheFile{DICO: map[string]string{}}
+	if b, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(b, &s.cache)
+	}
+	if s.cache.DICO == nil {
+		s.cache.DICO = map[string]string{}
+	}
+}
+
+func (s *ipmaState) save() {
+	b, _ := json.MarshalIndent(s.cache, "", "  ")
+	if err := os.WriteFile(s.path, b, 0644); err != nil {
+		slog.Warn("IPMA: erro a gravar cache", "path", s.path, "err", err)
+	}
+}
+
+// learn records the DICO of the incident's concelho, if the feed has it.
+func (s *ipmaState) learn(cfg *Config, p map[string]any) {
+	if !cfg.IPMARisk {
+		return
+	}
+	s.load(ipmaCachePath(cfg.statePath()))
+	dico := padDICO(getPropStr(p, "dico"))
+	muni := normMunicipio(getMunicipio(p))
+	if dico == "" || muni == "" || s.cache.DICO[muni] == dico {
+		return
+	}
+	s.cache.DICO[muni] = dico
+	s.save()
+}
+
+// risk returns today's RCM class (1–5) for a concelho, refreshing the
+// forecast when it is old. Without fresh data it reports ok=false.
+func (s *ipmaState) risk(cfg *Config, concelho string, now time.Time) (int, bool) {
+	if !cfg.IPMARisk {
+		return 0, false
+	}
+	s.load(ipmaCachePath(cfg.statePath()))
+	today := now.In(cfg.loc).Format("2006-01-02")
+	stale := s.cache.RCM.DataPrev != today || now.Sub(s.cache.Fetched) > ipmaRefresh
+	if stale && now.Sub(s.lastAttempt) > ipmaRetryAfter {
+		s.lastAttempt = now
+		if doc, err := fetchIPMARCM(cfg); err != nil {
+			slog.Warn("IPMA indisponível; risco de incêndio omitido", "err", err)
+		} else {
+			s.cache.RCM, s.cache.Fetched = doc, now
+			s.save()
+		}
+	}
+	if s.cache.RCM.DataPrev != today {
+		return 0, false
+	}
+	key := normMunicipio(concelho)
+	dico := s.cache.DICO[key]
+	if dico == "" {
+		dico = defaultDICO[key]
+	}
+	l, ok := s.cache.RCM.Local[dico]
+	if !ok || l.Data.RCM < 1 {
+		return 0, false
+	}
+	return l.Data.RCM, true
+}
+
+func fetchIPMARCM(cfg *Config) (ipmaRCM, error) {
+	var doc ipmaRCM
+	resp, err := cfg.httpClient.Get(ipmaRCMURL)
+	if err != nil {
+		return doc, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return doc, fmt.Errorf("http %d GET %s", resp.StatusCode, ipmaRCMURL)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return doc, err
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return doc, err
+	}
+	if doc.DataPrev == "" || len(doc.Local) == 0 {
+		return doc, fmt.Errorf("resposta IPMA sem dados")
+	}
+	return doc, nil
+}
+
+// rcmLabel names an RCM class as IPMA does.
+func rcmLabel(level int) string {
+	if level < 1 || level > 5 {
+		return "?"
+	}
+	return tr(fmt.Sprintf("rcm.%d", level))
+}
+
+// ipmaRiskLines lists today's class per monitored municipality for the daily summary.
+func ipmaRiskLines(cfg *Config, now time.Time) []string {
+	var lines []string
+	for _, m := range cfg.Municipios {
+		if l, ok := ipma.risk(cfg, m, now); ok {
+			lines = append(lines, fmt.Sprintf("%s: %s", m, rcmLabel(l)))
+		}
+	}
+	return lines
+}
+
+// bumpPriority raises an ntfy priority by one, up to 5.
+func bumpPriority(pr string) string {
+	n, err := strconv.Atoi(pr)
+	if err != nil || n >= 5 {
+		return pr
+	}
+	return strconv.Itoa(n + 1)
+}
+
+func ipmaCachePath(statePath string) string {
+	return strings.TrimSuffix(statePath, ".json") + "_ipma.json"
+}
+
+// padDICO reduces a dico/dicofre property to the 4-digit DICO.
+func padDICO(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s)%2 == 1 {
+		s = "0" + s // numeric values lose the leading zero
+	}
+	if len(s) < 4 {
+		return ""
+	}
+	return s[:4] // DICOFRE codes start with the DICO
+}
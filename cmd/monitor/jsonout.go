@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// runReport is the document written to stdout by `once --json`
+// (OUTPUT_JSON=1). Fields are only ever added, so scripts can rely on them.
+type runReport struct {
+	OK            bool                 `json:"ok"`            // false when the cycle failed
+	At            time.Time            `json:"at"`            // end of the cycle
+	Count         int                  `json:"count"`         // active incidents after filters
+	Municipios    map[string]int       `json:"municipios"`    // active incidents per municipality
+	NewIDs        []string             `json:"new_ids"`       // incidents seen for the first time
+	ChangedIDs    []string             `json:"changed_ids"`   // known incidents with a status, means or extra change
+	Notifications []notificationResult `json:"notifications"` // every notification attempted, in order
+	Errors        []string             `json:"errors"`        // cycle and notification errors
+}
+
+// notificationResult is one notification and what happened to it; Result
+// uses the bombeiros_notifications_total labels (ok, error, dryrun, muted…).
+type notificationResult struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	Server  string `json:"server,omitempty"`
+	Result  string `json:"result"`
+	Error   string `json:"error,omitempty"`
+}
+
+// report collects the current single-shot run; nil unless OUTPUT_JSON is on.
+var (
+	reportMu sync.Mutex
+	report   *runReport
+)
+
+func startRunReport() {
+	reportMu.Lock()
+	defer reportMu.Unlock()
+	report = &runReport{Municipios: map[string]int{}, NewIDs: []string{}, ChangedIDs: []string{}, Notifications: []notificationResult{}, Errors: []string{}}
+}
+
+// countNotification records a notification outcome decided before any
+// server was contacted (dry-run, filters, mutes...).
+func countNotification(typ, result string, err error) {
+	countDelivery("", typ, result, err)
+}
+
+// Notification channels, the channel label of bombeiros_notifications_total.
+const (
+	channelNtfy   = "ntfy"
+	channelGotify = "gotify"
+	channelEmail  = "email"
+)
+
+// countDelivery records an ntfy notification outcome. server is the ntfy
+// host, or empty when the message never reached one.
+func countDelivery(server, typ, result string, err error) {
+	countChannelDelivery(channelNtfy, server, typ, result, err)
+}
+
+// countChannelDelivery records a notification outcome in the metrics and,
+// when a run report is being collected, in the report.
+func countChannelDelivery(channel, server, typ, result string, err error) {
+	notificationsTotal.WithLabelValues(channel, server, typ, result).Inc()
+	reportMu.Lock()
+	defer reportMu.Unlock()
+	if report == nil {
+		return
+	}
+	r := notificationResult{Type: typ, Channel: channel, Server: server, Result: result}
+	if err != nil {
+		r.Error = err.Error()
+		report.Errors = append(report.Errors, typ+": "+r.Error)
+	}
+	report.Notifications = append(report.Notifications, r)
+}
+
+// reportCycle records the incidents of the cycle; IDs are deduplicated and sorted.
+func reportCycle(filtered []Feature, newIDs, changedIDs []string) {
+	reportMu.Lock()
+	defer reportMu.Unlock()
+	if report == nil {
+		return
+	}
+	report.Count = len(filtered)
+	for _, f := range filtered {
+		report.Municipios[getMunicipio(f.Properties)]++
+	}
+	clean := func(ids []string) []string {
+		ids = slices.DeleteFunc(append([]string{}, ids...), func(s string) bool { return s == "" })
+		slices.Sort(ids)
+		return slices.Compact(ids)
+	}
+	report.NewIDs = clean(newIDs)
+	report.ChangedIDs = slices.DeleteFunc(clean(changedIDs), func(id string) bool {
+		_, isNew := slices.BinarySearch(report.NewIDs, id)
+		return isNew
+	})
+}
+
+// writeRunReport finishes the report with the cycle error and writes it as
+// one JSON document.
+func writeRunReport(w io.Writer, cycleErr error) error {
+	reportMu.Lock()
+	defer reportMu.Unlock()
+	if report == nil {
+		return nil
+	}
+	report.At = conf().now().UTC()
+	report.OK = cycleErr == nil
+	if cycleErr != nil {
+		report.Errors = append(report.Errors, cycleErr.Error())
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// runWithReport runs one cycle collecting the OUTPUT_JSON report and returns
+// the document, decoded both generically and as runReport.
+func runWithReport(t *testing.T, cfg *Config, ms *MonitorState) (map[string]any, runReport) {
+	t.Helper()
+	startRunReport()
+	t.Cleanup(func() { report = nil })
+	_, err := runOnce(cfg, ms)
+	var buf bytes.Buffer
+	if werr := writeRunReport(&buf, err); werr != nil {
+		t.Fatal(werr)
+	}
+	// exactly one JSON document
+	dec := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatalf("report: %v\n%s", err, buf.Bytes())
+	}
+	if dec.More() {
+		t.Errorf("more than one document:\n%s", buf.Bytes())
+	}
+	var r runReport
+	strict := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+	strict.DisallowUnknownFields()
+	if err := strict.Decode(&r); err != nil {
+		t.Fatalf("report does not match runReport: %v", err)
+	}
+	return doc, r
+}
+
+// checkReportSchema checks the keys and JSON types of a report: every field
+// is always present, lists are [] rather than null.
+func checkReportSchema(t *testing.T, doc map[string]any) {
+	t.Helper()
+	want := map[string]string{
+		"ok": "bool", "at": "string", "count": "number", "municipios": "object",
+		"new_ids": "array", "changed_ids": "array", "notifications": "array", "errors": "array",
+	}
+	if got := slices.Sorted(maps.Keys(doc)); !slices.Equal(got, slices.Sorted(maps.Keys(want))) {
+		t.Errorf("keys %q", got)
+	}
+	for k, typ := range want {
+		if got := jsonType(doc[k]); got != typ {
+			t.Errorf("%s is %s, want %s", k, got, typ)
+		}
+	}
+	if at, ok := doc["at"].(string); ok {
+		if _, err := time.Parse(time.RFC3339, at); err != nil {
+			t.Errorf("at: %v", err)
+		}
+	}
+	notes, _ := doc["notifications"].([]any)
+	for _, n := range notes {
+		m, _ := n.(map[string]any)
+		for _, k := range []string{"type", "channel", "result"} {
+			if jsonType(m[k]) != "string" {
+				t.Errorf("notification without %s: %v", k, m)
+			}
+		}
+		for k := range m {
+			if !slices.Contains([]string{"type", "channel", "server", "result", "error"}, k) {
+				t.Errorf("notification with unknown key %s", k)
+			}
+		}
+	}
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case bool:
+		return "bool"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case nil:
+		return "null"
+	}
+	return "?"
+}
+
+func TestRunReportSchema(t *testing.T) {
+	cfg, srv, clk, ms := newTestMonitor(t, map[string]string{"OUTPUT_JSON": "1", "MUNICIPIOS": "Sertã,Oleiros"})
+
+	// nothing active: every list is still there
+	doc, r := runWithReport(t, cfg, ms)
+	checkReportSchema(t, doc)
+	if !r.OK || r.Count != 0 || len(r.Notifications) != 0 {
+		t.Errorf("empty feed: %+v", r)
+	}
+
+	clk.advance(time.Minute)
+	oleiros := incident("2025050002", "Despacho", 4)
+	oleiros["concelho"] = "Oleiros"
+	srv.setFeed(incident("2025050001", "Despacho", 8), oleiros)
+	doc, r = runWithReport(t, cfg, ms)
+	checkReportSchema(t, doc)
+	if r.Count != 2 || r.Municipios["Sertã"] != 1 || r.Municipios["Oleiros"] != 1 {
+		t.Errorf("count %d municipios %v", r.Count, r.Municipios)
+	}
+	if !slices.Equal(r.NewIDs, []string{"2025050001", "2025050002"}) || len(r.ChangedIDs) != 0 {
+		t.Errorf("new %q changed %q", r.NewIDs, r.ChangedIDs)
+	}
+	if len(r.Notifications) == 0 || r.Notifications[0].Channel != channelNtfy || r.Notifications[0].Result != "ok" || r.Notifications[0].Type != notifyNew {
+		t.Errorf("notifications %+v", r.Notifications)
+	}
+	if !r.At.Equal(clk.Now()) {
+		t.Errorf("at %v, want the clock's %v", r.At, clk.Now())
+	}
+	srv.take()
+
+	// ntfy fails: the notification and the error are both reported
+	clk.advance(time.Minute)
+	srv.Config.Handler = failingNtfy(srv.Config.Handler)
+	srv.setFeed(incident("2025050001", "Em Curso", 8), oleiros)
+	doc, r = runWithReport(t, cfg, ms)
+	checkReportSchema(t, doc)
+	if !slices.Equal(r.ChangedIDs, []string{"2025050001"}) || len(r.NewIDs) != 0 {
+		t.Errorf("new %q changed %q", r.NewIDs, r.ChangedIDs)
+	}
+	if len(r.Notifications) == 0 || r.Notifications[0].Result != "error" || r.Notifications[0].Error == "" || len(r.Errors) == 0 {
+		t.Errorf("failed notification: %+v errors %q", r.Notifications, r.Errors)
+	}
+	if !r.OK {
+		t.Error("a failed notification marked the cycle as failed")
+	}
+}
+
+// failingNtfy answers 500 to every POST and passes the rest to next.
+func failingNtfy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func TestRunReportCycleError(t *testing.T) {
+	testConfig(t, map[string]string{"OUTPUT_JSON": "1"})
+	startRunReport()
+	t.Cleanup(func() { report = nil })
+	var buf bytes.Buffer
+	if err := writeRunReport(&buf, errors.New("feed: 502")); err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	checkReportSchema(t, doc)
+	if doc["ok"] != false || !slices.Equal(doc["errors"].([]any), []any{"feed: 502"}) {
+		t.Errorf("failed cycle: %v", doc)
+	}
+}
+
+func TestRunReportOffWritesNothing(t *testing.T) {
+	report = nil
+	var buf bytes.Buffer
+	if err := writeRunReport(&buf, nil); err != nil || buf.Len() != 0 {
+		t.Errorf("without OUTPUT_JSON: %q, %v", buf.String(), err)
+	}
+}
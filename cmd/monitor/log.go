@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// setupLogging installs the default slog logger. LOG_LEVEL accepts
+// debug/info/warn/error (DEBUG=1 is kept as a shortcut for debug) and
+// LOG_FORMAT selects text (default) or json output. The log file, when open,
+// gets a copy of everything written to w.
+func setupLogging(w io.Writer, cfg *Config) {
+	level := slog.LevelInfo
+	switch strings.ToLower(cfg.LogLevel) {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	}
+	if cfg.Debug {
+		level = slog.LevelDebug
+	}
+	if logFile != nil {
+		w = io.MultiWriter(w, logFile)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	if strings.EqualFold(cfg.LogFormat, "json") {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	if logTee != nil {
+		h = teeHandler{h, logTee}
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+// logTee, when set, receives every record alongside the main handler (the
+// Windows service uses it to forward warnings and errors to the Event Log).
+var logTee slog.Handler
+
+// teeHandler fans records out to two handlers.
+type teeHandler struct{ a, b slog.Handler }
+
+func (t teeHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return t.a.Enabled(ctx, l) || t.b.Enabled(ctx, l)
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	if t.a.Enabled(ctx, r.Level) {
+		err = t.a.Handle(ctx, r.Clone())
+	}
+	if t.b.Enabled(ctx, r.Level) {
+		if err2 := t.b.Handle(ctx, r); err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+func (t teeHandler) WithAttrs(as []slog.Attr) slog.Handler {
+	return teeHandler{t.a.WithAttrs(as), t.b.WithAttrs(as)}
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	return teeHandler{t.a.WithGroup(name), t.b.WithGroup(name)}
+}
+
+func debugEnabled() bool {
+	return slog.Default().Enabled(context.Background(), slog.LevelDebug)
+}
+
+// Lightweight debug logger kept for the many ad-hoc call sites; structured
+// fields should go through slog.Debug directly.
+func debugf(format string, a ...any) {
+	if debugEnabled() {
+		slog.Debug(fmt.Sprintf(format, a...))
+	}
+}
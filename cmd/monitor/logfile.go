@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// logFile, when open, receives the same log stream as stderr. It is opened
+// once at startup (LOG_FILE, or monitor.log next to the executable when the
+// Windows console is hidden) and kept across reloads.
+var logFile *rotatingFile
+
+// logFilePath is where the log goes, or "" for no file.
+func logFilePath(cfg *Config, consoleHidden bool) string {
+	switch p := strings.TrimSpace(cfg.LogFile); {
+	case p == "-":
+		return ""
+	case p != "":
+		return p
+	case !consoleHidden:
+		return ""
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "monitor.log"
+	}
+	return filepath.Join(filepath.Dir(exe), "monitor.log")
+}
+
+// openLogFile opens the log file for cfg, if any. Call it before
+// setupLogging.
+func openLogFile(cfg *Config, consoleHidden bool) error {
+	path := logFilePath(cfg, consoleHidden)
+	if path == "" || logFile != nil {
+		return nil
+	}
+	f, err := openRotatingFile(path, int64(cfg.LogFileMaxMB)<<20, cfg.LogFileKeep)
+	if err != nil {
+		return fmt.Errorf("LOG_FILE: %w", err)
+	}
+	logFile = f
+	return nil
+}
+
+// rotatingFile is an append-only file that is renamed to path.1 (path.1 to
+// path.2, and so on up to keep) once a write would take it past max bytes.
+type rotatingFile struct {
+	mu   sync.Mutex
+	path string
+	max  int64
+	keep int
+	f    *os.File
+	size int64
+}
+
+func openRotatingFile(path string, max int64, keep int) (*rotatingFile, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	r := &rotatingFile{path: path, max: max, keep: keep}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, fi.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		// a failed rotation left no file; try again
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.size > 0 && r.size+int64(len(p)) > r.max {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the old files up by one and starts an empty one. The file
+// is closed first: Windows cannot rename an open file.
+func (r *rotatingFile) rotate() error {
+	r.f.Close()
+	r.f = nil
+	if r.keep == 0 {
+		_ = os.Remove(r.path)
+	} else {
+		_ = os.Remove(fmt.Sprintf("%s.%d", r.path, r.keep))
+		for i := r.keep - 1; i >= 1; i-- {
+			_ = os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		_ = os.Rename(r.path, r.path+".1")
+	}
+	return r.open()
+}
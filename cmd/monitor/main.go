@@ -3,30 +3,37 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"log/slog"
 	"math"
+	"math/big"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"runtime/debug"
 	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"context"
 	"runtime"
 	"unicode"
 
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/text/runes"
 	"golang.org/x/text/transform"
 	"golang.org/x/text/unicode/norm"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"os/signal"
 	"syscall"
 )
@@ -42,8 +49,10 @@ type FeatureCollection struct {
 	Features []Feature `json:"features"`
 }
 
+// ApiResponse is the api-dev envelope { success?: bool, data: ... }; data is
+// kept raw so toFeatures decodes it once, as whichever shape it turns out to be.
 type ApiResponse struct {
-	Data any `json:"data"`
+	Data json.RawMessage `json:"data"`
 }
 
 func getenv(key, def string) string {
@@ -53,9 +62,16 @@ func getenv(key, def string) string {
 	return def
 }
 
+// accentStrippers reuses the NFD → drop marks → NFC chain, which is costly
+// to build; a chain keeps state while running, so each call takes its own.
+var accentStrippers = sync.Pool{New: func() any {
+	return transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+}}
+
 // remove diacritics
 func stripAccents(s string) string {
-	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	t := accentStrippers.Get().(transform.Transformer)
+	defer accentStrippers.Put(t)
 	res, _, _ := transform.String(t, s)
 	return res
 }
@@ -97,23 +113,6 @@ var defaultMunicipios = []string{
 	"Covilhã",
 }
 
-func wantedMunicipiosFromEnv() []string {
-	v := getenv("MUNICIPIOS", getenv("MUNICIPIO", strings.Join(defaultMunicipios, ",")))
-	sep := ","
-	if strings.Contains(v, ";") {
-		sep = ";"
-	}
-	parts := strings.Split(v, sep)
-	out := make([]string, 0, len(parts))
-	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		if p != "" {
-			out = append(out, p)
-		}
-	}
-	return out
-}
-
 func makeWantedSet(names []string) (set map[string][]string, flat []string) {
 	set = map[string][]string{}
 	for _, n := range names {
@@ -134,7 +133,7 @@ func makeWantedSet(names []string) (set map[string][]string, flat []string) {
 	return
 }
 
-func defaultHeaders() http.Header {
+func defaultHeaders(cfg *Config) http.Header {
 	h := http.Header{}
 	h.Set("Accept", "application/json")
 	h.Set("User-Agent", "David-Bombeiros/0.3 (Go)")
@@ -142,48 +141,131 @@ func defaultHeaders() http.Header {
 	h.Set("Referer", "https://fogos.pt/")
 	h.Set("Origin", "https://fogos.pt")
 	h.Set("Cache-Control", "no-cache")
-	if key := strings.TrimSpace(os.Getenv("FOGOS_API_KEY")); key != "" {
+	h.Set("Accept-Encoding", "gzip, deflate") // decoded by readAPIBody
+	if key := cfg.FogosAPIKey; key != "" {
 		h.Set("Authorization", "Bearer "+key)
 	}
 	return h
 }
 
-// Reusable HTTP client with sane timeout
-var httpClient = &http.Client{Timeout: 20 * time.Second}
-
 // (Removed) ETag/Last-Modified cache vars
 
-// Lightweight debug logger (enable with LOG_LEVEL=debug or DEBUG=1)
-func debugf(format string, a ...any) {
-	if strings.EqualFold(getenv("LOG_LEVEL", ""), "debug") || getenv("DEBUG", "") != "" {
-		fmt.Printf("[debug] "+format+"\n", a...)
+// Per-incident gauges. Their label set depends on BOMBEIROS_METRICS_PER_ID and
+// METRICS_LABELS, so they are registered from main via initIncidentMetrics.
+var (
+	activeIncidents gaugeVec
+	activeLabels    []string
+	incidentMeans   gaugeVec
+	incidentAge     gaugeVec
+	metricsPerID    bool
+	meansKindLabels = []string{"man", "terrain", "aerial", "aquatic"}
+)
+
+// activeLabelNames are the possible labels of bombeiros_active_incidents, in
+// the order they are registered.
+var activeLabelNames = []string{"district", "concelho", "regiao", "natureza", "status"}
+
+// parseActiveLabels reads METRICS_LABELS; "none" leaves only the total.
+func parseActiveLabels(s string) ([]string, error) {
+	if strings.EqualFold(strings.TrimSpace(s), "none") {
+		return []string{}, nil
 	}
+	set := parseStrSet(s)
+	for l := range set {
+		if !slices.Contains(activeLabelNames, l) {
+			return nil, fmt.Errorf("METRICS_LABELS: label desconhecida %q (labels: %s)", l, strings.Join(activeLabelNames, ", "))
+		}
+	}
+	if len(set) == 0 {
+		return nil, fmt.Errorf("METRICS_LABELS vazio: indique labels ou none")
+	}
+	out := []string{}
+	for _, l := range activeLabelNames {
+		if _, ok := set[l]; ok {
+			out = append(out, l)
+		}
+	}
+	return out, nil
 }
 
-// Metrics
-var (
-	activeIncidents = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "bombeiros_active_incidents",
-		Help: "Active incidents count with labels",
-	}, []string{"district", "concelho", "regiao", "natureza", "status"})
-	statusTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "bombeiros_status_transitions_total",
-		Help: "Total number of status transitions",
-	}, []string{"from", "to"})
-	timeToConclusion = promauto.NewHistogram(prometheus.HistogramOpts{
-		Name:    "bombeiros_time_to_conclusion_seconds",
-		Help:    "Time from first seen to conclusion",
-		Buckets: prometheus.LinearBuckets(300, 900, 20), // 5min start, +15min, 20 buckets ~ 5h
-	})
-)
+// metricLabel normalizes a free-text feed value for use as a label, so
+// "Em  Curso", "em curso" and "Em Cursó" are one series.
+func metricLabel(s string) string {
+	s = strings.Join(strings.Fields(strings.ToLower(stripAccents(s))), " ")
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// initIncidentMetrics registers the per-incident gauges. The incident ID is
+// only added as a label when perID is set, to keep series cardinality bounded.
+func initIncidentMetrics(perID bool, active []string) {
+	activeLabels = active
+	activeIncidents = metrics.newGaugeVec("bombeiros_active_incidents",
+		"Active incidents count with labels", active)
+	metricsPerID = perID
+	meansLabels := []string{"concelho", "natureza", "kind"}
+	ageLabels := []string{"concelho", "natureza"}
+	if perID {
+		meansLabels = append(meansLabels, "id")
+		ageLabels = append(ageLabels, "id")
+	}
+	incidentMeans = metrics.newGaugeVec("bombeiros_incident_means",
+		"Operational means committed to active incidents (summed per concelho/natureza unless per-ID metrics are enabled)",
+		meansLabels)
+	incidentAge = metrics.newGaugeVec("bombeiros_incident_age_seconds",
+		"Time since the incident was first seen (oldest per concelho/natureza unless per-ID metrics are enabled)",
+		ageLabels)
+}
+
+// setIncidentMetrics resets and repopulates the means/age gauges from the filtered features.
+func setIncidentMetrics(ms *MonitorState, filtered []Feature, now time.Time) {
+	if incidentMeans == nil || incidentAge == nil {
+		return
+	}
+	incidentMeans.Reset()
+	incidentAge.Reset()
+	oldest := map[[2]string]float64{}
+	for _, f := range filtered {
+		p := f.Properties
+		id := ms.CanonicalID(p)
+		conc := getPropStr(p, "concelho")
+		nat := getPropStr(p, "natureza")
+		m := meansFromProps(p)
+		for i, v := range []int{m.Man, m.Terrain, m.Aerial, m.Aquatic} {
+			labels := []string{conc, nat, meansKindLabels[i]}
+			if metricsPerID {
+				labels = append(labels, id)
+			}
+			incidentMeans.WithLabelValues(labels...).Add(float64(v))
+		}
+		t0, ok := ms.FirstSeen(id)
+		if !ok {
+			continue
+		}
+		age := now.Sub(t0).Seconds()
+		if metricsPerID {
+			incidentAge.WithLabelValues(conc, nat, id).Set(age)
+			continue
+		}
+		key := [2]string{conc, nat}
+		if age > oldest[key] {
+			oldest[key] = age
+		}
+	}
+	for k, age := range oldest {
+		incidentAge.WithLabelValues(k[0], k[1]).Set(age)
+	}
+}
 
-func doGet(url string) (*http.Response, error) {
+func doGet(cfg *Config, url string) (*http.Response, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header = defaultHeaders()
-	resp, err := httpClient.Do(req)
+	req.Header = defaultHeaders(cfg)
+	resp, err := cfg.httpClient.Do(withTrace(cfg, req))
 	if err != nil {
 		return nil, err
 	}
@@ -199,42 +281,55 @@ func doGet(url string) (*http.Response, error) {
 // GET with extra headers (for If-None-Match / If-Modified-Since)
 // removed unused doGetWithHeaders
 
-func fetchActiveFeatures() ([]Feature, error) {
-	// Usa apenas a nova API (inclui incêndios, acidentes e outras naturezas)
-	const u = "https://api-dev.fogos.pt/v2/incidents/active?all=1"
-	resp, err := doGet(u)
-	if err != nil {
-		return nil, err
+// fogosActiveURL is the only feed used (inclui incêndios, acidentes e outras naturezas).
+const fogosActiveURL = "https://api-dev.fogos.pt/v2/incidents/active?all=1"
+
+// fetchFeatures is what runOnce polls; replay swaps it for saved snapshots.
+var fetchFeatures = fetchActiveFeatures
+
+// decodeJSON is json.Unmarshal with UseNumber: feed numbers stay
+// json.Number, so identifiers are not rounded through float64.
+func decodeJSON(b []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
 	}
-	defer resp.Body.Close()
-	data, err := io.ReadAll(resp.Body)
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("dados a mais depois do JSON")
+	}
+	return nil
+}
+
+// jsonKind is the first non-space byte of b: '{', '[' or something else.
+func jsonKind(b []byte) byte {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	if len(b) == 0 {
+		return 0
+	}
+	return b[0]
+}
+
+// toFeatures parses any of the accepted feed shapes. Features whose geometry
+// is missing or invalid get one from coordinates found in their properties.
+func toFeatures(body []byte) ([]Feature, error) {
+	features, err := decodeFeatures(body)
 	if err != nil {
 		return nil, err
 	}
-	return toFeatures(data)
+	normalizeGeometry(features)
+	return features, nil
 }
 
-func toFeatures(body []byte) ([]Feature, error) {
+func decodeFeatures(body []byte) ([]Feature, error) {
 	// Constrói Features a partir de objetos simples (sem GeoJSON)
 	buildFromPlain := func(objs []map[string]any) []Feature {
 		out := make([]Feature, 0, len(objs))
 		for _, obj := range objs {
 			var geom map[string]any
-			// Tenta lat/lng ou latitude/longitude
-			if lat, ok1 := toFloat(obj["lat"]); ok1 {
-				if lng, ok2 := toFloat(obj["lng"]); ok2 {
-					geom = map[string]any{
-						"type":        "Point",
-						"coordinates": []any{lng, lat}, // GeoJSON [lon, lat]
-					}
-				}
-			} else if lat, ok1 := toFloat(obj["latitude"]); ok1 {
-				if lng, ok2 := toFloat(obj["longitude"]); ok2 {
-					geom = map[string]any{
-						"type":        "Point",
-						"coordinates": []any{lng, lat},
-					}
-				}
+			// lat/lng, latitude/longitude ou um objeto aninhado (location, point...)
+			if lat, lng, ok := coordsFromProps(obj); ok {
+				geom = pointGeometry(lat, lng)
 			}
 			out = append(out, Feature{
 				Type:       "Feature",
@@ -245,77 +340,124 @@ func toFeatures(body []byte) ([]Feature, error) {
 		return out
 	}
 
-	// 1) FeatureCollection (GeoJSON)
-	var fc FeatureCollection
-	if err := json.Unmarshal(body, &fc); err == nil && fc.Type != "" {
-		return fc.Features, nil
-	}
-
-	// 2) Resposta embrulhada: { success?: bool, data: ... } (api-dev)
-	var wrap ApiResponse
-	if err := json.Unmarshal(body, &wrap); err == nil && wrap.Data != nil {
-		b, _ := json.Marshal(wrap.Data)
-		// 2a) data é FeatureCollection
-		if err := json.Unmarshal(b, &fc); err == nil && fc.Type != "" {
-			return fc.Features, nil
-		}
-		// 2b) data é []Feature
+	// Each candidate shape is decoded at most once, picked by the first byte.
+	// featuresFromArray tries []Feature, then plain objects; with checkValid a
+	// []Feature whose elements are all empty counts as plain objects.
+	featuresFromArray := func(b []byte, checkValid bool) ([]Feature, bool) {
 		var arrF []Feature
-		if err := json.Unmarshal(b, &arrF); err == nil {
+		if err := decodeJSON(b, &arrF); err == nil {
+			if !checkValid {
+				return arrF, true
+			}
 			// Verificar se os elementos parecem válidos (possuem propriedades/geometry/type)
-			valid := false
 			for _, f := range arrF {
 				if f.Type != "" || f.Geometry != nil || len(f.Properties) > 0 {
-					valid = true
-					break
+					return arrF, true
 				}
 			}
-			if valid {
-				return arrF, nil
-			}
-			// Caso contrário, continuar para 2c (objetos simples)
 		}
-		// 2c) data é []map[string]any (objetos simples)
 		var arrM []map[string]any
-		if err := json.Unmarshal(b, &arrM); err == nil {
-			return buildFromPlain(arrM), nil
+		if err := decodeJSON(b, &arrM); err == nil {
+			return buildFromPlain(arrM), true
 		}
+		return nil, false
 	}
 
-	// 3) Top-level []Feature
-	var arr []Feature
-	if err := json.Unmarshal(body, &arr); err == nil {
-		return arr, nil
-	}
-
-	// 4) Top-level []map[string]any (objetos simples)
-	var arrM []map[string]any
-	if err := json.Unmarshal(body, &arrM); err == nil {
-		return buildFromPlain(arrM), nil
+	switch jsonKind(body) {
+	case '{':
+		// 1) FeatureCollection (GeoJSON), or
+		// 2) resposta embrulhada: { success?: bool, data: ... } (api-dev)
+		var env struct {
+			FeatureCollection
+			ApiResponse
+		}
+		if err := decodeJSON(body, &env); err != nil {
+			// a bad "type"/"features" must not hide a valid "data"
+			env.FeatureCollection = FeatureCollection{}
+			if err := decodeJSON(body, &env.ApiResponse); err != nil {
+				break
+			}
+		}
+		if env.Type != "" {
+			return env.Features, nil
+		}
+		switch data := env.Data; jsonKind(data) {
+		case '{': // 2a) data é FeatureCollection
+			var fc FeatureCollection
+			if err := decodeJSON(data, &fc); err == nil && fc.Type != "" {
+				return fc.Features, nil
+			}
+		case '[': // 2b) data é []Feature, 2c) ou objetos simples
+			if out, ok := featuresFromArray(data, true); ok {
+				return out, nil
+			}
+		}
+	case '[':
+		// 3) Top-level []Feature, 4) ou objetos simples
+		if out, ok := featuresFromArray(body, false); ok {
+			return out, nil
+		}
 	}
 
 	return nil, fmt.Errorf("unknown response shape")
 }
 
+// getID returns the fogos.pt ID used as the state key. The ANEPC occurrence
+// number (anepcNumber) is deliberately not among the keys.
 func getID(p map[string]any) string {
-	keys := []string{"id", "globalId", "globalid", "ogc_fid", "ogcId", "uid"}
-	for _, k := range keys {
-		if v, ok := p[k]; ok {
-			switch t := v.(type) {
-			case string:
-				if t != "" {
-					return t
-				}
-			case float64:
-				if t != 0 {
-					return fmt.Sprintf("%.0f", t)
-				}
-			}
+	for _, k := range idKeys {
+		if id := idString(p[k]); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// idString formats an identifier property; empty for zero or missing values.
+func idString(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case json.Number:
+		if id := numberString(t); id != "0" {
+			return id
+		}
+	case float64:
+		if t != 0 {
+			return fmt.Sprintf("%.0f", t)
 		}
 	}
 	return ""
 }
 
+// numberString renders a JSON number as its exact decimal integer, so IDs
+// above 2^53 or sent as 1.2e18 keep every digit. Non-integers are rounded
+// as %.0f always did.
+func numberString(n json.Number) string {
+	s := n.String()
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return s
+	}
+	if r, ok := new(big.Rat).SetString(s); ok && r.IsInt() {
+		return r.Num().String()
+	}
+	f, _ := n.Float64()
+	return fmt.Sprintf("%.0f", f)
+}
+
+// anepcNumber returns the ANEPC/Prociv occurrence number, if the feed has one.
+func anepcNumber(p map[string]any) string {
+	return getPropStr(p, "sadoId", "sadoID", "sado_id", "prociv", "procivId", "prociv_id", "anepc", "anepcId", "anepc_id")
+}
+
+// anepcURL fills the {id} placeholder of ANEPC_URL.
+func anepcURL(cfg *Config, num string) string {
+	if cfg.AnepcURL == "" || num == "" {
+		return ""
+	}
+	return strings.ReplaceAll(cfg.AnepcURL, "{id}", url.QueryEscape(num))
+}
+
 func getMunicipio(p map[string]any) string {
 	for _, k := range []string{"concelho", "municipio", "county", "municipality"} {
 		if v, ok := p[k].(string); ok && strings.TrimSpace(v) != "" {
@@ -328,8 +470,6 @@ func getMunicipio(p map[string]any) string {
 type perMuniState map[string]map[string]struct{}
 type perMuniSeen map[string]map[string]time.Time
 
-// Additional state: status per ID and first/concluded timestamps (UTC)
-
 // Novo: snapshot tipado dos meios
 type Means struct {
 	Man     int `json:"man"`
@@ -338,15 +478,27 @@ type Means struct {
 	Aquatic int `json:"aquatic"`
 }
 
-func loadLastState(path string) (perMuniState, perMuniSeen, error) {
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return perMuniState{}, perMuniSeen{}, err
+// meansFromProps reads the current means snapshot from feed properties.
+func meansFromProps(p map[string]any) Means {
+	getInt := func(name string) int {
+		if v, ok := toFloat(p[name]); ok {
+			return int(v)
+		}
+		return 0
 	}
-	var raw map[string]any
-	if err := json.Unmarshal(b, &raw); err != nil {
-		return perMuniState{}, perMuniSeen{}, err
+	return Means{
+		Man:     getInt("man"),
+		Terrain: getInt("terrain"),
+		Aerial:  getInt("aerial"),
+		Aquatic: getInt("meios_aquaticos"),
 	}
+}
+
+// decodeState replaces the per-ID maps of ms with the sections of a state
+// document (the top-level keys of STATE_FILE) and returns the
+// per-municipality maps.
+func decodeState(ms *MonitorState, raw map[string]any) (perMuniState, perMuniSeen) {
+	ms.reset()
 	st := perMuniState{}
 	if m, ok := raw["by"].(map[string]any); ok {
 		for muni, idsAny := range m {
@@ -383,7 +535,7 @@ func loadLastState(path string) (perMuniState, perMuniSeen, error) {
 	if m, ok := raw["status"].(map[string]any); ok {
 		for id, v := range m {
 			if s, ok := v.(string); ok {
-				lastStatusByID[id] = s
+				ms.status[id] = s
 			}
 		}
 	}
@@ -391,7 +543,7 @@ func loadLastState(path string) (perMuniState, perMuniSeen, error) {
 		for id, v := range m {
 			if s, ok := v.(string); ok {
 				if t, err := time.Parse(time.RFC3339, s); err == nil {
-					firstSeenByID[id] = t
+					ms.firstSeen[id] = t
 				}
 			}
 		}
@@ -400,7 +552,7 @@ func loadLastState(path string) (perMuniState, perMuniSeen, error) {
 		for id, v := range m {
 			if s, ok := v.(string); ok {
 				if t, err := time.Parse(time.RFC3339, s); err == nil {
-					concludedAtID[id] = t
+					ms.concludedAt[id] = t
 				}
 			}
 		}
@@ -416,7 +568,7 @@ func loadLastState(path string) (perMuniState, perMuniSeen, error) {
 					}
 					return 0
 				}
-				lastMeansByID[id] = Means{
+				ms.means[id] = Means{
 					Man:     getInt("man"),
 					Terrain: getInt("terrain"),
 					Aerial:  getInt("aerial"),
@@ -425,26 +577,132 @@ func loadLastState(path string) (perMuniState, perMuniSeen, error) {
 			}
 		}
 	}
+	if m, ok := raw["means_max"].(map[string]any); ok {
+		for id, v := range m {
+			b, _ := json.Marshal(v)
+			var mm Means
+			if json.Unmarshal(b, &mm) == nil {
+				ms.maxMeans[id] = mm
+			}
+		}
+	}
 	// Novo: carregar extra por ID
 	if m, ok := raw["extra_text"].(map[string]any); ok {
 		for id, v := range m {
 			if s, ok := v.(string); ok {
-				lastExtraByID[id] = s
+				ms.extra[id] = s
+			}
+		}
+	}
+	if m, ok := raw["annotations"].(map[string]any); ok {
+		for id, v := range m {
+			if f, ok := toFloat(v); ok {
+				ms.annotations[id] = int64(f)
+			}
+		}
+	}
+	if m, ok := raw["history"].(map[string]any); ok {
+		for id, v := range m {
+			b, _ := json.Marshal(v)
+			var h historyEntry
+			if json.Unmarshal(b, &h) == nil {
+				ms.history[id] = h
+			}
+		}
+	}
+	if m, ok := raw["reactivations"].(map[string]any); ok {
+		for id, v := range m {
+			b, _ := json.Marshal(v)
+			var sp activeSpans
+			if json.Unmarshal(b, &sp) == nil {
+				ms.spans[id] = sp
+			}
+		}
+	}
+	if m, ok := raw["important"].(map[string]any); ok {
+		for id, v := range m {
+			if b, ok := v.(bool); ok {
+				ms.important[id] = b
+			}
+		}
+	}
+	if m, ok := raw["burned_ha"].(map[string]any); ok {
+		for id, v := range m {
+			if f, ok := toFloat(v); ok && f > 0 {
+				ms.burned[id] = f
+			}
+		}
+	}
+	if m, ok := raw["positions"].(map[string]any); ok {
+		for id, v := range m {
+			if pm, ok := v.(map[string]any); ok {
+				lat, okLat := toFloat(pm["lat"])
+				lon, okLon := toFloat(pm["lon"])
+				if okLat && okLon && validLatLon(lat, lon) {
+					ms.positions[id] = geoPoint{Lat: lat, Lon: lon}
+				}
+			}
+		}
+	}
+	if m, ok := raw["roads"].(map[string]any); ok {
+		for id, v := range m {
+			if arr, ok := v.([]any); ok {
+				for _, r := range arr {
+					if s, ok := r.(string); ok {
+						ms.roads[id] = append(ms.roads[id], s)
+					}
+				}
+			}
+		}
+	}
+	if m, ok := raw["timeline"].(map[string]any); ok {
+		for id, v := range m {
+			b, _ := json.Marshal(v)
+			var steps []statusStep
+			if json.Unmarshal(b, &steps) == nil && len(steps) > 0 {
+				ms.timeline[id] = steps
+			}
+		}
+	}
+	if m, ok := raw["peaks"].(map[string]any); ok {
+		for day, v := range m {
+			if f, ok := toFloat(v); ok {
+				ms.peaks[day] = int(f)
+			}
+		}
+	}
+	if s, ok := raw["last_weekly"].(string); ok {
+		ms.lastWeeklyMark = s
+	}
+	if m, ok := raw["aliases"].(map[string]any); ok {
+		for a, v := range m {
+			if t, ok := v.(string); ok && t != "" {
+				ms.aliasOf[a] = t
 			}
 		}
 	}
 	// Novo: carregar marcas de sumários
 	if s, ok := raw["last_hourly"].(string); ok {
-		lastHourlyMark = s
+		ms.lastHourlyMark = s
 	}
 	if s, ok := raw["last_daily"].(string); ok {
-		lastSummaryDay = s
+		ms.lastSummaryDay = s
+	}
+	if m, ok := raw["summary_base"].(map[string]any); ok {
+		for kind, dst := range map[string]**summaryCounts{"hourly": &ms.prevHourly, "daily": &ms.prevDaily} {
+			b, _ := json.Marshal(m[kind])
+			var c summaryCounts
+			if m[kind] != nil && json.Unmarshal(b, &c) == nil {
+				*dst = &c
+			}
+		}
 	}
 	// Optional migration: legacy files may not have these keys; that's fine
-	return st, seen, nil
+	return st, seen
 }
 
-func saveLastState(path string, st perMuniState, seen perMuniSeen) error {
+// encodeState builds the state document; every section is always present.
+func encodeState(ms *MonitorState, st perMuniState, seen perMuniSeen) map[string]any {
 	raw := map[string]any{
 		"by":        map[string][]string{},
 		"seen":      map[string]map[string]string{},
@@ -452,10 +710,23 @@ func saveLastState(path string, st perMuniState, seen perMuniSeen) error {
 		"first":     map[string]string{},
 		"concluded": map[string]string{},
 		// Novo: persistir meios/extra e marcas de sumários
-		"means":       map[string]map[string]int{},
-		"extra_text":  map[string]string{},
-		"last_hourly": lastHourlyMark,
-		"last_daily":  lastSummaryDay,
+		"means":         map[string]map[string]int{},
+		"means_max":     ms.maxMeans,
+		"extra_text":    map[string]string{},
+		"last_hourly":   ms.lastHourlyMark,
+		"last_daily":    ms.lastSummaryDay,
+		"summary_base":  map[string]*summaryCounts{},
+		"annotations":   ms.annotations,
+		"history":       ms.history,
+		"peaks":         ms.peaks,
+		"timeline":      ms.timeline,
+		"reactivations": ms.spans,
+		"roads":         ms.roads,
+		"important":     ms.important,
+		"burned_ha":     ms.burned,
+		"positions":     ms.positions,
+		"last_weekly":   ms.lastWeeklyMark,
+		"aliases":       ms.aliasOf,
 	}
 	for muni, set := range st {
 		ids := make([]string, 0, len(set))
@@ -464,6 +735,13 @@ func saveLastState(path string, st perMuniState, seen perMuniSeen) error {
 		}
 		raw["by"].(map[string][]string)[muni] = ids
 	}
+	base := raw["summary_base"].(map[string]*summaryCounts)
+	if ms.prevHourly != nil {
+		base["hourly"] = ms.prevHourly
+	}
+	if ms.prevDaily != nil {
+		base["daily"] = ms.prevDaily
+	}
 	seenOut := raw["seen"].(map[string]map[string]string)
 	for muni, kv := range seen {
 		out := map[string]string{}
@@ -474,22 +752,22 @@ func saveLastState(path string, st perMuniState, seen perMuniSeen) error {
 	}
 	// Save extended maps (já existente)
 	stOut := raw["status"].(map[string]string)
-	for id, s := range lastStatusByID {
+	for id, s := range ms.status {
 		if strings.TrimSpace(id) != "" && strings.TrimSpace(s) != "" {
 			stOut[id] = s
 		}
 	}
 	fstOut := raw["first"].(map[string]string)
-	for id, ts := range firstSeenByID {
+	for id, ts := range ms.firstSeen {
 		fstOut[id] = ts.UTC().Format(time.RFC3339)
 	}
 	cOut := raw["concluded"].(map[string]string)
-	for id, ts := range concludedAtID {
+	for id, ts := range ms.concludedAt {
 		cOut[id] = ts.UTC().Format(time.RFC3339)
 	}
 	// Novo: persistir meios
 	meansOut := raw["means"].(map[string]map[string]int)
-	for id, m := range lastMeansByID {
+	for id, m := range ms.means {
 		meansOut[id] = map[string]int{
 			"man":     m.Man,
 			"terrain": m.Terrain,
@@ -499,15 +777,50 @@ func saveLastState(path string, st perMuniState, seen perMuniSeen) error {
 	}
 	// Novo: persistir extra
 	extraOut := raw["extra_text"].(map[string]string)
-	for id, s := range lastExtraByID {
+	for id, s := range ms.extra {
 		extraOut[id] = s
 	}
+	return raw
+}
 
-	b, _ := json.MarshalIndent(raw, "", "  ")
-	if err := os.WriteFile(path, b, 0644); err != nil {
-		return err
+// forgetID removes every trace of an incident from the per-municipality and per-ID state.
+func (ms *MonitorState) forgetID(st perMuniState, seen perMuniSeen, muni, id string) {
+	delete(st[muni], id)
+	delete(seen[muni], id)
+	delete(ms.status, id)
+	delete(ms.firstSeen, id)
+	delete(ms.concludedAt, id)
+	delete(ms.means, id)
+	delete(ms.maxMeans, id)
+	delete(ms.meansHist, id)
+	delete(ms.extra, id)
+	delete(ms.annotations, id)
+	delete(ms.timeline, id)
+	delete(ms.spans, id)
+	delete(ms.roads, id)
+	delete(ms.important, id)
+	delete(ms.burned, id)
+	delete(ms.positions, id)
+	for a, t := range ms.aliasOf {
+		if t == id {
+			delete(ms.aliasOf, a)
+		}
 	}
-	return nil
+}
+
+// pruneSeenBefore forgets IDs last seen before cutoff (or never seen) and returns how many.
+func (ms *MonitorState) pruneSeenBefore(st perMuniState, seen perMuniSeen, cutoff time.Time) int {
+	pruned := 0
+	for muni, set := range st {
+		for id := range set {
+			ts, ok := seen[muni][id]
+			if !ok || ts.Before(cutoff) {
+				ms.forgetID(st, seen, muni, id)
+				pruned++
+			}
+		}
+	}
+	return pruned
 }
 
 func filterByMunicipios(features []Feature, wantedFlat []string) []Feature {
@@ -524,7 +837,7 @@ func filterByMunicipios(features []Feature, wantedFlat []string) []Feature {
 			continue
 		}
 		// Debug: explain why it was skipped
-		if getenv("DEBUG", "") != "" || strings.EqualFold(getenv("LOG_LEVEL", ""), "debug") {
+		if debugEnabled() {
 			// collect property keys for quick inspection when municipality is missing
 			keys := make([]string, 0, len(f.Properties))
 			for k := range f.Properties {
@@ -567,6 +880,42 @@ func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
 	return R * c
 }
 
+// bearingDeg is the initial great-circle bearing from point 1 to point 2, 0–360.
+func bearingDeg(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(d float64) float64 { return d * (math.Pi / 180) }
+	dLon := toRad(lon2 - lon1)
+	y := math.Sin(dLon) * math.Cos(toRad(lat2))
+	x := math.Cos(toRad(lat1))*math.Sin(toRad(lat2)) - math.Sin(toRad(lat1))*math.Cos(toRad(lat2))*math.Cos(dLon)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+// compass16 names a bearing as one of the 16 compass points.
+func compass16(deg float64) string {
+	points := []string{"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE", "S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW"}
+	return points[int(math.Round(math.Mod(deg+360, 360)/22.5))%16]
+}
+
+// distanceFromCenter is the distance in km from CENTER_LAT/CENTER_LON to f.
+func distanceFromCenter(cfg *Config, f Feature) (km, bearing float64, ok bool) {
+	if !cfg.hasCenter() {
+		return 0, 0, false
+	}
+	lat, lon, ok := getCoords(f.Geometry)
+	if !ok {
+		return 0, 0, false
+	}
+	return haversineKm(cfg.CenterLat, cfg.CenterLon, lat, lon), bearingDeg(cfg.CenterLat, cfg.CenterLon, lat, lon), true
+}
+
+// distanceLine renders "Distância: 7.3 km a NE", or "" without center or coordinates.
+func distanceLine(cfg *Config, f Feature) string {
+	km, b, ok := distanceFromCenter(cfg, f)
+	if !ok {
+		return ""
+	}
+	return tr("distance.line", km, compass16(b))
+}
+
 func muniLabel(names []string) string {
 	if len(names) == 0 {
 		return ""
@@ -578,29 +927,57 @@ func muniLabel(names []string) string {
 }
 
 func prettyTime(val any) string {
+	if t, ok := feedTime(val); ok {
+		return t.In(conf().loc).Format("02-01 15:04")
+	}
+	return ""
+}
+
+// feedTime parses a feed timestamp: a date string, epoch seconds or {"sec": ...}.
+func feedTime(val any) (time.Time, bool) {
 	switch v := val.(type) {
 	case string:
 		// Try common formats
+		// Zone-less layouts are fogos.pt local time, i.e. BOMBEIROS_TZ.
+		loc := conf().loc
 		layouts := []string{time.RFC3339, "2006-01-02 15:04:05", "02/01/2006 15:04"}
 		for _, layout := range layouts {
-			if t, err := time.Parse(layout, v); err == nil {
-				return t.Local().Format("02-01 15:04")
+			if t, err := time.ParseInLocation(layout, v, loc); err == nil {
+				return t, true
 			}
 		}
-	case float64:
+	case float64, json.Number:
 		// Epoch seconds
-		if v > 0 {
-			return time.Unix(int64(v), 0).Local().Format("02-01 15:04")
+		if f, _ := toFloat(v); f > 0 {
+			return time.Unix(int64(f), 0), true
 		}
 	case map[string]any:
 		// Support {"sec": ...}
 		if sec, ok := v["sec"]; ok {
 			if f, ok2 := toFloat(sec); ok2 && f > 0 {
-				return time.Unix(int64(f), 0).Local().Format("02-01 15:04")
+				return time.Unix(int64(f), 0), true
 			}
 		}
 	}
-	return ""
+	return time.Time{}, false
+}
+
+// eventBefore orders the events of a cycle: oldest dateTime first (undated
+// last), then municipality, then ID, so runs over the same feed notify in
+// the same order.
+func eventBefore(a, b Feature, muniA, muniB, idA, idB string) bool {
+	ta, okA := feedTime(a.Properties["dateTime"])
+	tb, okB := feedTime(b.Properties["dateTime"])
+	if okA != okB {
+		return okA
+	}
+	if !ta.Equal(tb) {
+		return ta.Before(tb)
+	}
+	if muniA != muniB {
+		return muniA < muniB
+	}
+	return idA < idB
 }
 
 // Helpers for UI/UX and enhanced notifications
@@ -630,13 +1007,9 @@ func getCoords(geom map[string]any) (lat, lon float64, ok bool) {
 	if geom == nil {
 		return
 	}
-	// GeoJSON: coordinates = [lon, lat]
-	if coords, ok2 := geom["coordinates"].([]any); ok2 && len(coords) >= 2 {
-		lonF, okLon := toFloat(coords[0])
-		latF, okLat := toFloat(coords[1])
-		if okLon && okLat {
-			return latF, lonF, true
-		}
+	// GeoJSON: coordinates = [lon, lat]; out-of-range points are ignored
+	if coords, ok2 := geom["coordinates"].([]any); ok2 {
+		return lonLatPair(coords)
 	}
 	return 0, 0, false
 }
@@ -644,7 +1017,7 @@ func getCoords(geom map[string]any) (lat, lon float64, ok bool) {
 func mapsURLForFeature(f Feature, muni string) string {
 	if lat, lon, ok := getCoords(f.Geometry); ok {
 		// Preferir geo: no Android, se ativado
-		if getenv("NTFY_CLICK_GEO", "") != "" {
+		if conf().NtfyClickGeo {
 			return fmt.Sprintf("geo:0,0?q=%f,%f", lat, lon)
 		}
 		return fmt.Sprintf("https://www.google.com/maps/search/?api=1&query=%f,%f", lat, lon)
@@ -655,15 +1028,21 @@ func mapsURLForFeature(f Feature, muni string) string {
 	return ""
 }
 
-func inQuietHours() bool {
+// quietWindow is a parsed QUIET_HOURS value.
+type quietWindow struct {
+	enabled      bool
+	startH, endH int
+}
+
+func parseQuietHours(win string) quietWindow {
 	// Formats like "23-7" or "22-07"
-	win := strings.TrimSpace(getenv("QUIET_HOURS", ""))
+	win = strings.TrimSpace(win)
 	if win == "" {
-		return false
+		return quietWindow{}
 	}
 	parts := strings.Split(win, "-")
 	if len(parts) != 2 {
-		return false
+		return quietWindow{}
 	}
 	parseHour := func(s string) (int, bool) {
 		s = strings.TrimSpace(s)
@@ -676,9 +1055,18 @@ func inQuietHours() bool {
 	startH, ok1 := parseHour(parts[0])
 	endH, ok2 := parseHour(parts[1])
 	if !ok1 || !ok2 {
+		return quietWindow{}
+	}
+	return quietWindow{enabled: true, startH: startH, endH: endH}
+}
+
+func inQuietHours(cfg *Config) bool {
+	q := cfg.quiet
+	if !q.enabled {
 		return false
 	}
-	nowH := time.Now().Hour()
+	startH, endH := q.startH, q.endH
+	nowH := cfg.now().In(cfg.loc).Hour()
 	if startH == endH {
 		return true // 24h quiet if same hour
 	}
@@ -689,6 +1077,22 @@ func inQuietHours() bool {
 	return nowH >= startH || nowH < endH
 }
 
+// quietExempt reports whether n is about an incident within QUIET_EXEMPT_KM
+// of the center, which quiet hours neither defer nor quieten. An incident
+// without coordinates only counts with QUIET_EXEMPT_NO_COORDS.
+func quietExempt(cfg *Config, n Notification) bool {
+	if cfg.QuietExemptKm <= 0 {
+		return false
+	}
+	for _, f := range n.Incidents {
+		km, _, ok := distanceFromCenter(cfg, f)
+		if (ok && km <= cfg.QuietExemptKm) || (!ok && cfg.QuietExemptNoCoords) {
+			return true
+		}
+	}
+	return false
+}
+
 func addTag(tags, t string) string {
 	t = strings.TrimSpace(t)
 	if t == "" {
@@ -775,6 +1179,9 @@ func getPropStr(p map[string]any, keys ...string) string {
 				return s
 			}
 			// Accept numbers
+			if n, ok := v.(json.Number); ok {
+				return numberString(n)
+			}
 			if f, ok := toFloat(v); ok {
 				return fmt.Sprintf("%.0f", f)
 			}
@@ -789,7 +1196,7 @@ func meansSummaryFromPropsPT(p map[string]any) string {
 	ter := getPropStr(p, "terrain")
 	air := getPropStr(p, "aerial")
 	aq := getPropStr(p, "meios_aquaticos")
-	return fmt.Sprintf("Operacionais=%s, Terrestres=%s, Aéreos=%s, Aquáticos=%s", man, ter, air, aq)
+	return tr("means.summary", man, ter, air, aq)
 }
 
 func aeronavesLineFromPropsPT(p map[string]any) string {
@@ -799,21 +1206,116 @@ func aeronavesLineFromPropsPT(p map[string]any) string {
 	if hf == "0" && hc == "0" && pf == "0" {
 		return ""
 	}
-	return fmt.Sprintf("Aeronaves: Combate=%s, Coordenação=%s, Aviões=%s", hf, hc, pf)
+	return tr("means.aircraft", hf, hc, pf)
+}
+
+// statusFrom names the previous status in a transition ("Novo" when unknown).
+func statusFrom(prev string) string {
+	if strings.TrimSpace(prev) == "" {
+		return tr("status.new")
+	}
+	return prev
+}
+
+// timeToConclude measures an incident that just reached Conclusão for the
+// bombeiros_time_to_conclusion_seconds histogram. It prefers the feed's own
+// dateTime (start) and updated (conclusion) over firstSeen and now, which
+// only hold when one process saw the whole incident. After a reactivation
+// the new span is added to the active time before it.
+func (ms *MonitorState) timeToConclude(id string, p map[string]any, now time.Time) (time.Duration, bool) {
+	sp := ms.spans[id]
+	start, ok := feedTime(p["dateTime"])
+	startSrc := "dateTime"
+	if sp.Since != nil {
+		start, ok, startSrc = *sp.Since, true, "reactivated"
+	}
+	if !ok {
+		if start, ok = ms.firstSeen[id]; !ok {
+			return 0, false
+		}
+		startSrc = "first_seen"
+	}
+	end, ok := feedTime(p["updated"])
+	endSrc := "updated"
+	if !ok || end.Before(start) || end.After(now) {
+		end, endSrc = now, "now"
+	}
+	if !end.After(start) {
+		return 0, false
+	}
+	d := time.Duration(sp.ActiveSec)*time.Second + end.Sub(start)
+	slog.Debug("tempo até conclusão", "incident_id", id, "duration", d,
+		"start_source", startSrc, "end_source", endSrc, "reactivations", sp.Reactivations)
+	sp.Since, sp.ActiveSec = nil, int64(d.Seconds())
+	ms.spans[id] = sp
+	return d, true
+}
+
+// isReactivation reports a concluded or watched incident going back to
+// dispatch or "em curso".
+func isReactivation(prev, cur string) bool {
+	prevS := strings.ToLower(stripAccents(prev))
+	s := strings.ToLower(stripAccents(cur))
+	return (strings.Contains(prevS, "conclus") || strings.Contains(prevS, "vigil")) && (strings.Contains(s, "curso") || strings.Contains(s, "despacho"))
+}
+
+// statusPriority is the ntfy priority for an incident now in status cur.
+func statusPriority(cur, base string) string {
+	s := strings.ToLower(stripAccents(cur))
+	switch {
+	case strings.Contains(s, "em curso") || strings.Contains(s, "em resolucao"):
+		return "5"
+	case strings.Contains(s, "despacho"):
+		return "4"
+	case strings.Contains(s, "vigilancia") || strings.Contains(s, "conclus"):
+		return "3"
+	}
+	return base
+}
+
+// statusTransition is one status change rolled into a grouped message.
+type statusTransition struct{ from, to, muni string }
+
+// groupTransitions renders one line per transition, most frequent first, e.g.
+// "Despacho → Em Curso: 6 (Sertã×2, Oleiros×1, …)".
+func groupTransitions(ts []statusTransition) string {
+	counts := map[string]int{}
+	munis := map[string]map[string]int{}
+	for _, t := range ts {
+		k := t.from + " → " + t.to
+		counts[k]++
+		if munis[k] == nil {
+			munis[k] = map[string]int{}
+		}
+		munis[k][t.muni]++
+	}
+	lines := make([]string, 0, len(counts))
+	for _, k := range sortedCounts(counts) {
+		parts := []string{}
+		for i, m := range sortedCounts(munis[k]) {
+			if i == 5 {
+				parts = append(parts, "…")
+				break
+			}
+			parts = append(parts, fmt.Sprintf("%s×%d", m, munis[k][m]))
+		}
+		lines = append(lines, fmt.Sprintf("%s: %d (%s)", k, counts[k], strings.Join(parts, ", ")))
+	}
+	return strings.Join(lines, "\n")
 }
 
 func appendMeansChangePartsPT(parts *[]string, oldM, newM Means) {
 	if oldM.Man != newM.Man {
-		*parts = append(*parts, fmt.Sprintf("Operacionais: %d → %d", oldM.Man, newM.Man))
+		*parts = append(*parts, tr("means.man", oldM.Man, newM.Man))
 	}
 	if oldM.Terrain != newM.Terrain {
-		*parts = append(*parts, fmt.Sprintf("Terrestres: %d → %d", oldM.Terrain, newM.Terrain))
+		*parts = append(*parts, tr("means.terrain", oldM.Terrain, newM.Terrain))
 	}
 	if oldM.Aerial != newM.Aerial {
-		*parts = append(*parts, fmt.Sprintf("Aéreos: %d → %d", oldM.Aerial, newM.Aerial))
+		*parts = append(*parts, tr("means.aerial", oldM.Aerial, newM.Aerial))
 	}
 	if oldM.Aquatic != newM.Aquatic {
-		*parts = append(*parts, fmt.Sprintf("Aquáticos: %d → %d", oldM.Aquatic, newM.Aquatic))
+		*parts = append(*parts, tr("means.aquatic", oldM.Aquatic, newM.Aquatic))
 	}
 }
 
@@ -887,25 +1389,245 @@ func canonicalizeSeenKeys(seen perMuniSeen, wantedSet map[string][]string) perMu
 	return out
 }
 
-// Extended ntfy with dry-run, quiet-hours and click URL
-func postNtfyExt(ntfyURL, topic, title, body, tags, priority, clickURL string) {
-	if strings.TrimSpace(topic) == "" {
-		return
+// Notification is one outgoing message. Type is one of the notify* constants
+// and is used to label delivery metrics.
+type Notification struct {
+	Type     string
+	Title    string
+	Body     string
+	Tags     string
+	Priority string
+	Click    string
+	// IncidentID is set on per-incident messages so mutes and actions can target them.
+	IncidentID string
+	// Incidents are the features the message is about, for the NOTIFY_ONLY_*
+	// gates; summaries and self-alerts leave it empty and always pass.
+	Incidents []Feature
+	// IncidentIDs are the tracked IDs of Incidents, in the same order, on
+	// messages that group several incidents and so have no IncidentID.
+	IncidentIDs []string
+	// Markdown is the rich-text rendering of Body, sent instead of it when
+	// NTFY_MARKDOWN is set. Empty means markdownBody(Body).
+	Markdown string
+	// ForceMarkdown sends Markdown even without NTFY_MARKDOWN (weekly report).
+	ForceMarkdown bool
+	// event names a summary for EMAIL_EVENTS (daily_summary, weekly_summary).
+	event string
+	// rateQueued marks a message that already went through the rate limiter.
+	rateQueued bool
+	// Share is the compact line for forwarding (SHARE_TEMPLATE), also behind
+	// the "Partilhar" button.
+	Share string
+	// servers, when set, replaces the configured ntfy servers (a retry after
+	// a 429 from one of them).
+	servers []ntfyServer
+	// parent is the poll cycle the message came from, for its trace span.
+	parent trace.SpanContext
+}
+
+// Notification types
+const (
+	notifyNew       = "new"
+	notifyStatus    = "status"
+	notifyMeans     = "means"
+	notifyExtra     = "extra"
+	notifyRoad      = "road"
+	notifyImportant = "important"
+	notifyBurned    = "burned"
+	notifyMoved     = "moved"
+	notifySummary   = "summary"
+	notifyTest      = "test"
+	notifyFeed      = "feed"
+	notifyPanic     = "panic"
+	notifyConfig    = "config"
+	notifyBacklog   = "backlog"
+	notifyState     = "state"
+)
+
+// notificationTypes lists the notify* values, for settings that name them.
+var notificationTypes = []string{notifyNew, notifyStatus, notifyMeans, notifyExtra, notifyRoad, notifyImportant,
+	notifyBurned, notifyMoved, notifySummary, notifyTest, notifyFeed, notifyPanic, notifyConfig, notifyBacklog, notifyState}
+
+// emailFor returns NTFY_EMAIL when n should be forwarded: its own priority
+// (before quiet hours lower it) reaches NTFY_EMAIL_MIN_PRIORITY and, with
+// NTFY_EMAIL_TYPES, its type is listed.
+func emailFor(cfg *Config, n Notification) string {
+	if cfg.NtfyEmail == "" {
+		return ""
 	}
-	// Dry-run mode: log instead of posting
-	if getenv("NTFY_DRYRUN", "") != "" {
-		fmt.Printf("[dry-run ntfy] %s\n%s\n", title, body)
-		return
+	prio := 3
+	if v, err := strconv.Atoi(strings.TrimSpace(n.Priority)); err == nil {
+		prio = v
 	}
-	// Quiet hours: lower priority and tag
-	if inQuietHours() {
-		// reduzir para prioridade default (3) se vier maior
-		if strings.TrimSpace(priority) == "" {
-			priority = "3"
-		} else if v, err := strconv.Atoi(priority); err == nil && v > 3 {
-			priority = "3"
+	if prio < cfg.NtfyEmailMinPriority {
+		return ""
+	}
+	if len(cfg.emailTypes) > 0 {
+		if _, ok := cfg.emailTypes[n.Type]; !ok {
+			return ""
+		}
+	}
+	return cfg.NtfyEmail
+}
+
+// Delivery results for bombeiros_notifications_total
+const (
+	resultOK              = "ok"
+	resultError           = "error"
+	resultDryRun          = "dryrun"
+	resultPaused          = "paused"
+	resultMuted           = "muted"
+	resultFiltered        = "filtered"
+	resultQuietSuppressed = "quiet_suppressed" // held back for the QUIET_DIGEST digest
+	resultRateLimited     = "rate_limited"     // 429 from ntfy; queued again
+	resultCollapsed       = "collapsed"        // folded into a backlog message
+	resultDeduplicated    = "deduplicated"     // same text sent within NTFY_DEDUP_SECONDS
+)
+
+// notifyOnlyAllows applies NOTIFY_ONLY_STATUS and NOTIFY_ONLY_WITHIN_KM: a
+// message passes when at least one of its incidents matches both. Unlike
+// INCLUDE_STATUS these only gate sending; tracking, metrics and summaries
+// still see every incident.
+func notifyOnlyAllows(cfg *Config, incidents []Feature) bool {
+	if len(incidents) == 0 || (len(cfg.notifyOnlyStatus) == 0 && cfg.NotifyOnlyWithinKm <= 0) {
+		return true
+	}
+	for _, f := range incidents {
+		if len(cfg.notifyOnlyStatus) > 0 {
+			cur := strings.ToLower(stripAccents(getPropStr(f.Properties, "status")))
+			ok := false
+			for want := range cfg.notifyOnlyStatus {
+				if strings.Contains(cur, want) {
+					ok = true
+					break
+				}
+			}
+			if !ok {
+				continue
+			}
+		}
+		if cfg.NotifyOnlyWithinKm > 0 {
+			// without coordinates the distance is unknown: not critical
+			if km, _, ok := distanceFromCenter(cfg, f); !ok || km > cfg.NotifyOnlyWithinKm {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Extended ntfy with dry-run, quiet-hours and click URL
+func postNtfyExt(ntfyURL, topic string, n Notification) (err error) {
+	if strings.TrimSpace(topic) == "" {
+		return nil
+	}
+	ctx, span := tracer.Start(trace.ContextWithSpanContext(context.Background(), n.parent), "notify",
+		trace.WithAttributes(attribute.String("notification.type", n.Type), attribute.String("incident.id", n.IncidentID)))
+	defer func() { endSpan(span, err) }()
+	cfg := conf()
+	title, body, tags, priority, clickURL := n.Title, n.Body, n.Tags, n.Priority, n.Click
+	// message is what gets posted; actions below are read from the plain body.
+	message := body
+	useMarkdown := cfg.NtfyMarkdown || (n.ForceMarkdown && n.Markdown != "")
+	if useMarkdown {
+		message = n.Markdown
+		if message == "" {
+			message = markdownBody(body)
+		}
+	}
+	if !notifyOnlyAllows(cfg, n.Incidents) {
+		slog.Debug("notificação suprimida (NOTIFY_ONLY_*)", "type", n.Type, "title", title)
+		countNotification(n.Type, resultFiltered, nil)
+		return nil
+	}
+	if !mutes.isMuted(n.IncidentID) && deferToDigest(cfg, n) {
+		slog.Info("notificação adiada para o fim das horas de silêncio", "type", n.Type, "title", title)
+		countNotification(n.Type, resultQuietSuppressed, nil)
+		return nil
+	}
+	// A message let through the rate limiter was already checked when queued.
+	if !n.rateQueued && notifyDedup.duplicate(topic, n, time.Duration(cfg.NtfyDedupSeconds)*time.Second, cfg.now()) {
+		slog.Info("notificação duplicada suprimida", "type", n.Type, "incident_id", n.IncidentID, "title", title)
+		countNotification(n.Type, resultDeduplicated, nil)
+		return nil
+	}
+	notifiers := notifiersFor(cfg, ntfyURL, topic, n)
+	if len(notifiers) == 0 {
+		return nil
+	}
+	// Dry-run mode: log instead of posting
+	if cfg.NtfyDryRun {
+		slog.Info("dry-run ntfy", "type", n.Type, "targets", notifierTargets(notifiers), "title", title, "body", message)
+		countNotification(n.Type, resultDryRun, nil)
+		return nil
+	}
+	if mutes.isMuted(n.IncidentID) {
+		slog.Info("notificação suprimida (ocorrência silenciada)", "type", n.Type, "incident_id", n.IncidentID)
+		countNotification(n.Type, resultMuted, nil)
+		return nil
+	}
+	if paused, _ := notifyPause.status(); paused {
+		slog.Info("notificação suprimida (pausa)", "type", n.Type, "title", title)
+		countNotification(n.Type, resultPaused, nil)
+		return nil
+	}
+	// Quiet hours: lower priority and tag, except close to home
+	switch {
+	case !inQuietHours(cfg):
+	case quietExempt(cfg, n):
+		tags = addTag(tags, "warning")
+	default:
+		// reduzir para prioridade default (3) se vier maior
+		if strings.TrimSpace(priority) == "" {
+			priority = "3"
+		} else if v, err := strconv.Atoi(priority); err == nil && v > 3 {
+			priority = "3"
+		}
+		tags = addTag(tags, "zzz")
+	}
+	md := n.Markdown
+	if useMarkdown {
+		md = message
+	}
+	ev := Event{Type: n.Type, IncidentID: n.IncidentID, Incidents: n.Incidents, Title: title, Body: body, Markdown: md,
+		UseMarkdown: useMarkdown, Tags: tags, Priority: priority, Click: clickURL, Share: n.Share, src: n}
+	if err = fanOut(ctx, notifiers, ev); err == nil {
+		notifyDedup.record(topic, n, cfg.now())
+	}
+	return err
+}
+
+// ntfyNotifier publishes to the ntfy servers of url (NTFY_URLS, or url
+// itself) under topic.
+type ntfyNotifier struct {
+	cfg        *Config
+	url, topic string
+}
+
+func (nt ntfyNotifier) Name() string { return channelNtfy }
+
+func (nt ntfyNotifier) Targets() string {
+	return ntfyServerLabels(ntfyServersFor(nt.cfg, nt.url))
+}
+
+// Send posts ev to each server in turn; a failure on one does not stop the
+// others.
+func (nt ntfyNotifier) Send(ctx context.Context, ev Event) error {
+	cfg, n, ntfyURL, topic := nt.cfg, ev.src, nt.url, nt.topic
+	title, body, tags, priority, clickURL := ev.Title, ev.Body, ev.Tags, ev.Priority, ev.Click
+	useMarkdown, message := ev.UseMarkdown, ev.text()
+
+	// The rate limit is ntfy's: a queued message is sent again to ntfy
+	// alone, so the other channels neither wait nor get it twice.
+	if ntfyRate != nil && !n.rateQueued {
+		if len(n.servers) == 0 {
+			n.servers = ntfyServersFor(cfg, ntfyURL)
+		}
+		if !ntfyRate.allow(notifyJob{url: ntfyURL, topic: topic, n: n}) {
+			slog.Debug("notificação em espera (NTFY_RATE_PER_MINUTE)", "type", n.Type, "title", title)
+			return nil
 		}
-		tags = addTag(tags, "zzz")
 	}
 
 	// Common: derive actions and optional attach URL from body/click
@@ -936,21 +1658,48 @@ func postNtfyExt(ntfyURL, topic, title, body, tags, priority, clickURL string) {
 		})
 	}
 	if clickURL != "" {
-		addAction("Abrir Mapa", clickURL)
+		addAction(tr("action.map"), clickURL)
 	}
 	if urlFogos := extractFogosURLFromBody(body); urlFogos != "" {
-		addAction("Abrir Fogos", urlFogos)
+		addAction(tr("action.fogos"), urlFogos)
+	}
+	if u := shareURL(cfg, n.Share); u != "" {
+		addAction(tr("action.share"), u)
+	}
+	if num := extractURLAfterPrefix(body, tr("anepc.prefix")); num != "" {
+		addAction("ANEPC", anepcURL(cfg, num))
 	}
 	var attachAreaURL string
-	if v := extractURLAfterPrefix(body, "Área URL: "); v != "" {
-		addAction("Abrir área", v)
+	if v := extractURLAfterPrefix(body, tr("area.url")); v != "" {
+		addAction(tr("action.area"), v)
 		attachAreaURL = v
 	} else if v2 := extractURLAfterPrefix(body, "Area URL: "); v2 != "" { // fallback sem acento
-		addAction("Abrir area", v2)
+		addAction(tr("action.area"), v2)
 		attachAreaURL = v2
 	}
+	muteURL := muteActionURL(cfg, n.IncidentID)
+	if u := muteURL; u != "" {
+		auth := "Bearer " + cfg.MuteToken
+		actionsHeader = append(actionsHeader, fmt.Sprintf("http, %s, %s, method=POST, headers.Authorization=%s, clear=true", tr("action.mute"), sanitizeActionURL(u), auth))
+		actionsJSON = append(actionsJSON, map[string]any{
+			"action":  "http",
+			"label":   tr("action.mute"),
+			"url":     u,
+			"method":  "POST",
+			"headers": map[string]string{"Authorization": auth},
+			"clear":   true,
+		})
+	}
+	// ntfy accepts at most 3 actions; "Silenciar" wins over the third view action.
+	if k := len(actionsHeader); k > 3 && muteURL != "" {
+		actionsHeader = append(actionsHeader[:2], actionsHeader[k-1])
+		actionsJSON = append(actionsJSON[:2], actionsJSON[k-1])
+	} else if k > 3 {
+		actionsHeader, actionsJSON = actionsHeader[:3], actionsJSON[:3]
+	}
 
-	useJSON := getenv("NTFY_JSON", "") != ""
+	useJSON := cfg.NtfyJSON
+	seq := ntfySequenceID(cfg, n)
 	// Normalize tags to slice for JSON mode
 	splitTags := func(csv string) []string {
 		if strings.TrimSpace(csv) == "" {
@@ -979,106 +1728,166 @@ func postNtfyExt(ntfyURL, topic, title, body, tags, priority, clickURL string) {
 		}
 	}
 
-	if useJSON {
-		// JSON publishing: POST to root with topic in body
-		endpoint := strings.TrimRight(ntfyURL, "/") + "/"
-		payload := map[string]any{
-			"topic":    topic,
-			"message":  body,
-			"title":    title,
-			"priority": prNum,
+	// One request per server; each may fail on its own
+	newRequest := func(base string) *http.Request {
+		if useJSON {
+			// JSON publishing: POST to root with topic in body
+			endpoint := strings.TrimRight(base, "/") + "/"
+			payload := map[string]any{
+				"topic":    topic,
+				"message":  message,
+				"title":    title,
+				"priority": prNum,
+			}
+			if clickURL != "" {
+				payload["click"] = clickURL
+			}
+			if tg := splitTags(tags); len(tg) > 0 {
+				payload["tags"] = tg
+			}
+			if useMarkdown {
+				payload["markdown"] = true
+			}
+			if icon := cfg.NtfyIconURL; icon != "" {
+				payload["icon"] = icon
+			}
+			if email := emailFor(cfg, n); email != "" {
+				payload["email"] = email
+			}
+			if cfg.NtfyAttachArea && attachAreaURL != "" {
+				payload["attach"] = attachAreaURL
+			}
+			if len(actionsJSON) > 0 && cfg.NtfyActions {
+				payload["actions"] = actionsJSON
+			}
+			if seq != "" {
+				payload["sequence_id"] = seq
+			}
+			b, _ := json.Marshal(payload)
+			req, _ := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(b))
+			req.Header.Set("Content-Type", "application/json; charset=utf-8")
+			return req
+		}
+
+		// Default: header-based publishing (existing behavior)
+		endpoint := strings.TrimRight(base, "/") + "/" + topic
+		// Markdown opcional
+		ct := "text/plain; charset=utf-8"
+		if useMarkdown {
+			ct = "text/markdown; charset=utf-8"
+		}
+		req, _ := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBufferString(message))
+		req.Header.Set("Content-Type", ct)
+		req.Header.Set("Title", title)
+		if tags != "" {
+			req.Header.Set("Tags", tags)
+		}
+		if priority != "" {
+			req.Header.Set("Priority", priority)
+		} else {
+			req.Header.Set("Priority", "3")
 		}
-		if clickURL != "" {
-			payload["click"] = clickURL
+		if strings.TrimSpace(clickURL) != "" {
+			req.Header.Set("Click", clickURL)
 		}
-		if tg := splitTags(tags); len(tg) > 0 {
-			payload["tags"] = tg
+		// Headers extra suportados pelo ntfy (via env)
+		if useMarkdown {
+			req.Header.Set("Markdown", "yes")
 		}
-		if getenv("NTFY_MARKDOWN", "") != "" {
-			payload["markdown"] = true
+		if icon := cfg.NtfyIconURL; icon != "" {
+			req.Header.Set("Icon", icon)
 		}
-		if icon := getenv("NTFY_ICON_URL", ""); icon != "" {
-			payload["icon"] = icon
+		if email := emailFor(cfg, n); email != "" {
+			req.Header.Set("Email", email)
 		}
-		if email := getenv("NTFY_EMAIL", ""); email != "" {
-			payload["email"] = email
+		if cacheCtl := cfg.NtfyCache; cacheCtl != "" {
+			req.Header.Set("Cache", cacheCtl) // e.g., "no"
 		}
-		if getenv("NTFY_ATTACH_AREA", "") != "" && attachAreaURL != "" {
-			payload["attach"] = attachAreaURL
+		if fb := cfg.NtfyFirebase; fb != "" {
+			req.Header.Set("Firebase", fb) // e.g., "no"
 		}
-		if len(actionsJSON) > 0 && getenv("NTFY_ACTIONS", "1") != "0" {
-			payload["actions"] = actionsJSON
+		if cfg.NtfyAttachArea && attachAreaURL != "" {
+			req.Header.Set("Attach", attachAreaURL)
 		}
-		b, _ := json.Marshal(payload)
-		req, _ := http.NewRequest("POST", endpoint, bytes.NewReader(b))
-		req.Header.Set("Content-Type", "application/json; charset=utf-8")
-		resp, err := httpClient.Do(req)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "ntfy erro:", err)
-			return
+		if len(actionsHeader) > 0 && cfg.NtfyActions {
+			req.Header.Set("Actions", strings.Join(actionsHeader, "; "))
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode >= 400 {
-			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-			fmt.Fprintf(os.Stderr, "ntfy HTTP %d: %s\n", resp.StatusCode, strings.TrimSpace(string(msg)))
+		if seq != "" {
+			req.Header.Set("X-Sequence-ID", seq)
 		}
-		return
-	}
-
-	// Default: header-based publishing (existing behavior)
-	endpoint := strings.TrimRight(ntfyURL, "/") + "/" + topic
-	// Markdown opcional
-	useMarkdown := getenv("NTFY_MARKDOWN", "")
-	ct := "text/plain; charset=utf-8"
-	if useMarkdown != "" {
-		ct = "text/markdown; charset=utf-8"
+		return req
 	}
-	req, _ := http.NewRequest("POST", endpoint, bytes.NewBufferString(body))
-	req.Header.Set("Content-Type", ct)
-	req.Header.Set("Title", title)
-	if tags != "" {
-		req.Header.Set("Tags", tags)
-	}
-	if priority != "" {
-		req.Header.Set("Priority", priority)
-	} else {
-		req.Header.Set("Priority", "3")
+	servers := n.servers
+	if len(servers) == 0 {
+		servers = ntfyServersFor(cfg, ntfyURL)
 	}
-	if strings.TrimSpace(clickURL) != "" {
-		req.Header.Set("Click", clickURL)
-	}
-	// Headers extra suportados pelo ntfy (via env)
-	if useMarkdown != "" {
-		req.Header.Set("Markdown", "yes")
-	}
-	if icon := getenv("NTFY_ICON_URL", ""); icon != "" {
-		req.Header.Set("Icon", icon)
-	}
-	if email := getenv("NTFY_EMAIL", ""); email != "" {
-		req.Header.Set("Email", email)
-	}
-	if cacheCtl := getenv("NTFY_CACHE", ""); cacheCtl != "" {
-		req.Header.Set("Cache", cacheCtl) // e.g., "no"
-	}
-	if fb := getenv("NTFY_FIREBASE", ""); fb != "" {
-		req.Header.Set("Firebase", fb) // e.g., "no"
+	var errs []error
+	for _, srv := range servers {
+		req := newRequest(srv.URL)
+		if srv.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+srv.Token)
+		}
+		if err := sendNtfy(req, ntfyURL, topic, n, srv); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	if getenv("NTFY_ATTACH_AREA", "") != "" && attachAreaURL != "" {
-		req.Header.Set("Attach", attachAreaURL)
+	return errors.Join(errs...)
+}
+
+// sendNtfy posts req to srv. On a 429 with the rate limiter running, n goes
+// back to the head of the queue for srv alone and the bucket pauses for
+// Retry-After.
+func sendNtfy(req *http.Request, ntfyURL, topic string, n Notification, srv ntfyServer) error {
+	err := doNtfyRequest(req, n.Type, srv.label())
+	var ra *retryAfterError
+	if !errors.As(err, &ra) {
+		return err
 	}
-	if len(actionsHeader) > 0 && getenv("NTFY_ACTIONS", "1") != "0" {
-		req.Header.Set("Actions", strings.Join(actionsHeader, "; "))
+	if ntfyRate == nil {
+		countDelivery(srv.label(), n.Type, resultError, err)
+		return err
 	}
-	resp, err := httpClient.Do(req)
+	slog.Warn("ntfy HTTP 429; envio em pausa", "type", n.Type, "server", srv.label(), "retry_after", ra.wait)
+	countDelivery(srv.label(), n.Type, resultRateLimited, nil)
+	n.servers = []ntfyServer{srv}
+	ntfyRate.retryLater(notifyJob{url: ntfyURL, topic: topic, n: n}, ra.wait)
+	return nil
+}
+
+// ntfyHTTPError is a publish the ntfy server answered with an error status.
+type ntfyHTTPError struct {
+	status      int
+	server, msg string
+}
+
+func (e *ntfyHTTPError) Error() string {
+	return fmt.Sprintf("ntfy HTTP %d (%s): %s", e.status, e.server, e.msg)
+}
+
+// doNtfyRequest sends a prepared ntfy request and records latency and result metrics.
+func doNtfyRequest(req *http.Request, typ, server string) error {
+	start := time.Now()
+	resp, err := conf().httpClient.Do(req)
+	ntfyRequestDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "ntfy erro:", err)
-		return
+		slog.Error("ntfy erro", "type", typ, "server", server, "err", err)
+		countDelivery(server, typ, resultError, err)
+		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &retryAfterError{wait: parseRetryAfter(resp.Header.Get("Retry-After"), conf().now()), msg: strings.TrimSpace(string(msg))}
+	}
 	if resp.StatusCode >= 400 {
 		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		fmt.Fprintf(os.Stderr, "ntfy HTTP %d: %s\n", resp.StatusCode, strings.TrimSpace(string(msg)))
+		slog.Error("ntfy HTTP", "type", typ, "server", server, "status", resp.StatusCode, "body", strings.TrimSpace(string(msg)))
+		err := &ntfyHTTPError{status: resp.StatusCode, server: server, msg: strings.TrimSpace(string(msg))}
+		countDelivery(server, typ, resultError, err)
+		return err
 	}
+	countDelivery(server, typ, resultOK, nil)
+	return nil
 }
 
 // Canonicalize/migrate inconsistent municipality keys in state
@@ -1121,9 +1930,9 @@ func canonicalizeStateKeys(st perMuniState, wantedSet map[string][]string) perMu
 }
 
 // Helpers for filtering
-func parseIntSetFromEnv(name string) map[int]struct{} {
+func parseIntSet(v string) map[int]struct{} {
 	set := map[int]struct{}{}
-	v := strings.TrimSpace(getenv(name, ""))
+	v = strings.TrimSpace(v)
 	if v == "" {
 		return set
 	}
@@ -1139,9 +1948,9 @@ func parseIntSetFromEnv(name string) map[int]struct{} {
 	return set
 }
 
-func parseStrSetFromEnv(name string) map[string]struct{} {
+func parseStrSet(v string) map[string]struct{} {
 	set := map[string]struct{}{}
-	v := strings.TrimSpace(getenv(name, ""))
+	v = strings.TrimSpace(v)
 	if v == "" {
 		return set
 	}
@@ -1155,27 +1964,27 @@ func parseStrSetFromEnv(name string) map[string]struct{} {
 	return set
 }
 
-func shouldKeepByAdminUnits(p map[string]any) bool {
+func shouldKeepByAdminUnits(cfg *Config, p map[string]any) bool {
 	// District
-	if ds := parseStrSetFromEnv("DISTRICTS"); len(ds) > 0 {
+	if ds := cfg.districts; len(ds) > 0 {
 		d := strings.ToLower(stripAccents(getPropStr(p, "district")))
 		if _, ok := ds[d]; !ok {
 			return false
 		}
 	}
-	if rs := parseStrSetFromEnv("REGIOES"); len(rs) > 0 {
+	if rs := cfg.regioes; len(rs) > 0 {
 		r := strings.ToLower(stripAccents(getPropStr(p, "regiao")))
 		if _, ok := rs[r]; !ok {
 			return false
 		}
 	}
-	if srs := parseStrSetFromEnv("SUBREGIOES"); len(srs) > 0 {
+	if srs := cfg.subregioes; len(srs) > 0 {
 		sr := strings.ToLower(stripAccents(getPropStr(p, "sub_regiao")))
 		if _, ok := srs[sr]; !ok {
 			return false
 		}
 	}
-	if frs := parseStrSetFromEnv("FREGUESIAS"); len(frs) > 0 {
+	if frs := cfg.freguesias; len(frs) > 0 {
 		f := strings.ToLower(stripAccents(getPropStr(p, "freguesia")))
 		if _, ok := frs[f]; !ok {
 			return false
@@ -1184,9 +1993,9 @@ func shouldKeepByAdminUnits(p map[string]any) bool {
 	return true
 }
 
-func shouldKeepByNatureAndStatus(p map[string]any) bool {
+func shouldKeepByNatureAndStatus(cfg *Config, p map[string]any) bool {
 	// EXCLUDE_STATUS_CODES = comma-int list
-	if exc := parseIntSetFromEnv("EXCLUDE_STATUS_CODES"); len(exc) > 0 {
+	if exc := cfg.excludeStatusCodes; len(exc) > 0 {
 		if scF, ok := toFloat(p["statusCode"]); ok {
 			if _, bad := exc[int(scF)]; bad {
 				return false
@@ -1194,20 +2003,20 @@ func shouldKeepByNatureAndStatus(p map[string]any) bool {
 		}
 	}
 	// Extras: include/exclude por naturezaCode (ex.: 3101)
-	if incCodes := parseStrSetFromEnv("INCLUDE_NATUREZA_CODE"); len(incCodes) > 0 {
+	if incCodes := cfg.includeNaturezaCode; len(incCodes) > 0 {
 		code := strings.ToLower(stripAccents(getPropStr(p, "naturezaCode")))
 		if _, ok := incCodes[code]; !ok {
 			return false
 		}
 	}
-	if excCodes := parseStrSetFromEnv("EXCLUDE_NATUREZA_CODE"); len(excCodes) > 0 {
+	if excCodes := cfg.excludeNaturezaCode; len(excCodes) > 0 {
 		code := strings.ToLower(stripAccents(getPropStr(p, "naturezaCode")))
 		if _, ok := excCodes[code]; ok {
 			return false
 		}
 	}
 	// INCLUDE_STATUS / EXCLUDE_STATUS (por nome; substring)
-	if incS := parseStrSetFromEnv("INCLUDE_STATUS"); len(incS) > 0 {
+	if incS := cfg.includeStatus; len(incS) > 0 {
 		cur := strings.ToLower(stripAccents(getPropStr(p, "status")))
 		ok := false
 		for want := range incS {
@@ -1220,7 +2029,7 @@ func shouldKeepByNatureAndStatus(p map[string]any) bool {
 			return false
 		}
 	}
-	if excS := parseStrSetFromEnv("EXCLUDE_STATUS"); len(excS) > 0 {
+	if excS := cfg.excludeStatus; len(excS) > 0 {
 		cur := strings.ToLower(stripAccents(getPropStr(p, "status")))
 		for bad := range excS {
 			if bad != "" && (strings.Contains(cur, bad) || cur == bad) {
@@ -1229,7 +2038,7 @@ func shouldKeepByNatureAndStatus(p map[string]any) bool {
 		}
 	}
 	// INCLUDE_NATUREZA (por nome; já existia)
-	if inc := parseStrSetFromEnv("INCLUDE_NATUREZA"); len(inc) > 0 {
+	if inc := cfg.includeNatureza; len(inc) > 0 {
 		nz := strings.ToLower(stripAccents(getPropStr(p, "natureza")))
 		nzc := strings.ToLower(stripAccents(getPropStr(p, "naturezaCode")))
 		if _, ok := inc[nz]; ok {
@@ -1264,10 +2073,8 @@ func enrichMeansTagsAndPriority(p map[string]any, baseTags, basePriority string)
 	hc := get("heliCoord")
 	pf := get("planeFight")
 	// thresholds (0 disables)
-	thMan, _ := strconv.Atoi(getenv("MIN_MAN", "0"))
-	thTer, _ := strconv.Atoi(getenv("MIN_TERRAIN", "0"))
-	thAir, _ := strconv.Atoi(getenv("MIN_AERIAL", "0"))
-	thAq, _ := strconv.Atoi(getenv("MIN_AQUATIC", "0"))
+	cfg := conf()
+	thMan, thTer, thAir, thAq := cfg.MinMan, cfg.MinTerrain, cfg.MinAerial, cfg.MinAquatic
 	tags := baseTags
 	prio := basePriority
 	// ntfy: 5 = máx/urgente, 3 = default, 1 = min → elevar prioridade quando n > cur
@@ -1287,33 +2094,33 @@ func enrichMeansTagsAndPriority(p map[string]any, baseTags, basePriority string)
 	}
 	// Melhor mapeamento de emojis
 	if thMan > 0 && man >= thMan {
-		tags = addTag(tags, "busts_in_silhouette")
+		tags = addTagsCSV(tags, tagFor("man_threshold"))
 		inc(4)
 	}
 	if thTer > 0 && ter >= thTer {
-		tags = addTag(tags, "deciduous_tree")
+		tags = addTagsCSV(tags, tagFor("terrain_threshold"))
 		inc(4)
 	}
 	if thAir > 0 && air >= thAir {
-		tags = addTag(tags, "small_airplane")
+		tags = addTagsCSV(tags, tagFor("aerial"))
 		inc(5)
 	}
 	if thAq > 0 && aq >= thAq {
-		tags = addTag(tags, "ocean")
+		tags = addTagsCSV(tags, tagFor("aquatic"))
 		inc(4)
 	}
 	// aeronaves dedicadas
 	if hf > 0 || hc > 0 {
-		tags = addTag(tags, "helicopter")
+		tags = addTagsCSV(tags, tagFor("helicopter"))
 		inc(5)
 	}
 	if pf > 0 {
-		tags = addTag(tags, "airplane")
+		tags = addTagsCSV(tags, tagFor("plane"))
 		inc(5)
 	}
 	// importante
-	if imp := strings.ToLower(strings.TrimSpace(getPropStr(p, "important"))); imp == "true" || imp == "1" {
-		tags = addTag(tags, "exclamation")
+	if isImportant(p) {
+		tags = addTagsCSV(tags, tagFor("important"))
 		inc(5)
 	}
 	return tags, prio
@@ -1322,10 +2129,10 @@ func enrichMeansTagsAndPriority(p map[string]any, baseTags, basePriority string)
 func parseExtraTags(extra string) (tags []string, highlight string) {
 	s := strings.ToLower(stripAccents(extra))
 	if strings.Contains(s, "reabert") {
-		tags = append(tags, "white_check_mark")
+		tags = append(tags, strings.Split(tagFor("reopened"), ",")...)
 	}
 	if strings.Contains(s, "cortad") || strings.Contains(s, "encerrad") || strings.Contains(s, "fechad") || strings.Contains(s, "corte") {
-		tags = append(tags, "no_entry")
+		tags = append(tags, strings.Split(tagFor("road_closed"), ",")...)
 	}
 	// keep original as highlight
 	highlight = extra
@@ -1358,120 +2165,195 @@ func saveKMLAndCompute(kmlStr, saveDir, id string) (areaKm2, perimeterKm float64
 	} else {
 		uri = "file://" + uri
 	}
-	// Very simple polygon extraction
+	areaKm2, perimeterKm = kmlAreaPerimeter(kmlStr)
+	return areaKm2, perimeterKm, uri, true, nil
+}
+
+// kmlAreaPerimeter computes the area (km²) and perimeter (km) of the first
+// polygon in a KML document; zero when it has fewer than 3 points.
+func kmlAreaPerimeter(kmlStr string) (areaKm2, perimeterKm float64) {
+	type pt struct{ lat, lon float64 }
+	var pts []pt
+	for _, c := range kmlCoords(kmlStr) {
+		pts = append(pts, pt{lat: c[1], lon: c[0]})
+	}
+	if len(pts) >= 3 {
+		// Compute area/perimeter with equirectangular projection around mean lat
+		var lat0 float64
+		for _, p := range pts {
+			lat0 += p.lat
+		}
+		lat0 /= float64(len(pts))
+		const R = 6371000.0
+		toXY := func(p pt) (x, y float64) {
+			x = (p.lon * math.Pi / 180) * R * math.Cos(lat0*math.Pi/180)
+			y = (p.lat * math.Pi / 180) * R
+			return
+		}
+		// Shoelace area and perimeter
+		var area2 float64
+		var per float64
+		for i := 0; i < len(pts); i++ {
+			j := (i + 1) % len(pts)
+			x1, y1 := toXY(pts[i])
+			x2, y2 := toXY(pts[j])
+			area2 += x1*y2 - x2*y1
+			dx := x2 - x1
+			dy := y2 - y1
+			per += math.Hypot(dx, dy)
+		}
+		areaKm2 = math.Abs(area2) / 2 / 1e6
+		perimeterKm = per / 1000
+	}
+	return areaKm2, perimeterKm
+}
+
+// kmlCoords returns the [lon, lat] points of the first <coordinates> element.
+func kmlCoords(kmlStr string) [][2]float64 {
 	coordsStart := strings.Index(strings.ToLower(kmlStr), "<coordinates>")
 	coordsEnd := strings.Index(strings.ToLower(kmlStr), "</coordinates>")
-	if coordsStart > 0 && coordsEnd > coordsStart {
-		coordsText := kmlStr[coordsStart+13 : coordsEnd]
-		// parse lon,lat[,alt] tuples separated by space or newline
-		type pt struct{ lat, lon float64 }
-		var pts []pt
-		for _, tok := range strings.Fields(coordsText) {
-			parts := strings.Split(tok, ",")
-			if len(parts) >= 2 {
-				lon, e1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
-				lat, e2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
-				if e1 == nil && e2 == nil {
-					pts = append(pts, pt{lat: lat, lon: lon})
-				}
-			}
-		}
-		if len(pts) >= 3 {
-			// Compute area/perimeter with equirectangular projection around mean lat
-			var lat0 float64
-			for _, p := range pts {
-				lat0 += p.lat
-			}
-			lat0 /= float64(len(pts))
-			const R = 6371000.0
-			toXY := func(p pt) (x, y float64) {
-				x = (p.lon * math.Pi / 180) * R * math.Cos(lat0*math.Pi/180)
-				y = (p.lat * math.Pi / 180) * R
-				return
+	if coordsStart <= 0 || coordsEnd <= coordsStart {
+		return nil
+	}
+	coordsText := kmlStr[coordsStart+13 : coordsEnd]
+	// parse lon,lat[,alt] tuples separated by space or newline
+	var pts [][2]float64
+	for _, tok := range strings.Fields(coordsText) {
+		parts := strings.Split(tok, ",")
+		if len(parts) >= 2 {
+			lon, e1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+			lat, e2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+			if e1 == nil && e2 == nil {
+				pts = append(pts, [2]float64{lon, lat})
 			}
-			// Shoelace area and perimeter
-			var area2 float64
-			var per float64
-			for i := 0; i < len(pts); i++ {
-				j := (i + 1) % len(pts)
-				x1, y1 := toXY(pts[i])
-				x2, y2 := toXY(pts[j])
-				area2 += x1*y2 - x2*y1
-				dx := x2 - x1
-				dy := y2 - y1
-				per += math.Hypot(dx, dy)
-			}
-			areaKm2 = math.Abs(area2) / 2 / 1e6
-			perimeterKm = per / 1000
 		}
 	}
-	return areaKm2, perimeterKm, uri, true, nil
+	return pts
 }
 
-// In-memory status tracking for transitions and summaries
-var (
-	lastStatusByID = map[string]string{}
-	firstSeenByID  = map[string]time.Time{}
-	concludedAtID  = map[string]time.Time{}
-
-	// Removido: lastSummaryHour (causava repetição quando re-inicializado)
-	// lastSummaryHour int
-	lastSummaryDay string
-
-	// Novo: marca do último sumário horário enviado ("YYYY-MM-DD HH"), persistente
-	lastHourlyMark string
+// Incidentes ativos (após filtros) no último ciclo concluído
+var lastCycleFiltered []Feature
 
-	// Novo: último snapshot de meios/extra por ID, persistente
-	lastMeansByID = map[string]Means{}
-	lastExtraByID = map[string]string{}
-)
-
-func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
-	features, err := fetchActiveFeatures()
-	if err != nil {
-		return false, err
-	}
-	wantedSet, wantedFlat := makeWantedSet(wantedNames)
-	filtered := filterByMunicipios(features, wantedFlat)
+// filterFeatures keeps the features of the monitored municipalities that
+// pass the admin-unit, nature/status and radius filters.
+func filterFeatures(cfg *Config, features []Feature) []Feature {
+	filtered := filterByMunicipios(features, cfg.wantedFlat)
 	// Additional admin filters
 	tmp := make([]Feature, 0, len(filtered))
 	for _, f := range filtered {
-		if shouldKeepByAdminUnits(f.Properties) && shouldKeepByNatureAndStatus(f.Properties) {
+		if shouldKeepByAdminUnits(cfg, f.Properties) && shouldKeepByNatureAndStatus(cfg, f.Properties) {
 			tmp = append(tmp, f)
 		}
 	}
 	filtered = tmp
 	// Optional radius filter
-	centerLat, _ := strconv.ParseFloat(strings.TrimSpace(getenv("CENTER_LAT", "")), 64)
-	centerLon, _ := strconv.ParseFloat(strings.TrimSpace(getenv("CENTER_LON", "")), 64)
-	radiusKm, _ := strconv.ParseFloat(strings.TrimSpace(getenv("RADIUS_KM", "0")), 64)
-	if radiusKm > 0 && !math.IsNaN(centerLat) && !math.IsNaN(centerLon) && centerLat != 0 {
-		filtered = filterByRadius(filtered, centerLat, centerLon, radiusKm)
+	if cfg.RadiusKm > 0 && cfg.hasCenter() {
+		filtered = filterByRadius(filtered, cfg.CenterLat, cfg.CenterLon, cfg.RadiusKm)
+	}
+	return filtered
+}
+
+// setActiveGauges resets the per-incident gauges and sets them from filtered.
+func setActiveGauges(cfg *Config, ms *MonitorState, filtered []Feature, now time.Time) {
+	if cfg.MetricsDisable {
+		return
+	}
+	if activeIncidents != nil {
+		activeIncidents.Reset()
+		for _, f := range filtered {
+			lvs := make([]string, len(activeLabels))
+			for i, l := range activeLabels {
+				lvs[i] = metricLabel(getPropStr(f.Properties, l))
+			}
+			activeIncidents.WithLabelValues(lvs...).Inc()
+		}
+	}
+	importantIncidents.Reset()
+	for _, f := range filtered {
+		if isImportant(f.Properties) {
+			importantIncidents.WithLabelValues(getPropStr(f.Properties, "concelho")).Inc()
+		}
 	}
-	debugf("Fetched %d features; filtered to %d", len(features), len(filtered))
+	setIncidentMetrics(ms, filtered, now)
+}
 
-	// load state
-	st, seen, _ := loadLastState(statePath)
-	if st == nil {
-		st = perMuniState{}
+func runOnce(cfg *Config, ms *MonitorState) (changed bool, err error) {
+	ctx, span := tracer.Start(context.Background(), "cycle")
+	defer func() {
+		span.SetAttributes(attribute.Bool("changed", changed))
+		endSpan(span, err)
+	}()
+	// Messages are built into an outbox and handed to the package dispatch
+	// by send once ms is unlocked, so a full queue never holds the state.
+	// They carry the cycle's span, so the notify spans join the trace even
+	// when a worker sends them later.
+	var outbox []notifyJob
+	send := func() {
+		for _, j := range outbox {
+			dispatch(j.url, j.topic, j.n)
+		}
+		outbox = nil
+	}
+	dispatch := func(ntfyURL, topic string, n Notification) {
+		n.parent = span.SpanContext()
+		outbox = append(outbox, notifyJob{url: ntfyURL, topic: topic, n: n})
+	}
+	store := cfg.stateStore()
+	quietDigestTick(cfg)
+	features, err := fetchFeatures(ctx, cfg)
+	health.recordFetch(err)
+	feedAlert.track(err)
+	if err != nil {
+		serveCachedFeed(cfg, ms, store, cfg.now())
+		return false, err
 	}
-	if seen == nil {
-		seen = perMuniSeen{}
+	checkGeometry(cfg, features)
+	feedCache.store(cfg, features, cfg.now())
+	schema.check(cfg, features)
+	wantedSet := cfg.wantedSet
+	_, filterSpan := tracer.Start(ctx, "filter")
+	filtered := filterFeatures(cfg, features)
+	filterSpan.SetAttributes(attribute.Int("features.fetched", len(features)), attribute.Int("features.filtered", len(filtered)))
+	filterSpan.End()
+	span.SetAttributes(attribute.Int("features.fetched", len(features)), attribute.Int("features.filtered", len(filtered)))
+	slog.Debug("features obtidas", "fetched", len(features), "filtered", len(filtered))
+
+	// ms is locked while the feed is compared with it and it is updated,
+	// and again for the pruning, summaries and save at the end; the detail,
+	// weather and notification requests run in between without it.
+	unlock := ms.lock()
+	defer func() { unlock() }()
+
+	// state: kept in memory between cycles, read from disk on the first one
+	_, loadSpan := tracer.Start(ctx, "state.load")
+	st, seen, err := ms.loadForCycle(store)
+	endSpan(loadSpan, err)
+	if err != nil {
+		return false, err
+	}
+	if n, ok := ms.takeRecovered(); ok {
+		dispatch(cfg.NtfyURL, cfg.NtfyTopic, n)
 	}
 	// migrate/canonicalize keys
 	st = canonicalizeStateKeys(st, wantedSet)
 	seen = canonicalizeSeenKeys(seen, wantedSet)
 
 	// compute new IDs per muni
-	now := time.Now()
-	ntfyURL := getenv("NTFY_URL", "https://ntfy.sh")
-	topic := getenv("NTFY_TOPIC", "bombeiros-serta")
-	priority := getenv("NTFY_PRIORITY", "5")
-	tags := getenv("NTFY_TAGS", "fire,rotating_light")
+	now := cfg.now()
+	ntfyURL := cfg.NtfyURL
+	topic := cfg.NtfyTopic
+	priority := cfg.NtfyPriority
+	tags := cfg.NtfyTags
 
 	perMuniNew := map[string][]Feature{}
 	// IDs currently present in the active filtered feed
 	presentIDs := map[string]struct{}{}
+	aliased := false // new ID aliases or merged duplicates to persist
+	rekeyed := false // known incidents put back under their key by the warm-up
+	var warmed []warmUpEntry
+	warmUp := !ms.warm
+	concluded := false // written right away, see MonitorState.flush
+	var archived []archiveRecord
 	for _, f := range filtered {
 		mun := normMunicipio(getMunicipio(f.Properties))
 		// map syns to canonical key if needed
@@ -1485,7 +2367,9 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 			}
 		}
 		perMuniNew[canon] = append(perMuniNew[canon], f)
-		if id := getID(f.Properties); strings.TrimSpace(id) != "" {
+		id, changed := ms.resolveID(st, seen, f.Properties)
+		aliased = aliased || changed
+		if strings.TrimSpace(id) != "" {
 			presentIDs[id] = struct{}{}
 		}
 	}
@@ -1509,6 +2393,10 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 		f       Feature
 		prev    string
 		cur     string
+		// quoted from the state before it is unlocked
+		maxLine       string
+		timelineLine  string
+		reactivations int
 	}
 	events := make([]newEvent, 0, 8)
 	statusEvents := make([]newEvent, 0, 8)
@@ -1521,6 +2409,7 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 		old     Means
 		new     Means
 		f       Feature
+		trend   string
 	}
 	type extraEvent struct {
 		muniKey string
@@ -1532,12 +2421,19 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 	}
 	meansEvents := make([]meansEvent, 0, 8)
 	extraEvents := make([]extraEvent, 0, 8)
+	var roadEvents []roadEvent
+	var importantEvents []importantEvent
+	var burnedEvents []burnedEvent
+	var movedEvents []movedEvent
+	roadsChanged := false
+	positionsChanged := false
+	maxMeansChanged := false
 
 	for muniKey, feats := range perMuniNew {
 		for _, f := range feats {
-			id := getID(f.Properties)
+			id := ms.canonicalID(f.Properties)
 			if id == "" {
-				if getenv("DEBUG", "") != "" || strings.EqualFold(getenv("LOG_LEVEL", ""), "debug") {
+				if debugEnabled() {
 					debugf("skip: feature without ID in muniKey=%s; props keys=%v", muniKey, func() []string {
 						ks := make([]string, 0, len(f.Properties))
 						for k := range f.Properties {
@@ -1549,6 +2445,7 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 				}
 				continue
 			}
+			ms.recordHistory(id, f.Properties, now)
 			// mark last seen
 			if seen[muniKey] == nil {
 				seen[muniKey] = map[string]time.Time{}
@@ -1556,22 +2453,15 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 			seen[muniKey][id] = now
 
 			// Novo: ler meios atuais
-			getInt := func(name string) int {
-				if v, ok := toFloat(f.Properties[name]); ok {
-					return int(v)
-				}
-				return 0
-			}
-			curMeans := Means{
-				Man:     getInt("man"),
-				Terrain: getInt("terrain"),
-				Aerial:  getInt("aerial"),
-				Aquatic: getInt("meios_aquaticos"),
-			}
+			curMeans := meansFromProps(f.Properties)
 			curExtra := getPropStr(f.Properties, "extra")
 
-			// new incident
+			// new incident, unless the warm-up finds it in the saved state
 			_, existed := st[muniKey][id]
+			if ms.warmUpMatch(&warmed, id, f, existed, curMeans) && !existed {
+				st[muniKey][id] = struct{}{}
+				existed, rekeyed = true, true
+			}
 			if !existed {
 				st[muniKey][id] = struct{}{}
 				when := prettyTime(f.Properties["dateTime"])
@@ -1579,25 +2469,29 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 				if disp == "" {
 					disp = muniKey
 				}
-				if getenv("DEBUG", "") != "" || strings.EqualFold(getenv("LOG_LEVEL", ""), "debug") {
-					debugf("new: muniKey=%s id=%s disp=%s", muniKey, id, disp)
-				}
+				slog.Info("novo incidente", "event_type", notifyNew, "incident_id", id, "concelho", disp,
+					"natureza", getPropStr(f.Properties, "natureza"), "status", getPropStr(f.Properties, "status"))
 				events = append(events, newEvent{muniKey: muniKey, disp: disp, id: id, when: when, f: f})
-				if _, ok := firstSeenByID[id]; !ok {
-					firstSeenByID[id] = now
+				incidentsStarted.WithLabelValues(disp, getPropStr(f.Properties, "natureza")).Inc()
+				if _, ok := ms.firstSeen[id]; !ok {
+					ms.firstSeen[id] = now
 				}
 			} else {
 				// Novo: detetar alterações de meios e extra (só após já existir)
-				if prev, ok := lastMeansByID[id]; ok {
+				if prev, ok := ms.means[id]; ok {
 					if prev != curMeans {
+						slog.Info("alteração de meios", "event_type", notifyMeans, "incident_id", id,
+							"concelho", getMunicipio(f.Properties), "old", prev, "new", curMeans)
 						meansEvents = append(meansEvents, meansEvent{
 							muniKey: muniKey, disp: getMunicipio(f.Properties), id: id,
 							old: prev, new: curMeans, f: f,
 						})
 					}
 				}
-				if prevX, ok := lastExtraByID[id]; ok {
+				if prevX, ok := ms.extra[id]; ok {
 					if strings.TrimSpace(prevX) != strings.TrimSpace(curExtra) {
+						slog.Info("alteração de extra", "event_type", notifyExtra, "incident_id", id,
+							"concelho", getMunicipio(f.Properties))
 						extraEvents = append(extraEvents, extraEvent{
 							muniKey: muniKey, disp: getMunicipio(f.Properties), id: id,
 							old: prevX, new: curExtra, f: f,
@@ -1606,14 +2500,61 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 				}
 			}
 			// Atualizar snapshots sempre no fim
-			lastMeansByID[id] = curMeans
-			lastExtraByID[id] = curExtra
+			maxMeansChanged = ms.trackMaxMeans(id, curMeans) || maxMeansChanged
+			ms.sampleMeans(id, getPropStr(f.Properties, "status"), curMeans, now)
+			ms.means[id] = curMeans
+			ms.extra[id] = curExtra
+
+			// Estradas cortadas/reabertas segundo o extra
+			if roads, closed, reopened := updateRoads(ms.roads[id], curExtra); !slices.Equal(roads, ms.roads[id]) {
+				if len(closed) > 0 || len(reopened) > 0 {
+					slog.Info("estradas", "event_type", notifyRoad, "incident_id", id,
+						"concelho", getMunicipio(f.Properties), "closed", closed, "reopened", reopened)
+					roadEvents = append(roadEvents, roadEvent{disp: getMunicipio(f.Properties), id: id, closed: closed, reopened: reopened, f: f})
+				}
+				if len(roads) == 0 {
+					delete(ms.roads, id)
+				} else {
+					ms.roads[id] = roads
+				}
+				roadsChanged = true
+			}
+
+			// Flag "important": só transições; na primeira vez vai na notificação de novo
+			imp := isImportant(f.Properties)
+			if was, ok := ms.important[id]; ok && was != imp && existed {
+				slog.Info("importante", "event_type", notifyImportant, "incident_id", id,
+					"concelho", getMunicipio(f.Properties), "important", imp)
+				importantEvents = append(importantEvents, importantEvent{disp: getMunicipio(f.Properties), id: id, on: imp, f: f})
+			}
+			ms.important[id] = imp
+
+			// Área ardida do ICNF: na primeira vez vai na notificação de novo
+			if a, ok := icnfBurnedArea(f.Properties); ok && burnedAreaChanged(ms.burned[id], a.Total, cfg.BurnedAreaDeltaHa) {
+				if existed {
+					slog.Info("área ardida", "event_type", notifyBurned, "incident_id", id,
+						"concelho", getMunicipio(f.Properties), "from_ha", ms.burned[id], "to_ha", a.Total)
+					burnedEvents = append(burnedEvents, burnedEvent{disp: getMunicipio(f.Properties), id: id, prev: ms.burned[id], area: a, f: f})
+				}
+				ms.burned[id] = a.Total
+			}
+
+			// Ponto deslocado mais do que MOVE_THRESHOLD_KM
+			km, moved, stored := ms.trackPosition(cfg, id, f)
+			positionsChanged = positionsChanged || stored
+			if moved && existed {
+				slog.Info("localização atualizada", "event_type", notifyMoved, "incident_id", id,
+					"concelho", getMunicipio(f.Properties), "km", math.Round(km*10)/10)
+				movedEvents = append(movedEvents, movedEvent{disp: getMunicipio(f.Properties), id: id, km: km, f: f})
+			}
 
 			// Status change detection — forçar envio na primeira vez que o vemos
 			curStatus := getPropStr(f.Properties, "status")
-			prev := lastStatusByID[id]
+			prev := ms.status[id]
 			forceFirstSeenStatus := !existed
 			if curStatus != "" && (curStatus != prev || forceFirstSeenStatus) {
+				slog.Info("mudança de estado", "event_type", notifyStatus, "incident_id", id,
+					"concelho", getMunicipio(f.Properties), "from", prev, "to", curStatus)
 				statusEvents = append(statusEvents, newEvent{
 					muniKey: muniKey,
 					disp:    getMunicipio(f.Properties),
@@ -1626,24 +2567,175 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 				if prev != "" && curStatus != prev {
 					statusTransitions.WithLabelValues(prev, curStatus).Inc()
 				}
-				lastStatusByID[id] = curStatus
+				ms.status[id] = curStatus
+				// A change found by the warm-up happened while the monitor
+				// was down, so its time is not known.
+				if ms.recordStatus(id, curStatus, f.Properties, now) && !warmUp {
+					if from, d, ok := ms.leftStatus(id); ok {
+						statusDuration.WithLabelValues(from).Observe(d.Seconds())
+					}
+				}
+				if isReactivation(prev, curStatus) {
+					ms.reactivate(id, prev, f.Properties, now)
+				}
 				if strings.EqualFold(curStatus, "Conclusão") || strings.Contains(strings.ToLower(stripAccents(curStatus)), "conclus") {
-					concludedAtID[id] = now
-					if t0, ok := firstSeenByID[id]; ok && now.After(t0) {
-						timeToConclusion.Observe(now.Sub(t0).Seconds())
+					ms.concludedAt[id] = now
+					ms.recordConcluded(id, now)
+					concluded = true
+					incidentsConcluded.WithLabelValues(getMunicipio(f.Properties), getPropStr(f.Properties, "natureza")).Inc()
+					if d, ok := ms.timeToConclude(id, f.Properties, now); ok {
+						timeToConclusion.Observe(d.Seconds())
 					}
+					archived = append(archived, ms.archiveRecord(id, f, now))
 				}
 			}
 		}
 	}
 
-	anyChange := len(events) > 0 || len(statusEvents) > 0 || len(meansEvents) > 0 || len(extraEvents) > 0
+	if warmUp {
+		ms.warm = true
+		logWarmUp(warmed)
+	}
+
+	// What the messages quote from the state, read before it is unlocked
+	for i := range statusEvents {
+		ev := &statusEvents[i]
+		ev.maxLine = ms.maxMeansLine(ev.id, ev.cur)
+		ev.timelineLine = ms.timelineLine(cfg, ev.id, ev.cur)
+		ev.reactivations = ms.spans[ev.id].Reactivations
+	}
+	for i := range meansEvents {
+		meansEvents[i].trend = ms.meansTrendLine(meansEvents[i].id)
+	}
+	unlock()
+
+	for _, ev := range statusEvents {
+		ms.grafanaTrack(cfg, ev.id, ev.f, ev.cur, now)
+	}
+
+	anyChange := len(events) > 0 || len(statusEvents) > 0 || len(meansEvents) > 0 || len(extraEvents) > 0 || len(roadEvents) > 0 || len(importantEvents) > 0 || len(burnedEvents) > 0 || len(movedEvents) > 0
+	if cfg.OutputJSON || span.IsRecording() {
+		var newIDs, changedIDs []string
+		for _, ev := range events {
+			newIDs = append(newIDs, ev.id)
+		}
+		for _, ev := range statusEvents {
+			changedIDs = append(changedIDs, ev.id)
+		}
+		for _, ev := range meansEvents {
+			changedIDs = append(changedIDs, ev.id)
+		}
+		for _, ev := range extraEvents {
+			changedIDs = append(changedIDs, ev.id)
+		}
+		for _, ev := range roadEvents {
+			changedIDs = append(changedIDs, ev.id)
+		}
+		for _, ev := range importantEvents {
+			changedIDs = append(changedIDs, ev.id)
+		}
+		for _, ev := range burnedEvents {
+			changedIDs = append(changedIDs, ev.id)
+		}
+		for _, ev := range movedEvents {
+			changedIDs = append(changedIDs, ev.id)
+		}
+		span.SetAttributes(attribute.StringSlice("incidents.new", newIDs), attribute.StringSlice("incidents.changed", changedIDs))
+		if cfg.OutputJSON {
+			reportCycle(filtered, newIDs, changedIDs)
+		}
+	}
+
+	// perMuniNew is a map: fix the order before anything is sent
+	sort.Slice(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		return eventBefore(a.f, b.f, a.disp, b.disp, a.id, b.id)
+	})
+	sort.Slice(statusEvents, func(i, j int) bool {
+		a, b := statusEvents[i], statusEvents[j]
+		return eventBefore(a.f, b.f, a.disp, b.disp, a.id, b.id)
+	})
+	sort.Slice(meansEvents, func(i, j int) bool {
+		a, b := meansEvents[i], meansEvents[j]
+		return eventBefore(a.f, b.f, a.disp, b.disp, a.id, b.id)
+	})
+	sort.Slice(extraEvents, func(i, j int) bool {
+		a, b := extraEvents[i], extraEvents[j]
+		return eventBefore(a.f, b.f, a.disp, b.disp, a.id, b.id)
+	})
+	sort.Slice(roadEvents, func(i, j int) bool {
+		a, b := roadEvents[i], roadEvents[j]
+		return eventBefore(a.f, b.f, a.disp, b.disp, a.id, b.id)
+	})
+	sort.Slice(importantEvents, func(i, j int) bool {
+		a, b := importantEvents[i], importantEvents[j]
+		return eventBefore(a.f, b.f, a.disp, b.disp, a.id, b.id)
+	})
+	sort.Slice(burnedEvents, func(i, j int) bool {
+		a, b := burnedEvents[i], burnedEvents[j]
+		return eventBefore(a.f, b.f, a.disp, b.disp, a.id, b.id)
+	})
+	sort.Slice(movedEvents, func(i, j int) bool {
+		a, b := movedEvents[i], movedEvents[j]
+		return eventBefore(a.f, b.f, a.disp, b.disp, a.id, b.id)
+	})
+
+	// Nearest first, so the closest incident is the first notification
+	if cfg.hasCenter() {
+		dist := func(f Feature) float64 {
+			if km, _, ok := distanceFromCenter(cfg, f); ok {
+				return km
+			}
+			return math.Inf(1)
+		}
+		sort.SliceStable(events, func(i, j int) bool { return dist(events[i].f) < dist(events[j].f) })
+		sort.SliceStable(statusEvents, func(i, j int) bool { return dist(statusEvents[i].f) < dist(statusEvents[j].f) })
+	}
+
+	// Optional per-incident detail, merged before the messages are built
+	if cfg.DetailFetch {
+		// New incidents also get a status event; both share the same properties.
+		merged := map[string]bool{}
+		for _, ev := range append(slices.Clip(events), statusEvents...) {
+			if !merged[ev.id] {
+				merged[ev.id] = true
+				mergeDetail(cfg, ev.f.Properties, ev.id, now)
+			}
+		}
+	}
 
 	// notify (aggregate or per-incident)
 	if anyChange {
+		// Status storm: past NTFY_STATUS_SUMMARY_THRESHOLD the status changes
+		// go out as one message grouped by transition; reactivations still
+		// get their own.
+		var statusGroup *Notification
+		if t := cfg.NtfyStatusSummaryThreshold; t > 0 && len(statusEvents) > t {
+			keep := statusEvents[:0:0]
+			var ts []statusTransition
+			var incidents []Feature
+			var ids []string
+			pr := "1"
+			for _, ev := range statusEvents {
+				cur := getPropStr(ev.f.Properties, "status")
+				if isReactivation(ev.prev, cur) {
+					keep = append(keep, ev)
+					continue
+				}
+				ts = append(ts, statusTransition{from: statusFrom(ev.prev), to: cur, muni: ev.disp})
+				incidents = append(incidents, ev.f)
+				ids = append(ids, ev.id)
+				if p := statusPriority(cur, "3"); p > pr {
+					pr = p
+				}
+			}
+			if len(ts) > 0 {
+				statusGroup = &Notification{Type: notifyStatus, Title: tr("status.many", len(ts)), Body: groupTransitions(ts), Tags: "arrows_counterclockwise", Priority: pr, Incidents: incidents, IncidentIDs: ids}
+			}
+			statusEvents = keep
+		}
 		// Optional aggregation threshold (0 = disabled)
-		summaryThreshold := 0
-		fmt.Sscanf(getenv("NTFY_SUMMARY_THRESHOLD", "0"), "%d", &summaryThreshold)
+		summaryThreshold := cfg.NtfySummaryThreshold
 		if summaryThreshold > 0 && len(events) >= summaryThreshold {
 			counts := map[string]int{}
 			sampleIDs := map[string][]string{}
@@ -1662,9 +2754,15 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 				lines = append(lines, line)
 			}
 			sort.Strings(lines)
-			title := fmt.Sprintf("Novos incidentes (%d)", len(events))
-			body := strings.Join(lines, "\n") + fmt.Sprintf("\nTotal ativo no alvo: %d", len(filtered))
-			postNtfyExt(ntfyURL, topic, title, body, tags, priority, "")
+			title := tr("new.many", len(events))
+			body := strings.Join(lines, "\n") + "\n" + tr("total.active", len(filtered))
+			incidents := make([]Feature, 0, len(events))
+			ids := make([]string, 0, len(events))
+			for _, ev := range events {
+				incidents = append(incidents, ev.f)
+				ids = append(ids, ev.id)
+			}
+			dispatch(ntfyURL, topic, Notification{Type: notifyNew, Title: title, Body: body, Tags: tags, Priority: priority, Incidents: incidents, IncidentIDs: ids})
 
 			// NEW: não perder transições de estado na agregação
 			for _, ev := range statusEvents {
@@ -1672,51 +2770,71 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 				curStatus := getPropStr(p, "status")
 				prev := ev.prev
 				nature := getPropStr(p, "natureza")
-				title := fmt.Sprintf("%s → %s — %s", func() string {
-					if strings.TrimSpace(prev) == "" {
-						return "Novo"
-					}
-					return prev
-				}(), curStatus, ev.disp)
+				title := fmt.Sprintf("%s → %s — %s", statusFrom(prev), curStatus, ev.disp)
 				if strings.TrimSpace(nature) != "" {
 					title += " — " + nature
 				}
-				body := fmt.Sprintf("ID: %s\nMeios: %s", ev.id, meansSummaryFromPropsPT(p))
+				body := tr("status.body", ev.id, meansSummaryFromPropsPT(p))
+				if num := anepcNumber(p); num != "" {
+					body += "\n" + tr("anepc.prefix") + num
+				}
+				if dl := distanceLine(cfg, ev.f); dl != "" {
+					body += "\n" + dl
+				}
+				if nl := nearLine(cfg, ev.f); nl != "" {
+					body += "\n" + nl
+				}
+				if p["coordsSwapped"] == true {
+					body += "\n" + tr("coords.swapped")
+				}
 				infoTags, extraLines := extraInfoTags(p)
 				if len(extraLines) > 0 {
 					body += "\n" + strings.Join(extraLines, "\n")
 				}
-				pr := priority
-				s := strings.ToLower(stripAccents(curStatus))
-				if strings.Contains(s, "em curso") || strings.Contains(s, "em resolucao") {
-					pr = "5"
-				} else if strings.Contains(s, "despacho") {
-					pr = "4"
-				} else if strings.Contains(s, "vigilancia") || strings.Contains(s, "conclus") {
-					pr = "3"
+				if ev.maxLine != "" {
+					body += "\n" + ev.maxLine
 				}
+				if ev.timelineLine != "" {
+					body += "\n" + ev.timelineLine
+				}
+				pr := statusPriority(curStatus, priority)
+				s := strings.ToLower(stripAccents(curStatus))
 				baseTags := adjustTagsForNature(addTagsCSV(tags, infoTags), p)
 				tg, pr2 := enrichMeansTagsAndPriority(p, baseTags, pr)
 				if strings.Contains(s, "conclus") {
-					tg = addTag(tg, "white_check_mark")
+					tg = addTagsCSV(tg, tagFor("concluded"))
 				}
 				// Fogos link só para incêndios
 				click := mapsURLForFeature(ev.f, ev.disp)
 				if isFireIncident(p) && ev.id != "" {
-					body += "\nFogos: https://fogos.pt/fogo/" + ev.id
+					body += "\n" + tr("fogos.line", "https://fogos.pt/fogo/"+ev.id)
 				}
-				postNtfyExt(ntfyURL, topic, title, body, tg, pr2, click)
+				body, share := withShare(cfg, ev.f, ev.id, body)
+				md := markdownBody(body, mdTransition(statusFrom(prev), curStatus))
+				dispatch(ntfyURL, topic, Notification{Type: notifyStatus, Title: title, Body: body, Tags: tg, Priority: pr2, Click: click, IncidentID: ev.id, Markdown: md, Incidents: []Feature{ev.f}, Share: share})
 			}
 		} else {
 			for _, ev := range events {
 				p := ev.f.Properties
 				status := getPropStr(p, "status", "phase", "estado")
 				nature := getPropStr(p, "natureza", "type", "tipo")
-				title := fmt.Sprintf("Novo em %s — %s", ev.disp, nature)
+				title := tr("new.title", ev.disp, nature)
 				if ev.when != "" {
 					title += " (" + ev.when + ")"
 				}
-				body := fmt.Sprintf("ID: %s\nMunicípio: %s\nEstado: %s\nMeios: %s", ev.id, ev.disp, status, meansSummaryFromPropsPT(p))
+				body := tr("new.body", ev.id, ev.disp, status, meansSummaryFromPropsPT(p))
+				if num := anepcNumber(p); num != "" {
+					body += "\n" + tr("anepc.prefix") + num
+				}
+				if dl := distanceLine(cfg, ev.f); dl != "" {
+					body += "\n" + dl
+				}
+				if nl := nearLine(cfg, ev.f); nl != "" {
+					body += "\n" + nl
+				}
+				if p["coordsSwapped"] == true {
+					body += "\n" + tr("coords.swapped")
+				}
 				if al := aeronavesLineFromPropsPT(p); al != "" {
 					body += "\n" + al
 				}
@@ -1724,7 +2842,7 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 				if extra := getPropStr(p, "extra"); extra != "" {
 					_, hi := parseExtraTags(extra)
 					if hi != "" {
-						body += "\nExtra: " + hi
+						body += "\n" + tr("extra.line", hi)
 					}
 				}
 				// Info adicional e tags
@@ -1732,18 +2850,26 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 				if len(extraLines) > 0 {
 					body += "\n" + strings.Join(extraLines, "\n")
 				}
+				if isImportant(p) {
+					body += "\n" + tr("important.line")
+				}
 				// KML área
 				if kml := getPropStr(p, "kmlVost", "kml"); kml != "" {
-					if areaKm2, perKm, areaURL, saved, _ := saveKMLAndCompute(kml, getenv("SAVE_KML_DIR", ""), ev.id); saved {
-						body += fmt.Sprintf("\nÁrea: %.2f km², Perímetro: %.1f km", areaKm2, perKm)
-						body += "\nÁrea URL: " + areaURL
+					if areaKm2, perKm, areaURL, saved, _ := saveKMLAndCompute(kml, cfg.SaveKMLDir, ev.id); saved {
+						body += "\n" + tr("area.line", areaKm2, perKm)
+						body += "\n" + tr("area.url") + areaURL
 					}
 				}
-				body += fmt.Sprintf("\nTotal ativo no alvo: %d", len(filtered))
+				ipma.learn(cfg, p)
+				risk, hasRisk := ipma.risk(cfg, ev.disp, now)
+				if hasRisk {
+					body += "\n" + tr("ipma.line", rcmLabel(risk))
+				}
+				body += "\n" + tr("total.active", len(filtered))
 				clickURL := mapsURLForFeature(ev.f, ev.disp)
 				// Só adicionar Fogos se for incêndio
 				if isFireIncident(p) && ev.id != "" {
-					body += "\nFogos: https://fogos.pt/fogo/" + ev.id
+					body += "\n" + tr("fogos.line", "https://fogos.pt/fogo/"+ev.id)
 				}
 				// Enriquecer tags/prioridade
 				baseTags := adjustTagsForNature(addTagsCSV(tags, infoTags), p)
@@ -1756,7 +2882,13 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 						}
 					}
 				}
-				postNtfyExt(ntfyURL, topic, title, body, tg, pr, clickURL)
+				if hasRisk && cfg.IPMARiskBump > 0 && risk >= cfg.IPMARiskBump {
+					tg = addTag(tg, "warning")
+					pr = bumpPriority(pr)
+				}
+				body, tg, pr = weatherEnrich(cfg, ev.f, body, tg, pr, now)
+				body, share := withShare(cfg, ev.f, ev.id, body)
+				dispatch(ntfyURL, topic, Notification{Type: notifyNew, Title: title, Body: body, Tags: tg, Priority: pr, Click: clickURL, IncidentID: ev.id, Incidents: []Feature{ev.f}, Share: share})
 			}
 			// Send status-change notifications
 			for _, ev := range statusEvents {
@@ -1764,16 +2896,23 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 				curStatus := getPropStr(p, "status")
 				prev := ev.prev
 				nature := getPropStr(p, "natureza")
-				title := fmt.Sprintf("%s → %s — %s", func() string {
-					if strings.TrimSpace(prev) == "" {
-						return "Novo"
-					}
-					return prev
-				}(), curStatus, ev.disp)
+				title := fmt.Sprintf("%s → %s — %s", statusFrom(prev), curStatus, ev.disp)
 				if strings.TrimSpace(nature) != "" {
 					title += " — " + nature
 				}
-				body := fmt.Sprintf("ID: %s\nMeios: %s", ev.id, meansSummaryFromPropsPT(p))
+				body := tr("status.body", ev.id, meansSummaryFromPropsPT(p))
+				if num := anepcNumber(p); num != "" {
+					body += "\n" + tr("anepc.prefix") + num
+				}
+				if dl := distanceLine(cfg, ev.f); dl != "" {
+					body += "\n" + dl
+				}
+				if nl := nearLine(cfg, ev.f); nl != "" {
+					body += "\n" + nl
+				}
+				if p["coordsSwapped"] == true {
+					body += "\n" + tr("coords.swapped")
+				}
 				if al := aeronavesLineFromPropsPT(p); al != "" {
 					body += "\n" + al
 				}
@@ -1781,7 +2920,7 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 				if extra := getPropStr(p, "extra"); extra != "" {
 					_, hi := parseExtraTags(extra)
 					if hi != "" {
-						body += "\nExtra: " + hi
+						body += "\n" + tr("extra.line", hi)
 					}
 				}
 				// Info adicional
@@ -1789,30 +2928,32 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 				if len(extraLines) > 0 {
 					body += "\n" + strings.Join(extraLines, "\n")
 				}
+				if ev.maxLine != "" {
+					body += "\n" + ev.maxLine
+				}
+				if ev.timelineLine != "" {
+					body += "\n" + ev.timelineLine
+				}
 				// Fogos link só para incêndios
 				if isFireIncident(p) && ev.id != "" {
-					body += "\nFogos: https://fogos.pt/fogo/" + ev.id
+					body += "\n" + tr("fogos.line", "https://fogos.pt/fogo/"+ev.id)
 				}
 				// Ajuste de prioridade por status
-				pr := priority
+				pr := statusPriority(curStatus, priority)
 				s := strings.ToLower(stripAccents(curStatus))
-				if strings.Contains(s, "em curso") || strings.Contains(s, "em resolucao") {
-					pr = "5"
-				} else if strings.Contains(s, "despacho") {
-					pr = "4"
-				} else if strings.Contains(s, "vigilancia") || strings.Contains(s, "conclus") {
-					pr = "3"
-				}
 				baseTags := adjustTagsForNature(addTagsCSV(tags, infoTags), p)
 				tg, pr2 := enrichMeansTagsAndPriority(p, baseTags, pr)
-				prevS := strings.ToLower(stripAccents(prev))
-				if (strings.Contains(prevS, "conclus") || strings.Contains(prevS, "vigil")) && (strings.Contains(s, "curso") || strings.Contains(s, "despacho")) {
-					tg = addTag(tg, "repeat")
-					title = "Reativado: " + title
+				if isReactivation(prev, curStatus) {
+					tg = addTagsCSV(tg, tagFor("reactivated"))
+					title = reactivationTitle(ev.reactivations, title)
 					pr2 = "5"
 				}
+				// Escalation to "em curso" from a known earlier status
+				if prev != "" && strings.Contains(s, "curso") {
+					body, tg, pr2 = weatherEnrich(cfg, ev.f, body, tg, pr2, now)
+				}
 				if strings.Contains(s, "conclus") {
-					tg = addTag(tg, "white_check_mark")
+					tg = addTagsCSV(tg, tagFor("concluded"))
 				}
 				// Extra tags
 				if extra := getPropStr(p, "extra"); extra != "" {
@@ -1822,11 +2963,13 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 						}
 					}
 				}
-				postNtfyExt(ntfyURL, topic, title, body, tg, pr2, mapsURLForFeature(ev.f, ev.disp))
+				body, share := withShare(cfg, ev.f, ev.id, body)
+				md := markdownBody(body, mdTransition(statusFrom(prev), curStatus))
+				dispatch(ntfyURL, topic, Notification{Type: notifyStatus, Title: title, Body: body, Tags: tg, Priority: pr2, Click: mapsURLForFeature(ev.f, ev.disp), IncidentID: ev.id, Markdown: md, Incidents: []Feature{ev.f}, Share: share})
 			}
 
 			// Novo: enviar atualizações de meios
-			if getenv("NOTIFY_MEANS_CHANGES", "1") != "0" {
+			if cfg.NotifyMeansChanges {
 				for _, ev := range meansEvents {
 					parts := []string{}
 					appendMeansChangePartsPT(&parts, ev.old, ev.new)
@@ -1838,52 +2981,114 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 					if len(parts) == 0 {
 						continue
 					}
-					title := fmt.Sprintf("Atualização de meios — %s", ev.disp)
+					title := tr("means.title", ev.disp)
 					body := fmt.Sprintf("ID: %s\n%s", ev.id, strings.Join(parts, ", "))
+					// the markdown version shows the changes as a table instead
+					var rest []string
+					if al := aeronavesLineFromPropsPT(p); al != "" {
+						rest = append(rest, al)
+					}
+					if ev.trend != "" {
+						body += "\n" + ev.trend
+						rest = append(rest, ev.trend)
+					}
+					if dl := distanceLine(cfg, ev.f); dl != "" {
+						body += "\n" + dl
+						rest = append(rest, dl)
+					}
 					infoTags, extraLines := extraInfoTags(p)
 					if len(extraLines) > 0 {
 						body += "\n" + strings.Join(extraLines, "\n")
+						rest = append(rest, extraLines...)
 					}
+					md := markdownBody(strings.Join(rest, "\n"), "ID: "+ev.id, meansTableMD(ev.old, ev.new))
 					baseTags := adjustTagsForNature(addTag(tags, infoTags), p)
 					tg, pr := enrichMeansTagsAndPriority(p, baseTags, "3")
-					postNtfyExt(ntfyURL, topic, title, body, tg, pr, mapsURLForFeature(ev.f, ev.disp))
+					dispatch(ntfyURL, topic, Notification{Type: notifyMeans, Title: title, Body: body, Tags: tg, Priority: pr, Click: mapsURLForFeature(ev.f, ev.disp), IncidentID: ev.id, Markdown: md, Incidents: []Feature{ev.f}})
 				}
 			}
 			// Novo: enviar alterações no extra
-			if getenv("NOTIFY_EXTRA_CHANGES", "1") != "0" {
+			if cfg.NotifyExtraChanges {
 				for _, ev := range extraEvents {
 					// ignorar se ambos vazios
 					if strings.TrimSpace(ev.old) == strings.TrimSpace(ev.new) {
 						continue
 					}
-					title := fmt.Sprintf("Atualização — %s", ev.disp)
-					body := fmt.Sprintf("ID: %s\nExtra: %s", ev.id, strings.TrimSpace(ev.new))
+					title := tr("extra.title", ev.disp)
+					change, added := extraChange(ev.old, ev.new)
+					body := tr("extra.body", ev.id, strings.TrimSpace(ev.new))
+					if change != strings.TrimSpace(ev.new) {
+						body = tr("extra.changes", ev.id, change)
+					}
+					if dl := distanceLine(cfg, ev.f); dl != "" {
+						body += "\n" + dl
+					}
 					// tags adicionais do 'extra' (ex.: estrada cortada)
-					more, _ := parseExtraTags(ev.new)
+					more, _ := parseExtraTags(added)
 					baseTags := adjustTagsForNature(tags, ev.f.Properties)
 					tg := baseTags
 					for _, t := range more {
 						tg = addTag(tg, t)
 					}
-					postNtfyExt(ntfyURL, topic, title, body, tg, "3", mapsURLForFeature(ev.f, ev.disp))
+					dispatch(ntfyURL, topic, Notification{Type: notifyExtra, Title: title, Body: body, Tags: tg, Priority: "3", Click: mapsURLForFeature(ev.f, ev.disp), IncidentID: ev.id, Incidents: []Feature{ev.f}})
 				}
 			}
 		}
+		for _, ev := range importantEvents {
+			dispatch(ntfyURL, topic, ev.notification(cfg))
+		}
+		if cfg.NotifyBurnedArea {
+			for _, ev := range burnedEvents {
+				dispatch(ntfyURL, topic, ev.notification(cfg))
+			}
+		}
+		if cfg.NotifyMoved {
+			for _, ev := range movedEvents {
+				dispatch(ntfyURL, topic, ev.notification(cfg))
+			}
+		}
+		if cfg.NotifyRoadClosures {
+			for _, ev := range roadEvents {
+				for _, n := range ev.notifications() {
+					dispatch(ntfyURL, topic, n)
+				}
+			}
+		}
+		if statusGroup != nil {
+			dispatch(ntfyURL, topic, *statusGroup)
+		}
+	}
+	send()
+
+	// Written after the notifications so a slow disk cannot hold them up
+	archiveConcluded(cfg, archived)
+
+	// Periodic summary (hourly/daily), scheduled on the BOMBEIROS_TZ wall clock
+	local := now.In(cfg.loc)
+	nowHour := local.Hour()
+	nowDay := local.Format("2006-01-02")
+	// With IPMA_RISK the daily summary also goes out on quiet days, for the
+	// risk classes; they may be fetched, so before the state is locked.
+	var riskLines []string
+	if _, day := ms.SummaryMarks(); cfg.SummaryDaily && nowDay > day && nowHour >= 8 {
+		riskLines = ipmaRiskLines(cfg, now)
 	}
 
-	// Cleanup: remove incidents that no longer appear in the active list (keep JSON lean)
+	unlock = ms.lock()
+
+	// Cleanup: remove incidents that no longer appear in the active list (keep JSON lean).
+	// Municipalities no longer in MUNICIPIOS are left alone (their incidents are
+	// filtered out, not finished) and only expire through STATE_TTL_HOURS, so
+	// adding one back does not announce its incidents again.
 	pruned := 0
-	if getenv("CLEAN_FINISHED", "1") != "0" {
+	if cfg.CleanFinished {
 		for muni, set := range st {
+			if _, ok := wantedSet[muni]; !ok {
+				continue
+			}
 			for id := range set {
 				if _, ok := presentIDs[id]; !ok {
-					delete(st[muni], id)
-					delete(seen[muni], id)
-					delete(lastStatusByID, id)
-					delete(firstSeenByID, id)
-					delete(concludedAtID, id)
-					delete(lastMeansByID, id)
-					delete(lastExtraByID, id)
+					ms.forgetID(st, seen, muni, id)
 					pruned++
 				}
 			}
@@ -1891,237 +3096,491 @@ func runOnce(statePath string, wantedNames []string) (changed bool, err error) {
 	}
 
 	// TTL retention: prune old IDs
-	ttlHours, _ := strconv.ParseFloat(strings.TrimSpace(getenv("STATE_TTL_HOURS", "0")), 64)
-	if ttlHours > 0 {
-		cutoff := now.Add(-time.Duration(ttlHours * float64(time.Hour)))
-		for muni, set := range st {
-			for id := range set {
-				ts, ok := seen[muni][id]
-				if !ok || ts.Before(cutoff) {
-					delete(st[muni], id)
-					delete(seen[muni], id)
-					delete(lastStatusByID, id)
-					delete(firstSeenByID, id)
-					delete(concludedAtID, id)
-					delete(lastMeansByID, id)
-					delete(lastExtraByID, id)
-					pruned++
-				}
+	if ttl := cfg.StateTTL; ttl > 0 {
+		pruned += ms.pruneSeenBefore(st, seen, now.Add(-ttl))
+	}
+
+	var saveErr error
+
+	// Once per hour, on the first poll of the hour (not only at minute 0, which
+	// a slow POLL_SECONDS or an outage can miss); only with active incidents.
+	// Marks are "2006-01-02 15" / "2006-01-02", so string order is time order.
+	if cfg.SummaryHourly {
+		hourMark := local.Format("2006-01-02 15")
+		if hourMark > ms.lastHourlyMark {
+			cur := countSummary(filtered)
+			if cur.Total > 0 {
+				dispatch(ntfyURL, topic, summaryNotification(cfg, tr("summary.hourly", nowHour), cur, ms.prevHourly, 6, ", ", "bar_chart"))
+				ms.lastHourlyMark = hourMark
+				ms.prevHourly = cur
+				ms.dirty = true
 			}
 		}
 	}
 
-	// Metrics gauges: reset then set counts for current filtered
-	if getenv("METRICS_DISABLE", "") == "" {
-		activeIncidents.Reset()
-		for _, f := range filtered {
-			p := f.Properties
-			activeIncidents.WithLabelValues(
-				getPropStr(p, "district"),
-				getPropStr(p, "concelho"),
-				getPropStr(p, "regiao"),
-				getPropStr(p, "natureza"),
-				getPropStr(p, "status"),
-			).Inc()
-		}
-	}
-
-	// Periodic summary (hourly/daily)
-	nowHour := now.Hour()
-	nowDay := now.Format("2006-01-02")
-	nowMin := now.Minute()
-
-	// Corrigido: só no minuto 0 e uma vez por hora, persistente; enviar apenas se houver ativos
-	if getenv("SUMMARY_HOURLY", "1") != "0" {
-		hourMark := now.Format("2006-01-02 15")
-		if nowMin == 0 && lastHourlyMark != hourMark {
-			// Build summary by concelho, natureza, estado
-			byConc := map[string]int{}
-			byNat := map[string]int{}
-			bySta := map[string]int{}
-			for _, f := range filtered {
-				p := f.Properties
-				byConc[getPropStr(p, "concelho")]++
-				byNat[getPropStr(p, "natureza")]++
-				bySta[getPropStr(p, "status")]++
-			}
-			mk := func(m map[string]int) string {
-				type kv struct {
-					k string
-					v int
-				}
-				arr := []kv{}
-				for k, v := range m {
-					arr = append(arr, kv{k, v})
-				}
-				sort.Slice(arr, func(i, j int) bool { return arr[i].v > arr[j].v })
-				parts := []string{}
-				for i, e := range arr {
-					if i >= 6 {
-						break
-					}
-					parts = append(parts, fmt.Sprintf("%s: %d", e.k, e.v))
-				}
-				if len(parts) == 0 {
-					return "(n/a)"
-				}
-				return strings.Join(parts, ", ")
+	// Daily: first poll from 08:00 on, once per day
+	if cfg.SummaryDaily && nowDay > ms.lastSummaryDay && nowHour >= 8 {
+		cur := countSummary(filtered)
+		title := tr("summary.daily", nowDay)
+		count := cur.Total
+		if count > 0 || len(riskLines) > 0 {
+			body := cur.body(ms.prevDaily, 10, "; ")
+			if count == 0 {
+				body, _, _ = strings.Cut(body, "\n") // no groups to list
 			}
-			title := fmt.Sprintf("Sumário horário (%02d:00)", nowHour)
-			count := len(filtered)
-			if count > 0 {
-				body := fmt.Sprintf("Ativos: %d\nConcelhos: %s\nNatureza: %s\nEstados: %s", count, mk(byConc), mk(byNat), mk(bySta))
-				sumTags := stripTagCSV(tags, "fire")
-				sumTags = addTag(sumTags, "bar_chart")
-				postNtfyExt(ntfyURL, topic, title, body, sumTags, "3", "")
-				lastHourlyMark = hourMark
-				// persist marks immediately to avoid duplicates when no incident changes
-				if err := saveLastState(statePath, st, seen); err != nil {
-					fmt.Fprintln(os.Stderr, "Erro a gravar estado:", err)
-				}
+			if d, n := ms.medianDispatchTime(now); n > 0 {
+				body += "\n" + trn("despacho.median", n, fmtDuration(d))
 			}
-		}
-	}
-
-	// Corrigido: diário apenas às 08:00 em ponto e uma vez por dia; enviar apenas se houver ativos
-	if getenv("SUMMARY_DAILY", "1") != "0" && lastSummaryDay != nowDay && nowHour == 8 && nowMin == 0 {
-		byConc := map[string]int{}
-		byNat := map[string]int{}
-		bySta := map[string]int{}
-		for _, f := range filtered {
-			p := f.Properties
-			byConc[getPropStr(p, "concelho")]++
-			byNat[getPropStr(p, "natureza")]++
-			bySta[getPropStr(p, "status")]++
-		}
-		mk := func(m map[string]int) string {
-			type kv struct {
-				k string
-				v int
-			}
-			arr := []kv{}
-			for k, v := range m {
-				arr = append(arr, kv{k, v})
-			}
-			sort.Slice(arr, func(i, j int) bool { return arr[i].v > arr[j].v })
-			parts := []string{}
-			for i, e := range arr {
-				if i >= 10 {
-					break
-				}
-				parts = append(parts, fmt.Sprintf("%s: %d", e.k, e.v))
+			if ha, n := ms.burnedSince(now.Add(-24 * time.Hour)); n > 0 {
+				body += "\n" + trn("icnf.summary", n, ha)
 			}
-			if len(parts) == 0 {
-				return "(n/a)"
+			if len(riskLines) > 0 {
+				body += "\n" + tr("ipma.heading") + "\n" + strings.Join(riskLines, "\n")
 			}
-			return strings.Join(parts, "; ")
-		}
-		title := fmt.Sprintf("Sumário diário (%s)", nowDay)
-		count := len(filtered)
-		if count > 0 {
-			body := fmt.Sprintf("Ativos: %d\nConcelhos: %s\nNatureza: %s\nEstados: %s", count, mk(byConc), mk(byNat), mk(bySta))
 			sumTags := stripTagCSV(tags, "fire")
 			sumTags = addTag(sumTags, "calendar")
-			postNtfyExt(ntfyURL, topic, title, body, sumTags, "3", "")
-			lastSummaryDay = nowDay
-			// persist immediately
-			if err := saveLastState(statePath, st, seen); err != nil {
-				fmt.Fprintln(os.Stderr, "Erro a gravar estado:", err)
-			}
+			sumTags = trendTag(cfg, sumTags, cur, ms.prevDaily)
+			dispatch(ntfyURL, topic, Notification{Type: notifySummary, Title: title, Body: body, Tags: sumTags, Priority: "3", event: eventDailySummary})
+			ms.lastSummaryDay = nowDay
+			ms.prevDaily = cur
+			ms.dirty = true
 		}
 	}
 
-	// Save state when there were new events or TTL pruned entries
-	if anyChange || pruned > 0 {
-		if err := saveLastState(statePath, st, seen); err != nil {
-			fmt.Fprintln(os.Stderr, "Erro a gravar estado:", err)
+	// Weekly report: first poll from SUMMARY_WEEKLY_AT on, always as markdown
+	ms.recordPeak(cfg, len(filtered), now)
+	if cfg.SummaryWeekly {
+		if mark, due := ms.weeklyDue(cfg, now); due {
+			title, body, md := ms.buildWeeklySummary(cfg, now)
+			sumTags := addTag(stripTagCSV(tags, "fire"), "spiral_calendar")
+			dispatch(ntfyURL, topic, Notification{Type: notifySummary, Title: title, Body: body, Tags: sumTags, Priority: "3", Markdown: md, ForceMarkdown: true, event: eventWeeklySummary})
+			ms.lastWeeklyMark = mark
+			ms.dirty = true
 		}
+	}
+
+	// Save state when there were new events or TTL pruned entries, at most
+	// once per STATE_FLUSH_SECONDS; conclusions and single-shot runs are
+	// written right away.
+	if anyChange || pruned > 0 || aliased || rekeyed || roadsChanged || positionsChanged || maxMeansChanged {
+		ms.dirty = true
+	}
+	if ms.dirty {
+		_, saveSpan := tracer.Start(ctx, "state.save")
+		if err := ms.flush(cfg, store, st, seen, concluded || cfg.PollInterval == 0); err != nil {
+			saveErr = err
+		}
+		endSpan(saveSpan, saveErr)
 	} else {
-		debugf("Sem alterações; estado não gravado")
+		slog.Debug("sem alterações; estado não gravado")
+	}
+	ms.cycleState, ms.cycleSeen = st, seen
+	unlock()
+
+	setActiveGauges(cfg, ms, filtered, now)
+	lastCycleFiltered = filtered
+	views := buildIncidentViews(cfg, ms, filtered, now)
+	incidents.publish(views, now)
+	capAlerts.update(cfg, views, now)
+	send()
+	if saveErr != nil {
+		return anyChange, fmt.Errorf("erro a gravar estado: %w", saveErr)
 	}
-	fmt.Printf("{\n  \"count\": %d,\n  \"timestamp\": %q\n}\n", len(filtered), now.Format(time.RFC3339))
+	slog.Info("ciclo concluído", "count", len(filtered), "fetched", len(features), "changed", anyChange, "pruned", pruned)
 	return anyChange, nil
 }
 
-func main() {
-	pollSecStr := getenv("POLL_SECONDS", "30")
-	pollSec := 30
-	fmt.Sscanf(pollSecStr, "%d", &pollSec)
-	stateFile := getenv("STATE_FILE", "last_ids.json")
-	if !filepath.IsAbs(stateFile) {
-		stateFile = filepath.Join(".", stateFile)
+// cmdRun is the monitor itself: `run` polls until interrupted, `once` runs a
+// single cycle (as does run with POLL_SECONDS=0).
+func cmdRun(name string, args []string, once bool) {
+	var printConfig, jsonOut *bool
+	cfg, loader, _ := loadCommandConfig(name, args, func(fs *flag.FlagSet) {
+		printConfig = fs.Bool("print-config", false, "mostrar a configuração efetiva (segredos ocultados) e sair")
+		jsonOut = fs.Bool("json", false, "escrever o resultado do ciclo em JSON no stdout (equivale a OUTPUT_JSON=1)")
+	})
+	if once {
+		cfg.PollInterval = 0
+	}
+	if *jsonOut {
+		cfg.OutputJSON = true
+	}
+	if cfg.OutputJSON {
+		if cfg.PollInterval > 0 {
+			slog.Warn("OUTPUT_JSON só se aplica a execuções únicas (once); ignorado")
+			cfg.OutputJSON = false
+		} else {
+			// stdout carries only the report: no tray on Windows
+			cfg.UseTray, cfg.Tray = false, false
+		}
+	}
+	if *printConfig {
+		if err := cfg.print(os.Stdout); err != nil {
+			slog.Error("print-config", "err", err)
+			os.Exit(1)
+		}
+		return
 	}
-	// Determine tray mode early (Windows defaults to tray; disable with USE_TRAY=0)
+
+	// Graceful shutdown on Ctrl+C / SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serve(ctx, stop, cfg, loader, true)
+}
+
+// serve runs the monitor until ctx is canceled (or a single-shot run ends),
+// then shuts down cleanly. stop cancels ctx; the Windows service passes its
+// own context here so SCM stop requests take the same path as Ctrl+C.
+func serve(ctx context.Context, stop context.CancelFunc, cfg *Config, loader *configLoader, allowTray bool) {
+	setConfig(cfg)
+
+	// Determine tray mode early (Windows defaults to tray; disable with USE_TRAY=0).
+	// Linux/macOS opt in with TRAY=1 on a binary built with -tags tray.
 	isWindows := strings.EqualFold(runtime.GOOS, "windows")
-	isTray := isWindows && getenv("USE_TRAY", "1") != "0"
+	isTray := allowTray && ((isWindows && cfg.UseTray) || (!isWindows && cfg.Tray && trayBuilt))
+
+	// With the Windows console hidden the log would be lost; it goes to a file.
+	logErr := openLogFile(cfg, isTray && isWindows)
+	setupLogging(os.Stderr, cfg)
+	if logErr != nil {
+		slog.Warn("registo em ficheiro desligado", "err", logErr)
+	} else if logFile != nil && !isTray {
+		slog.Info("registo também em " + logFile.path)
+	}
+	reportEnvironment()
+	warnInsecureTLS(cfg)
+	setupTracing()
+	defer flushTraces()
+
+	if allowTray && !isWindows && cfg.Tray && !trayBuilt {
+		slog.Warn("TRAY=1 ignorado: binário compilado sem -tags tray")
+	}
 	if isTray {
 		// Hide console immediately to avoid any taskbar flash
 		hideConsoleWindow()
 	}
 
-	wanted := wantedMunicipiosFromEnv()
 	if !isTray {
-		fmt.Printf("Monitor a cada %ds para: %s\n", pollSec, muniLabel(wanted))
+		if cfg.PollInterval > 0 {
+			slog.Info(fmt.Sprintf("Monitor a cada %s para: %s", cfg.PollInterval, muniLabel(cfg.Municipios)))
+		} else {
+			slog.Info("Execução única para: " + muniLabel(cfg.Municipios))
+		}
 	}
 
-	// Teste opcional de notificação no arranque (defina NTFY_TEST=1)
-	if getenv("NTFY_TEST", "") != "" {
-		postNtfyExt(getenv("NTFY_URL", "https://ntfy.sh"), getenv("NTFY_TOPIC", "bombeiros-serta"), "[teste] monitor iniciado", time.Now().Format(time.RFC3339), "white_check_mark", "3", "")
+	// Autoteste opcional do ntfy no arranque (defina NTFY_TEST=1)
+	if cfg.NtfyTest {
+		_ = ntfySelfTest(cfg)
 	}
 
-	// Metrics endpoint
-	if getenv("METRICS_DISABLE", "") == "" {
-		addr := getenv("METRICS_ADDR", ":2112")
-		go func() {
-			mux := http.NewServeMux()
-			mux.Handle("/metrics", promhttp.Handler())
-			if err := http.ListenAndServe(addr, mux); err != nil {
-				fmt.Fprintln(os.Stderr, "metrics server error:", err)
+	mutes.load(mutesPath(cfg.statePath()))
+
+	// Metrics endpoint (and the optional dashboard, mute API and CAP feed on the same server)
+	var metricsSrv *http.Server
+	metricsHandler := metrics.handler()
+	if httpServerEnabled(cfg) {
+		mux := http.NewServeMux()
+		if !cfg.MetricsDisable {
+			initIncidentMetrics(cfg.MetricsPerID, cfg.activeLabels)
+			if metricsHandler != nil {
+				mux.Handle("/metrics", metricsHandler)
 			}
-		}()
-		if !isTray {
-			fmt.Println("Métricas Prometheus em", getenv("METRICS_ADDR", ":2112"), "/metrics")
 		}
-	}
+		mux.HandleFunc("/healthz", healthzHandler)
+		mux.HandleFunc("/readyz", readyzHandler(cfg.PollInterval))
+		registerIncidentAPI(mux, cfg)
+		registerMuteAPI(mux, cfg)
+		registerSummaryAPI(mux, cfg)
+		if cfg.CAP {
+			mux.HandleFunc("GET /cap/{file}", capHandler)
+		}
+		if cfg.Dashboard {
+			mux.Handle("/{$}", dashboardHandler(cfg.PollInterval))
+		}
+		metricsSrv = &http.Server{Addr: cfg.MetricsAddr, Handler: requireAuth(mux, cfg)}
+		// Bind before going on: a port held by another monitor means a
+		// duplicate instance, which would send every notification twice.
+		ln, err := net.Listen("tcp", cfg.MetricsAddr)
+		if err != nil {
+			if pid, ok := runningInstance(cfg); ok {
+				msg := fmt.Sprintf("já existe um monitor em execução (PID %s)", pid)
+				slog.Error(msg, "addr", cfg.MetricsAddr)
+				if isTray {
+					alertBox("Bombeiros Monitor", msg+" em "+cfg.MetricsAddr+".\nEsta instância vai fechar.")
+				}
+				flushTraces()
+				os.Exit(1)
+			}
+			slog.Error("metrics server error", "err", err)
+		} else {
+			go func() {
+				var err error
+				if cfg.MetricsTLSCert != "" {
+					err = metricsSrv.ServeTLS(ln, cfg.MetricsTLSCert, cfg.MetricsTLSKey)
+				} else {
+					err = metricsSrv.Serve(ln)
+				}
+				if err != nil && err != http.ErrServerClosed {
+					slog.Error("metrics server error", "err", err)
+				}
+			}()
+		}
+		https := ""
+		if cfg.MetricsTLSCert != "" {
+			https = " (HTTPS)"
+		}
+		if !isTray && !cfg.MetricsDisable && metricsHandler != nil {
+			slog.Info("Métricas Prometheus em " + cfg.MetricsAddr + "/metrics" + https)
+		}
+		if !isTray && cfg.Dashboard {
+			slog.Info("Painel em " + cfg.MetricsAddr + "/" + https)
+		}
+	}
+
+	// SIGHUP (or the tray menu) re-reads CONFIG_FILE and the environment.
+	reloader := &configReloader{loader: loader}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	// SIGUSR1 sends the current summary right away (not on Windows).
+	usr1 := make(chan os.Signal, 1)
+	notifySummarySignal(usr1)
+	go func() {
+		for {
+			select {
+			case <-usr1:
+				requestSummary("SIGUSR1")
+			case <-hup:
+				_ = reloader.reload("SIGHUP")
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 
-	// Graceful shutdown on Ctrl+C / SIGTERM
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
+	var hooks monitorHooks
+	var trayUpdates chan cycleReport
+	wake := make(chan struct{}, 1)
+	if isTray {
+		trayUpdates = make(chan cycleReport, 1)
+		hooks.onCycle = func(r cycleReport) { sendLatest(trayUpdates, r) }
+		hooks.wake = wake
+	}
+	mail = startMailer()
+	if cfg.PollInterval > 0 {
+		ntfyRate = startRateLimiter()
+		if cfg.NotifyConcurrency > 0 {
+			notifications = startNotifyPool(cfg.NotifyConcurrency)
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runMonitor(ctx, hooks)
+	}()
 
 	// Windows: tray mode by default. Disable with USE_TRAY=0.
 	if isTray {
-		go runMonitor(ctx, pollSec, stateFile, wanted)
-		StartTray(func() {
-			stop()
+		StartTray(trayControl{
+			Quit:   stop,
+			Reload: func() { _ = reloader.reload("tray") },
+			CheckNow: func() {
+				select {
+				case wake <- struct{}{}:
+				default: // a check is already queued
+				}
+			},
+			Pause:   notifyPause.pause,
+			Resume:  notifyPause.resume,
+			Updates: trayUpdates,
 		})
+	} else {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			// single-shot run finished
+		}
+	}
+	shutdown(done, metricsSrv, monitor, conf().stateStore(), ctx.Err() != nil)
+}
+
+// shutdownTimeout bounds how long we wait for an in-flight cycle and the HTTP server.
+const shutdownTimeout = 15 * time.Second
+
+// shutdown waits for the poll loop to finish its current cycle, stops the metrics
+// server and, when interrupted by a signal or the tray, flushes the last
+// consistent state to the store. With a shared store the replica lock is
+// released, so another replica takes over on its next poll.
+func shutdown(done <-chan struct{}, srv *http.Server, ms *MonitorState, store StateStore, interrupted bool) {
+	deadline := time.NewTimer(shutdownTimeout)
+	defer deadline.Stop()
+	cycleDone := true
+	select {
+	case <-done:
+	case <-deadline.C:
+		cycleDone = false
+		slog.Warn("ciclo em curso não terminou a tempo; estado final não gravado")
+	}
+	if notifications != nil && !notifications.drain(shutdownTimeout) {
+		slog.Warn("notificações por enviar ao terminar; descartadas")
+	}
+	if ntfyRate != nil && !ntfyRate.drain(shutdownTimeout) {
+		slog.Warn("notificações em espera (NTFY_RATE_PER_MINUTE) ao terminar; descartadas")
+	}
+	if mail != nil && !mail.drain(shutdownTimeout) {
+		slog.Warn("emails por enviar ao terminar; descartados")
+	}
+	if srv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		if err := srv.Shutdown(ctx); err != nil {
+			slog.Error("metrics server shutdown", "err", err)
+		}
+		cancel()
+	}
+	lk, shared := store.(stateLocker)
+	if shared {
+		defer lk.release()
+	}
+	if !interrupted {
 		return
 	}
+	// Only flush when the last cycle completed; a cycle cut short may have half-updated maps.
+	// A standby replica has nothing of its own to write.
+	if cycleDone && (!shared || replicaLock.held.Load()) {
+		ms.mu.RLock()
+		if ms.cycleState != nil {
+			if err := store.Save(ms, ms.cycleState, ms.cycleSeen); err != nil {
+				slog.Error("erro a gravar estado", "err", err)
+			}
+		}
+		ms.mu.RUnlock()
+	}
+	slog.Info("A terminar...")
+}
+
+// runCycle runs one poll cycle, isolating panics so a malformed feature cannot
+// kill the monitor. A panicking cycle is reported as an error and its partial
+// in-memory updates are discarded instead of being persisted.
+func runCycle(cfg *Config, ms *MonitorState) (changed bool, err error) {
+	if held, err := holdReplicaLock(cfg, ms); !held {
+		return false, err
+	}
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		panicsTotal.Inc()
+		slog.Error("pânico no ciclo", "panic", r, "stack", string(debug.Stack()))
+		discardInMemoryState(ms)
+		if cfg.PanicNotify {
+			postNtfyExt(cfg.NtfyURL, cfg.NtfyTopic, Notification{
+				Type:     notifyPanic,
+				Title:    tr("panic.title"),
+				Body:     tr("panic.body", r),
+				Tags:     "warning",
+				Priority: "3",
+			})
+		}
+		changed, err = false, fmt.Errorf("pânico no ciclo: %v", r)
+	}()
+	return runOnce(cfg, ms)
+}
+
+// discardInMemoryState drops per-ID maps that a failed cycle may have left
+// half-updated; the next cycle reloads the last good copy from the store,
+// through loadForCycle and its handling of a store that cannot be read.
+// runOnce has already released the lock while the panic unwound.
+func discardInMemoryState(ms *MonitorState) {
+	unlock := ms.lock()
+	defer unlock()
+	ms.reset()
+	ms.dirty = false
+}
 
-	runMonitor(ctx, pollSec, stateFile, wanted)
+// monitorHooks lets the tray observe and nudge the poll loop.
+type monitorHooks struct {
+	onCycle func(cycleReport) // called after each cycle from the poll goroutine
+	wake    <-chan struct{}   // run a cycle now instead of waiting for the ticker
 }
 
-// runMonitor executes the polling loop until ctx is canceled.
-func runMonitor(ctx context.Context, pollSec int, stateFile string, wanted []string) {
-	if pollSec <= 0 {
-		if _, err := runOnce(stateFile, wanted); err != nil {
-			fmt.Fprintln(os.Stderr, "Erro:", err)
+// runMonitor executes the polling loop until ctx is canceled. The config is
+// re-read every cycle so a reload takes effect on the next poll.
+func runMonitor(ctx context.Context, hooks monitorHooks) {
+	cfg := conf()
+	poll := cfg.PollInterval
+	if poll <= 0 {
+		if cfg.OutputJSON {
+			startRunReport()
+		}
+		_, err := runCycle(cfg, monitor)
+		if werr := writeRunReport(os.Stdout, err); werr != nil {
+			slog.Error("erro a escrever o relatório JSON", "err", werr)
+		}
+		if err != nil {
+			slog.Error("erro no ciclo", "err", err)
+			flushTraces()
 			os.Exit(1)
 		}
+		touchHeartbeat(cfg, cfg.now())
 		return
 	}
-	ticker := time.NewTicker(time.Duration(pollSec) * time.Second)
+	var failures []cycleFailure
+	ticker := time.NewTicker(poll)
 	defer ticker.Stop()
 	for {
-		if _, err := runOnce(stateFile, wanted); err != nil {
-			fmt.Fprintln(os.Stderr, "Erro:", err)
+		cfg = conf()
+		if cfg.PollInterval != poll {
+			poll = cfg.PollInterval
+			ticker.Reset(poll)
 		}
-		select {
-		case <-ticker.C:
-		case <-ctx.Done():
-			fmt.Println("A terminar...")
-			return
+		maxFailures := cfg.MaxConsecutiveFailures
+		_, err := runCycle(cfg, monitor)
+		if hooks.onCycle != nil {
+			hooks.onCycle(newCycleReport(lastCycleFiltered, err))
 		}
+		if err != nil {
+			slog.Error("erro no ciclo", "err", err)
+			if maxFailures > 0 {
+				failures = append(failures, cycleFailure{at: cfg.now(), err: err})
+				if len(failures) >= maxFailures {
+					exitAfterFailures(failures)
+				}
+			}
+		} else {
+			failures = failures[:0]
+			touchHeartbeat(cfg, cfg.now())
+		}
+	wait:
+		for {
+			select {
+			case <-ticker.C:
+				break wait
+			case <-hooks.wake:
+				slog.Info("verificação pedida")
+				ticker.Reset(poll)
+				break wait
+			case <-summaryRequests:
+				sendSummaryNow(cfg, monitor)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+type cycleFailure struct {
+	at  time.Time
+	err error
+}
+
+// exitAfterFailures logs the run of failed cycles and exits with code 2 so a
+// supervisor (systemd Restart=on-failure, Docker restart policy) restarts us.
+func exitAfterFailures(failures []cycleFailure) {
+	for i, f := range failures {
+		slog.Error("falha consecutiva", "n", i+1, "at", f.at.Format(time.RFC3339), "err", f.err)
 	}
+	slog.Error("demasiadas falhas consecutivas; a sair", "failures", len(failures))
+	flushTraces()
+	os.Exit(2)
 }
 
 // Helpers para enriquecimento de notificações
@@ -2129,15 +3588,14 @@ func relUpdated(p map[string]any) string {
 	// "updated": {"sec": ...}
 	if m, ok := p["updated"].(map[string]any); ok && m != nil {
 		if sec, ok2 := toFloat(m["sec"]); ok2 && sec > 0 {
-			t := time.Unix(int64(sec), 0)
-			d := time.Since(t)
+			d := conf().now().Sub(time.Unix(int64(sec), 0))
 			if d < 0 {
 				d = -d
 			}
 			if d < time.Minute {
-				return "agora"
+				return tr("time.now")
 			}
-			return fmt.Sprintf("há %dm", int(d.Minutes()))
+			return tr("time.ago", int(d.Minutes()))
 		}
 	}
 	return ""
@@ -2146,57 +3604,67 @@ func relUpdated(p map[string]any) string {
 func extraInfoTags(p map[string]any) (addTags string, extraLines []string) {
 	// Linhas informativas
 	if s := getPropStr(p, "localidade"); s != "" {
-		extraLines = append(extraLines, "Localidade: "+s)
+		extraLines = append(extraLines, tr("info.localidade", s))
 	}
 	if s := getPropStr(p, "detailLocation"); s != "" {
-		extraLines = append(extraLines, "Detalhe: "+s)
+		extraLines = append(extraLines, tr("info.detail", s))
 	}
 	if s := getPropStr(p, "freguesia"); s != "" {
-		extraLines = append(extraLines, "Freguesia: "+s)
+		extraLines = append(extraLines, tr("info.freguesia", s))
 	}
 	if s := getPropStr(p, "dico"); s != "" {
-		extraLines = append(extraLines, "DICO: "+s)
+		extraLines = append(extraLines, tr("info.dico", s))
 	}
 	if rg := getPropStr(p, "regiao"); rg != "" || getPropStr(p, "sub_regiao") != "" {
-		extraLines = append(extraLines, fmt.Sprintf("Região: %s / %s", rg, getPropStr(p, "sub_regiao")))
+		extraLines = append(extraLines, tr("info.regiao", rg, getPropStr(p, "sub_regiao")))
 	}
 	if ru := relUpdated(p); ru != "" {
-		extraLines = append(extraLines, "Atualizado: "+ru)
+		extraLines = append(extraLines, tr("info.updated", ru))
+	}
+	if s := getPropStr(p, "fireRisk", "risco"); s != "" {
+		extraLines = append(extraLines, tr("info.firerisk", s))
 	}
 
 	// ICNF
 	if m, ok := p["icnf"].(map[string]any); ok && m != nil {
 		if f, ok2 := toFloat(m["altitude"]); ok2 && f > 0 {
-			extraLines = append(extraLines, fmt.Sprintf("Altitude: %.0f m", f))
+			extraLines = append(extraLines, tr("info.altitude", f))
 		}
-		if b, ok2 := m["fogacho"].(bool); ok2 && b {
+		if truthy(m["fogacho"]) {
+			extraLines = append(extraLines, tr("icnf.fogacho"))
 			addTags = addTag(addTags, "sparkles")
 		}
+		if a, ok2 := icnfBurnedArea(p); ok2 {
+			extraLines = append(extraLines, a.line())
+		}
+		if c := icnfCause(p); c != "" {
+			extraLines = append(extraLines, tr("icnf.cause", c))
+		}
 		if s := getPropStr(m, "fontealerta"); s != "" {
-			extraLines = append(extraLines, "Fonte: "+s)
+			extraLines = append(extraLines, tr("info.source", s))
 			s2 := strings.ToLower(stripAccents(s))
 			if strings.Contains(s2, "112") {
-				addTags = addTag(addTags, "telephone")
+				addTags = addTagsCSV(addTags, tagFor("source_112"))
 			}
 			if strings.Contains(s2, "popular") {
-				addTags = addTag(addTags, "busts_in_silhouette")
+				addTags = addTagsCSV(addTags, tagFor("source_popular"))
 			}
 		}
 	}
 
 	// Aviacao
 	if hf, _ := toFloat(p["heliFight"]); hf > 0 {
-		addTags = addTag(addTags, "helicopter")
+		addTags = addTagsCSV(addTags, tagFor("helicopter"))
 	}
 	if hc, _ := toFloat(p["heliCoord"]); hc > 0 {
-		addTags = addTag(addTags, "helicopter")
+		addTags = addTagsCSV(addTags, tagFor("helicopter"))
 	}
 	if pf, _ := toFloat(p["planeFight"]); pf > 0 {
-		addTags = addTag(addTags, "airplane")
+		addTags = addTagsCSV(addTags, tagFor("plane"))
 	}
 	// Flag "important"
-	if imp := strings.ToLower(strings.TrimSpace(getPropStr(p, "important"))); imp == "true" || imp == "1" {
-		addTags = addTag(addTags, "exclamation")
+	if isImportant(p) {
+		addTags = addTagsCSV(addTags, tagFor("important"))
 	}
 	return
 }
@@ -0,0 +1,832 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock is a Clock a test moves by hand.
+type testClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *testClock) set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = t
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// posted is one message received by the fake ntfy server (NTFY_JSON mode).
+type posted struct {
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Priority int      `json:"priority"`
+	Tags     []string `json:"tags"`
+	Click    string   `json:"click"`
+}
+
+func (p posted) hasTag(tag string) bool { return slices.Contains(p.Tags, tag) }
+
+// testServer is the fogos.pt API (GET /feed) and an ntfy server (POST /)
+// in one httptest server.
+type testServer struct {
+	*httptest.Server
+	mu   sync.Mutex
+	feed []byte
+	msgs []posted
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	s := &testServer{}
+	s.setFeed()
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if r.Method == http.MethodGet && r.URL.Path == "/feed" {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(s.feed)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		var p posted
+		if err := json.Unmarshal(b, &p); err != nil {
+			t.Errorf("ntfy: %s: %v", b, err)
+		}
+		s.msgs = append(s.msgs, p)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// setFeed makes GET /feed return incidents in the fogos.pt shape.
+func (s *testServer) setFeed(incidents ...map[string]any) {
+	if incidents == nil {
+		incidents = []map[string]any{}
+	}
+	b, _ := json.Marshal(map[string]any{"success": true, "data": incidents})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.feed = b
+}
+
+// take returns the messages posted since the last call.
+func (s *testServer) take() []posted {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := s.msgs
+	s.msgs = nil
+	return out
+}
+
+func titles(msgs []posted) []string {
+	out := make([]string, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.Title
+	}
+	return out
+}
+
+// incident is one feed entry in Sertã, 2 km from the test CENTER.
+func incident(id, status string, man int) map[string]any {
+	return map[string]any{
+		"id":       id,
+		"concelho": "Sertã",
+		"district": "Castelo Branco",
+		"natureza": "Mato",
+		"status":   status,
+		"lat":      39.8,
+		"lng":      -8.1,
+		"man":      man,
+		"terrain":  man / 4,
+		"aerial":   0,
+		"dateTime": map[string]any{"sec": testStart.Unix()},
+		"updated":  map[string]any{"sec": testStart.Unix()},
+	}
+}
+
+// testStart is a summer afternoon in Lisbon (UTC+1).
+var testStart = time.Date(2025, 8, 14, 15, 20, 0, 0, time.UTC)
+
+// testConfig builds the configuration the way the monitor does, from env
+// on top of settings that keep the test off the network and out of the
+// working directory, and publishes it with the returned clock.
+func testConfig(t *testing.T, env map[string]string) (*Config, *testClock) {
+	t.Helper()
+	dir := t.TempDir()
+	base := map[string]string{
+		"MUNICIPIOS":          "Sertã",
+		"STATE_FILE":          filepath.Join(dir, "state.json"),
+		"DEBUG_DIR":           filepath.Join(dir, "debug"),
+		"FEED_CACHE":          "0",
+		"POLL_SECONDS":        "0",
+		"NTFY_TOPIC":          "teste",
+		"NTFY_JSON":           "1",
+		"NTFY_DEDUP_SECONDS":  "0",
+		"NTFY_ACTIONS":        "0",
+		"SHARE_TEMPLATE":      "",
+		"SUMMARY_HOURLY":      "0",
+		"SUMMARY_DAILY":       "0",
+		"CENTER_LAT":          "39.81",
+		"CENTER_LON":          "-8.09",
+		"BOMBEIROS_LANG":      "pt",
+		"BOMBEIROS_TZ":        "Europe/Lisbon",
+		"STATE_FLUSH_SECONDS": "0",
+	}
+	for k, v := range env {
+		base[k] = v
+	}
+	for _, f := range configFields {
+		for _, name := range f.envs {
+			t.Setenv(name, base[name])
+		}
+	}
+	t.Setenv("CONFIG_FILE", "")
+	cfg, err := newConfigLoader(flag.NewFlagSet("test", flag.ContinueOnError)).build(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk := &testClock{t: testStart}
+	cfg.clock = clk
+	setConfig(cfg)
+	t.Cleanup(func() { currentConfig.Store(nil) })
+	return cfg, clk
+}
+
+// newTestMonitor wires a config to a test server: the feed comes from it
+// and the notifications go to it.
+func newTestMonitor(t *testing.T, env map[string]string) (*Config, *testServer, *testClock, *MonitorState) {
+	t.Helper()
+	srv := newTestServer(t)
+	all := map[string]string{"FEATURES_SOURCE": srv.URL + "/feed", "NTFY_URL": srv.URL}
+	for k, v := range env {
+		all[k] = v
+	}
+	cfg, clk := testConfig(t, all)
+	cfg.useRoundTripper(srv.Client().Transport)
+	return cfg, srv, clk, NewMonitorState()
+}
+
+func mustRun(t *testing.T, cfg *Config, ms *MonitorState) bool {
+	t.Helper()
+	changed, err := runOnce(cfg, ms)
+	if err != nil {
+		t.Fatalf("runOnce: %v", err)
+	}
+	return changed
+}
+
+func TestRunOnceScriptedPolls(t *testing.T) {
+	cfg, srv, clk, ms := newTestMonitor(t, nil)
+
+	srv.setFeed(incident("2025050001", "Despacho", 12))
+	if !mustRun(t, cfg, ms) {
+		t.Fatal("first poll: no change reported")
+	}
+	msgs := srv.take()
+	if len(msgs) != 2 {
+		t.Fatalf("first poll: got %q, want the new incident and its status", titles(msgs))
+	}
+	// dateTime is shown on the BOMBEIROS_TZ wall clock
+	if msgs[0].Title != "Novo em Sertã — Mato (14-08 16:20)" || msgs[0].Priority != 5 {
+		t.Errorf("new incident: %q priority %d", msgs[0].Title, msgs[0].Priority)
+	}
+	if !strings.Contains(msgs[0].Message, "ID: 2025050001") {
+		t.Errorf("new incident body lacks the ID:\n%s", msgs[0].Message)
+	}
+	if msgs[1].Title != "Novo → Despacho — Sertã — Mato" {
+		t.Errorf("status: %q", msgs[1].Title)
+	}
+
+	clk.advance(time.Minute)
+	if mustRun(t, cfg, ms) {
+		t.Error("unchanged feed reported a change")
+	}
+	if msgs := srv.take(); len(msgs) != 0 {
+		t.Errorf("unchanged feed: got %q", titles(msgs))
+	}
+
+	clk.advance(time.Minute)
+	srv.setFeed(incident("2025050001", "Em Curso", 30))
+	mustRun(t, cfg, ms)
+	msgs = srv.take()
+	want := []string{"Despacho → Em Curso — Sertã — Mato", "Atualização de meios — Sertã"}
+	if got := titles(msgs); !slices.Equal(got, want) {
+		t.Fatalf("escalation: got %q, want %q", got, want)
+	}
+
+	clk.advance(time.Hour)
+	srv.setFeed(incident("2025050001", "Conclusão", 0))
+	mustRun(t, cfg, ms)
+	msgs = srv.take()
+	if len(msgs) == 0 || msgs[0].Title != "Em Curso → Conclusão — Sertã — Mato" {
+		t.Fatalf("conclusion: got %q", titles(msgs))
+	}
+	if at, ok := ms.ConcludedAt("2025050001"); !ok || !at.Equal(clk.Now()) {
+		t.Errorf("concluded at %v (%v), want the clock's %v", at, ok, clk.Now())
+	}
+
+	// Gone from the feed: forgotten, and a new ID is announced again.
+	clk.advance(time.Minute)
+	srv.setFeed(incident("2025050002", "Despacho", 4))
+	mustRun(t, cfg, ms)
+	if _, ok := ms.Status("2025050001"); ok {
+		t.Error("concluded incident still tracked after leaving the feed")
+	}
+	if got := titles(srv.take()); len(got) != 2 || !strings.HasPrefix(got[0], "Novo em Sertã") {
+		t.Errorf("second incident: got %q", got)
+	}
+}
+
+func TestRunOnceRestartKeepsState(t *testing.T) {
+	cfg, srv, clk, ms := newTestMonitor(t, nil)
+	srv.setFeed(incident("2025050001", "Em Curso", 20))
+	mustRun(t, cfg, ms)
+	srv.take()
+
+	// A new process reads STATE_FILE and stays quiet about what it knows.
+	clk.advance(10 * time.Minute)
+	ms = NewMonitorState()
+	mustRun(t, cfg, ms)
+	if msgs := srv.take(); len(msgs) != 0 {
+		t.Errorf("after restart: got %q", titles(msgs))
+	}
+	if first, ok := ms.FirstSeen("2025050001"); !ok || !first.Equal(testStart) {
+		t.Errorf("first seen %v (%v), want %v from the state file", first, ok, testStart)
+	}
+}
+
+func TestRunOnceFeedError(t *testing.T) {
+	cfg, srv, _, ms := newTestMonitor(t, nil)
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	})
+	if _, err := runOnce(cfg, ms); err == nil {
+		t.Fatal("runOnce: no error for a failing feed")
+	}
+}
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with testdata/name, or rewrites it with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs:\n%s", path, got)
+	}
+}
+
+// activeFeed500 is a captured api-dev response with 500 incidents.
+func activeFeed500(tb testing.TB) []byte {
+	tb.Helper()
+	f, err := os.Open(filepath.Join("testdata", "active_500.json.gz"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+func TestToFeaturesGolden(t *testing.T) {
+	inputs, _ := filepath.Glob(filepath.Join("testdata", "feeds", "*.json"))
+	if len(inputs) == 0 {
+		t.Fatal("no feeds in testdata/feeds")
+	}
+	for _, in := range inputs {
+		name := strings.TrimSuffix(filepath.Base(in), ".json")
+		t.Run(name, func(t *testing.T) {
+			body, err := os.ReadFile(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			features, err := toFeatures(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := json.MarshalIndent(features, "", "  ")
+			golden(t, filepath.Join("feeds", name+".golden"), append(got, '\n'))
+		})
+	}
+
+	// the captured payload is too big for a readable golden file: its digest
+	features, err := toFeatures(activeFeed500(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features) != 500 {
+		t.Fatalf("got %d features, want 500", len(features))
+	}
+	b, _ := json.Marshal(features)
+	sum := sha256.Sum256(b)
+	golden(t, "active_500.sha256", []byte(hex.EncodeToString(sum[:])+"\n"))
+}
+
+func TestNormMunicipioGolden(t *testing.T) {
+	var out strings.Builder
+	for _, s := range []string{
+		"Sertã", "SERTÃ", " sertã ", "Serta",
+		"Proença-a-Nova", "Proença a Nova", "proenca_a_nova",
+		"Vila Velha de Ródão", "Vila  Velha   de Rodão",
+		"Pedrógão Grande", "Figueiró dos Vinhos", "Ferreira do Zêzere",
+		"Castanheira de Pêra", "Idanha-a-Nova", "Fundão", "",
+		"Sertã̃", "Mação\t",
+	} {
+		fmt.Fprintf(&out, "%q\t%q\n", s, normMunicipio(s))
+	}
+	golden(t, "normmunicipio.golden", []byte(out.String()))
+}
+
+func BenchmarkToFeatures(b *testing.B) {
+	body := activeFeed500(b)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := toFeatures(body); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNormMunicipio(b *testing.B) {
+	names := append(slices.Clone(defaultMunicipios), "Vila Velha de Rodão", "proenca_a_nova")
+	b.ReportAllocs()
+	for range b.N {
+		for _, s := range names {
+			normMunicipio(s)
+		}
+	}
+}
+
+func TestQuietExempt(t *testing.T) {
+	near := Feature{Geometry: pointGeometry(39.8, -8.1)} // 1.4 km from the test center
+	far := Feature{Geometry: pointGeometry(40.2, -8.1)}  // 43 km
+	noCoords := Feature{Properties: map[string]any{"id": "2025050003"}}
+	for _, c := range []struct {
+		name     string
+		km       string
+		noCoords string
+		incs     []Feature
+		want     bool
+	}{
+		{"inside the radius", "5", "0", []Feature{near}, true},
+		{"outside the radius", "5", "0", []Feature{far}, false},
+		{"on the edge", "43.5", "0", []Feature{far}, true},
+		{"one of a group inside", "5", "0", []Feature{far, near}, true},
+		{"no coordinates, policy off", "5", "0", []Feature{noCoords}, false},
+		{"no coordinates, policy on", "5", "1", []Feature{noCoords}, true},
+		{"radius off", "0", "1", []Feature{near, noCoords}, false},
+		{"not about an incident", "5", "1", nil, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cfg, _ := testConfig(t, map[string]string{"QUIET_EXEMPT_KM": c.km, "QUIET_EXEMPT_NO_COORDS": c.noCoords})
+			if got := quietExempt(cfg, Notification{Type: notifyNew, Incidents: c.incs}); got != c.want {
+				t.Errorf("quietExempt = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestNotifyOnlyAllows(t *testing.T) {
+	feature := func(status string, lat float64, coords bool) Feature {
+		f := Feature{Properties: map[string]any{"status": status}}
+		if coords {
+			f.Geometry = pointGeometry(lat, -8.1)
+		}
+		return f
+	}
+	nearCurso := feature("Em Curso", 39.8, true) // 1.4 km from the test center
+	farCurso := feature("Em Curso", 40.2, true)  // 43 km
+	nearDespacho := feature("Despacho", 39.8, true)
+	noCoords := feature("Em curso", 0, false)
+	for _, c := range []struct {
+		name, status, km string
+		incs             []Feature
+		want             bool
+	}{
+		{"no gate", "", "0", []Feature{farCurso}, true},
+		{"status matches", "em curso", "0", []Feature{farCurso}, true},
+		{"status with accents and case", "EM CURSO,Resolução", "0", []Feature{feature("Em Resolução", 0, false)}, true},
+		{"status does not match", "em curso", "0", []Feature{nearDespacho}, false},
+		{"within km", "", "10", []Feature{nearDespacho}, true},
+		{"beyond km", "", "10", []Feature{farCurso}, false},
+		{"no coordinates", "", "10", []Feature{noCoords}, false},
+		{"both match", "em curso", "10", []Feature{nearCurso}, true},
+		{"each matches one", "em curso", "10", []Feature{farCurso, nearDespacho}, false},
+		{"one of a group matches both", "em curso", "10", []Feature{farCurso, nearCurso}, true},
+		{"not about an incident", "em curso", "10", nil, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cfg, _ := testConfig(t, map[string]string{"NOTIFY_ONLY_STATUS": c.status, "NOTIFY_ONLY_WITHIN_KM": c.km})
+			if got := notifyOnlyAllows(cfg, c.incs); got != c.want {
+				t.Errorf("notifyOnlyAllows = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+// TestNotifyOnlyWithQuietHours follows the documented precedence: NOTIFY_ONLY_*
+// first, then QUIET_DIGEST, then the quiet-hours priority. Tracking and the
+// summaries still see every incident.
+func TestNotifyOnlyWithQuietHours(t *testing.T) {
+	for _, withDigest := range []bool{false, true} {
+		t.Run(map[bool]string{false: "quiet hours", true: "quiet digest"}[withDigest], func(t *testing.T) {
+			digest = &quietDigest{}
+			t.Cleanup(func() { digest = &quietDigest{} })
+			// 16:20 in Lisbon on the test clock, inside QUIET_HOURS
+			cfg, srv, clk, ms := newTestMonitor(t, map[string]string{
+				"NOTIFY_ONLY_STATUS":    "em curso",
+				"NOTIFY_ONLY_WITHIN_KM": "10",
+				"QUIET_HOURS":           "16-17",
+				"QUIET_DIGEST":          map[bool]string{false: "0", true: "1"}[withDigest],
+				"SUMMARY_HOURLY":        "1",
+			})
+			far := incident("2025050002", "Em Curso", 12)
+			far["lat"] = 40.2
+			srv.setFeed(incident("2025050001", "Despacho", 4), far)
+			mustRun(t, cfg, ms)
+			msgs := srv.take()
+			// only the summary: neither incident is critical
+			if len(msgs) != 1 || !strings.HasPrefix(msgs[0].Title, "Sumário horário") || !strings.Contains(msgs[0].Message, "Ativos: 2") {
+				t.Fatalf("first poll: %q", titles(msgs))
+			}
+			if !msgs[0].hasTag("zzz") || msgs[0].Priority != 3 {
+				t.Errorf("summary in quiet hours: tags %q priority %d", msgs[0].Tags, msgs[0].Priority)
+			}
+			for _, id := range []string{"2025050001", "2025050002"} {
+				if _, ok := ms.Status(id); !ok {
+					t.Errorf("%s not tracked", id)
+				}
+			}
+
+			// the near one escalates: it passes NOTIFY_ONLY_*
+			clk.advance(time.Minute)
+			srv.setFeed(incident("2025050001", "Em Curso", 30), far)
+			mustRun(t, cfg, ms)
+			msgs = srv.take()
+			if withDigest {
+				if len(msgs) != 0 {
+					t.Fatalf("sent during the digest window: %q", titles(msgs))
+				}
+				clk.advance(time.Hour)
+				mustRun(t, cfg, ms)
+				var dig *posted
+				for _, m := range srv.take() {
+					if m.Title == tr("digest.title") {
+						dig = &m
+					}
+				}
+				if dig == nil || !strings.Contains(dig.Message, "/2025050001") || strings.Contains(dig.Message, "/2025050002") {
+					t.Errorf("digest after the window: %+v", dig)
+				}
+				return
+			}
+			got := titles(msgs)
+			if !slices.Equal(got, []string{"Despacho → Em Curso — Sertã — Mato", "Atualização de meios — Sertã"}) {
+				t.Fatalf("escalation: %q", got)
+			}
+			for _, m := range msgs {
+				if !m.hasTag("zzz") || m.Priority > 3 {
+					t.Errorf("%q in quiet hours: tags %q priority %d", m.Title, m.Tags, m.Priority)
+				}
+			}
+		})
+	}
+}
+
+func TestIDString(t *testing.T) {
+	for _, c := range []struct {
+		in   any
+		want string
+	}{
+		{"2025050012345678901", "2025050012345678901"},
+		{json.Number("2025050012345678901"), "2025050012345678901"},   // 19 digits, above 2^53
+		{json.Number("9007199254740993"), "9007199254740993"},         // 2^53+1, lost by float64
+		{json.Number("12345678901234567890"), "12345678901234567890"}, // beyond int64
+		{json.Number("2.025050012345678901e18"), "2025050012345678901"},
+		{json.Number("1.2E+18"), "1200000000000000000"},
+		{json.Number("2025050001.0"), "2025050001"},
+		{float64(2025050001), "2025050001"},
+		{json.Number("0"), ""},
+		{float64(0), ""},
+		{"", ""},
+		{nil, ""},
+		{true, ""},
+	} {
+		if got := idString(c.in); got != c.want {
+			t.Errorf("idString(%#v) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestToFeaturesKeepsLargeIDs(t *testing.T) {
+	body := []byte(`{"success":true,"data":[
+		{"id":2025050012345678901,"concelho":"Sertã"},
+		{"id":2.025050012345678902e18,"concelho":"Sertã"},
+		{"id":"2025050012345678903","concelho":"Sertã"}]}`)
+	features, err := toFeatures(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range features {
+		got = append(got, getID(f.Properties))
+	}
+	if want := []string{"2025050012345678901", "2025050012345678902", "2025050012345678903"}; !slices.Equal(got, want) {
+		t.Errorf("IDs %q, want %q", got, want)
+	}
+}
+
+// TestIDStringThenNumber: the same 19-digit incident arrives as a string,
+// then as a number, then in scientific notation; it is announced once.
+func TestIDStringThenNumber(t *testing.T) {
+	cfg, srv, clk, ms := newTestMonitor(t, nil)
+	const id = "2025050012345678901"
+	for i, v := range []any{id, json.Number(id), json.Number("2.025050012345678901e18"), id} {
+		f := incident("", "Em Curso", 8)
+		f["id"] = v
+		srv.setFeed(f)
+		mustRun(t, cfg, ms)
+		msgs := srv.take()
+		if i == 0 {
+			if len(msgs) != 2 || !strings.Contains(msgs[0].Message, "ID: "+id) {
+				t.Fatalf("first poll: %q", titles(msgs))
+			}
+		} else if len(msgs) != 0 {
+			t.Errorf("poll %d (%v): %q", i+1, v, titles(msgs))
+		}
+		clk.advance(time.Minute)
+	}
+	if _, ok := ms.Status(id); !ok {
+		t.Errorf("%s not tracked", id)
+	}
+}
+
+// orderingFeed is the same five new incidents in the given feed order: two
+// pairs with equal dateTime in different municipalities, and one undated.
+func orderingFeed(order []int) []map[string]any {
+	mk := func(id, muni string, offset time.Duration, dated bool) map[string]any {
+		f := incident(id, "Despacho", 4)
+		f["concelho"] = muni
+		f["dateTime"] = map[string]any{"sec": testStart.Add(offset).Unix()}
+		if !dated {
+			delete(f, "dateTime")
+		}
+		return f
+	}
+	all := []map[string]any{
+		mk("2025050005", "Sertã", 10*time.Minute, true),
+		mk("2025050009", "Oleiros", 0, true),
+		mk("2025050003", "Sertã", 0, true),
+		mk("2025050001", "Oleiros", 10*time.Minute, true),
+		mk("2025050002", "Sertã", 0, false),
+	}
+	out := make([]map[string]any, len(order))
+	for i, j := range order {
+		out[i] = all[j]
+	}
+	return out
+}
+
+var messageID = regexp.MustCompile(`ID: (\d+)`)
+
+func TestEventOrderDeterministic(t *testing.T) {
+	run := func(order []int, env map[string]string) []posted {
+		env["MUNICIPIOS"] = "Sertã,Oleiros"
+		cfg, srv, _, ms := newTestMonitor(t, env)
+		srv.setFeed(orderingFeed(order)...)
+		mustRun(t, cfg, ms)
+		return srv.take()
+	}
+	newIDs := func(msgs []posted) []string {
+		var ids []string
+		for _, m := range msgs {
+			if strings.HasPrefix(m.Title, "Novo em") {
+				ids = append(ids, messageID.FindStringSubmatch(m.Message)[1])
+			}
+		}
+		return ids
+	}
+
+	// oldest first, then municipality, then ID; undated last
+	want := []string{"2025050009", "2025050003", "2025050001", "2025050005", "2025050002"}
+	first := run([]int{0, 1, 2, 3, 4}, map[string]string{})
+	second := run([]int{4, 3, 2, 1, 0}, map[string]string{})
+	if got := newIDs(first); !slices.Equal(got, want) {
+		t.Errorf("order %q, want %q", got, want)
+	}
+	if !slices.Equal(titles(first), titles(second)) || !slices.Equal(newIDs(first), newIDs(second)) {
+		t.Errorf("runs differ:\n%q\n%q", titles(first), titles(second))
+	}
+
+	// the aggregated message lists the sample IDs in the same order
+	env := func() map[string]string { return map[string]string{"NTFY_SUMMARY_THRESHOLD": "3"} }
+	agg1, agg2 := run([]int{2, 0, 4, 1, 3}, env()), run([]int{3, 1, 4, 0, 2}, env())
+	if len(agg1) == 0 || len(agg2) == 0 || agg1[0].Message != agg2[0].Message {
+		t.Fatalf("aggregated messages differ: %q / %q", titles(agg1), titles(agg2))
+	}
+	if lines := strings.Split(agg1[0].Message, "\n"); lines[0] != "Oleiros: 2 (2025050009, 2025050001)" || lines[1] != "Sertã: 3 (2025050003, 2025050005, 2025050002)" {
+		t.Errorf("aggregated body:\n%s", agg1[0].Message)
+	}
+}
+
+// observed records what a histogram was given.
+type observed []float64
+
+func (o *observed) Observe(v float64) { *o = append(*o, v) }
+
+// TestTimeToConclusion fabricates dateTime and updated values and checks the
+// duration observed when the incident reaches Conclusão three hours after
+// the monitor first saw it.
+func TestTimeToConclusion(t *testing.T) {
+	sec := func(d time.Duration) map[string]any { return map[string]any{"sec": testStart.Add(d).Unix()} }
+	for _, c := range []struct {
+		name              string
+		dateTime, updated any // nil: not in the feed
+		restart           bool
+		want              time.Duration
+		sources           string
+	}{
+		{"from the feed", sec(-90 * time.Minute), sec(2 * time.Hour), false, 3*time.Hour + 30*time.Minute, "start_source=dateTime end_source=updated"},
+		{"across a restart", sec(-90 * time.Minute), sec(2 * time.Hour), true, 3*time.Hour + 30*time.Minute, "start_source=dateTime end_source=updated"},
+		{"local dateTime", "2025-08-14 15:50:00", sec(2 * time.Hour), false, 2*time.Hour + 30*time.Minute, "start_source=dateTime end_source=updated"},
+		{"no dateTime", nil, sec(2 * time.Hour), false, 2 * time.Hour, "start_source=first_seen end_source=updated"},
+		{"no updated", sec(-90 * time.Minute), nil, false, 4*time.Hour + 30*time.Minute, "start_source=dateTime end_source=now"},
+		{"updated in the future", sec(-90 * time.Minute), sec(5 * time.Hour), false, 4*time.Hour + 30*time.Minute, "start_source=dateTime end_source=now"},
+		{"updated before dateTime", sec(0), sec(-time.Hour), false, 3 * time.Hour, "start_source=dateTime end_source=now"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cfg, srv, clk, ms := newTestMonitor(t, nil)
+			var got observed
+			prev := timeToConclusion
+			timeToConclusion = &got
+			t.Cleanup(func() { timeToConclusion = prev })
+			feed := func(status string) map[string]any {
+				f := incident("2025050001", status, 20)
+				f["dateTime"], f["updated"] = c.dateTime, c.updated
+				for _, k := range []string{"dateTime", "updated"} {
+					if f[k] == nil {
+						delete(f, k)
+					}
+				}
+				return f
+			}
+			srv.setFeed(feed("Em Curso"))
+			mustRun(t, cfg, ms)
+
+			clk.advance(3 * time.Hour)
+			if c.restart {
+				ms = NewMonitorState()
+				mustRun(t, cfg, ms)
+			}
+			logs := captureDebugLog(t)
+			srv.setFeed(feed("Conclusão"))
+			mustRun(t, cfg, ms)
+			if len(got) != 1 || got[0] != c.want.Seconds() {
+				t.Fatalf("observed %v, want [%v]", got, c.want.Seconds())
+			}
+			if !strings.Contains(logs.String(), c.sources) {
+				t.Errorf("debug log lacks %q:\n%s", c.sources, logs)
+			}
+
+			// a later cycle still listing it as concluded observes nothing more
+			clk.advance(time.Minute)
+			mustRun(t, cfg, ms)
+			if len(got) != 1 {
+				t.Errorf("observed again: %v", got)
+			}
+		})
+	}
+}
+
+// TestUnmonitoredMunicipalityRoundTrip takes Oleiros out of MUNICIPIOS for a
+// while: its incidents stay in the state file until STATE_TTL_HOURS, so
+// adding it back announces nothing.
+func TestUnmonitoredMunicipalityRoundTrip(t *testing.T) {
+	cfg, srv, clk, ms := newTestMonitor(t, map[string]string{"MUNICIPIOS": "Sertã,Oleiros"})
+	oleiros := incident("2025050002", "Em Curso", 12)
+	oleiros["concelho"] = "Oleiros"
+	srv.setFeed(incident("2025050001", "Em Curso", 20), oleiros)
+	mustRun(t, cfg, ms)
+	if got := titles(srv.take()); len(got) != 4 {
+		t.Fatalf("first poll: %q", got)
+	}
+
+	// restart sharing the state file, the feed and the clock
+	restart := func(municipios, ttl string) (*Config, *MonitorState) {
+		t.Helper()
+		c, _ := testConfig(t, map[string]string{
+			"MUNICIPIOS": municipios, "STATE_TTL_HOURS": ttl, "STATE_FILE": cfg.StateFile,
+			"FEATURES_SOURCE": srv.URL + "/feed", "NTFY_URL": srv.URL,
+		})
+		c.useRoundTripper(srv.Client().Transport)
+		c.clock = clk
+		return c, NewMonitorState()
+	}
+	saved := func() []string {
+		t.Helper()
+		b, err := os.ReadFile(cfg.StateFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc struct {
+			By map[string][]string `json:"by"`
+		}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			t.Fatal(err)
+		}
+		return doc.By[normMunicipio("Oleiros")]
+	}
+
+	cfg, ms = restart("Sertã", "0")
+	for range 3 {
+		clk.advance(10 * time.Minute)
+		mustRun(t, cfg, ms)
+		if got := titles(srv.take()); len(got) != 0 {
+			t.Errorf("Sertã only: %q", got)
+		}
+		if got := saved(); !slices.Equal(got, []string{"2025050002"}) {
+			t.Fatalf("oleiros in the state file: %q", got)
+		}
+	}
+
+	clk.advance(10 * time.Minute)
+	cfg, ms = restart("Sertã,Oleiros", "0")
+	mustRun(t, cfg, ms)
+	if got := titles(srv.take()); len(got) != 0 {
+		t.Errorf("Oleiros added back: %q", got)
+	}
+
+	// out of MUNICIPIOS, it still expires with STATE_TTL_HOURS
+	cfg, ms = restart("Sertã", "1")
+	clk.advance(2 * time.Hour)
+	mustRun(t, cfg, ms)
+	if got := saved(); len(got) != 0 {
+		t.Errorf("oleiros after the TTL: %q", got)
+	}
+}
+
+// TestNtfySendUsesContext: a cancelled fan-out does not reach ntfy.
+func TestNtfySendUsesContext(t *testing.T) {
+	cfg, srv, _, _ := newTestMonitor(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n := Notification{Type: notifyNew, Title: "Novo em Sertã — Mato (14-08 16:20)", Body: "ID: 2025050001"}
+	err := ntfyNotifier{cfg: cfg, url: cfg.NtfyURL, topic: cfg.NtfyTopic}.Send(ctx, Event{Type: n.Type, Title: n.Title, Body: n.Body, src: n})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Send = %v, want context.Canceled", err)
+	}
+	if msgs := srv.take(); len(msgs) != 0 {
+		t.Errorf("posted %q", titles(msgs))
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// markdownBody renders a plain notification body as markdown: lead blocks
+// first, lines kept apart with hard breaks (a bare "\n" is a soft break and
+// would run them together) and the "Extra:" line as a blockquote. Action
+// URLs are still taken from the plain body.
+func markdownBody(plain string, lead ...string) string {
+	var blocks, text []string
+	for _, b := range lead {
+		if b != "" {
+			blocks = append(blocks, b)
+		}
+	}
+	flush := func() {
+		if len(text) > 0 {
+			blocks = append(blocks, strings.Join(text, "  \n"))
+			text = nil
+		}
+	}
+	extra := tr("extra.line", "")
+	for _, l := range strings.Split(plain, "\n") {
+		if s, ok := strings.CutPrefix(l, extra); ok && strings.TrimSpace(s) != "" {
+			flush()
+			blocks = append(blocks, "> "+s)
+			continue
+		}
+		if strings.TrimSpace(l) != "" {
+			text = append(text, l)
+		}
+	}
+	flush()
+	return strings.Join(blocks, "\n\n")
+}
+
+// mdTransition bolds a status change, e.g. "**Despacho → Em Curso**".
+func mdTransition(prev, cur string) string {
+	return fmt.Sprintf("**%s → %s**", prev, cur)
+}
+
+// meansTableMD lists the means that changed as a kind | antes | agora table;
+// empty when nothing changed.
+func meansTableMD(oldM, newM Means) string {
+	rows := []struct {
+		key      string
+		old, new int
+	}{
+		{"md.man", oldM.Man, newM.Man},
+		{"md.terrain", oldM.Terrain, newM.Terrain},
+		{"md.aerial", oldM.Aerial, newM.Aerial},
+		{"md.aquatic", oldM.Aquatic, newM.Aquatic},
+	}
+	var b strings.Builder
+	for _, r := range rows {
+		if r.old == r.new {
+			continue
+		}
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "| %s | %s | %s |\n|---|--:|--:|", tr("md.kind"), tr("md.before"), tr("md.after"))
+		}
+		fmt.Fprintf(&b, "\n| %s | %d | %d |", tr(r.key), r.old, r.new)
+	}
+	return b.String()
+}
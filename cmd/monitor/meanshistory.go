@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The means history feeds the "Op.: 12→25→34 ▁▄█" trend in means-change
+// notifications and the series in /api/incidents. It lives in memory only,
+// so a restart starts it again, and is dropped when the incident concludes.
+const (
+	meansHistoryWindow = 2 * time.Hour
+	meansHistoryStep   = 15 * time.Minute // sample spacing while the means hold steady
+	meansHistoryMax    = 12
+)
+
+// meansSample is one point of an incident's means history.
+type meansSample struct {
+	At      time.Time `json:"t"`
+	Man     int       `json:"man"`
+	Terrain int       `json:"terrain"`
+	Aerial  int       `json:"aerial"`
+}
+
+// sampleMeans adds m to the history of id when it differs from the last
+// sample or that one is older than meansHistoryStep. Samples older than
+// meansHistoryWindow and those past meansHistoryMax are dropped, oldest first.
+func (ms *MonitorState) sampleMeans(id, status string, m Means, now time.Time) {
+	if isConcludedStatus(status) {
+		delete(ms.meansHist, id)
+		return
+	}
+	h := ms.meansHist[id]
+	if n := len(h); n > 0 {
+		last := h[n-1]
+		if last.Man == m.Man && last.Terrain == m.Terrain && last.Aerial == m.Aerial && now.Sub(last.At) < meansHistoryStep {
+			return
+		}
+	}
+	h = append(h, meansSample{At: now, Man: m.Man, Terrain: m.Terrain, Aerial: m.Aerial})
+	drop := 0
+	for drop < len(h)-1 && now.Sub(h[drop].At) > meansHistoryWindow {
+		drop++
+	}
+	drop = max(drop, len(h)-meansHistoryMax)
+	ms.meansHist[id] = append(h[:0:0], h[drop:]...)
+}
+
+// meansTrendLine is the operatives trend of id, or "" with fewer than two
+// samples.
+func (ms *MonitorState) meansTrendLine(id string) string {
+	h := ms.meansHist[id]
+	if len(h) < 2 {
+		return ""
+	}
+	vals := make([]int, len(h))
+	nums := make([]string, len(h))
+	for i, s := range h {
+		vals[i], nums[i] = s.Man, strconv.Itoa(s.Man)
+	}
+	return tr("means.trend", strings.Join(nums, "→"), sparkline(vals))
+}
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws vals with block characters scaled between their minimum
+// and maximum; a flat series sits at the bottom.
+func sparkline(vals []int) string {
+	if len(vals) == 0 {
+		return ""
+	}
+	lo, hi := vals[0], vals[0]
+	for _, v := range vals {
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	var b strings.Builder
+	for _, v := range vals {
+		i := 0
+		if hi > lo {
+			i = (v - lo) * (len(sparkBlocks) - 1) / (hi - lo)
+		}
+		b.WriteRune(sparkBlocks[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,42 @@
+package main
+
+// maxOf is the larger of each kind of means in m and o.
+func (m Means) maxOf(o Means) Means {
+	return Means{
+		Man:     max(m.Man, o.Man),
+		Terrain: max(m.Terrain, o.Terrain),
+		Aerial:  max(m.Aerial, o.Aerial),
+		Aquatic: max(m.Aquatic, o.Aquatic),
+	}
+}
+
+// trackMaxMeans raises the peak means of id to cur and reports whether it
+// changed. Each kind is kept on its own, so the peak may combine snapshots.
+// It is never lowered, not even by a reactivation. An incident from a state
+// file without peaks starts from its last snapshot.
+func (ms *MonitorState) trackMaxMeans(id string, cur Means) bool {
+	prev, ok := ms.maxMeans[id]
+	if !ok {
+		prev = ms.means[id]
+	}
+	next := prev.maxOf(cur)
+	if ok && next == prev {
+		return false
+	}
+	ms.maxMeans[id] = next
+	return true
+}
+
+// maxMeansLine is the "Máximo" line of a conclusion notification, or "" for
+// other statuses or an incident that never had means.
+func (ms *MonitorState) maxMeansLine(id, status string) string {
+	m := ms.maxMeans[id]
+	if !isConcludedStatus(status) || m == (Means{}) {
+		return ""
+	}
+	line := tr("means.max", m.Man, m.Terrain, m.Aerial)
+	if m.Aquatic > 0 {
+		line += tr("means.max.aquatic", m.Aquatic)
+	}
+	return line
+}
@@ -0,0 +1,134 @@
+package main
+
+import "net/http"
+
+// The monitor records metrics through these interfaces so the Prometheus
+// client can be left out of the binary: metrics_prom.go backs them with
+// promauto, metrics_noop.go (-tags nometrics) with values that do nothing.
+
+type counter interface {
+	Inc()
+	Add(float64)
+}
+
+type gauge interface {
+	Set(float64)
+	Inc()
+	Add(float64)
+}
+
+type observer interface{ Observe(float64) }
+
+type counterVec interface {
+	WithLabelValues(lvs ...string) counter
+}
+
+type observerVec interface {
+	WithLabelValues(lvs ...string) observer
+}
+
+type gaugeVec interface {
+	WithLabelValues(lvs ...string) gauge
+	Reset()
+}
+
+// metricsProvider creates and registers metrics. handler returns nil when
+// there is nothing to serve on /metrics.
+type metricsProvider interface {
+	newCounter(name, help string) counter
+	newCounterVec(name, help string, labels []string) counterVec
+	newGauge(name, help string) gauge
+	newGaugeVec(name, help string, labels []string) gaugeVec
+	newHistogram(name, help string, buckets []float64) observer
+	newHistogramVec(name, help string, buckets []float64, labels []string) observerVec
+	handler() http.Handler
+}
+
+func linearBuckets(start, width float64, count int) []float64 {
+	b := make([]float64, count)
+	for i := range b {
+		b[i] = start + float64(i)*width
+	}
+	return b
+}
+
+func exponentialBuckets(start, factor float64, count int) []float64 {
+	b := make([]float64, count)
+	for i := range b {
+		b[i] = start
+		start *= factor
+	}
+	return b
+}
+
+// Metrics
+var (
+	importantIncidents = metrics.newGaugeVec("bombeiros_important_incidents",
+		"Active incidents marked important by VOST",
+		[]string{"concelho"})
+	statusTransitions = metrics.newCounterVec("bombeiros_status_transitions_total",
+		"Total number of status transitions",
+		[]string{"from", "to"})
+	timeToConclusion = metrics.newHistogram("bombeiros_time_to_conclusion_seconds",
+		"Time from first seen to conclusion",
+		linearBuckets(300, 900, 20)) // 5min start, +15min, 20 buckets ~ 5h
+	statusDuration = metrics.newHistogramVec("bombeiros_status_duration_seconds",
+		"Time spent in a status, observed when the incident leaves it",
+		exponentialBuckets(60, 2, 11), // 1min .. ~17h
+		[]string{"status"})
+	notificationsTotal = metrics.newCounterVec("bombeiros_notifications_total",
+		"Notifications by channel, ntfy server, type (new/status/means/extra/summary) and result (ok/error/dryrun/quiet_suppressed)",
+		[]string{"channel", "server", "type", "result"})
+	// Both follow the saved state (known IDs and last status), so a restart
+	// does not count an incident again.
+	incidentsStarted = metrics.newCounterVec("bombeiros_incidents_started_total",
+		"Incidents announced as new, by concelho and natureza",
+		[]string{"concelho", "natureza"})
+	incidentsConcluded = metrics.newCounterVec("bombeiros_incidents_concluded_total",
+		"Incidents that reached Conclusão, by concelho and natureza",
+		[]string{"concelho", "natureza"})
+	reactivationsTotal = metrics.newCounter("bombeiros_reactivations_total",
+		"Incidents that went back to Despacho/Em Curso after Conclusão or Vigilância")
+	panicsTotal = metrics.newCounter("bombeiros_panics_total",
+		"Poll cycles aborted by a recovered panic")
+	apiUp = metrics.newGauge("bombeiros_api_up",
+		"1 if the last fogos.pt fetch succeeded, 0 otherwise")
+	apiConsecutiveFailures = metrics.newGauge("bombeiros_api_consecutive_failures",
+		"Number of consecutive failed fogos.pt fetches")
+	apiReceivedBytes = metrics.newCounter("bombeiros_api_received_bytes_total",
+		"Bytes received from the fogos.pt API as sent on the wire (compressed)")
+	apiPayloadBytes = metrics.newGauge("bombeiros_api_payload_bytes",
+		"Decompressed size of the last incidents response")
+	sourceUp = metrics.newGaugeVec("bombeiros_source_up",
+		"1 if the last fetch of the source (SOURCES) succeeded, 0 otherwise",
+		[]string{"source"})
+	sourceIncidents = metrics.newGaugeVec("bombeiros_source_incidents",
+		"Incidents in the last successful response of the source, before merging and filters",
+		[]string{"source"})
+	geometryFixes = metrics.newCounterVec("bombeiros_geometry_fixes_total",
+		"Incident points outside GEO_BBOX, by result: swapped (lat/lon were swapped and fixed) or dropped (geometry removed)",
+		[]string{"result"})
+	stateLockHeld = metrics.newGauge("bombeiros_state_lock_held",
+		"1 if this replica holds the STATE_BACKEND=redis lock and sends the notifications")
+	dataStale = metrics.newGauge("bombeiros_data_stale",
+		"1 if the last fetch failed and the incident gauges come from the cached feed (or an older cycle)")
+	httpDNSDuration = metrics.newHistogram("bombeiros_http_dns_seconds",
+		"DNS lookup time of API requests",
+		exponentialBuckets(0.001, 2, 14)) // 1ms .. ~8s
+	httpConnectDuration = metrics.newHistogram("bombeiros_http_connect_seconds",
+		"TCP connect time of API requests (new connections only)",
+		exponentialBuckets(0.001, 2, 14))
+	httpTLSDuration = metrics.newHistogram("bombeiros_http_tls_seconds",
+		"TLS handshake time of API requests (new connections only)",
+		exponentialBuckets(0.001, 2, 14))
+	httpTTFBDuration = metrics.newHistogram("bombeiros_http_ttfb_seconds",
+		"Time from sending an API request to the first byte of the response",
+		exponentialBuckets(0.01, 2, 12)) // 10ms .. ~20s
+	httpConnReuseRatio = metrics.newGauge("bombeiros_http_conn_reuse_ratio",
+		"Share of API requests since startup that reused a pooled connection")
+	ntfyRequestDuration = metrics.newHistogram("bombeiros_ntfy_request_duration_seconds",
+		"Latency of ntfy publish requests",
+		exponentialBuckets(0.05, 2, 10)) // 50ms .. ~25s
+	ntfyQueueLength = metrics.newGauge("bombeiros_ntfy_queue_length",
+		"Notifications waiting for the ntfy rate limiter")
+)
@@ -0,0 +1,40 @@
+//go:build nometrics
+// +build nometrics
+
+package main
+
+import "net/http"
+
+// Built with -tags nometrics: nothing is recorded and /metrics is not served.
+var metrics metricsProvider = noMetrics{}
+
+type noMetrics struct{}
+
+type noMetric struct{}
+
+func (noMetric) Inc()            {}
+func (noMetric) Set(float64)     {}
+func (noMetric) Add(float64)     {}
+func (noMetric) Observe(float64) {}
+func (noMetric) Reset()          {}
+
+func (noMetric) WithLabelValues(...string) gauge { return noMetric{} }
+
+type noCounterVec struct{}
+
+type noObserverVec struct{}
+
+func (noObserverVec) WithLabelValues(...string) observer { return noMetric{} }
+
+func (noCounterVec) WithLabelValues(...string) counter { return noMetric{} }
+
+func (noMetrics) newCounter(string, string) counter                 { return noMetric{} }
+func (noMetrics) newCounterVec(string, string, []string) counterVec { return noCounterVec{} }
+func (noMetrics) newGauge(string, string) gauge                     { return noMetric{} }
+func (noMetrics) newGaugeVec(string, string, []string) gaugeVec     { return noMetric{} }
+func (noMetrics) newHistogram(string, string, []float64) observer   { return noMetric{} }
+func (noMetrics) handler() http.Handler                             { return nil }
+
+func (noMetrics) newHistogramVec(string, string, []float64, []string) observerVec {
+	return noObserverVec{}
+}
@@ -0,0 +1,13 @@
+//go:build nometrics
+
+package main
+
+import "testing"
+
+func TestMetricsHandler(t *testing.T) {
+	countNotification(notifyNew, resultFiltered, nil)
+	stateLockHeld.Set(1)
+	if metrics.handler() != nil {
+		t.Error("/metrics handler in a nometrics build")
+	}
+}
@@ -0,0 +1,61 @@
+//go:build !nometrics
+// +build !nometrics
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var metrics metricsProvider = promMetrics{}
+
+// promMetrics registers everything with the default Prometheus registry.
+type promMetrics struct{}
+
+type promCounterVec struct{ *prometheus.CounterVec }
+
+func (v promCounterVec) WithLabelValues(lvs ...string) counter {
+	return v.CounterVec.WithLabelValues(lvs...)
+}
+
+type promGaugeVec struct{ *prometheus.GaugeVec }
+
+func (v promGaugeVec) WithLabelValues(lvs ...string) gauge {
+	return v.GaugeVec.WithLabelValues(lvs...)
+}
+
+type promHistogramVec struct{ *prometheus.HistogramVec }
+
+func (v promHistogramVec) WithLabelValues(lvs ...string) observer {
+	return v.HistogramVec.WithLabelValues(lvs...)
+}
+
+func (promMetrics) newCounter(name, help string) counter {
+	return promauto.NewCounter(prometheus.CounterOpts{Name: name, Help: help})
+}
+
+func (promMetrics) newCounterVec(name, help string, labels []string) counterVec {
+	return promCounterVec{promauto.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)}
+}
+
+func (promMetrics) newGauge(name, help string) gauge {
+	return promauto.NewGauge(prometheus.GaugeOpts{Name: name, Help: help})
+}
+
+func (promMetrics) newGaugeVec(name, help string, labels []string) gaugeVec {
+	return promGaugeVec{promauto.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)}
+}
+
+func (promMetrics) newHistogram(name, help string, buckets []float64) observer {
+	return promauto.NewHistogram(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets})
+}
+
+func (promMetrics) newHistogramVec(name, help string, buckets []float64, labels []string) observerVec {
+	return promHistogramVec{promauto.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)}
+}
+
+func (promMetrics) handler() http.Handler { return promhttp.Handler() }
@@ -0,0 +1,23 @@
+//go:build !nometrics
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	countNotification(notifyNew, resultFiltered, nil)
+	h := metrics.handler()
+	if h == nil {
+		t.Fatal("no /metrics handler in the default build")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if want := `bombeiros_notifications_total{channel="ntfy",result="filtered",server="",type="new"}`; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("/metrics lacks %s", want)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"maps"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestBuildVariants builds the default binary and the nometrics one, and
+// checks that only the default one links the Prometheus client.
+func TestBuildVariants(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the binary twice")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go toolchain in PATH")
+	}
+	for _, c := range []struct {
+		tags string
+		prom bool
+	}{
+		{"", true},
+		{"nometrics", false},
+	} {
+		args := []string{"build", "-o", filepath.Join(t.TempDir(), "monitor")}
+		list := []string{"list", "-deps"}
+		if c.tags != "" {
+			args = append(args, "-tags", c.tags)
+			list = append(list, "-tags", c.tags)
+		}
+		if out, err := exec.Command(gobin, append(args, ".")...).CombinedOutput(); err != nil {
+			t.Errorf("go build -tags %q: %v\n%s", c.tags, err, out)
+			continue
+		}
+		out, err := exec.Command(gobin, append(list, ".")...).Output()
+		if err != nil {
+			t.Errorf("go list -tags %q: %v", c.tags, err)
+			continue
+		}
+		if got := strings.Contains(string(out), "github.com/prometheus/client_golang/"); got != c.prom {
+			t.Errorf("-tags %q: links the Prometheus client = %v, want %v", c.tags, got, c.prom)
+		}
+	}
+}
+
+func TestMetricLabel(t *testing.T) {
+	for in, want := range map[string]string{
+		"Em Curso":              "em curso",
+		"  em   curso ":         "em curso",
+		"EM\tCURSO":             "em curso",
+		"Em Cursó":              "em curso",
+		"Sertã":                 "serta",
+		"Vila de Rei":           "vila de rei",
+		"Povoamento\nFlorestal": "povoamento florestal",
+		"Agrícola – Colheitas":  "agricola – colheitas",
+		"":                      "unknown",
+		" \t ":                  "unknown",
+	} {
+		if got := metricLabel(in); got != want {
+			t.Errorf("metricLabel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseActiveLabels(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want []string
+		err  bool
+	}{
+		{"district,concelho,regiao,natureza,status", activeLabelNames, false},
+		// registration order, whatever the order given
+		{"status; Concelho", []string{"concelho", "status"}, false},
+		{"None", []string{}, false},
+		{"", nil, true},
+		{"concelho,freguesia", nil, true},
+	} {
+		got, err := parseActiveLabels(c.in)
+		if (err != nil) != c.err || !slices.Equal(got, c.want) {
+			t.Errorf("parseActiveLabels(%q) = %q, %v", c.in, got, err)
+		}
+	}
+}
+
+// gaugeSeries is a gaugeVec that keeps its series in memory, keyed by the
+// label values joined with "|".
+type gaugeSeries map[string]float64
+
+func (g gaugeSeries) WithLabelValues(lvs ...string) gauge {
+	return seriesGauge{g, strings.Join(lvs, "|")}
+}
+
+func (g gaugeSeries) Reset() { clear(g) }
+
+type seriesGauge struct {
+	g   gaugeSeries
+	key string
+}
+
+func (s seriesGauge) Set(v float64) { s.g[s.key] = v }
+func (s seriesGauge) Inc()          { s.g[s.key]++ }
+func (s seriesGauge) Add(v float64) { s.g[s.key] += v }
+
+// TestActiveIncidentLabels: typo'd and empty feed values end up in one
+// series, and METRICS_LABELS picks the dimensions.
+func TestActiveIncidentLabels(t *testing.T) {
+	for _, tc := range []struct {
+		labels string
+		want   map[string]float64
+	}{
+		{"district,concelho,regiao,natureza,status", map[string]float64{
+			"castelo branco|serta|unknown|mato|em curso":    3,
+			"castelo branco|serta|unknown|unknown|despacho": 1,
+		}},
+		{"concelho,status", map[string]float64{"serta|em curso": 3, "serta|despacho": 1}},
+		{"none", map[string]float64{"": 4}},
+	} {
+		t.Run(tc.labels, func(t *testing.T) {
+			cfg, srv, _, ms := newTestMonitor(t, map[string]string{"METRICS_LABELS": tc.labels})
+			series := gaugeSeries{}
+			prevVec, prevLabels := activeIncidents, activeLabels
+			activeIncidents, activeLabels = series, cfg.activeLabels
+			t.Cleanup(func() { activeIncidents, activeLabels = prevVec, prevLabels })
+
+			a := incident("2025050001", "Em Curso", 20)
+			b := incident("2025050002", "  em  curso", 8)
+			b["concelho"], b["natureza"] = "SERTÃ", "Mato "
+			c := incident("2025050003", "Em Cursó", 4)
+			d := incident("2025050004", "Despacho", 4)
+			d["natureza"] = ""
+			srv.setFeed(a, b, c, d)
+			mustRun(t, cfg, ms)
+			if !maps.Equal(series, gaugeSeries(tc.want)) {
+				t.Errorf("series %v, want %v", series, tc.want)
+			}
+		})
+	}
+}
+
+// TestMetricsLabelsNeedRestart: the gauge is registered once, so a reload
+// keeps the label set it was registered with.
+func TestMetricsLabelsNeedRestart(t *testing.T) {
+	old, _ := testConfig(t, nil)
+	cur, _ := testConfig(t, map[string]string{"METRICS_LABELS": "status"})
+	if kept := keepStartupOnly(old, cur); !slices.Contains(kept, "METRICS_LABELS") {
+		t.Errorf("kept %q", kept)
+	}
+	if !slices.Equal(cur.activeLabels, activeLabelNames) || cur.MetricsLabels != old.MetricsLabels {
+		t.Errorf("after a reload: %q, %q", cur.MetricsLabels, cur.activeLabels)
+	}
+}
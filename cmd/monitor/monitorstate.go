@@ -0,0 +1,190 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// MonitorState is the per-incident tracking carried from one cycle to the
+// next and persisted in STATE_FILE. runOnce holds mu while it reads and
+// changes the state, never across fetches or sends; the methods in lower
+// case expect the caller to hold it, the exported accessors take it
+// themselves and are safe from any goroutine.
+type MonitorState struct {
+	mu sync.RWMutex
+
+	status      map[string]string        // last status per ID
+	firstSeen   map[string]time.Time     // first time each ID was seen
+	concludedAt map[string]time.Time     // when each ID reached Conclusão
+	means       map[string]Means         // last means snapshot per ID
+	maxMeans    map[string]Means         // most means of each kind ever committed per ID
+	meansHist   map[string][]meansSample // recent means per active ID, oldest first; not persisted
+	extra       map[string]string        // last "extra" text per ID
+	annotations map[string]int64         // open Grafana annotation per ID
+	aliasOf     map[string]string        // other identifiers -> tracked ID
+	history     map[string]historyEntry  // 8-day history for the weekly summary
+	peaks       map[string]int           // local day -> most incidents active at once
+	timeline    map[string][]statusStep  // status steps per ID, oldest first
+	spans       map[string]activeSpans   // reactivations and active time per ID
+	roads       map[string][]string      // roads the extra says are closed, per ID
+	important   map[string]bool          // last "important" flag per ID
+	burned      map[string]float64       // ICNF burned area (ha) last notified per ID
+	positions   map[string]geoPoint      // last stored point per ID (see MOVE_THRESHOLD_KM)
+
+	lastHourlyMark string // "2006-01-02 15" of the last hourly summary
+	lastSummaryDay string // "2006-01-02" of the last daily summary
+	lastWeeklyMark string // local date of the last scheduled weekly summary
+
+	// What the last hourly and daily summaries reported, for their deltas.
+	prevHourly, prevDaily *summaryCounts
+
+	warm bool // the warm-up cycle has run since the state was loaded
+
+	// Per-municipality IDs and last-seen times after the last completed
+	// cycle; nil until the first cycle (or after a discard).
+	cycleState perMuniState
+	cycleSeen  perMuniSeen
+
+	// recovered is a STATE_FILE loadForCycle read from a backup, reported
+	// once ms is unlocked (see takeRecovered).
+	recovered *stateRecoveredError
+
+	// Stamp of what the poll loop last read from or wrote to the store.
+	onDisk    string
+	dirty     bool // in-memory state not yet written
+	flushedAt time.Time
+}
+
+func NewMonitorState() *MonitorState {
+	ms := &MonitorState{}
+	ms.reset()
+	return ms
+}
+
+// monitor is the state of the running process; commands that work on a
+// state file of their own build theirs with NewMonitorState.
+var monitor = NewMonitorState()
+
+// reset empties the per-ID maps and marks before a reload.
+func (ms *MonitorState) reset() {
+	ms.status = map[string]string{}
+	ms.firstSeen = map[string]time.Time{}
+	ms.concludedAt = map[string]time.Time{}
+	ms.means = map[string]Means{}
+	ms.maxMeans = map[string]Means{}
+	ms.meansHist = map[string][]meansSample{}
+	ms.extra = map[string]string{}
+	ms.annotations = map[string]int64{}
+	ms.aliasOf = map[string]string{}
+	ms.history = map[string]historyEntry{}
+	ms.peaks = map[string]int{}
+	ms.timeline = map[string][]statusStep{}
+	ms.spans = map[string]activeSpans{}
+	ms.roads = map[string][]string{}
+	ms.important = map[string]bool{}
+	ms.burned = map[string]float64{}
+	ms.positions = map[string]geoPoint{}
+	ms.lastHourlyMark, ms.lastSummaryDay, ms.lastWeeklyMark = "", "", ""
+	ms.prevHourly, ms.prevDaily = nil, nil
+	ms.cycleState, ms.cycleSeen = nil, nil
+	ms.warm = false
+}
+
+// lock takes mu for writing and returns the function that releases it. The
+// function can be called again with no effect, so a deferred call covers a
+// panic or an early return while an explicit one ends the section.
+func (ms *MonitorState) lock() (unlock func()) {
+	ms.mu.Lock()
+	return sync.OnceFunc(ms.mu.Unlock)
+}
+
+// CanonicalID returns the ID the incident in p is tracked under.
+func (ms *MonitorState) CanonicalID(p map[string]any) string {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.canonicalID(p)
+}
+
+// Status returns the last status recorded for id.
+func (ms *MonitorState) Status(id string) (string, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	s, ok := ms.status[id]
+	return s, ok
+}
+
+// FirstSeen returns when id was first seen.
+func (ms *MonitorState) FirstSeen(id string) (time.Time, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	t, ok := ms.firstSeen[id]
+	return t, ok
+}
+
+// ConcludedAt returns when id reached Conclusão.
+func (ms *MonitorState) ConcludedAt(id string) (time.Time, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	t, ok := ms.concludedAt[id]
+	return t, ok
+}
+
+// SummaryMarks returns the hour and day of the last hourly and daily summaries.
+func (ms *MonitorState) SummaryMarks() (hourly, daily string) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.lastHourlyMark, ms.lastSummaryDay
+}
+
+// SummaryBase returns what the last hourly and daily summaries reported, nil
+// before the first of each.
+func (ms *MonitorState) SummaryBase() (hourly, daily *summaryCounts) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.prevHourly, ms.prevDaily
+}
+
+// Means returns the last means snapshot of id.
+func (ms *MonitorState) Means(id string) (Means, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	m, ok := ms.means[id]
+	return m, ok
+}
+
+// MaxMeans returns the most means of each kind id has had.
+func (ms *MonitorState) MaxMeans(id string) (Means, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	m, ok := ms.maxMeans[id]
+	return m, ok
+}
+
+// Extra returns the last "extra" text of id.
+func (ms *MonitorState) Extra(id string) string {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.extra[id]
+}
+
+// MeansHistory returns a copy of the recent means samples of id.
+func (ms *MonitorState) MeansHistory(id string) []meansSample {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return slices.Clone(ms.meansHist[id])
+}
+
+// Timeline returns a copy of the status steps of id.
+func (ms *MonitorState) Timeline(id string) []statusStep {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return slices.Clone(ms.timeline[id])
+}
+
+// ClosedRoads returns a copy of the roads the extra of id says are closed.
+func (ms *MonitorState) ClosedRoads(id string) []string {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return slices.Clone(ms.roads[id])
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestForgetIDDropsTimeline(t *testing.T) {
+	ms := NewMonitorState()
+	st := perMuniState{"Sertã": {"1": {}, "2": {}}}
+	seen := perMuniSeen{"Sertã": {"1": testStart.Add(-100 * time.Hour), "2": testStart}}
+	for _, id := range []string{"1", "2"} {
+		ms.status[id] = "Em Curso"
+		ms.recordStatus(id, "Despacho", nil, testStart.Add(-time.Hour))
+		ms.recordStatus(id, "Em Curso", nil, testStart)
+	}
+
+	if n := ms.pruneSeenBefore(st, seen, testStart.Add(-72*time.Hour)); n != 1 {
+		t.Fatalf("pruned %d IDs, want 1", n)
+	}
+	if _, ok := ms.timeline["1"]; ok {
+		t.Error("timeline of a forgotten ID kept")
+	}
+	if len(ms.timeline["2"]) != 2 {
+		t.Errorf("timeline of a kept ID = %v", ms.timeline["2"])
+	}
+}
+
+// TestRunOnceConcurrentReaders runs cycles while another goroutine reads
+// through the accessors, for `go test -race`.
+func TestRunOnceConcurrentReaders(t *testing.T) {
+	cfg, srv, clk, ms := newTestMonitor(t, nil)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p := map[string]any{"id": "2025050001"}
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			id := ms.CanonicalID(p)
+			ms.Status(id)
+			ms.FirstSeen(id)
+			ms.ConcludedAt(id)
+			ms.Means(id)
+			ms.MaxMeans(id)
+			ms.Extra(id)
+			ms.MeansHistory(id)
+			ms.Timeline(id)
+			ms.ClosedRoads(id)
+			ms.SummaryMarks()
+			incidents.get()
+		}
+	}()
+
+	statuses := []string{"Despacho", "Em Curso", "Em Resolução", "Conclusão"}
+	for i := range 12 {
+		f := incident("2025050001", statuses[i%len(statuses)], 4*(i+1))
+		if i%2 == 1 {
+			f["extra"] = "EN2 cortada ao trânsito"
+		}
+		srv.setFeed(f, incident("2025050002", "Em Curso", 8))
+		mustRun(t, cfg, ms)
+		clk.advance(time.Minute)
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestRunOnceUnlockedWhileSending(t *testing.T) {
+	cfg, srv, _, ms := newTestMonitor(t, nil)
+	inner := srv.Config.Handler
+	var mu sync.Mutex
+	var seen []string
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			done := make(chan string, 1)
+			go func() {
+				s, _ := ms.Status("2025050001")
+				done <- s
+			}()
+			select {
+			case s := <-done:
+				mu.Lock()
+				seen = append(seen, s)
+				mu.Unlock()
+			case <-time.After(2 * time.Second):
+				t.Error("state still locked while a notification is sent")
+			}
+		}
+		inner.ServeHTTP(w, r)
+	})
+
+	srv.setFeed(incident("2025050001", "Despacho", 4))
+	mustRun(t, cfg, ms)
+	mu.Lock()
+	defer mu.Unlock()
+	// the messages go out after the cycle recorded the status
+	if len(seen) != 2 || seen[0] != "Despacho" {
+		t.Errorf("status read during the sends: %q", seen)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import "fmt"
+
+// geoPoint is the last stored position of an incident.
+type geoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// movedEvent is an incident whose point moved more than MOVE_THRESHOLD_KM
+// from the position stored for it.
+type movedEvent struct {
+	disp, id string
+	km       float64
+	f        Feature
+}
+
+// trackPosition compares the feature's point with the one stored for id. The
+// stored point only changes on a move beyond the threshold, so slow drift
+// adds up until it counts. The first point of an incident is stored as is;
+// stored reports that the state changed either way.
+func (ms *MonitorState) trackPosition(cfg *Config, id string, f Feature) (km float64, moved, stored bool) {
+	lat, lon, ok := getCoords(f.Geometry)
+	if !ok {
+		return 0, false, false
+	}
+	prev, ok := ms.positions[id]
+	if !ok {
+		ms.positions[id] = geoPoint{Lat: lat, Lon: lon}
+		return 0, false, true
+	}
+	km = haversineKm(prev.Lat, prev.Lon, lat, lon)
+	if cfg.MoveThresholdKm <= 0 || km <= cfg.MoveThresholdKm {
+		return km, false, false
+	}
+	ms.positions[id] = geoPoint{Lat: lat, Lon: lon}
+	return km, true, true
+}
+
+func (ev movedEvent) notification(cfg *Config) Notification {
+	p := ev.f.Properties
+	body := fmt.Sprintf("ID: %s", ev.id)
+	if lat, lon, ok := getCoords(ev.f.Geometry); ok {
+		body += "\n" + tr("moved.coords", lat, lon)
+	}
+	if dl := distanceLine(cfg, ev.f); dl != "" {
+		body += "\n" + dl
+	}
+	if nl := nearLine(cfg, ev.f); nl != "" {
+		body += "\n" + nl
+	}
+	if isFireIncident(p) && ev.id != "" {
+		body += "\n" + tr("fogos.line", "https://fogos.pt/fogo/"+ev.id)
+	}
+	return Notification{
+		Type:       notifyMoved,
+		Title:      tr("moved.title", ev.km, ev.disp),
+		Body:       body,
+		Tags:       "round_pushpin",
+		Priority:   "2",
+		Click:      mapsURLForFeature(ev.f, ev.disp),
+		IncidentID: ev.id,
+		Incidents:  []Feature{ev.f},
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// muteSet holds incidents silenced through the API. Muted incidents keep
+// updating state and metrics; only their notifications are skipped. It is
+// written by HTTP handlers and read by the poll goroutine, and persisted to
+// its own file next to STATE_FILE so neither side rewrites the other's data.
+type muteSet struct {
+	mu     sync.Mutex
+	path   string
+	loaded bool
+	until  map[string]time.Time // zero time = until unmuted
+}
+
+var mutes = &muteSet{until: map[string]time.Time{}}
+
+// mutesPath is <state file without .json>_muted.json.
+func mutesPath(statePath string) string {
+	return strings.TrimSuffix(statePath, ".json") + "_muted.json"
+}
+
+// load reads the persisted set once; later calls are no-ops.
+func (m *muteSet) load(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.loaded {
+		return
+	}
+	m.loaded, m.path = true, path
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(b, &raw); err != nil {
+		slog.Warn("ficheiro de silenciados inválido; ignorado", "path", path, "err", err)
+		return
+	}
+	for id, s := range raw {
+		t, _ := time.Parse(time.RFC3339, s)
+		m.until[id] = t
+	}
+}
+
+// saveLocked writes the set; callers hold m.mu.
+func (m *muteSet) saveLocked() error {
+	if m.path == "" {
+		return nil
+	}
+	raw := map[string]string{}
+	for id, t := range m.until {
+		raw[id] = ""
+		if !t.IsZero() {
+			raw[id] = t.UTC().Format(time.RFC3339)
+		}
+	}
+	b, _ := json.MarshalIndent(raw, "", "  ")
+	return os.WriteFile(m.path, b, 0644)
+}
+
+func (m *muteSet) isMuted(id string) bool {
+	if id == "" {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.until[id]
+	if !ok {
+		return false
+	}
+	if !t.IsZero() && conf().now().After(t) {
+		delete(m.until, id)
+		_ = m.saveLocked()
+		return false
+	}
+	return true
+}
+
+// set mutes id for ttl (0 = until unmuted) or, with mute=false, unmutes it.
+func (m *muteSet) set(id string, mute bool, ttl time.Duration) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var until time.Time
+	if mute {
+		if ttl > 0 {
+			until = conf().now().Add(ttl)
+		}
+		m.until[id] = until
+	} else {
+		delete(m.until, id)
+	}
+	return until, m.saveLocked()
+}
+
+// muteActionURL is the "Silenciar" action target, or "" when muting over HTTP
+// is not configured.
+func muteActionURL(cfg *Config, id string) string {
+	if id == "" || cfg.PublicBaseURL == "" || cfg.MuteToken == "" {
+		return ""
+	}
+	return strings.TrimRight(cfg.PublicBaseURL, "/") + "/api/incidents/" + url.PathEscape(id) + "/mute"
+}
+
+// registerMuteAPI adds POST /api/incidents/{id}/mute and /unmute when
+// MUTE_TOKEN is set. The token goes in "Authorization: Bearer" or ?token=.
+func registerMuteAPI(mux *http.ServeMux, cfg *Config) {
+	if cfg.MuteToken == "" {
+		return
+	}
+	handle := func(mute bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !validToken(r, cfg.MuteToken) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			id := r.PathValue("id")
+			until, err := mutes.set(id, mute, conf().MuteTTL)
+			if err != nil {
+				slog.Error("erro a gravar silenciados", "err", err)
+			}
+			slog.Info("silenciar ocorrência", "incident_id", id, "muted", mute, "remote", r.RemoteAddr)
+			resp := map[string]any{"id": id, "muted": mute}
+			if mute && !until.IsZero() {
+				resp["until"] = until.UTC().Format(time.RFC3339)
+			}
+			writeJSON(w, time.Time{}, resp)
+		}
+	}
+	mux.HandleFunc("POST /api/incidents/{id}/mute", handle(true))
+	mux.HandleFunc("POST /api/incidents/{id}/unmute", handle(false))
+}
+
+// validToken checks a Bearer header or ?token= against want in constant time.
+func validToken(r *http.Request, want string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		got = r.URL.Query().Get("token")
+	}
+	return got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
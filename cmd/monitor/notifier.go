@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// A Notifier delivers a message on one channel (ntfy, Gotify, email).
+// postNtfyExt applies the filters, digest, dedup, dry-run, mutes, pause and
+// quiet hours once, then hands the resulting Event to every configured
+// notifier at the same time; NTFY_RATE_PER_MINUTE holds back ntfy alone.
+// CHANNEL_EVENTS_<CHANNEL> narrows what ntfy and Gotify receive, EMAIL_EVENTS
+// what goes by email.
+type Notifier interface {
+	// Name is the channel label of bombeiros_notifications_total.
+	Name() string
+	// Targets names where Send posts, for the dry-run log.
+	Targets() string
+	// Send delivers ev and records the outcome in the metrics itself.
+	Send(ctx context.Context, ev Event) error
+}
+
+// Event is a message ready to send: quiet hours have already lowered its
+// priority and added their tag.
+type Event struct {
+	Type       string
+	IncidentID string
+	Incidents  []Feature
+	Title      string
+	Body       string // plain text; action links are read from it
+	Markdown   string // markdown rendering, "" when there is none
+	// UseMarkdown sends Markdown instead of Body (NTFY_MARKDOWN, or the
+	// weekly report).
+	UseMarkdown bool
+	Tags        string
+	Priority    string
+	Click       string
+	Share       string
+	// src is the notification as queued, for what depends on its original
+	// priority (NTFY_EMAIL) and for 429 retries.
+	src Notification
+}
+
+// text is what a channel without a markdown switch of its own posts.
+func (ev Event) text() string {
+	if ev.UseMarkdown {
+		return ev.Markdown
+	}
+	return ev.Body
+}
+
+// notifiersFor lists the channels n goes to, minus those whose
+// CHANNEL_EVENTS leave it out. A 429 retry goes back to ntfy alone. Email
+// is only there outside the single-shot commands (mail is nil) and for what
+// EMAIL_EVENTS selects.
+func notifiersFor(cfg *Config, ntfyURL, topic string, n Notification) []Notifier {
+	var all []Notifier
+	if len(n.servers) > 0 || !cfg.GotifyOnly {
+		all = append(all, ntfyNotifier{cfg: cfg, url: ntfyURL, topic: topic})
+	}
+	if len(n.servers) == 0 && cfg.GotifyURL != "" {
+		all = append(all, gotifyNotifier{cfg: cfg})
+	}
+	if len(n.servers) == 0 && mail != nil && emailWanted(cfg, n) {
+		all = append(all, emailNotifier{cfg: cfg, m: mail})
+	}
+	out := all[:0]
+	for _, nt := range all {
+		if set := cfg.channelEvents[nt.Name()]; len(set) > 0 && !eventSelected(set, n) {
+			slog.Debug("notificação filtrada para o canal (CHANNEL_EVENTS)", "channel", nt.Name(), "type", n.Type)
+			countChannelDelivery(nt.Name(), "", n.Type, resultFiltered, nil)
+			continue
+		}
+		out = append(out, nt)
+	}
+	return out
+}
+
+// notifierTargets joins the targets of ns, for the dry-run log.
+func notifierTargets(ns []Notifier) string {
+	out := make([]string, len(ns))
+	for i, nt := range ns {
+		out[i] = nt.Targets()
+	}
+	return strings.Join(out, ", ")
+}
+
+// fanOut sends ev on every notifier concurrently and joins their errors.
+func fanOut(ctx context.Context, ns []Notifier, ev Event) error {
+	if len(ns) == 1 {
+		return ns[0].Send(ctx, ev)
+	}
+	errs := make([]error, len(ns))
+	var wg sync.WaitGroup
+	for i, nt := range ns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = nt.Send(ctx, ev)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Events an event list can name besides the notification types.
+const (
+	eventDailySummary  = "daily_summary"
+	eventWeeklySummary = "weekly_summary"
+	eventConclusion    = "conclusion"
+)
+
+// eventNames are the values EMAIL_EVENTS and CHANNEL_EVENTS_* accept.
+func eventNames() []string {
+	return append([]string{eventDailySummary, eventWeeklySummary, eventConclusion}, notificationTypes...)
+}
+
+// isConclusion reports whether n announces a single incident's conclusion.
+func isConclusion(n Notification) bool {
+	return n.Type == notifyStatus && len(n.Incidents) == 1 && isConcludedStatus(getPropStr(n.Incidents[0].Properties, "status"))
+}
+
+// eventSelected reports whether an event list (EMAIL_EVENTS,
+// CHANNEL_EVENTS_*) names n: its type, its summary kind, or conclusion.
+func eventSelected(set map[string]struct{}, n Notification) bool {
+	if _, ok := set[n.Type]; ok {
+		return true
+	}
+	if _, ok := set[n.event]; ok && n.event != "" {
+		return true
+	}
+	_, ok := set[eventConclusion]
+	return ok && isConclusion(n)
+}
+
+// checkEventNames rejects names in an event list that are not eventNames.
+func checkEventNames(option string, set map[string]struct{}) error {
+	for e := range set {
+		if !slices.Contains(eventNames(), e) {
+			return fmt.Errorf("%s: evento desconhecido %q (válidos: %s)", option, e, strings.Join(eventNames(), ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"hash/fnv"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// notifyQueueSize bounds the notifications waiting across all workers; when
+// it is full the poll blocks until a slot frees up or the pool is drained.
+const notifyQueueSize = 96
+
+type notifyJob struct {
+	url, topic string
+	n          Notification
+	titles     []string // messages folded into a backlog message
+}
+
+// notifyPool delivers the notifications of a cycle in the background with
+// NOTIFY_CONCURRENCY workers. Each worker owns one lane and jobs are put in
+// a lane by incident, so the messages for one incident go out in the order
+// they were queued (new before status before means) while different
+// incidents are sent in parallel.
+type notifyPool struct {
+	lanes []chan notifyJob
+	wg    sync.WaitGroup
+
+	// mu guards closed; sending counts the enqueues past that check, which
+	// drain waits for before it closes the lanes. stop ends a blocked one.
+	mu      sync.Mutex
+	closed  bool
+	sending sync.WaitGroup
+	stop    chan struct{}
+}
+
+// notifications is nil when NOTIFY_CONCURRENCY is 0 or for single-shot
+// runs; dispatch then sends synchronously.
+var notifications *notifyPool
+
+func startNotifyPool(workers int) *notifyPool {
+	p := &notifyPool{lanes: make([]chan notifyJob, workers), stop: make(chan struct{})}
+	for i := range p.lanes {
+		lane := make(chan notifyJob, max(1, notifyQueueSize/workers))
+		p.lanes[i] = lane
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for j := range lane {
+				_ = postNtfyExt(j.url, j.topic, j.n)
+			}
+		}()
+	}
+	return p
+}
+
+// notifyKey picks the lane key: the incident, or "" for messages that are
+// not about a single incident (summaries, aggregated new incidents), which
+// share one lane and keep their relative order.
+func notifyKey(n Notification) string {
+	if n.IncidentID != "" {
+		return n.IncidentID
+	}
+	if ids := n.incidentIDs(); len(ids) == 1 {
+		return ids[0]
+	}
+	return ""
+}
+
+// incidentIDs returns the tracked ID of each of n.Incidents, in order: the
+// alias-resolved IDs runOnce put on the message, or the feed's own ID for a
+// message built without them.
+func (n Notification) incidentIDs() []string {
+	if n.IncidentID == "" && len(n.IncidentIDs) == len(n.Incidents) {
+		return n.IncidentIDs
+	}
+	ids := make([]string, len(n.Incidents))
+	for i, f := range n.Incidents {
+		ids[i] = n.IncidentID
+		if ids[i] == "" {
+			ids[i] = getID(f.Properties)
+		}
+	}
+	return ids
+}
+
+// enqueue puts j in its lane, waiting while the lane is full. After drain,
+// or when drain starts while it waits, the job is dropped.
+func (p *notifyPool) enqueue(j notifyJob) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		slog.Warn("a terminar; notificação descartada", "type", j.n.Type, "title", j.n.Title)
+		return
+	}
+	p.sending.Add(1)
+	p.mu.Unlock()
+	defer p.sending.Done()
+
+	h := fnv.New32a()
+	h.Write([]byte(notifyKey(j.n)))
+	lane := p.lanes[h.Sum32()%uint32(len(p.lanes))]
+	select {
+	case lane <- j:
+		return
+	default:
+	}
+	slog.Warn("fila de notificações cheia; à espera", "type", j.n.Type)
+	select {
+	case lane <- j:
+	case <-p.stop:
+		slog.Warn("a terminar; notificação descartada", "type", j.n.Type, "title", j.n.Title)
+	}
+}
+
+// drain stops accepting jobs and waits up to timeout for the queued ones to
+// be sent. It reports whether the queue emptied in time. Calls after the
+// first only wait.
+func (p *notifyPool) drain(timeout time.Duration) bool {
+	p.mu.Lock()
+	first := !p.closed
+	p.closed = true
+	p.mu.Unlock()
+	if first {
+		close(p.stop)
+		p.sending.Wait()
+		for _, lane := range p.lanes {
+			close(lane)
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// dispatch sends n through the pool when there is one, otherwise right away.
+func dispatch(ntfyURL, topic string, n Notification) {
+	if notifications == nil {
+		_ = postNtfyExt(ntfyURL, topic, n)
+		return
+	}
+	notifications.enqueue(notifyJob{url: ntfyURL, topic: topic, n: n})
+}
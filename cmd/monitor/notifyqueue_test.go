@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// flipped is an incident tracked as 2025050001 that the feed now sends
+// under globalId only.
+var flipped = Feature{Properties: map[string]any{"globalId": "G-77", "concelho": "Sertã", "natureza": "Mato"}}
+
+func TestNotifyKeyUsesTrackedID(t *testing.T) {
+	other := Feature{Properties: map[string]any{"id": "2025050002"}}
+	for _, c := range []struct {
+		name string
+		n    Notification
+		want string
+	}{
+		{"per-incident", Notification{IncidentID: "2025050001", Incidents: []Feature{flipped}}, "2025050001"},
+		{"grouped one", Notification{Incidents: []Feature{flipped}, IncidentIDs: []string{"2025050001"}}, "2025050001"},
+		{"grouped many", Notification{Incidents: []Feature{flipped, other}, IncidentIDs: []string{"2025050001", "2025050002"}}, ""},
+		{"no tracked IDs", Notification{Incidents: []Feature{other}}, "2025050002"},
+		{"summary", Notification{}, ""},
+	} {
+		if got := notifyKey(c.n); got != c.want {
+			t.Errorf("%s: notifyKey = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestQuietDigestUsesTrackedID(t *testing.T) {
+	d := &quietDigest{}
+	d.add("2025-08-14T23", Notification{Type: notifyStatus, Title: "Despacho → Em Curso", IncidentID: "2025050001", Incidents: []Feature{flipped}})
+	d.add("2025-08-14T23", Notification{Type: notifyNew, Incidents: []Feature{flipped}, IncidentIDs: []string{"2025050001"}})
+	_, evs := d.take()
+	var ids []string
+	for _, ev := range evs {
+		ids = append(ids, ev.ID)
+	}
+	if want := []string{"2025050001", "2025050001"}; !slices.Equal(ids, want) {
+		t.Errorf("digest IDs = %q, want %q", ids, want)
+	}
+	if evs[1].Title != "Sertã: Mato" {
+		t.Errorf("grouped entry title = %q", evs[1].Title)
+	}
+}
+
+func TestBacklogKeepsTrackedIDs(t *testing.T) {
+	l := &rateLimiter{queue: []notifyJob{
+		{n: Notification{Type: notifyStatus, Title: "a", IncidentID: "2025050001", Incidents: []Feature{flipped}}},
+		{n: Notification{Type: notifyNew, Title: "b", Incidents: []Feature{flipped}, IncidentIDs: []string{"2025050003"}}},
+	}}
+	l.collapseLocked()
+	if got := l.queue[0].n.incidentIDs(); !slices.Equal(got, []string{"2025050001", "2025050003"}) {
+		t.Errorf("backlog IDs = %q", got)
+	}
+}
+
+func TestNotifyPoolEnqueueAfterDrain(t *testing.T) {
+	cfg, srv, _, _ := newTestMonitor(t, nil)
+	p := startNotifyPool(2)
+	p.enqueue(notifyJob{url: cfg.NtfyURL, topic: cfg.NtfyTopic, n: Notification{Type: notifyNew, Title: "antes", IncidentID: "1"}})
+	if !p.drain(5 * time.Second) {
+		t.Fatal("drain timed out")
+	}
+	// a cycle still running when shutdown gave up on it
+	p.enqueue(notifyJob{url: cfg.NtfyURL, topic: cfg.NtfyTopic, n: Notification{Type: notifyNew, Title: "depois", IncidentID: "1"}})
+	if !p.drain(time.Second) {
+		t.Error("second drain timed out")
+	}
+	if got := titles(srv.take()); !slices.Equal(got, []string{"antes"}) {
+		t.Errorf("sent %q, want only the message queued before drain", got)
+	}
+}
+
+func TestNotifyPoolDrainEndsBlockedEnqueue(t *testing.T) {
+	cfg, srv, _, _ := newTestMonitor(t, nil)
+	release := make(chan struct{})
+	inner := srv.Config.Handler
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		inner.ServeHTTP(w, r)
+	})
+
+	p := startNotifyPool(1)
+	// let the worker finish before the test ends, so it does not outlive it
+	t.Cleanup(func() {
+		close(release)
+		p.drain(5 * time.Second)
+	})
+	job := notifyJob{url: cfg.NtfyURL, topic: cfg.NtfyTopic, n: Notification{Type: notifyMeans, IncidentID: "1"}}
+	// one in the stuck worker, a full lane, and one more that has to wait
+	for range notifyQueueSize + 1 {
+		p.enqueue(job)
+	}
+	returned := make(chan struct{})
+	go func() {
+		p.enqueue(job)
+		close(returned)
+	}()
+	if p.drain(50 * time.Millisecond) {
+		t.Error("drain reported an empty queue with the worker stuck")
+	}
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("enqueue still blocked after drain")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import "strings"
+
+// With NTFY_REPLACE every message about one incident is published under the
+// same ntfy sequence ID, so the phone updates that incident's notification
+// instead of stacking a new one. Servers older than ntfy 2.14 ignore the ID
+// and keep stacking, as without the option. The conclusion goes out without
+// an ID: it stays next to the last update instead of replacing it.
+
+// ntfySequenceID is the sequence ID for n, or "" when n should not replace
+// anything: NTFY_REPLACE off, a message not about a single incident, or the
+// incident's conclusion.
+func ntfySequenceID(cfg *Config, n Notification) string {
+	if !cfg.NtfyReplace || n.IncidentID == "" || len(n.Incidents) > 1 {
+		return ""
+	}
+	if isConclusion(n) {
+		return ""
+	}
+	// ntfy accepts 1-64 characters from [-_A-Za-z0-9]
+	id := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, n.IncidentID)
+	id = "fogo-" + id
+	if len(id) > 64 {
+		id = id[:64]
+	}
+	return id
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ntfyServer is one ntfy base URL messages are published to, with its
+// access token if it needs one.
+type ntfyServer struct {
+	URL   string
+	Token string
+}
+
+// label names the server in logs and metrics: its host, never the token.
+func (s ntfyServer) label() string {
+	if u, err := url.Parse(s.URL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return s.URL
+}
+
+// parseNtfyURLs reads NTFY_URLS: comma-separated base URLs, each optionally
+// followed by |token.
+func parseNtfyURLs(v string) ([]ntfyServer, error) {
+	var out []ntfyServer
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		base, token, _ := strings.Cut(item, "|")
+		base = strings.TrimSpace(base)
+		u, err := url.Parse(base)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("NTFY_URLS: URL inválido %q", base)
+		}
+		out = append(out, ntfyServer{URL: base, Token: strings.TrimSpace(token)})
+	}
+	return out, nil
+}
+
+// ntfyServersFor returns where a message meant for ntfyURL goes: every
+// NTFY_URLS server when ntfyURL is the configured one, otherwise just
+// ntfyURL (e.g. the old server, when a reload changes it).
+func ntfyServersFor(cfg *Config, ntfyURL string) []ntfyServer {
+	if ntfyURL == cfg.NtfyURL && len(cfg.ntfyServers) > 0 {
+		return cfg.ntfyServers
+	}
+	return []ntfyServer{{URL: ntfyURL}}
+}
+
+func ntfyServerLabels(servers []ntfyServer) string {
+	labels := make([]string, len(servers))
+	for i, s := range servers {
+		labels[i] = s.label()
+	}
+	return strings.Join(labels, ", ")
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// notifyPause suppresses ntfy posts while set; cycles keep updating state and
+// metrics. A zero until with active=true means "until resumed".
+type pauseState struct {
+	mu     sync.Mutex
+	active bool
+	until  time.Time
+}
+
+var notifyPause = &pauseState{}
+
+// pause suspends notifications for d, or until resume when d <= 0.
+func (p *pauseState) pause(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active = true
+	p.until = time.Time{}
+	if d > 0 {
+		p.until = conf().now().Add(d)
+	}
+}
+
+func (p *pauseState) resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active, p.until = false, time.Time{}
+}
+
+// status reports whether notifications are paused and, for timed pauses, until when.
+func (p *pauseState) status() (paused bool, until time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active && !p.until.IsZero() && conf().now().After(p.until) {
+		p.active, p.until = false, time.Time{}
+	}
+	return p.active, p.until
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sourceProciv is ANEPC's public occurrence map (prociv.gov.pt), served as an
+// ArcGIS FeatureServer query.
+const sourceProciv = "prociv"
+
+const procivURL = "https://prociv-agserver.geomai.mai.gov.pt/arcgis/rest/services/Ocorrencias_Base/FeatureServer/0/query?where=1%3D1&outFields=*&outSR=4326&f=json"
+
+// procivResponse is the ArcGIS JSON envelope; a failed query comes back as
+// HTTP 200 with an error object.
+type procivResponse struct {
+	Features []struct {
+		Attributes map[string]any `json:"attributes"`
+		Geometry   struct {
+			X any `json:"x"`
+			Y any `json:"y"`
+		} `json:"geometry"`
+	} `json:"features"`
+	Error *struct {
+		Code    any    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type procivParser struct{}
+
+func (procivParser) defaultURL() string { return procivURL }
+
+// parse maps the ANEPC attributes onto the fogos.pt property names. The
+// occurrence number is both id and sadoId, which is what fogos.pt calls it,
+// so the same incident from both sources merges into one.
+func (procivParser) parse(body []byte) ([]Feature, error) {
+	var doc procivResponse
+	if err := decodeJSON(body, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Error != nil {
+		return nil, fmt.Errorf("ArcGIS: %v %s", doc.Error.Code, doc.Error.Message)
+	}
+	out := make([]Feature, 0, len(doc.Features))
+	for _, f := range doc.Features {
+		a := make(map[string]any, len(f.Attributes))
+		for k, v := range f.Attributes {
+			a[strings.ToLower(k)] = v
+		}
+		num := getPropStr(a, "numero", "numeroocorrencia")
+		if num == "" {
+			continue
+		}
+		p := map[string]any{
+			"id":         num,
+			"sadoId":     num,
+			"natureza":   getPropStr(a, "natureza"),
+			"status":     getPropStr(a, "estadoocorrencia", "estado", "estadoagrupado"),
+			"concelho":   getPropStr(a, "concelho"),
+			"district":   getPropStr(a, "distrito"),
+			"freguesia":  getPropStr(a, "freguesia"),
+			"localidade": getPropStr(a, "localidade"),
+		}
+		if code := getPropStr(a, "codnatureza"); code != "" {
+			p["naturezaCode"] = code
+		}
+		if ms, ok := toFloat(a["datainicioocorrencia"]); ok && ms > 0 {
+			// ArcGIS dates are epoch milliseconds.
+			p["dateTime"] = time.UnixMilli(int64(ms)).In(conf().loc).Format(time.RFC3339)
+		}
+		sum := func(keys ...string) (float64, bool) {
+			var n float64
+			found := false
+			for _, k := range keys {
+				if v, ok := toFloat(a[k]); ok {
+					n, found = n+v, true
+				}
+			}
+			return n, found
+		}
+		if v, ok := sum("numerooperacionaisterrestresenvolvidos", "numerooperacionaisaereosenvolvidos"); ok {
+			p["man"] = v
+		}
+		if v, ok := sum("numeromeiosterrestresenvolvidos"); ok {
+			p["terrain"] = v
+		}
+		if v, ok := sum("numeromeiosaereosenvolvidos"); ok {
+			p["aerial"] = v
+		}
+		if v, ok := sum("numeromeiosaquaticosenvolvidos"); ok {
+			p["meios_aquaticos"] = v
+		}
+		lat, okLat := toFloat(a["latitude"])
+		lon, okLon := toFloat(a["longitude"])
+		if !okLat || !okLon {
+			lon, okLon = toFloat(f.Geometry.X)
+			lat, okLat = toFloat(f.Geometry.Y)
+		}
+		var geom map[string]any
+		if okLat && okLon && validLatLon(lat, lon) {
+			geom = pointGeometry(lat, lon)
+		}
+		out = append(out, Feature{Type: "Feature", Geometry: geom, Properties: p})
+	}
+	return out, nil
+}
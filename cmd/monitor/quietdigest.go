@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// digestEvent is one incident notification held back during quiet hours.
+type digestEvent struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Concelho  string `json:"concelho"`
+	Title     string `json:"title"`
+	Concluded bool   `json:"concluded,omitempty"`
+}
+
+// quietDigest buffers incident notifications while QUIET_DIGEST holds them
+// back and sends them as one message on the first poll after the window. It
+// is keyed by the start of the quiet window and persisted to its own file
+// next to STATE_FILE, so a restart during the night does not lose it.
+type quietDigest struct {
+	mu     sync.Mutex
+	path   string
+	loaded bool
+	Window string        `json:"window"` // window start, "2006-01-02T15" local; "" = nothing pending
+	Events []digestEvent `json:"events"`
+}
+
+var digest = &quietDigest{}
+
+// digestPath is <state file without .json>_quiet.json.
+func digestPath(statePath string) string {
+	return strings.TrimSuffix(statePath, ".json") + "_quiet.json"
+}
+
+// load reads the persisted buffer once; later calls are no-ops.
+func (d *quietDigest) load(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.loaded {
+		return
+	}
+	d.loaded, d.path = true, path
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(b, d); err != nil {
+		slog.Warn("ficheiro de resumo noturno inválido; ignorado", "path", path, "err", err)
+		d.Window, d.Events = "", nil
+	}
+}
+
+// saveLocked writes the buffer, removing the file when nothing is pending;
+// callers hold d.mu.
+func (d *quietDigest) saveLocked() {
+	if d.path == "" {
+		return
+	}
+	if d.Window == "" {
+		if err := os.Remove(d.path); err != nil && !os.IsNotExist(err) {
+			slog.Warn("falha ao remover resumo noturno", "path", d.path, "err", err)
+		}
+		return
+	}
+	b, _ := json.MarshalIndent(d, "", "  ")
+	if err := os.WriteFile(d.path, b, 0644); err != nil {
+		slog.Warn("falha ao gravar resumo noturno", "path", d.path, "err", err)
+	}
+}
+
+// quietWindowStart names the quiet window that contains now: its start hour
+// today, or yesterday when the window crossed midnight.
+func quietWindowStart(q quietWindow, now time.Time) string {
+	start := time.Date(now.Year(), now.Month(), now.Day(), q.startH, 0, 0, 0, now.Location())
+	if now.Hour() < q.startH {
+		start = start.AddDate(0, 0, -1)
+	}
+	return start.Format("2006-01-02T15")
+}
+
+// open marks the window as started, so a digest (or "Noite calma") is due
+// when it ends even if nothing was held back.
+func (d *quietDigest) open(window string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.Window == window {
+		return
+	}
+	if d.Window != "" {
+		// A window that was never flushed (monitor stopped through the
+		// morning): its events are still worth sending with the new one.
+		slog.Info("resumo noturno anterior por enviar; acumulado", "window", d.Window)
+	}
+	d.Window = window
+	d.saveLocked()
+}
+
+// add buffers n, one event per incident it carries.
+func (d *quietDigest) add(window string, n Notification) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Window = window
+	ids := n.incidentIDs()
+	for i, f := range n.Incidents {
+		ev := digestEvent{Type: n.Type, ID: ids[i], Concelho: getMunicipio(f.Properties), Title: n.Title}
+		if n.IncidentID == "" {
+			// aggregated "Novos incidentes": one line per incident
+			ev.Title = strings.TrimSpace(ev.Concelho + ": " + getPropStr(f.Properties, "natureza"))
+		}
+		if n.Type == notifyStatus {
+			ev.Concluded = strings.Contains(strings.ToLower(stripAccents(getPropStr(f.Properties, "status"))), "conclus")
+		}
+		d.Events = append(d.Events, ev)
+	}
+	d.saveLocked()
+}
+
+// take returns the pending window and events and clears the buffer.
+func (d *quietDigest) take() (string, []digestEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w, evs := d.Window, d.Events
+	if w == "" {
+		return "", nil
+	}
+	d.Window, d.Events = "", nil
+	d.saveLocked()
+	return w, evs
+}
+
+// deferToDigest reports whether n is an incident notification to hold back
+// for the end-of-quiet-hours digest, and buffers it if so.
+func deferToDigest(cfg *Config, n Notification) bool {
+	if !cfg.QuietDigest || !cfg.quiet.enabled || len(n.Incidents) == 0 || !inQuietHours(cfg) || quietExempt(cfg, n) {
+		return false
+	}
+	switch n.Type {
+	case notifyNew, notifyStatus, notifyMeans, notifyExtra, notifyRoad, notifyImportant, notifyBurned, notifyMoved:
+	default:
+		return false
+	}
+	digest.add(quietWindowStart(cfg.quiet, cfg.now().In(cfg.loc)), n)
+	return true
+}
+
+// quietDigestTick runs at the start of each poll: inside the window it opens
+// the buffer, after it sends what was held back and clears it.
+func quietDigestTick(cfg *Config) {
+	if !cfg.QuietDigest || !cfg.quiet.enabled {
+		return
+	}
+	digest.load(digestPath(cfg.statePath()))
+	if inQuietHours(cfg) {
+		digest.open(quietWindowStart(cfg.quiet, cfg.now().In(cfg.loc)))
+		return
+	}
+	window, evs := digest.take()
+	if window == "" {
+		return
+	}
+	if len(evs) == 0 {
+		if !cfg.QuietDigestAlways {
+			return
+		}
+		dispatch(cfg.NtfyURL, cfg.NtfyTopic, Notification{Type: notifySummary, Title: tr("digest.calm.title"), Body: tr("digest.calm.body", cfg.quiet.startH, cfg.quiet.endH), Tags: "crescent_moon", Priority: "2"})
+		return
+	}
+	title, body := buildQuietDigest(evs)
+	dispatch(cfg.NtfyURL, cfg.NtfyTopic, Notification{Type: notifySummary, Title: title, Body: body, Tags: "sunrise", Priority: "3"})
+}
+
+// quietDigestMaxLines caps the per-incident lines of the digest.
+const quietDigestMaxLines = 20
+
+// buildQuietDigest renders the held-back events: a lead line with the counts,
+// e.g. "Durante a noite: 2 novos incidentes (Sertã, Oleiros), 1 concluído",
+// then one line per incident with its latest title and fogos.pt link.
+//
+// An incident seen for the first time gets a status message along with its
+// "novo" one; the first status event of an ID announced as new in the window
+// is that one and is left out, so it is not counted as a transition too.
+func buildQuietDigest(evs []digestEvent) (title, body string) {
+	var nNew, nStatus, nDone, nUpd int
+	var newMunis []string
+	var order []string
+	latest := map[string]digestEvent{}
+	firstStatus := map[string]bool{} // IDs whose first-seen status is still to skip
+	for _, ev := range evs {
+		if ev.Type == notifyNew {
+			firstStatus[ev.ID] = true
+		}
+	}
+	for _, ev := range evs {
+		if ev.Type == notifyStatus && firstStatus[ev.ID] {
+			delete(firstStatus, ev.ID)
+			continue
+		}
+		switch {
+		case ev.Type == notifyNew:
+			nNew++
+			if ev.Concelho != "" && !slices.Contains(newMunis, ev.Concelho) {
+				newMunis = append(newMunis, ev.Concelho)
+			}
+		case ev.Concluded:
+			nDone++
+		case ev.Type == notifyStatus:
+			nStatus++
+		default:
+			nUpd++
+		}
+		if _, ok := latest[ev.ID]; !ok {
+			order = append(order, ev.ID)
+		}
+		latest[ev.ID] = ev
+	}
+	var parts []string
+	if nNew > 0 {
+		s := trn("digest.new", nNew)
+		if len(newMunis) > 0 {
+			s += " (" + strings.Join(newMunis, ", ") + ")"
+		}
+		parts = append(parts, s)
+	}
+	if nStatus > 0 {
+		parts = append(parts, trn("digest.status", nStatus))
+	}
+	if nDone > 0 {
+		parts = append(parts, trn("digest.done", nDone))
+	}
+	if nUpd > 0 {
+		parts = append(parts, trn("digest.updates", nUpd))
+	}
+	lines := []string{tr("digest.lead", strings.Join(parts, ", "))}
+	for i, id := range order {
+		if i == quietDigestMaxLines {
+			lines = append(lines, tr("digest.more", len(order)-i))
+			break
+		}
+		l := "• " + latest[id].Title
+		if id != "" {
+			l += " — https://fogos.pt/fogo/" + id
+		}
+		lines = append(lines, l)
+	}
+	return tr("digest.title"), strings.Join(lines, "\n")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestQuietExemptWithDigest runs cycles inside QUIET_HOURS with QUIET_DIGEST:
+// incidents within QUIET_EXEMPT_KM go out at once with their priority and the
+// warning tag, the others wait for the digest after the window.
+func TestQuietExemptWithDigest(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		lat      float64 // the test center is 39.81, -8.09
+		coords   bool
+		noCoords string
+		exempt   bool
+	}{
+		{"inside the radius", 39.8, true, "0", true},
+		{"outside the radius", 40.2, true, "0", false},
+		{"no coordinates, policy off", 0, false, "0", false},
+		{"no coordinates, policy on", 0, false, "1", true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			digest = &quietDigest{}
+			t.Cleanup(func() { digest = &quietDigest{} })
+			// 16:20 in Lisbon on the test clock
+			cfg, srv, clk, ms := newTestMonitor(t, map[string]string{
+				"QUIET_HOURS":            "16-17",
+				"QUIET_DIGEST":           "1",
+				"QUIET_EXEMPT_KM":        "5",
+				"QUIET_EXEMPT_NO_COORDS": c.noCoords,
+			})
+			f := incident("2025050001", "Em Curso", 20)
+			f["lat"] = c.lat
+			if !c.coords {
+				delete(f, "lat")
+				delete(f, "lng")
+			}
+			srv.setFeed(f)
+			mustRun(t, cfg, ms)
+			msgs := srv.take()
+			if !c.exempt {
+				if len(msgs) != 0 {
+					t.Fatalf("sent during quiet hours: %q", titles(msgs))
+				}
+				// after the window, it is in the digest
+				clk.advance(time.Hour)
+				mustRun(t, cfg, ms)
+				msgs = srv.take()
+				if len(msgs) != 1 || msgs[0].Title != tr("digest.title") || !strings.Contains(msgs[0].Message, "fogos.pt/fogo/2025050001") {
+					t.Errorf("after the window: %q", titles(msgs))
+				}
+				return
+			}
+			if len(msgs) != 2 {
+				t.Fatalf("got %q, want the new incident and its status", titles(msgs))
+			}
+			for _, m := range msgs {
+				if !m.hasTag("warning") || m.hasTag("zzz") {
+					t.Errorf("%q: tags %q", m.Title, m.Tags)
+				}
+			}
+			if msgs[0].Priority != 5 {
+				t.Errorf("new incident at priority %d, want 5", msgs[0].Priority)
+			}
+
+			// nothing was held back, so the end of the window sends nothing
+			clk.advance(time.Hour)
+			mustRun(t, cfg, ms)
+			for _, m := range srv.take() {
+				if strings.HasPrefix(m.Title, tr("digest.title")) {
+					t.Errorf("digest after an exempt incident: %q\n%s", m.Title, m.Message)
+				}
+			}
+		})
+	}
+}
+
+// TestQuietDigestFirstSeenStatus: a new incident comes with a status message
+// for its first status; the digest counts it as new only. A later change in
+// the same window is still a transition.
+func TestQuietDigestFirstSeenStatus(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		later string // status at a second poll inside the window, "" = none
+		lead  string
+	}{
+		{"new only", "", "Durante a noite: 1 novo incidente (Sertã)"},
+		{"new then a change", "Em Resolução", "Durante a noite: 1 novo incidente (Sertã), 1 transição de estado"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			digest = &quietDigest{}
+			t.Cleanup(func() { digest = &quietDigest{} })
+			cfg, srv, clk, ms := newTestMonitor(t, map[string]string{"QUIET_HOURS": "16-17", "QUIET_DIGEST": "1"})
+			srv.setFeed(incident("2025050001", "Em Curso", 20))
+			mustRun(t, cfg, ms)
+			if c.later != "" {
+				clk.advance(10 * time.Minute)
+				srv.setFeed(incident("2025050001", c.later, 20))
+				mustRun(t, cfg, ms)
+			}
+			if msgs := srv.take(); len(msgs) != 0 {
+				t.Fatalf("sent during quiet hours: %q", titles(msgs))
+			}
+
+			clk.set(testStart.Add(time.Hour))
+			mustRun(t, cfg, ms)
+			msgs := srv.take()
+			if len(msgs) != 1 || msgs[0].Title != tr("digest.title") {
+				t.Fatalf("after the window: %q", titles(msgs))
+			}
+			lines := strings.Split(msgs[0].Message, "\n")
+			if lines[0] != c.lead {
+				t.Errorf("lead %q, want %q", lines[0], c.lead)
+			}
+			if len(lines) != 2 {
+				t.Errorf("want one line per incident:\n%s", msgs[0].Message)
+			}
+		})
+	}
+}
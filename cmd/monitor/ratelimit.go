@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// retryAfterDefault is the pause after a 429 without a usable Retry-After.
+const retryAfterDefault = time.Minute
+
+// backlogTitlesMax bounds the titles listed in a collapsed backlog message.
+const backlogTitlesMax = 20
+
+// rateLimiter is a token bucket in front of every ntfy post. Messages that
+// find the bucket empty, or a queue already waiting, are queued in order and
+// sent by one goroutine as tokens come back. NTFY_RATE_PER_MINUTE and
+// NTFY_RATE_BURST are read on each refill, so a reload applies at once.
+type rateLimiter struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	until  time.Time // paused by a 429 Retry-After
+	queue  []notifyJob
+	wake   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// ntfyRate is nil for single-shot runs; ntfyNotifier then sends right away.
+var ntfyRate *rateLimiter
+
+func startRateLimiter() *rateLimiter {
+	l := &rateLimiter{
+		tokens: float64(conf().NtfyRateBurst),
+		last:   conf().now(),
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go l.loop()
+	return l
+}
+
+// refill adds the tokens earned since the last call. Without a rate the
+// bucket is always full and only a Retry-After pause holds messages back.
+func (l *rateLimiter) refill(now time.Time) (perToken time.Duration, burst float64) {
+	cfg := conf()
+	burst = float64(max(1, cfg.NtfyRateBurst))
+	if cfg.NtfyRatePerMinute <= 0 {
+		l.tokens, l.last = burst, now
+		return 0, burst
+	}
+	perToken = time.Minute / time.Duration(cfg.NtfyRatePerMinute)
+	l.tokens = min(burst, l.tokens+float64(now.Sub(l.last))/float64(perToken))
+	l.last = now
+	return perToken, burst
+}
+
+// allow takes a token for j and reports whether it may be sent now. When it
+// may not, j is queued behind the messages already waiting.
+func (l *rateLimiter) allow(j notifyJob) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := conf().now()
+	l.refill(now)
+	if len(l.queue) == 0 && !now.Before(l.until) && l.tokens >= 1 {
+		l.tokens--
+		return true
+	}
+	l.pushLocked(j)
+	return false
+}
+
+// retryLater puts j back at the head of the queue and pauses the bucket,
+// after ntfy answered 429.
+func (l *rateLimiter) retryLater(j notifyJob, wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.until = conf().now().Add(wait)
+	l.tokens = 0
+	j.n.rateQueued = true
+	l.queue = append([]notifyJob{j}, l.queue...)
+	ntfyQueueLength.Set(float64(len(l.queue)))
+	l.signal()
+}
+
+func (l *rateLimiter) pushLocked(j notifyJob) {
+	j.n.rateQueued = true
+	l.queue = append(l.queue, j)
+	if limit := conf().NtfyBacklogCollapse; limit > 0 && len(l.queue) > limit {
+		l.collapseLocked()
+	}
+	ntfyQueueLength.Set(float64(len(l.queue)))
+	l.signal()
+}
+
+func (l *rateLimiter) signal() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// collapseLocked replaces the queue with one message listing the titles of
+// everything waiting, at the highest priority among them.
+// It goes to every ntfy server of the head's URL, and to ntfy only.
+func (l *rateLimiter) collapseLocked() {
+	if len(l.queue) < 2 {
+		return
+	}
+	var titles []string
+	var incidents []Feature
+	var ids []string
+	prio := 0
+	for _, j := range l.queue {
+		if j.n.Type == notifyBacklog {
+			titles = append(titles, j.titles...)
+		} else {
+			titles = append(titles, j.n.Title)
+			countNotification(j.n.Type, resultCollapsed, nil)
+		}
+		incidents = append(incidents, j.n.Incidents...)
+		ids = append(ids, j.n.incidentIDs()...)
+		if p, err := strconv.Atoi(strings.TrimSpace(j.n.Priority)); err == nil {
+			prio = max(prio, p)
+		}
+	}
+	slog.Warn("demasiadas notificações em espera; agrupadas numa só", "count", len(titles))
+	lines := titles
+	if len(lines) > backlogTitlesMax {
+		lines = append(lines[:backlogTitlesMax:backlogTitlesMax], tr("backlog.more", len(titles)-backlogTitlesMax))
+	}
+	head := l.queue[0]
+	n := Notification{
+		Type:        notifyBacklog,
+		Title:       trn("backlog.title", len(titles)),
+		Body:        strings.Join(lines, "\n"),
+		Tags:        "hourglass",
+		Priority:    strconv.Itoa(max(3, prio)),
+		Incidents:   incidents,
+		IncidentIDs: ids,
+		rateQueued:  true,
+		servers:     ntfyServersFor(conf(), head.url),
+	}
+	l.queue = []notifyJob{{url: head.url, topic: head.topic, n: n, titles: titles}}
+}
+
+// next pops the head of the queue when a token is available, or returns how
+// long to wait for one.
+func (l *rateLimiter) next(now time.Time) (j notifyJob, wait time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	perToken, _ := l.refill(now)
+	switch {
+	case len(l.queue) == 0:
+		return j, time.Hour, false
+	case now.Before(l.until):
+		return j, l.until.Sub(now), false
+	case l.tokens < 1:
+		return j, time.Duration((1 - l.tokens) * float64(perToken)), false
+	}
+	l.tokens--
+	j, l.queue = l.queue[0], l.queue[1:]
+	ntfyQueueLength.Set(float64(len(l.queue)))
+	return j, 0, true
+}
+
+func (l *rateLimiter) loop() {
+	defer close(l.done)
+	stop, stopping := l.stop, false
+	for {
+		j, wait, ok := l.next(conf().now())
+		if ok {
+			_ = postNtfyExt(j.url, j.topic, j.n)
+			continue
+		}
+		if stopping {
+			l.mu.Lock()
+			empty := len(l.queue) == 0
+			l.mu.Unlock()
+			if empty {
+				return
+			}
+		}
+		t := time.NewTimer(max(wait, 10*time.Millisecond))
+		select {
+		case <-l.wake:
+		case <-t.C:
+		case <-stop:
+			// Send what is left as a single message rather than at the rate.
+			l.mu.Lock()
+			l.collapseLocked()
+			l.mu.Unlock()
+			stopping, stop = true, nil
+		}
+		t.Stop()
+	}
+}
+
+// drain collapses what is still queued and waits up to timeout for it to be
+// sent. It reports whether the queue emptied in time. Call it after the
+// notification workers have drained, so nothing is added meanwhile.
+func (l *rateLimiter) drain(timeout time.Duration) bool {
+	close(l.stop)
+	select {
+	case <-l.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// retryAfterError is a 429 from ntfy with the pause it asked for.
+type retryAfterError struct {
+	wait time.Duration
+	msg  string
+}
+
+func (e *retryAfterError) Error() string {
+	return fmt.Sprintf("ntfy HTTP 429 (retry after %s): %s", e.wait, e.msg)
+}
+
+// parseRetryAfter reads Retry-After as seconds or an HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if s, err := strconv.Atoi(v); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return retryAfterDefault
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRateLimitNtfyOnly: NTFY_RATE_PER_MINUTE queues what ntfy cannot take
+// yet, while Gotify gets every message at once and nothing twice.
+func TestRateLimitNtfyOnly(t *testing.T) {
+	var mu sync.Mutex
+	var gotify []string
+	gsrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		var p struct{ Title string }
+		_ = json.Unmarshal(b, &p)
+		mu.Lock()
+		defer mu.Unlock()
+		gotify = append(gotify, p.Title)
+	}))
+	t.Cleanup(gsrv.Close)
+	gotifyTitles := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		out := gotify
+		gotify = nil
+		return out
+	}
+
+	cfg, srv, clk, _ := newTestMonitor(t, map[string]string{
+		"NTFY_RATE_PER_MINUTE": "1",
+		"NTFY_RATE_BURST":      "1",
+		"GOTIFY_URL":           gsrv.URL,
+		"GOTIFY_TOKEN":         "segredo",
+	})
+	ntfyRate = startRateLimiter()
+	t.Cleanup(func() { ntfyRate = nil })
+
+	sent := []string{"Novo em Sertã — 1", "Novo em Sertã — 2", "Novo em Sertã — 3"}
+	for _, title := range sent {
+		if err := postNtfyExt(cfg.NtfyURL, cfg.NtfyTopic, Notification{Type: notifyNew, Title: title, Body: title}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := gotifyTitles(); !slices.Equal(got, sent) {
+		t.Errorf("gotify = %q, want %q", got, sent)
+	}
+	if got := titles(srv.take()); !slices.Equal(got, sent[:1]) {
+		t.Errorf("ntfy = %q, want %q", got, sent[:1])
+	}
+
+	// What is still queued goes out as one backlog message, to ntfy only.
+	clk.advance(time.Minute)
+	if !ntfyRate.drain(5 * time.Second) {
+		t.Fatal("rate limiter did not drain")
+	}
+	if want := []string{trn("backlog.title", 2)}; !slices.Equal(titles(srv.take()), want) {
+		t.Errorf("ntfy after drain, want %q", want)
+	}
+	if got := gotifyTitles(); len(got) != 0 {
+		t.Errorf("gotify got the queued messages again: %q", got)
+	}
+}
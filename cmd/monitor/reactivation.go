@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// activeSpans follows an incident that concluded and came back, so the time
+// to conclusion only counts the time it was active and not the quiet gap.
+type activeSpans struct {
+	Reactivations int        `json:"reactivations,omitempty"`
+	Since         *time.Time `json:"since,omitempty"`    // start of the span after the last reactivation
+	ActiveSec     int64      `json:"active_s,omitempty"` // active time up to the last conclusion
+}
+
+// reactivate records id going back to Despacho/Em Curso from Conclusão or
+// Vigilância. After a conclusion it also clears the conclusion time and
+// starts a new active span.
+func (ms *MonitorState) reactivate(id, prev string, p map[string]any, now time.Time) {
+	sp := ms.spans[id]
+	sp.Reactivations++
+	if isConcludedStatus(prev) {
+		at := now
+		if t, ok := feedTime(p["updated"]); ok && !t.After(now) {
+			at = t
+		}
+		sp.Since = &at
+		delete(ms.concludedAt, id)
+		if h, ok := ms.history[id]; ok {
+			h.Concluded = time.Time{}
+			ms.history[id] = h
+		}
+	}
+	ms.spans[id] = sp
+	reactivationsTotal.Inc()
+	slog.Debug("ocorrência reativada", "incident_id", id, "count", sp.Reactivations, "since", sp.Since)
+}
+
+// reactivationTitle prefixes a status title with "Reativado", and the
+// count n of reactivations from the second time on.
+func reactivationTitle(n int, title string) string {
+	if n > 1 {
+		return tr("status.reactive.n", n, title)
+	}
+	return tr("status.reactive", title)
+}
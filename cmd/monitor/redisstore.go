@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	stateBackendFile  = "file"
+	stateBackendRedis = "redis"
+
+	// redisSectionsField lists, in <prefix>:meta, the sections kept as hashes.
+	redisSectionsField = "_sections"
+	redisTimeout       = 10 * time.Second
+)
+
+// redisStore keeps the state in Redis so replicas share it. Every section of
+// the state document that is a map (status, first, means, seen...) is a hash
+// <prefix>:<section> with one field per ID or municipality holding its JSON
+// value; the scalar sections go in <prefix>:meta. <prefix>:version goes up
+// with every save and is the stamp.
+type redisStore struct {
+	client *redis.Client
+	prefix string
+	label  string // URL without the password
+	owner  string // value of the replica lock
+}
+
+// stateLocker is a store shared by replicas: only the holder of its lock runs
+// cycles and sends notifications.
+type stateLocker interface {
+	// acquire takes the lock, or renews it if this process holds it, for ttl.
+	acquire(ttl time.Duration) (bool, error)
+	release()
+}
+
+var redisStores = struct {
+	sync.Mutex
+	m map[string]*redisStore
+}{m: map[string]*redisStore{}}
+
+// redisStoreFor returns the store for url and prefix, sharing one client per
+// pair across reloads. url was checked by finalize.
+func redisStoreFor(url, prefix string) *redisStore {
+	redisStores.Lock()
+	defer redisStores.Unlock()
+	k := url + "\x00" + prefix
+	if s, ok := redisStores.m[k]; ok {
+		return s
+	}
+	opt, err := redis.ParseURL(url)
+	if err != nil {
+		opt = &redis.Options{Addr: url}
+	}
+	host, _ := os.Hostname()
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	s := &redisStore{
+		client: redis.NewClient(opt),
+		prefix: prefix,
+		label:  fmt.Sprintf("redis://%s/%d %s", opt.Addr, opt.DB, prefix),
+		owner:  fmt.Sprintf("%s:%d:%s", host, os.Getpid(), hex.EncodeToString(b[:])),
+	}
+	redisStores.m[k] = s
+	return s
+}
+
+func (s *redisStore) key(name string) string { return s.prefix + ":" + name }
+
+func (s *redisStore) String() string { return s.label }
+
+func (s *redisStore) Load(ms *MonitorState) (perMuniState, perMuniSeen, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	meta, err := s.client.HGetAll(ctx, s.key("meta")).Result()
+	if err != nil {
+		return perMuniState{}, perMuniSeen{}, err
+	}
+	if len(meta) == 0 {
+		return perMuniState{}, perMuniSeen{}, fmt.Errorf("%s: %w", s, os.ErrNotExist)
+	}
+	var sections []string
+	_ = json.Unmarshal([]byte(meta[redisSectionsField]), &sections)
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(sections))
+	for i, name := range sections {
+		cmds[i] = pipe.HGetAll(ctx, s.key(name))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return perMuniState{}, perMuniSeen{}, err
+	}
+	doc := map[string]json.RawMessage{}
+	for k, v := range meta {
+		if k != redisSectionsField && json.Valid([]byte(v)) {
+			doc[k] = json.RawMessage(v)
+		}
+	}
+	for i, name := range sections {
+		fields := map[string]json.RawMessage{}
+		for f, v := range cmds[i].Val() {
+			if json.Valid([]byte(v)) {
+				fields[f] = json.RawMessage(v)
+			}
+		}
+		doc[name], _ = json.Marshal(fields)
+	}
+	// the same decoding as STATE_FILE
+	b, _ := json.Marshal(doc)
+	var raw map[string]any
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return perMuniState{}, perMuniSeen{}, err
+	}
+	st, seen := decodeState(ms, raw)
+	return st, seen, nil
+}
+
+// Save replaces the stored state in one MULTI/EXEC, so a replica never reads
+// half of it.
+func (s *redisStore) Save(ms *MonitorState, st perMuniState, seen perMuniSeen) error {
+	b, err := json.Marshal(encodeState(ms, st, seen))
+	if err != nil {
+		return err
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	meta := map[string]any{}
+	hashes := map[string]map[string]any{}
+	for name, v := range doc {
+		var obj map[string]json.RawMessage
+		if len(v) > 0 && v[0] == '{' && json.Unmarshal(v, &obj) == nil {
+			fields := make(map[string]any, len(obj))
+			for f, fv := range obj {
+				fields[f] = string(fv)
+			}
+			hashes[name] = fields
+			continue
+		}
+		meta[name] = string(v)
+	}
+	names := slices.Sorted(maps.Keys(hashes))
+	list, _ := json.Marshal(names)
+	meta[redisSectionsField] = string(list)
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	_, err = s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Del(ctx, s.key("meta"))
+		p.HSet(ctx, s.key("meta"), meta)
+		for _, name := range names {
+			p.Del(ctx, s.key(name))
+			if len(hashes[name]) > 0 {
+				p.HSet(ctx, s.key(name), hashes[name])
+			}
+		}
+		p.Incr(ctx, s.key("version"))
+		return nil
+	})
+	return err
+}
+
+func (s *redisStore) Stamp() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	v, err := s.client.Get(ctx, s.key("version")).Result()
+	if errors.Is(err, redis.Nil) {
+		return "0", nil
+	}
+	return v, err
+}
+
+// check pings the server and says which replica holds the lock.
+func (s *redisStore) check() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		return "", fmt.Errorf("%s: %w", s, err)
+	}
+	owner, err := s.client.Get(ctx, s.key("lock")).Result()
+	switch {
+	case errors.Is(err, redis.Nil):
+		return s.String() + "; bloqueio livre", nil
+	case err != nil:
+		return "", err
+	}
+	return fmt.Sprintf("%s; bloqueio de %s", s, owner), nil
+}
+
+// Renewing and releasing check the owner first, so a replica whose lock
+// expired cannot extend or drop the new holder's.
+var (
+	renewLockScript   = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) end return 0`)
+	releaseLockScript = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+)
+
+func (s *redisStore) acquire(ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	ok, err := s.client.SetNX(ctx, s.key("lock"), s.owner, ttl).Result()
+	if err != nil || ok {
+		return ok, err
+	}
+	n, err := renewLockScript.Run(ctx, s.client, []string{s.key("lock")}, s.owner, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+func (s *redisStore) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if n, err := releaseLockScript.Run(ctx, s.client, []string{s.key("lock")}, s.owner).Int(); err != nil {
+		slog.Warn("erro a libertar o bloqueio de réplica", "store", s.String(), "err", err)
+	} else if n == 1 {
+		replicaLock.held.Store(false)
+		stateLockHeld.Set(0)
+	}
+}
+
+// replicaLock is this process's view of the lock of a shared store.
+var replicaLock struct {
+	held    atomic.Bool
+	standby atomic.Bool // already logged as standby
+}
+
+// replicaLockTTL is REDIS_LOCK_TTL_SECONDS or, by default, three polls (at
+// least 30s): the holder renews it every poll, and a replica takes over
+// within that time when the holder stops.
+func replicaLockTTL(cfg *Config) time.Duration {
+	if cfg.RedisLockTTLSeconds > 0 {
+		return time.Duration(cfg.RedisLockTTLSeconds) * time.Second
+	}
+	return max(3*cfg.PollInterval, 30*time.Second)
+}
+
+// holdReplicaLock takes or renews the lock of a shared store before a cycle.
+// Without it the cycle is skipped: the replica only refreshes its in-memory
+// state, so it can take over from the latest one.
+func holdReplicaLock(cfg *Config, ms *MonitorState) (bool, error) {
+	store := cfg.stateStore()
+	lk, ok := store.(stateLocker)
+	if !ok {
+		return true, nil
+	}
+	held, err := lk.acquire(replicaLockTTL(cfg))
+	was := replicaLock.held.Swap(held)
+	if held {
+		stateLockHeld.Set(1)
+	} else {
+		stateLockHeld.Set(0)
+	}
+	if err != nil {
+		return false, fmt.Errorf("bloqueio de réplica (%s): %w", store, err)
+	}
+	if held {
+		replicaLock.standby.Store(false)
+		if !was {
+			slog.Info("bloqueio de réplica obtido; esta instância envia as notificações", "store", store.String())
+		}
+		return true, nil
+	}
+	if !replicaLock.standby.Swap(true) {
+		slog.Info("outra réplica tem o bloqueio; em espera", "store", store.String(), "ttl", replicaLockTTL(cfg).String())
+	}
+	unlock := ms.lock()
+	defer unlock()
+	if st, seen, err := ms.loadForCycle(store); err == nil {
+		ms.cycleState, ms.cycleSeen = st, seen
+	}
+	return false, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newRedisMonitor is newTestMonitor with STATE_BACKEND=redis on a miniredis
+// server.
+func newRedisMonitor(t *testing.T) (*Config, *testServer, *testClock, *MonitorState, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	cfg, srv, clk, ms := newTestMonitor(t, map[string]string{
+		"STATE_BACKEND":          "redis",
+		"REDIS_URL":              "redis://" + mr.Addr(),
+		"REDIS_LOCK_TTL_SECONDS": "30",
+	})
+	replicaLock.held.Store(false)
+	replicaLock.standby.Store(false)
+	t.Cleanup(func() { replicaLock.held.Store(false) })
+	return cfg, srv, clk, ms, mr
+}
+
+// otherReplica is a second process on the same Redis: same keys, another
+// lock owner.
+func otherReplica(cfg *Config) *redisStore {
+	s := *cfg.stateStore().(*redisStore)
+	s.owner = "outra-replica"
+	return &s
+}
+
+func TestRedisStoreRoundTrip(t *testing.T) {
+	cfg, _, _, _, _ := newRedisMonitor(t)
+	store := cfg.stateStore()
+	ms := NewMonitorState()
+	ms.status["2025050001"] = "Em Curso"
+	ms.firstSeen["2025050001"] = testStart
+	ms.lastHourlyMark = "2025-08-14 16"
+	st := perMuniState{"Sertã": {"2025050001": {}}}
+	seen := perMuniSeen{"Sertã": {"2025050001": testStart}}
+
+	before, _ := store.Stamp()
+	if err := store.Save(ms, st, seen); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := store.Stamp(); after == before {
+		t.Errorf("stamp %q unchanged by Save", after)
+	}
+	got := NewMonitorState()
+	st2, seen2, err := store.Load(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := st2["Sertã"]["2025050001"]; !ok || !seen2["Sertã"]["2025050001"].Equal(testStart) {
+		t.Errorf("loaded %v %v", st2, seen2)
+	}
+	if s, _ := got.Status("2025050001"); s != "Em Curso" {
+		t.Errorf("status %q", s)
+	}
+	if h, _ := got.SummaryMarks(); h != "2025-08-14 16" {
+		t.Errorf("hourly mark %q", h)
+	}
+}
+
+func TestReplicaLockRenewAndTakeover(t *testing.T) {
+	cfg, _, _, _, mr := newRedisMonitor(t)
+	a, b := cfg.stateStore().(*redisStore), otherReplica(cfg)
+	ttl := 30 * time.Second
+	lockKey := a.key("lock")
+
+	if ok, err := a.acquire(ttl); !ok || err != nil {
+		t.Fatalf("a: acquire = %v, %v", ok, err)
+	}
+	if ok, _ := b.acquire(ttl); ok {
+		t.Fatal("b took a held lock")
+	}
+
+	// a renews every poll, so the lock outlives its first TTL
+	mr.FastForward(20 * time.Second)
+	if ok, _ := a.acquire(ttl); !ok {
+		t.Fatal("a could not renew")
+	}
+	if got := mr.TTL(lockKey); got != ttl {
+		t.Errorf("TTL after renewal = %v, want %v", got, ttl)
+	}
+	mr.FastForward(20 * time.Second)
+	if ok, _ := b.acquire(ttl); ok {
+		t.Fatal("b took a renewed lock")
+	}
+
+	// a stops renewing: b takes over, and a can neither renew nor release b's lock
+	mr.FastForward(ttl)
+	if ok, _ := b.acquire(ttl); !ok {
+		t.Fatal("b did not take over an expired lock")
+	}
+	if ok, _ := a.acquire(ttl); ok {
+		t.Error("a renewed b's lock")
+	}
+	a.release()
+	if owner, _ := mr.Get(lockKey); owner != b.owner {
+		t.Errorf("lock owner after a released = %q, want %q", owner, b.owner)
+	}
+}
+
+func TestReplicaFailover(t *testing.T) {
+	cfg, srv, clk, ms, mr := newRedisMonitor(t)
+	other := otherReplica(cfg)
+	srv.setFeed(incident("2025050001", "Em Curso", 20))
+
+	// The other replica holds the lock and has announced the incident.
+	if ok, _ := other.acquire(replicaLockTTL(cfg)); !ok {
+		t.Fatal("other replica: no lock")
+	}
+	prev := NewMonitorState()
+	prev.status["2025050001"] = "Em Curso"
+	prev.firstSeen["2025050001"] = testStart
+	prev.means["2025050001"] = Means{Man: 20, Terrain: 5}
+	if err := other.Save(prev, perMuniState{"Sertã": {"2025050001": {}}}, perMuniSeen{"Sertã": {"2025050001": testStart}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// standby: no cycle, but the state is kept up to date
+	if changed, err := runCycle(cfg, ms); changed || err != nil {
+		t.Fatalf("standby cycle = %v, %v", changed, err)
+	}
+	if msgs := srv.take(); len(msgs) != 0 {
+		t.Errorf("standby replica sent %q", titles(msgs))
+	}
+	if _, ok := ms.Status("2025050001"); !ok {
+		t.Error("standby replica did not read the shared state")
+	}
+
+	// the holder stops; this replica takes over without announcing again
+	mr.FastForward(replicaLockTTL(cfg) + time.Second)
+	clk.advance(time.Minute)
+	if _, err := runCycle(cfg, ms); err != nil {
+		t.Fatal(err)
+	}
+	if !replicaLock.held.Load() {
+		t.Fatal("lock not taken over")
+	}
+	if msgs := srv.take(); len(msgs) != 0 {
+		t.Errorf("after takeover: %q", titles(msgs))
+	}
+
+	// and notices changes from then on
+	clk.advance(time.Minute)
+	srv.setFeed(incident("2025050001", "Em Resolução", 20))
+	if _, err := runCycle(cfg, ms); err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(srv.take()); len(got) == 0 || got[0] != "Em Curso → Em Resolução — Sertã — Mato" {
+		t.Errorf("after takeover, status change: %q", got)
+	}
+}
+
+func TestRedisLoadErrorKeepsState(t *testing.T) {
+	cfg, srv, clk, ms, mr := newRedisMonitor(t)
+	srv.setFeed(incident("2025050001", "Em Curso", 20))
+	if _, err := runCycle(cfg, ms); err != nil {
+		t.Fatal(err)
+	}
+	srv.take()
+
+	// A section that is no longer a hash makes Load fail after the stamp moved.
+	store := cfg.stateStore().(*redisStore)
+	mr.Del(store.key("status"))
+	if err := mr.Set(store.key("status"), "x"); err != nil {
+		t.Fatal(err)
+	}
+	mr.Incr(store.key("version"), 1)
+
+	clk.advance(time.Minute)
+	if _, err := runCycle(cfg, ms); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := srv.take(); len(msgs) != 0 {
+		t.Errorf("state dropped after a failed load: %q", titles(msgs))
+	}
+	if s, ok := ms.Status("2025050001"); !ok || s != "Em Curso" {
+		t.Errorf("status after a failed load = %q, %v", s, ok)
+	}
+}
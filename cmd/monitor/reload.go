@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// configReloader re-reads CONFIG_FILE and the environment (flags given at
+// startup still apply) and publishes the result if it is valid. The poll loop
+// picks up the new value on its next cycle; per-ID state is untouched.
+type configReloader struct {
+	mu     sync.Mutex
+	loader *configLoader
+}
+
+func (r *configReloader) reload(source string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := conf()
+	cfg, err := r.loader.load()
+	if err == nil && old.PollInterval > 0 && cfg.PollInterval <= 0 {
+		err = errors.New("POLL_SECONDS=0 (execução única) só é suportado no arranque")
+	}
+	if err != nil {
+		slog.Error("recarregamento rejeitado; mantida a configuração anterior", "source", source, "err", err)
+		if old.ReloadNotify {
+			postNtfyExt(old.NtfyURL, old.NtfyTopic, Notification{
+				Type:     notifyConfig,
+				Title:    tr("reload.fail"),
+				Body:     tr("reload.fail.body", err.Error()),
+				Tags:     "warning",
+				Priority: "3",
+			})
+		}
+		return err
+	}
+	for _, name := range keepStartupOnly(old, cfg) {
+		slog.Warn("opção alterada só tem efeito após reiniciar", "option", name)
+	}
+	cfg.keepHTTPTransport(old)
+	setConfig(cfg)
+	setupLogging(os.Stderr, cfg)
+	if !old.InsecureSkipVerify {
+		warnInsecureTLS(cfg)
+	}
+	slog.Info("configuração recarregada", "source", source, "municipios", muniLabel(cfg.Municipios), "poll", cfg.PollInterval.String())
+	if cfg.ReloadNotify {
+		postNtfyExt(cfg.NtfyURL, cfg.NtfyTopic, Notification{
+			Type:     notifyConfig,
+			Title:    tr("reload.ok"),
+			Body:     tr("reload.ok.body", muniLabel(cfg.Municipios)),
+			Tags:     "gear",
+			Priority: "2",
+		})
+	}
+	return nil
+}
+
+// keepStartupOnly restores options that are only read at startup to their
+// running values and returns the names of the ones that differed. STATE_FILE
+// and the state backend are kept so the in-memory per-ID state stays tied to
+// the store it came from.
+func keepStartupOnly(old, cur *Config) []string {
+	var out []string
+	if old.StateFile != cur.StateFile {
+		cur.StateFile = old.StateFile
+		out = append(out, "STATE_FILE")
+	}
+	if old.StateBackend != cur.StateBackend || old.RedisURL != cur.RedisURL || old.RedisPrefix != cur.RedisPrefix {
+		cur.StateBackend, cur.RedisURL, cur.RedisPrefix = old.StateBackend, old.RedisURL, old.RedisPrefix
+		out = append(out, "STATE_BACKEND/REDIS_URL/REDIS_PREFIX")
+	}
+	if old.MetricsDisable != cur.MetricsDisable {
+		cur.MetricsDisable = old.MetricsDisable
+		out = append(out, "METRICS_DISABLE")
+	}
+	if old.MetricsAddr != cur.MetricsAddr {
+		cur.MetricsAddr = old.MetricsAddr
+		out = append(out, "METRICS_ADDR")
+	}
+	if old.MetricsPerID != cur.MetricsPerID {
+		cur.MetricsPerID = old.MetricsPerID
+		out = append(out, "BOMBEIROS_METRICS_PER_ID")
+	}
+	if old.MetricsLabels != cur.MetricsLabels {
+		cur.MetricsLabels, cur.activeLabels = old.MetricsLabels, old.activeLabels
+		out = append(out, "METRICS_LABELS")
+	}
+	if old.LogFile != cur.LogFile || old.LogFileMaxMB != cur.LogFileMaxMB || old.LogFileKeep != cur.LogFileKeep {
+		cur.LogFile, cur.LogFileMaxMB, cur.LogFileKeep = old.LogFile, old.LogFileMaxMB, old.LogFileKeep
+		out = append(out, "LOG_FILE/LOG_FILE_*")
+	}
+	if old.UseTray != cur.UseTray {
+		cur.UseTray = old.UseTray
+		out = append(out, "USE_TRAY")
+	}
+	if old.Tray != cur.Tray {
+		cur.Tray = old.Tray
+		out = append(out, "TRAY")
+	}
+	if old.MuteToken != cur.MuteToken {
+		cur.MuteToken = old.MuteToken
+		out = append(out, "MUTE_TOKEN")
+	}
+	if old.HTTPAuthToken != cur.HTTPAuthToken || old.HTTPBasicUser != cur.HTTPBasicUser ||
+		old.HTTPBasicPass != cur.HTTPBasicPass || old.MetricsPublic != cur.MetricsPublic {
+		cur.HTTPAuthToken, cur.HTTPBasicUser = old.HTTPAuthToken, old.HTTPBasicUser
+		cur.HTTPBasicPass, cur.MetricsPublic = old.HTTPBasicPass, old.MetricsPublic
+		out = append(out, "HTTP_AUTH_TOKEN/HTTP_BASIC_*/METRICS_PUBLIC")
+	}
+	if old.MetricsBasicUser != cur.MetricsBasicUser || old.MetricsBasicPass != cur.MetricsBasicPass ||
+		old.MetricsTLSCert != cur.MetricsTLSCert || old.MetricsTLSKey != cur.MetricsTLSKey {
+		cur.MetricsBasicUser, cur.MetricsBasicPass = old.MetricsBasicUser, old.MetricsBasicPass
+		cur.MetricsTLSCert, cur.MetricsTLSKey = old.MetricsTLSCert, old.MetricsTLSKey
+		out = append(out, "METRICS_BASIC_*/METRICS_TLS_*")
+	}
+	return out
+}
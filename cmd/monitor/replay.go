@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshots are named by fetch time so a lexical sort is chronological.
+const (
+	snapshotPrefix     = "fogos-"
+	snapshotTimeLayout = "20060102T150405.000Z"
+)
+
+// saveSnapshot writes a raw API response body to dir as fogos-<UTC time>.json.
+func saveSnapshot(dir string, body []byte, at time.Time) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := snapshotPrefix + at.UTC().Format(snapshotTimeLayout) + ".json"
+	return os.WriteFile(filepath.Join(dir, name), body, 0644)
+}
+
+// listSnapshots returns the snapshot files in dir, oldest first.
+func listSnapshots(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, e := range entries {
+		n := e.Name()
+		if e.Type().IsRegular() && strings.HasPrefix(n, snapshotPrefix) && strings.HasSuffix(n, ".json") {
+			out = append(out, filepath.Join(dir, n))
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// cmdReplay feeds saved snapshots through runOnce in order, with notifications
+// forced into dry-run and a throwaway state file, so a past sequence of feed
+// responses can be reproduced.
+func cmdReplay(name string, args []string) {
+	var stateOut string
+	cfg, _, rest := loadCommandConfig(name, args, func(fs *flag.FlagSet) {
+		fs.StringVar(&stateOut, "state-out", filepath.Join(os.TempDir(), "bombeiros-replay.json"), "ficheiro de estado do replay (apagado no início)")
+	})
+	if len(rest) != 1 {
+		fmt.Fprintf(os.Stderr, "Uso: %s replay [opções] <diretório>\n", progName())
+		os.Exit(2)
+	}
+	files, err := listSnapshots(rest[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro a ler %s: %v\n", rest[0], err)
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "nenhum %s*.json em %s\n", snapshotPrefix, rest[0])
+		os.Exit(1)
+	}
+	cfg.NtfyDryRun = true
+	cfg.SnapshotDir = ""
+	cfg.GrafanaURL = ""
+	cfg.ArchiveDir = ""
+	cfg.DetailFetch = false
+	cfg.WeatherEnrich = false
+	cfg.StateFile = stateOut
+	cfg.StateBackend = stateBackendFile
+	cfg.StateFlushSeconds = 0 // write after every cycle
+	cfg.APIFailureNotifyThreshold = 0
+	setConfig(cfg)
+	setupLogging(os.Stderr, cfg)
+	if err := os.Remove(stateOut); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "erro a apagar %s: %v\n", stateOut, err)
+		os.Exit(1)
+	}
+
+	failed := 0
+	for _, f := range files {
+		body, err := os.ReadFile(f)
+		if err != nil {
+			slog.Error("replay", "file", f, "err", err)
+			failed++
+			continue
+		}
+		fetchFeatures = func(context.Context, *Config) ([]Feature, error) { return toFeatures(body) }
+		slog.Info("replay", "file", filepath.Base(f))
+		if _, err := runCycle(cfg, monitor); err != nil {
+			slog.Error("erro no ciclo", "file", filepath.Base(f), "err", err)
+			failed++
+		}
+	}
+	fmt.Printf("%d snapshot(s) reproduzidos, %d com erro; estado em %s\n", len(files), failed, stateOut)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// roadRe finds road identifiers in an accent-stripped, lower-cased extra:
+// EN/N, IC, IP and ER with an optional space or dash before the number,
+// motorways (A) and municipal roads (M, CM) written together ("A23", "M520",
+// "CM1175").
+var roadRe = regexp.MustCompile(`\b(?:(en|n|ic|ip|er)[ -]?(\d{1,3}(?:-\d{1,2})?)|(a|m|cm)-?(\d{1,4}(?:-\d{1,2})?))\b`)
+
+var (
+	roadClosedWords = []string{"cortad", "corte", "encerrad", "fechad", "interdit", "bloquead"}
+	roadOpenWords   = []string{"reabert", "aberta ao transito", "abertas ao transito", "desobstruid", "restabelecid", "reposta", "desimpedid"}
+	roadNegations   = []string{"nao", "sem", "nenhuma", "nem"}
+)
+
+// roadKeyword is a closure or reopening keyword found in a sentence.
+type roadKeyword struct {
+	pos    int
+	closed bool
+}
+
+// roadKeywords lists the keywords of s in text order. A closure word right
+// after a negation ("não cortada", "sem estradas cortadas") counts as open.
+func roadKeywords(s string) []roadKeyword {
+	var out []roadKeyword
+	scan := func(words []string, closed bool) {
+		for _, w := range words {
+			for off := 0; ; {
+				i := strings.Index(s[off:], w)
+				if i < 0 {
+					break
+				}
+				i += off
+				c := closed
+				if c && negated(s[:i]) {
+					c = false
+				}
+				out = append(out, roadKeyword{pos: i, closed: c})
+				off = i + len(w)
+			}
+		}
+	}
+	scan(roadClosedWords, true)
+	scan(roadOpenWords, false)
+	slices.SortFunc(out, func(a, b roadKeyword) int { return a.pos - b.pos })
+	return out
+}
+
+// negated reports a negation among the last three words before a keyword.
+func negated(before string) bool {
+	f := strings.Fields(before)
+	for _, w := range f[max(0, len(f)-3):] {
+		if slices.Contains(roadNegations, strings.Trim(w, ",;:")) {
+			return true
+		}
+	}
+	return false
+}
+
+// roadMentions reads the extra text sentence by sentence and returns, for
+// every road mentioned next to a closure or reopening keyword, whether the
+// last such mention says it is closed. Each road takes the nearest keyword
+// of its clause ("EN238 reaberta, IC8 ainda cortado"), or of its sentence
+// when the clause has none ("cortadas a EN2, o IC8 e a A23").
+func roadMentions(extra string) map[string]bool {
+	out := map[string]bool{}
+	for _, sentence := range extraFragments(extra) {
+		s := strings.ToLower(stripAccents(sentence))
+		kws := roadKeywords(s)
+		if len(kws) == 0 {
+			continue
+		}
+		for _, m := range roadRe.FindAllStringSubmatchIndex(s, -1) {
+			lo := strings.LastIndexByte(s[:m[0]], ',') + 1
+			hi := len(s)
+			if i := strings.IndexByte(s[m[1]:], ','); i >= 0 {
+				hi = m[1] + i
+			}
+			cands := slices.DeleteFunc(slices.Clone(kws), func(k roadKeyword) bool { return k.pos < lo || k.pos >= hi })
+			if len(cands) == 0 {
+				cands = kws
+			}
+			nearest := cands[0]
+			for _, k := range cands[1:] {
+				if abs(k.pos-m[0]) < abs(nearest.pos-m[0]) {
+					nearest = k
+				}
+			}
+			out[roadName(s, m)] = nearest.closed
+		}
+	}
+	return out
+}
+
+// roadName renders a match as the usual identifier: EN238, IC8, A23, M520.
+func roadName(s string, m []int) string {
+	g := 2 // EN/IC/IP/ER, or A/M/CM in the second alternative
+	if m[g] < 0 {
+		g = 6
+	}
+	prefix, num := s[m[g]:m[g+1]], s[m[g+2]:m[g+3]]
+	if prefix == "n" {
+		prefix = "en"
+	}
+	return strings.ToUpper(prefix) + num
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// updateRoads works out the roads closed now from the current extra and
+// the set kept for the incident. A road leaves the set when the extra says
+// it reopened (reported in reopened) or no longer mentions it.
+func updateRoads(prev []string, extra string) (now, closed, reopened []string) {
+	mentions := roadMentions(extra)
+	for road, isClosed := range mentions {
+		if !isClosed {
+			continue
+		}
+		now = append(now, road)
+		if !slices.Contains(prev, road) {
+			closed = append(closed, road)
+		}
+	}
+	for _, road := range prev {
+		if isClosed, ok := mentions[road]; ok && !isClosed {
+			reopened = append(reopened, road)
+		}
+	}
+	slices.Sort(now)
+	slices.Sort(closed)
+	slices.Sort(reopened)
+	return now, closed, reopened
+}
+
+// roadEvent is a change to the closed roads of one incident.
+type roadEvent struct {
+	disp, id         string
+	closed, reopened []string
+	f                Feature
+}
+
+// notifications renders one message for the roads closed and one for those
+// reopened, e.g. "EN238 cortada (Sertã)" and "EN238 reaberta".
+func (ev roadEvent) notifications() []Notification {
+	var out []Notification
+	body := tr("extra.body", ev.id, strings.TrimSpace(getPropStr(ev.f.Properties, "extra")))
+	click := mapsURLForFeature(ev.f, ev.disp)
+	if n := len(ev.closed); n > 0 {
+		out = append(out, Notification{Type: notifyRoad, Title: trn("road.closed", n, joinRoads(ev.closed), ev.disp), Body: body,
+			Tags: tagFor("road_closed"), Priority: "4", Click: click, IncidentID: ev.id, Incidents: []Feature{ev.f}})
+	}
+	if n := len(ev.reopened); n > 0 {
+		out = append(out, Notification{Type: notifyRoad, Title: trn("road.open", n, joinRoads(ev.reopened)), Body: body,
+			Tags: tagFor("reopened"), Priority: "3", Click: click, IncidentID: ev.id, Incidents: []Feature{ev.f}})
+	}
+	return out
+}
+
+// joinRoads lists roads as "EN2, IC8 e A23".
+func joinRoads(roads []string) string {
+	if len(roads) == 1 {
+		return roads[0]
+	}
+	return strings.Join(roads[:len(roads)-1], ", ") + tr("list.and") + roads[len(roads)-1]
+}
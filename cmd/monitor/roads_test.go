@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoadMentions(t *testing.T) {
+	for _, c := range []struct {
+		extra string
+		want  map[string]bool // road: closed
+	}{
+		{"EN238 cortada entre Sertã e Cernache do Bonjardim.", map[string]bool{"EN238": true}},
+		// accents, case and the ways a road gets written
+		{"ESTRADA N 238 CORTADA AO TRÂNSITO.", map[string]bool{"EN238": true}},
+		{"A N-2 encontra-se encerrada.", map[string]bool{"EN2": true}},
+		{"Trânsito interdito no IC8 e na EN238-1.", map[string]bool{"IC8": true, "EN238-1": true}},
+		{"A23 e IP2 fechadas nos dois sentidos.", map[string]bool{"A23": true, "IP2": true}},
+		{"Estrada municipal M520 bloqueada; CM1175 também bloqueado.", map[string]bool{"M520": true, "CM1175": true}},
+		{"Cortadas a EN2, o IC8 e a A23.", map[string]bool{"EN2": true, "IC8": true, "A23": true}},
+		{"EN238 reaberta ao trânsito.", map[string]bool{"EN238": false}},
+		{"A EN2 já está aberta ao trânsito.", map[string]bool{"EN2": false}},
+		// each road takes the nearest keyword of its sentence
+		{"EN238 reaberta, IC8 ainda cortado.", map[string]bool{"EN238": false, "IC8": true}},
+		{"EN2 cortada. EN238 reaberta.", map[string]bool{"EN2": true, "EN238": false}},
+		// false positives
+		{"A EN238 não está cortada.", map[string]bool{"EN238": false}},
+		{"EN238 nao cortada, circulação condicionada.", map[string]bool{"EN238": false}},
+		{"Sem estradas cortadas na EN2, trânsito lento.", map[string]bool{"EN2": false}},
+		{"Nenhuma via cortada na zona da EN238.", map[string]bool{"EN238": false}},
+		{"Incêndio junto à EN238, com 3 frentes ativas.", map[string]bool{}},
+		{"Reacendimento às 18h a 2 km da aldeia; corte de energia na zona.", map[string]bool{}},
+	} {
+		if got := roadMentions(c.extra); !maps.Equal(got, c.want) {
+			t.Errorf("%q: %v, want %v", c.extra, got, c.want)
+		}
+	}
+}
+
+func TestUpdateRoads(t *testing.T) {
+	now, closed, reopened := updateRoads([]string{"EN238", "IC8"}, "IC8 reaberto. EN2 cortada; EN238 ainda cortada.")
+	if !slices.Equal(now, []string{"EN2", "EN238"}) || !slices.Equal(closed, []string{"EN2"}) || !slices.Equal(reopened, []string{"IC8"}) {
+		t.Errorf("now %v, closed %v, reopened %v", now, closed, reopened)
+	}
+	// no longer mentioned: dropped without a reopening
+	now, closed, reopened = updateRoads([]string{"EN238"}, "Incêndio em resolução.")
+	if len(now)+len(closed)+len(reopened) != 0 {
+		t.Errorf("now %v, closed %v, reopened %v", now, closed, reopened)
+	}
+}
+
+// TestRoadNotifications: a message only when the set of closed roads
+// changes, and the set in /api/incidents.
+func TestRoadNotifications(t *testing.T) {
+	cfg, srv, clk, ms := newTestMonitor(t, nil)
+	mux := http.NewServeMux()
+	registerIncidentAPI(mux, cfg)
+	for _, p := range []struct {
+		extra string
+		want  []string // road notifications
+		roads []string // in the API
+	}{
+		{"Incêndio em povoamento florestal. A EN238 não está cortada.", nil, nil},
+		{"EN238 cortada entre Sertã e Pedrógão Pequeno.", []string{"EN238 cortada (Sertã)"}, []string{"EN238"}},
+		{"EN238 cortada entre Sertã e Pedrógão Pequeno. Meios aéreos no local.", nil, []string{"EN238"}},
+		{"EN238 e IC8 CORTADOS ao trânsito.", []string{"IC8 cortada (Sertã)"}, []string{"EN238", "IC8"}},
+		{"EN238 reaberta; IC8 ainda cortado.", []string{"EN238 reaberta"}, []string{"IC8"}},
+		{"IC8 e EN2 reabertas.", []string{"IC8 reaberta"}, nil},
+	} {
+		clk.advance(time.Minute)
+		f := incident("2025050001", "Em Curso", 20)
+		f["extra"] = p.extra
+		srv.setFeed(f)
+		mustRun(t, cfg, ms)
+		var got []string
+		for _, title := range titles(srv.take()) {
+			if strings.HasSuffix(title, " (Sertã)") || strings.HasSuffix(title, " reaberta") || strings.HasSuffix(title, " reabertas") {
+				got = append(got, title)
+			}
+		}
+		if !slices.Equal(got, p.want) {
+			t.Errorf("%q: %q, want %q", p.extra, got, p.want)
+		}
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/incidents/2025050001", nil))
+		var v struct {
+			ClosedRoads []string `json:"closedRoads"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+			t.Fatalf("%q: %v", rec.Body, err)
+		}
+		if !slices.Equal(v.ClosedRoads, p.roads) {
+			t.Errorf("%q: closedRoads %v, want %v", p.extra, v.ClosedRoads, p.roads)
+		}
+	}
+}
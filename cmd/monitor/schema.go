@@ -0,0 +1,96 @@
+package main
+
+import (
+	"log/slog"
+)
+
+// Feed keys whose disappearance would silently break detection, each with
+// the alternative names the parser already accepts.
+var schemaKeys = []struct {
+	name  string
+	alias []string
+}{
+	{"status", []string{"status", "phase", "estado"}},
+	{"natureza", []string{"natureza", "type", "tipo"}},
+	{"man", []string{"man"}},
+	{"terrain", []string{"terrain"}},
+	{"concelho", []string{"concelho", "municipio", "county", "municipality"}},
+	{"dateTime", []string{"dateTime"}},
+}
+
+const (
+	// schemaMinFraction is the share of features that must carry a key.
+	schemaMinFraction = 0.5
+	// schemaMinFeatures skips polls too small to judge.
+	schemaMinFeatures = 5
+	// schemaPolls is how many polls in a row a key must be missing.
+	schemaPolls = 3
+)
+
+// schemaWatch counts, per key, the consecutive polls where it was missing
+// from most features, and remembers which keys were already reported.
+type schemaWatch struct {
+	misses  map[string]int
+	alerted map[string]bool
+}
+
+var schema = &schemaWatch{misses: map[string]int{}, alerted: map[string]bool{}}
+
+// keyCoverage is the fraction of features that carry the key under any of
+// its names.
+func keyCoverage(features []Feature, alias []string) float64 {
+	if len(features) == 0 {
+		return 1
+	}
+	n := 0
+	for _, f := range features {
+		for _, k := range alias {
+			if v, ok := f.Properties[k]; ok && v != nil {
+				n++
+				break
+			}
+		}
+	}
+	return float64(n) / float64(len(features))
+}
+
+// observe updates the counters with one poll and returns the keys that have
+// just crossed schemaPolls. A key that comes back is forgotten, so a later
+// drop is reported again.
+func (w *schemaWatch) observe(features []Feature) (missing []string) {
+	if len(features) < schemaMinFeatures {
+		return nil
+	}
+	for _, k := range schemaKeys {
+		if keyCoverage(features, k.alias) >= schemaMinFraction {
+			if w.alerted[k.name] {
+				slog.Info("campo da API de volta", "key", k.name)
+			}
+			delete(w.misses, k.name)
+			delete(w.alerted, k.name)
+			continue
+		}
+		w.misses[k.name]++
+		if w.misses[k.name] >= schemaPolls && !w.alerted[k.name] {
+			w.alerted[k.name] = true
+			missing = append(missing, k.name)
+		}
+	}
+	return missing
+}
+
+// check runs observe on everything fetched (a missing concelho would empty
+// the filtered list) and sends one self-alert per key that went missing.
+// Only called from the poll goroutine.
+func (w *schemaWatch) check(cfg *Config, features []Feature) {
+	for _, key := range w.observe(features) {
+		slog.Warn("possível alteração da API: campo ausente", "key", key, "polls", schemaPolls, "features", len(features))
+		postNtfyExt(cfg.NtfyURL, cfg.NtfyTopic, Notification{
+			Type:     notifyFeed,
+			Title:    tr("schema.title", key),
+			Body:     tr("schema.body", key, int(schemaMinFraction*100), schemaPolls),
+			Tags:     "warning",
+			Priority: "4",
+		})
+	}
+}
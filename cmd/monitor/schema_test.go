@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// schemaFeatures returns n incidents; the first without of them lack key.
+func schemaFeatures(n, without int, key string) []Feature {
+	out := make([]Feature, n)
+	for i := range out {
+		p := incident(fmt.Sprintf("20250500%02d", i), "Em Curso", 20)
+		if i < without {
+			delete(p, key)
+		}
+		out[i] = Feature{Properties: p}
+	}
+	return out
+}
+
+func TestSchemaWatch(t *testing.T) {
+	w := &schemaWatch{misses: map[string]int{}, alerted: map[string]bool{}}
+	for i, p := range []struct {
+		features []Feature
+		want     []string
+	}{
+		{schemaFeatures(5, 0, "man"), nil},
+		// missing twice, then back: the count starts over
+		{schemaFeatures(5, 5, "man"), nil},
+		{schemaFeatures(5, 5, "man"), nil},
+		{schemaFeatures(5, 0, "man"), nil},
+		{schemaFeatures(5, 5, "man"), nil},
+		{schemaFeatures(5, 3, "man"), nil}, // 2 of 5 carry it
+		// polls too small to judge neither count nor reset
+		{schemaFeatures(4, 4, "man"), nil},
+		{schemaFeatures(5, 5, "man"), []string{"man"}},
+		// reported once
+		{schemaFeatures(5, 5, "man"), nil},
+		{schemaFeatures(8, 8, "man"), nil},
+		// half of them is enough, and it can go missing again
+		{schemaFeatures(6, 3, "man"), nil},
+		{schemaFeatures(5, 5, "man"), nil},
+		{schemaFeatures(5, 5, "man"), nil},
+		{schemaFeatures(5, 5, "man"), []string{"man"}},
+	} {
+		if got := w.observe(p.features); !slices.Equal(got, p.want) {
+			t.Errorf("poll %d: %q, want %q", i+1, got, p.want)
+		}
+	}
+}
+
+func TestSchemaWatchAliases(t *testing.T) {
+	w := &schemaWatch{misses: map[string]int{}, alerted: map[string]bool{}}
+	features := schemaFeatures(5, 0, "")
+	for _, f := range features {
+		// the other names the parser accepts, and a null
+		f.Properties["phase"] = f.Properties["status"]
+		delete(f.Properties, "status")
+		f.Properties["municipality"] = f.Properties["concelho"]
+		delete(f.Properties, "concelho")
+		f.Properties["terrain"] = nil
+	}
+	var got []string
+	for range schemaPolls {
+		got = append(got, w.observe(features)...)
+	}
+	if !slices.Equal(got, []string{"terrain"}) {
+		t.Errorf("missing %q, want terrain only", got)
+	}
+}
+
+// TestSchemaSelfAlert: the renamed field of the request, through the poll
+// loop: one self-alert, and the incidents are still followed.
+func TestSchemaSelfAlert(t *testing.T) {
+	prev := schema
+	schema = &schemaWatch{misses: map[string]int{}, alerted: map[string]bool{}}
+	t.Cleanup(func() { schema = prev })
+	cfg, srv, clk, ms := newTestMonitor(t, nil)
+	var feed []map[string]any
+	for _, f := range schemaFeatures(6, 0, "") {
+		f.Properties["operatives"] = f.Properties["man"]
+		delete(f.Properties, "man")
+		feed = append(feed, f.Properties)
+	}
+	srv.setFeed(feed...)
+	const title = "Possível alteração da API: campo 'man' ausente"
+	for poll := 1; poll <= schemaPolls+2; poll++ {
+		mustRun(t, cfg, ms)
+		n := 0
+		for _, m := range srv.take() {
+			if m.Title == title {
+				n++
+				if !m.hasTag("warning") || m.Message != "O campo 'man' falta em mais de 50% das ocorrências há 3 leituras seguidas. Meios, estados ou filtros podem estar errados." {
+					t.Errorf("self-alert %v:\n%s", m.Tags, m.Message)
+				}
+			}
+		}
+		if want := map[bool]int{true: 1}[poll == schemaPolls]; n != want {
+			t.Errorf("poll %d: %d self-alerts, want %d", poll, n, want)
+		}
+		clk.advance(time.Minute)
+	}
+	if _, ok := ms.Status("2025050005"); !ok {
+		t.Error("incidents not followed")
+	}
+}
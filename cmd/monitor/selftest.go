@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// selfTestWait is how long the topic is polled for the test message.
+	selfTestWait = 10 * time.Second
+	// selfTestSince bounds the poll; relative, so clock skew does not matter.
+	selfTestSince = "2m"
+)
+
+// selfTestError says at which step the self-test failed, to pick the hints.
+type selfTestError struct {
+	step   string // "publish", "poll" or "missing"
+	status int    // HTTP status, 0 for network errors
+	err    error
+}
+
+func (e *selfTestError) Error() string { return e.step + ": " + e.err.Error() }
+
+func (e *selfTestError) Unwrap() error { return e.err }
+
+// ntfySelfTest publishes a message carrying a random token to every ntfy
+// server and polls the topic's JSON endpoint until it shows up, logging the
+// round-trip time or what to look at.
+func ntfySelfTest(cfg *Config) error {
+	if strings.TrimSpace(cfg.NtfyTopic) == "" {
+		return errors.New("NTFY_TOPIC vazio")
+	}
+	if cfg.NtfyDryRun {
+		slog.Info("autoteste ntfy omitido (NTFY_DRYRUN)")
+		return nil
+	}
+	var b [6]byte
+	_, _ = rand.Read(b[:])
+	token := hex.EncodeToString(b[:])
+	var errs []error
+	for _, srv := range ntfyServersFor(cfg, cfg.NtfyURL) {
+		start := time.Now()
+		err := selfTestServer(cfg, srv, token)
+		if err == nil {
+			slog.Info("autoteste ntfy: mensagem entregue", "server", srv.label(), "topic", cfg.NtfyTopic, "latency", time.Since(start).Round(time.Millisecond).String())
+			continue
+		}
+		slog.Error("autoteste ntfy falhou", "server", srv.label(), "topic", cfg.NtfyTopic, "err", err)
+		for _, h := range selfTestHints(err) {
+			slog.Warn("autoteste ntfy: sugestão", "hint", h)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", srv.label(), err))
+	}
+	return errors.Join(errs...)
+}
+
+// selfTestServer publishes the test message to srv and waits for it to be
+// readable from the topic.
+func selfTestServer(cfg *Config, srv ntfyServer, token string) error {
+	base := strings.TrimRight(srv.URL, "/") + "/" + cfg.NtfyTopic
+	req, err := http.NewRequest("POST", base, strings.NewReader(tr("selftest.body", token)))
+	if err != nil {
+		return &selfTestError{step: "publish", err: err}
+	}
+	req.Header.Set("Title", tr("test.started"))
+	req.Header.Set("Tags", "white_check_mark")
+	req.Header.Set("Priority", "3")
+	if srv.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+srv.Token)
+	}
+	if err := doNtfyRequest(req, notifyTest, srv.label()); err != nil {
+		return &selfTestError{step: "publish", status: httpStatusOf(err), err: err}
+	}
+	deadline := time.Now().Add(selfTestWait)
+	for {
+		found, err := selfTestPoll(cfg, srv, base, token)
+		if err != nil {
+			return err
+		}
+		if found {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return &selfTestError{step: "missing", err: fmt.Errorf("mensagem aceite mas não lida do tópico em %s", selfTestWait)}
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// selfTestPoll reads the topic's cached messages and looks for token.
+func selfTestPoll(cfg *Config, srv ntfyServer, base, token string) (bool, error) {
+	req, err := http.NewRequest("GET", base+"/json?poll=1&since="+selfTestSince, nil)
+	if err != nil {
+		return false, &selfTestError{step: "poll", err: err}
+	}
+	if srv.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+srv.Token)
+	}
+	resp, err := cfg.httpClient.Do(req)
+	if err != nil {
+		return false, &selfTestError{step: "poll", err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return false, &selfTestError{step: "poll", status: resp.StatusCode, err: fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))}
+	}
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var m struct {
+			Event   string `json:"event"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			return false, &selfTestError{step: "poll", status: resp.StatusCode, err: fmt.Errorf("resposta não é JSON do ntfy: %s", previewBody(sc.Bytes(), 80))}
+		}
+		if m.Event == "message" && strings.Contains(m.Message, token) {
+			return true, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return false, &selfTestError{step: "poll", err: err}
+	}
+	return false, nil
+}
+
+// httpStatusOf digs the status out of a doNtfyRequest error.
+func httpStatusOf(err error) int {
+	var ra *retryAfterError
+	if errors.As(err, &ra) {
+		return http.StatusTooManyRequests
+	}
+	var he *ntfyHTTPError
+	if errors.As(err, &he) {
+		return he.status
+	}
+	return 0
+}
+
+// selfTestHints suggests what to check for a failed self-test.
+func selfTestHints(err error) []string {
+	var st *selfTestError
+	if !errors.As(err, &st) {
+		return nil
+	}
+	switch {
+	case st.status == http.StatusUnauthorized || st.status == http.StatusForbidden:
+		return []string{
+			"o servidor exige autenticação: indique o token em NTFY_URLS (https://servidor|tk_...)",
+			"confirme que o token tem permissão de escrita e de leitura no tópico " + conf().NtfyTopic,
+		}
+	case st.status == http.StatusTooManyRequests:
+		return []string{"limite de pedidos do servidor ntfy atingido; tente mais tarde ou use um servidor próprio"}
+	case st.status == http.StatusNotFound || st.status == http.StatusMethodNotAllowed || (st.step == "poll" && st.status != 0):
+		return []string{"NTFY_URL deve ser a raiz do servidor (ex.: https://ntfy.sh), sem o tópico nem /v1"}
+	case st.status == 0 && st.step != "missing":
+		return []string{
+			"servidor inacessível: confirme NTFY_URL, o DNS e a ligação",
+			"atrás de um proxy: HTTPS_PROXY; com inspeção TLS: HTTP_CA_FILE",
+		}
+	case st.step == "missing":
+		return []string{
+			"confirme o nome do tópico em NTFY_TOPIC (maiúsculas contam) e na app",
+			"o servidor pode ter a cache de mensagens desligada (cache-duration: 0), o que impede a confirmação",
+		}
+	}
+	return []string{"veja o erro acima e `" + progName() + " check`"}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runningAsService is always false outside Windows; use systemd or similar.
+func runningAsService() bool { return false }
+
+func runAsService(args []string) {}
+
+func cmdService(name string, args []string) {
+	fmt.Fprintln(os.Stderr, "service só está disponível em Windows; use systemd, launchd ou Docker")
+	os.Exit(2)
+}
@@ -0,0 +1,207 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const (
+	serviceName    = "BombeirosMonitor"
+	serviceDisplay = "Bombeiros Monitor"
+	serviceDesc    = "Monitoriza ocorrências do fogos.pt e envia notificações ntfy"
+)
+
+// runningAsService reports whether the SCM started this process.
+func runningAsService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// runAsService hands control to the SCM. Relative paths (STATE_FILE,
+// CONFIG_FILE) resolve against the executable's directory rather than
+// System32.
+func runAsService(args []string) {
+	if exe, err := os.Executable(); err == nil {
+		_ = os.Chdir(filepath.Dir(exe))
+	}
+	if el, err := eventlog.Open(serviceName); err == nil {
+		defer el.Close()
+		logTee = eventLogHandler{el: el}
+	}
+	if err := svc.Run(serviceName, &monitorService{args: args}); err != nil {
+		slog.Error("serviço", "err", err)
+		os.Exit(1)
+	}
+}
+
+type monitorService struct {
+	args []string
+}
+
+// Execute runs the same serve path as the console, canceling its context on
+// Stop/Shutdown.
+func (m *monitorService) Execute(_ []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	cfg, loader, _ := loadCommandConfig("run", m.args, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve(ctx, cancel, cfg, loader, false)
+	}()
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending, WaitHint: uint32((shutdownTimeout + 5*time.Second).Milliseconds())}
+				cancel()
+				<-done
+				return false, 0
+			}
+		case <-done:
+			return false, 0
+		}
+	}
+}
+
+// eventLogHandler forwards warnings and errors to the Windows Event Log.
+type eventLogHandler struct {
+	el    *eventlog.Log
+	attrs []slog.Attr
+}
+
+func (h eventLogHandler) Enabled(_ context.Context, l slog.Level) bool { return l >= slog.LevelWarn }
+
+func (h eventLogHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Message)
+	write := func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+		return true
+	}
+	for _, a := range h.attrs {
+		write(a)
+	}
+	r.Attrs(write)
+	if r.Level >= slog.LevelError {
+		return h.el.Error(1, b.String())
+	}
+	return h.el.Warning(2, b.String())
+}
+
+func (h eventLogHandler) WithAttrs(as []slog.Attr) slog.Handler {
+	return eventLogHandler{el: h.el, attrs: append(append([]slog.Attr{}, h.attrs...), as...)}
+}
+
+func (h eventLogHandler) WithGroup(string) slog.Handler { return h }
+
+// cmdService implements `service install|uninstall|start|stop`. Options given
+// after install (e.g. --config C:\bombeiros\monitor.yaml) are stored in the
+// service command line.
+func cmdService(name string, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Uso: %s service install [opções]|uninstall|start|stop\n", progName())
+		os.Exit(2)
+	}
+	var err error
+	switch args[0] {
+	case "install":
+		err = installService(args[1:])
+	case "uninstall":
+		err = uninstallService()
+	case "start":
+		err = withService(func(s *mgr.Service) error { return s.Start() })
+	case "stop":
+		err = withService(func(s *mgr.Service) error {
+			_, err := s.Control(svc.Stop)
+			return err
+		})
+	default:
+		err = fmt.Errorf("subcomando desconhecido: service %s", args[0])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("service %s: ok\n", args[0])
+}
+
+func installService(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	// Make a relative --config absolute: the service does not start in the current directory.
+	for i, a := range args {
+		if (a == "--config" || a == "-config") && i+1 < len(args) {
+			if p, err := filepath.Abs(args[i+1]); err == nil {
+				args[i+1] = p
+			}
+		}
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("serviço %s já existe", serviceName)
+	}
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: serviceDisplay,
+		Description: serviceDesc,
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	_ = s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: time.Minute},
+	}, 24*60*60)
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		_ = s.Delete()
+		return fmt.Errorf("registo no Event Log: %w", err)
+	}
+	return nil
+}
+
+func uninstallService() error {
+	err := withService(func(s *mgr.Service) error { return s.Delete() })
+	if err != nil {
+		return err
+	}
+	_ = eventlog.Remove(serviceName)
+	return nil
+}
+
+func withService(fn func(s *mgr.Service) error) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("serviço %s não encontrado: %w", serviceName, err)
+	}
+	defer s.Close()
+	return fn(s)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// shareLine renders SHARE_TEMPLATE for one incident, e.g.
+// "🔥 Mato — Sertã (Cernache), Em Curso, 34 op. + 1 heli — https://fogos.pt/fogo/123456".
+// Placeholders: {emoji} {natureza} {concelho} {localidade} {local} {status}
+// {meios} {id} {url}. Parts left empty drop out with their separator.
+func shareLine(cfg *Config, f Feature, id string) string {
+	tmpl := strings.TrimSpace(cfg.ShareTemplate)
+	if tmpl == "" {
+		return ""
+	}
+	p := f.Properties
+	muni := getMunicipio(p)
+	loc := getPropStr(p, "localidade")
+	local := muni
+	if loc != "" && !strings.EqualFold(loc, muni) {
+		local += " (" + loc + ")"
+	}
+	emoji, link := "🚨", mapsURLForFeature(f, muni)
+	if isFireIncident(p) {
+		emoji = "🔥"
+		if id != "" {
+			link = "https://fogos.pt/fogo/" + id
+		}
+	}
+	s := strings.NewReplacer(
+		"{emoji}", emoji,
+		"{natureza}", getPropStr(p, "natureza"),
+		"{concelho}", muni,
+		"{localidade}", loc,
+		"{local}", local,
+		"{status}", getPropStr(p, "status"),
+		"{meios}", shareMeans(p),
+		"{id}", id,
+		"{url}", link,
+	).Replace(tmpl)
+	for _, sep := range []string{" — ", ", "} {
+		var parts []string
+		for _, part := range strings.Split(s, sep) {
+			if part = strings.TrimSpace(part); part != "" {
+				parts = append(parts, part)
+			}
+		}
+		s = strings.Join(parts, sep)
+	}
+	return s
+}
+
+// shareMeans is the short means summary of the share line: "34 op. + 1 heli".
+func shareMeans(p map[string]any) string {
+	var parts []string
+	if man, _ := toFloat(p["man"]); man > 0 {
+		parts = append(parts, tr("share.man", int(man)))
+	}
+	hf, _ := toFloat(p["heliFight"])
+	hc, _ := toFloat(p["heliCoord"])
+	if heli := int(hf + hc); heli > 0 {
+		parts = append(parts, tr("share.heli", heli))
+	}
+	if pf, _ := toFloat(p["planeFight"]); pf > 0 {
+		parts = append(parts, trn("share.plane", int(pf)))
+	}
+	return strings.Join(parts, " + ")
+}
+
+// withShare appends the share line to body, after a blank line.
+func withShare(cfg *Config, f Feature, id, body string) (string, string) {
+	s := shareLine(cfg, f, id)
+	if s == "" {
+		return body, ""
+	}
+	return body + "\n\n" + s, s
+}
+
+// shareURL is SHARE_URL with {text} replaced by the escaped share line; empty
+// when there is no line or no SHARE_URL.
+func shareURL(cfg *Config, text string) string {
+	if text == "" || strings.TrimSpace(cfg.ShareURL) == "" {
+		return ""
+	}
+	return strings.ReplaceAll(cfg.ShareURL, "{text}", strings.ReplaceAll(url.QueryEscape(text), "+", "%20"))
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifySummarySignal delivers SIGUSR1 (on-demand summary) to ch.
+func notifySummarySignal(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGUSR1)
+}
@@ -0,0 +1,9 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "os"
+
+// notifySummarySignal is a no-op: Windows has no SIGUSR1. Use POST /api/summary.
+func notifySummarySignal(ch chan<- os.Signal) {}
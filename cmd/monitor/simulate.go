@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path/filepath"
+)
+
+// muniSeats are approximate coordinates of the municipal seats in the default
+// area, used to place simulated incidents.
+var muniSeats = map[string][2]float64{
+	"serta":             {39.8008, -8.0986},
+	"oleiros":           {39.9183, -7.9144},
+	"castanheiradepera": {40.0064, -8.2097},
+	"proencaanova":      {39.7497, -7.9253},
+	"viladerei":         {39.6756, -8.1450},
+	"vilavelhaderodao":  {39.6556, -7.6756},
+	"sardoal":           {39.5369, -8.1611},
+	"figueirodosvinhos": {39.9047, -8.2744},
+	"pedrogaogrande":    {39.9175, -8.1456},
+	"pampilhosadaserra": {40.0464, -7.9528},
+	"ferreiradozezere":  {39.6939, -8.2897},
+	"fundao":            {40.1389, -7.5011},
+	"castelobranco":     {39.8222, -7.4931},
+	"idanhaanova":       {39.9219, -7.2372},
+	"penamacor":         {40.1681, -7.1714},
+	"belmonte":          {40.3586, -7.3511},
+	"covilha":           {40.2803, -7.5044},
+}
+
+// cmdSimulate injects a fabricated incident into a normal cycle so the whole
+// notification path (filters, enrichment, click URLs, ntfy) can be exercised.
+// With --transition it runs a second cycle moving the same ID to a new status.
+func cmdSimulate(name string, args []string) {
+	var (
+		muni, natureza, status, transition, statePath string
+		man, terrain, aerial                          int
+	)
+	cfg, _, _ := loadCommandConfig(name, args, func(fs *flag.FlagSet) {
+		fs.StringVar(&muni, "municipio", "Sertã", "município da ocorrência simulada")
+		fs.StringVar(&natureza, "natureza", "Incêndio Rural", "natureza")
+		fs.StringVar(&status, "status", "Em Curso", "estado inicial")
+		fs.StringVar(&transition, "transition", "", "estado seguinte, num segundo ciclo")
+		fs.IntVar(&man, "man", 15, "operacionais")
+		fs.IntVar(&terrain, "terrain", 4, "meios terrestres")
+		fs.IntVar(&aerial, "aerial", 0, "meios aéreos")
+		fs.StringVar(&statePath, "state", filepath.Join(os.TempDir(), "bombeiros-simulate.json"), "ficheiro de estado (use STATE_FILE para o real)")
+	})
+	if _, ok := cfg.wantedSet[normMunicipio(muni)]; !ok {
+		slog.Warn("município fora de MUNICIPIOS; adicionado só para esta simulação", "municipio", muni)
+		cfg.Municipios = append(cfg.Municipios, muni)
+		cfg.wantedSet, cfg.wantedFlat = makeWantedSet(cfg.Municipios)
+	}
+	cfg.StateFile = statePath
+	cfg.StateBackend = stateBackendFile // never the shared state
+	// Keep real IDs in a shared state file and leave the summaries alone.
+	cfg.CleanFinished = false
+	cfg.StateTTL = 0
+	cfg.StateFlushSeconds = 0 // write after every cycle
+	cfg.SummaryHourly, cfg.SummaryDaily = false, false
+	// Simulated IDs do not exist upstream.
+	cfg.DetailFetch = false
+	cfg.ArchiveDir = ""
+	setConfig(cfg)
+	setupLogging(os.Stderr, cfg)
+
+	id := simulatedID(muni)
+	steps := []string{status}
+	if transition != "" {
+		steps = append(steps, transition)
+	}
+	for _, st := range steps {
+		body := simulatedBody(id, muni, natureza, st, man, terrain, aerial)
+		fetchFeatures = func(context.Context, *Config) ([]Feature, error) { return toFeatures(body) }
+		changed, err := runCycle(cfg, monitor)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "erro no ciclo: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("ID %s em %s: %s (alterações: %v)\n", id, muni, st, changed)
+	}
+	fmt.Printf("estado em %s\n", statePath)
+}
+
+// simulatedID is stable per municipality so --transition hits the same incident.
+// The 9999 prefix keeps it clear of real ANEPC numbers.
+func simulatedID(muni string) string {
+	h := fnv.New32a()
+	h.Write([]byte(normMunicipio(muni)))
+	return fmt.Sprintf("9999%09d", h.Sum32()%1_000_000_000)
+}
+
+// simulatedBody builds a feed document in the fogos.pt shape for one incident.
+func simulatedBody(id, muni, natureza, status string, man, terrain, aerial int) []byte {
+	lat, lon := 39.6, -8.0
+	if c, ok := muniSeats[normMunicipio(muni)]; ok {
+		lat, lon = c[0], c[1]
+	} else if cfg := conf(); cfg.hasCenter() {
+		lat, lon = cfg.CenterLat, cfg.CenterLon
+	}
+	// Up to ~2 km from the seat, fixed per ID.
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	r := rand.New(rand.NewSource(int64(h.Sum64())))
+	lat += (r.Float64() - 0.5) * 0.03
+	lon += (r.Float64() - 0.5) * 0.03
+	now := conf().now()
+	obj := map[string]any{
+		"id":         id,
+		"concelho":   muni,
+		"natureza":   natureza,
+		"status":     status,
+		"localidade": "Simulação",
+		"lat":        lat,
+		"lng":        lon,
+		"man":        man,
+		"terrain":    terrain,
+		"aerial":     aerial,
+		"dateTime":   map[string]any{"sec": now.Unix()},
+		"updated":    map[string]any{"sec": now.Unix()},
+		"extra":      "Ocorrência simulada — ignorar",
+	}
+	b, _ := json.Marshal(map[string]any{"success": true, "data": []any{obj}})
+	return b
+}
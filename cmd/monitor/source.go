@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// FEATURES_SOURCE forms: an http(s) URL, file:<path> (re-read every poll so
+// it can be edited live) or "-" for stdin (read once, then reused).
+
+func isHTTPSource(src string) bool {
+	return strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")
+}
+
+// validateSource checks one source string; name is the setting it came from.
+func validateSource(name, src string) error {
+	switch {
+	case src == "", src == "-", isHTTPSource(src):
+		return nil
+	case strings.HasPrefix(src, "file:") && strings.TrimPrefix(src, "file:") != "":
+		return nil
+	}
+	return fmt.Errorf("%s=%q: esperado URL http(s), file:<caminho> ou -", name, src)
+}
+
+var stdinSource struct {
+	once sync.Once
+	data []byte
+	err  error
+}
+
+// readLocalSource returns the raw document behind a file: or stdin source.
+func readLocalSource(src string) ([]byte, error) {
+	if src == "-" {
+		stdinSource.once.Do(func() {
+			stdinSource.data, stdinSource.err = io.ReadAll(os.Stdin)
+		})
+		return stdinSource.data, stdinSource.err
+	}
+	return os.ReadFile(strings.TrimPrefix(src, "file:"))
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// cmdState implements `state show|export|forget|prune|verify|migrate` on
+// STATE_FILE. It never touches the network, and reads and writes the file
+// with the same code as the poll loop.
+func cmdState(name string, args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintf(os.Stderr, "Uso: %s state show|export|forget|prune|verify|migrate [opções]\n", progName())
+		os.Exit(2)
+	}
+	sub, args := args[0], args[1:]
+	switch sub {
+	case "show":
+		cfg, _, _ := loadCommandConfig(name+" show", args, nil)
+		stateShow(cfg)
+	case "export":
+		var format string
+		cfg, _, _ := loadCommandConfig(name+" export", args, func(fs *flag.FlagSet) {
+			fs.StringVar(&format, "format", "json", "formato: json ou csv")
+		})
+		stateExport(cfg, format)
+	case "forget":
+		// the ID may come before or after the options
+		var id string
+		if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			id, args = args[0], args[1:]
+		}
+		cfg, _, rest := loadCommandConfig(name+" forget", args, nil)
+		if id == "" && len(rest) > 0 {
+			id = rest[0]
+		}
+		if strings.TrimSpace(id) == "" {
+			fmt.Fprintf(os.Stderr, "Uso: %s state forget <id> [opções]\n", progName())
+			os.Exit(2)
+		}
+		stateForget(cfg, strings.TrimSpace(id))
+	case "prune":
+		var olderThan time.Duration
+		var dryRun bool
+		cfg, _, _ := loadCommandConfig(name+" prune", args, func(fs *flag.FlagSet) {
+			fs.DurationVar(&olderThan, "older-than", 0, "remover IDs não vistos há mais do que isto (por omissão STATE_TTL_HOURS)")
+			fs.BoolVar(&dryRun, "dry-run", false, "mostrar o que seria removido sem gravar")
+		})
+		if olderThan <= 0 {
+			olderThan = cfg.StateTTL
+		}
+		if olderThan <= 0 {
+			fmt.Fprintln(os.Stderr, "indique --older-than ou STATE_TTL_HOURS")
+			os.Exit(2)
+		}
+		statePrune(cfg, olderThan, dryRun)
+	case "verify":
+		cfg, _, _ := loadCommandConfig(name+" verify", args, nil)
+		stateVerify(cfg)
+	case "migrate":
+		cfg, _, _ := loadCommandConfig(name+" migrate", args, nil)
+		stateMigrate(cfg)
+	default:
+		fmt.Fprintf(os.Stderr, "subcomando desconhecido: state %s\n", sub)
+		os.Exit(2)
+	}
+}
+
+// readStateOrExit loads the state (STATE_FILE or STATE_BACKEND) into a fresh
+// MonitorState.
+func readStateOrExit(cfg *Config) (*MonitorState, StateStore, perMuniState, perMuniSeen) {
+	ms := NewMonitorState()
+	store := cfg.stateStore()
+	st, seen, err := store.Load(ms)
+	var rec *stateRecoveredError
+	if errors.As(err, &rec) {
+		fmt.Fprintf(os.Stderr, "aviso: %v\n", rec)
+		err = nil
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro a ler %s: %v\n", store, err)
+		os.Exit(1)
+	}
+	return ms, store, st, seen
+}
+
+func saveStateOrExit(ms *MonitorState, store StateStore, st perMuniState, seen perMuniSeen) {
+	if err := store.Save(ms, st, seen); err != nil {
+		fmt.Fprintf(os.Stderr, "erro a gravar %s: %v\n", store, err)
+		os.Exit(1)
+	}
+}
+
+// stateRow is one tracked incident, as listed by show and export.
+type stateRow struct {
+	Municipio string
+	ID        string
+	Status    string
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Concluded time.Time
+	Means     *Means
+	Extra     string
+}
+
+// stateRows lists the incidents in st by municipality and ID.
+func stateRows(ms *MonitorState, st perMuniState, seen perMuniSeen) []stateRow {
+	var rows []stateRow
+	for m, set := range st {
+		for id := range set {
+			r := stateRow{Municipio: m, ID: id, LastSeen: seen[m][id], Extra: ms.Extra(id)}
+			r.Status, _ = ms.Status(id)
+			r.FirstSeen, _ = ms.FirstSeen(id)
+			r.Concluded, _ = ms.ConcludedAt(id)
+			if mn, ok := ms.Means(id); ok {
+				r.Means = &mn
+			}
+			rows = append(rows, r)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Municipio != rows[j].Municipio {
+			return rows[i].Municipio < rows[j].Municipio
+		}
+		return rows[i].ID < rows[j].ID
+	})
+	return rows
+}
+
+func stateShow(cfg *Config) {
+	ms, store, st, seen := readStateOrExit(cfg)
+	fmt.Printf("Estado: %s\n", store)
+	if hourly, daily := ms.SummaryMarks(); hourly != "" || daily != "" {
+		fmt.Printf("Último sumário horário: %s; diário: %s\n", hourly, daily)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MUNICÍPIO\tID\tESTADO\tPRIMEIRO\tÚLTIMO\tCONCLUÍDO\tMEIOS (OP/TER/AÉR/AQU)")
+	rows := stateRows(ms, st, seen)
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Municipio, r.ID, orDash(r.Status),
+			fmtStateTime(r.FirstSeen), fmtStateTime(r.LastSeen), fmtStateTime(r.Concluded), fmtStateMeans(r.Means))
+	}
+	_ = tw.Flush()
+	fmt.Printf("%d ocorrência(s) em %d município(s)\n", len(rows), len(st))
+}
+
+// stateExport writes the tracked incidents to stdout as JSON or CSV. Times
+// are RFC 3339; empty CSV cells mean unknown.
+func stateExport(cfg *Config, format string) {
+	ms, _, st, seen := readStateOrExit(cfg)
+	rows := stateRows(ms, st, seen)
+	switch strings.ToLower(format) {
+	case "json":
+		type jsonRow struct {
+			Municipio string `json:"municipio"`
+			ID        string `json:"id"`
+			Status    string `json:"status,omitempty"`
+			FirstSeen string `json:"firstSeen,omitempty"`
+			LastSeen  string `json:"lastSeen,omitempty"`
+			Concluded string `json:"concluded,omitempty"`
+			Means     *Means `json:"means,omitempty"`
+			Extra     string `json:"extra,omitempty"`
+		}
+		out := make([]jsonRow, 0, len(rows))
+		for _, r := range rows {
+			out = append(out, jsonRow{r.Municipio, r.ID, r.Status, csvTime(r.FirstSeen), csvTime(r.LastSeen),
+				csvTime(r.Concluded), r.Means, r.Extra})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			fmt.Fprintf(os.Stderr, "erro a exportar: %v\n", err)
+			os.Exit(1)
+		}
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		_ = w.Write([]string{"municipio", "id", "status", "first_seen", "last_seen", "concluded", "man", "terrain", "aerial", "aquatic", "extra"})
+		for _, r := range rows {
+			rec := []string{r.Municipio, r.ID, r.Status, csvTime(r.FirstSeen), csvTime(r.LastSeen), csvTime(r.Concluded), "", "", "", "", r.Extra}
+			if m := r.Means; m != nil {
+				rec[6], rec[7], rec[8], rec[9] = strconv.Itoa(m.Man), strconv.Itoa(m.Terrain), strconv.Itoa(m.Aerial), strconv.Itoa(m.Aquatic)
+			}
+			_ = w.Write(rec)
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			fmt.Fprintf(os.Stderr, "erro a exportar: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "--format=%q: esperado json ou csv\n", format)
+		os.Exit(2)
+	}
+}
+
+// stateForget removes one incident (given by its ID or an alias) so the
+// next poll that sees it announces it as new.
+func stateForget(cfg *Config, id string) {
+	ms, store, st, seen := readStateOrExit(cfg)
+	if target, ok := ms.aliasOf[id]; ok {
+		id = target
+	}
+	var muni string
+	for m, set := range st {
+		if _, ok := set[id]; ok {
+			muni = m
+			break
+		}
+	}
+	if muni == "" {
+		fmt.Fprintf(os.Stderr, "ID %s não está em %s\n", id, store)
+		os.Exit(1)
+	}
+	ms.forgetID(st, seen, muni, id)
+	saveStateOrExit(ms, store, st, seen)
+	fmt.Printf("%s (%s) removido de %s\n", id, muni, store)
+}
+
+func statePrune(cfg *Config, olderThan time.Duration, dryRun bool) {
+	ms, store, st, seen := readStateOrExit(cfg)
+	cutoff := cfg.now().Add(-olderThan)
+	if dryRun {
+		n := 0
+		for muni, set := range st {
+			for id := range set {
+				if ts, ok := seen[muni][id]; !ok || ts.Before(cutoff) {
+					fmt.Printf("%s\t%s\t%s\n", muni, id, fmtStateTime(ts))
+					n++
+				}
+			}
+		}
+		fmt.Printf("%d ID(s) seriam removidos\n", n)
+		return
+	}
+	n := ms.pruneSeenBefore(st, seen, cutoff)
+	saveStateOrExit(ms, store, st, seen)
+	fmt.Printf("%d ID(s) removidos de %s\n", n, store)
+}
+
+// stateVerify runs the load-time integrity check on STATE_FILE and each of
+// its backups. It exits with 1 when STATE_FILE itself is damaged.
+func stateVerify(cfg *Config) {
+	store := cfg.stateStore()
+	fs, ok := store.(fileStore)
+	if !ok {
+		fmt.Printf("%s: sem verificação (só para STATE_FILE)\n", store)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	bad := false
+	for n := 0; n <= fs.backups; n++ {
+		path := fs.path
+		if n > 0 {
+			path = stateBackupPath(fs.path, n)
+		}
+		result := "OK"
+		b, err := os.ReadFile(path)
+		if err == nil {
+			_, err = readStateFile(path)
+		}
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			result = "não existe"
+		case err != nil:
+			result = "ERRO: " + err.Error()
+			bad = bad || n == 0
+		case !bytes.HasPrefix(b, []byte(checksumPrefix)):
+			result = "OK (sem checksum)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", path, result)
+	}
+	_ = tw.Flush()
+	if bad {
+		os.Exit(1)
+	}
+}
+
+// stateMigrate rewrites the state in the current format with municipality
+// keys canonicalized against MUNICIPIOS. An original STATE_FILE is kept as
+// <file>.bak.
+func stateMigrate(cfg *Config) {
+	ms, store, st, seen := readStateOrExit(cfg)
+	fs, isFile := store.(fileStore)
+	if isFile {
+		b, err := os.ReadFile(fs.path)
+		if err == nil {
+			err = os.WriteFile(fs.path+".bak", b, 0644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "erro a criar cópia de segurança: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	st = canonicalizeStateKeys(st, cfg.wantedSet)
+	seen = canonicalizeSeenKeys(seen, cfg.wantedSet)
+	saveStateOrExit(ms, store, st, seen)
+	if isFile {
+		fmt.Printf("%s migrado (original em %s.bak)\n", fs.path, fs.path)
+	} else {
+		fmt.Printf("%s migrado\n", store)
+	}
+}
+
+func fmtStateTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.In(conf().loc).Format("2006-01-02 15:04")
+}
+
+func fmtStateMeans(m *Means) string {
+	if m == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d/%d/%d", m.Man, m.Terrain, m.Aerial, m.Aquatic)
+}
+
+// csvTime is t in RFC 3339 (BOMBEIROS_TZ), or "" when unknown.
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(conf().loc).Format(time.RFC3339)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// STATE_FILE starts with a checksum of the rest of the document:
+//
+//	{
+//	  "checksum": "sha256:…",
+//	  "aliases": …
+//
+// The line is still JSON, so the file stays readable by hand. The sum covers
+// the file as written without that line; a file without it (older versions,
+// or edited by hand with the line removed) is accepted as is.
+const (
+	checksumPrefix = "{\n  \"checksum\": \"sha256:"
+	checksumSuffix = "\",\n"
+)
+
+var errChecksum = errors.New("checksum não confere")
+
+// stateBackupPath is the n-th previous generation of path (path.1 is the
+// newest).
+func stateBackupPath(path string, n int) string {
+	return path + "." + strconv.Itoa(n)
+}
+
+// loadLastState reads STATE_FILE. When it cannot be parsed or its checksum
+// does not match, the backups are tried newest first, and the state of the
+// first good one comes with a *stateRecoveredError. A missing STATE_FILE is
+// not replaced by a backup: that is a fresh start.
+func loadLastState(ms *MonitorState, path string, backups int) (perMuniState, perMuniSeen, error) {
+	raw, err := readStateFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return perMuniState{}, perMuniSeen{}, err
+	}
+	var rec *stateRecoveredError
+	if err != nil {
+		rec = &stateRecoveredError{path: path, err: err}
+		for n := 1; n <= backups && rec.from == ""; n++ {
+			if raw, err = readStateFile(stateBackupPath(path, n)); err == nil {
+				rec.from = stateBackupPath(path, n)
+			}
+		}
+		if rec.from == "" {
+			return perMuniState{}, perMuniSeen{}, fmt.Errorf("%s: %w (sem cópia de segurança válida)", path, rec.err)
+		}
+	}
+	st, seen := decodeState(ms, raw)
+	if rec != nil {
+		return st, seen, rec
+	}
+	return st, seen, nil
+}
+
+// stateRecoveredError comes with a good state that was read from a backup
+// because STATE_FILE was damaged.
+type stateRecoveredError struct {
+	path, from string
+	err        error
+}
+
+func (e *stateRecoveredError) Error() string {
+	return fmt.Sprintf("%s: %v; estado lido de %s", e.path, e.err, e.from)
+}
+
+func (e *stateRecoveredError) Unwrap() error { return e.err }
+
+// readStateFile parses one state file and checks its checksum.
+func readStateFile(path string) (map[string]any, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	body, err := verifyStateChecksum(b)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// verifyStateChecksum strips the checksum line from b and checks it. It
+// returns b unchanged when there is no checksum line.
+func verifyStateChecksum(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, []byte(checksumPrefix)) {
+		return b, nil
+	}
+	rest := b[len(checksumPrefix):]
+	i := bytes.Index(rest, []byte(checksumSuffix))
+	if i < 0 {
+		return nil, errChecksum
+	}
+	want := string(rest[:i])
+	body := append([]byte("{\n"), rest[i+len(checksumSuffix):]...)
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != want {
+		return nil, errChecksum
+	}
+	return body, nil
+}
+
+// saveLastState writes STATE_FILE with its checksum through a temporary file
+// and a rename, so a crash leaves either the old or the new file. The file it
+// replaces becomes path.1, shifting older generations up to path.<backups>;
+// a damaged one is not kept. path.1 is a link to (or copy of) the old file
+// made before the rename, so STATE_FILE itself is never missing.
+func saveLastState(ms *MonitorState, path string, backups int, st perMuniState, seen perMuniSeen) error {
+	body, err := json.MarshalIndent(encodeState(ms, st, seen), "", "  ")
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(body)
+	b := make([]byte, 0, len(body)+100)
+	b = append(b, checksumPrefix...)
+	b = append(b, hex.EncodeToString(sum[:])...)
+	b = append(b, checksumSuffix...)
+	b = append(b, body[len("{\n"):]...)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after the rename
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if backups > 0 {
+		if _, err := readStateFile(path); err == nil {
+			for n := backups - 1; n >= 1; n-- {
+				_ = os.Rename(stateBackupPath(path, n), stateBackupPath(path, n+1))
+			}
+			if err := linkOrCopy(path, stateBackupPath(path, 1)); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// linkOrCopy makes dst a hard link to src, or a copy of it where the file
+// system has no links. An existing dst is replaced.
+func linkOrCopy(src, dst string) error {
+	if err := os.Remove(dst); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if os.Link(src, dst) == nil {
+		return nil
+	}
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, b, 0644)
+}
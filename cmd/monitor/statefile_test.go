@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// saveGeneration saves a state that tracks only id.
+func saveGeneration(t *testing.T, path string, backups int, id string) {
+	t.Helper()
+	ms := NewMonitorState()
+	ms.status[id] = "Em Curso"
+	st := perMuniState{"Sertã": {id: {}}}
+	seen := perMuniSeen{"Sertã": {id: testStart}}
+	if err := saveLastState(ms, path, backups, st, seen); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// trackedIn reads one state file and returns the ID it tracks.
+func trackedIn(t *testing.T, path string) string {
+	t.Helper()
+	raw, err := readStateFile(path)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	_, seen := decodeState(NewMonitorState(), raw)
+	for id := range seen["Sertã"] {
+		return id
+	}
+	return ""
+}
+
+func TestSaveLastStateGenerations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	for _, id := range []string{"1", "2", "3", "4"} {
+		saveGeneration(t, path, 2, id)
+	}
+	for p, want := range map[string]string{path: "4", path + ".1": "3", path + ".2": "2"} {
+		if got := trackedIn(t, p); got != want {
+			t.Errorf("%s tracks %q, want %q", filepath.Base(p), got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("generation past STATE_BACKUPS kept: %v", err)
+	}
+}
+
+func TestSaveLastStateBackupSurvivesNextSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	saveGeneration(t, path, 1, "1")
+	saveGeneration(t, path, 1, "2")
+	// path.1 may be a hard link to the old file: the next save must not
+	// write through it.
+	saveGeneration(t, path, 1, "3")
+	if got := trackedIn(t, path+".1"); got != "2" {
+		t.Errorf("path.1 tracks %q, want 2", got)
+	}
+}
+
+func TestLoadLastStateFromBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	saveGeneration(t, path, 2, "1")
+	saveGeneration(t, path, 2, "2")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// torn write: the checksum no longer matches
+	if err := os.WriteFile(path, b[:len(b)-20], 0644); err != nil {
+		t.Fatal(err)
+	}
+	ms := NewMonitorState()
+	_, seen, err := loadLastState(ms, path, 2)
+	var rec *stateRecoveredError
+	if !errors.As(err, &rec) || rec.from != path+".1" {
+		t.Fatalf("loadLastState error = %v, want recovery from %s.1", err, filepath.Base(path))
+	}
+	if !seen["Sertã"]["1"].Equal(testStart.Truncate(time.Second)) {
+		t.Errorf("recovered state = %v", seen)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// The poll loop keeps the state in memory between cycles (ms.cycleState and
+// the per-ID maps) and only writes it when something changed, at most once
+// per STATE_FLUSH_SECONDS. The store is re-read only when its stamp no longer
+// matches what the monitor last read or wrote, i.e. when STATE_FILE was
+// edited by hand or by `state prune`, or another replica saved to Redis.
+
+// StateStore is where the state lives between cycles and runs: STATE_FILE
+// (fileStore) or Redis (redisStore, STATE_BACKEND=redis). Both store the
+// document built by encodeState, so the format is the same.
+type StateStore interface {
+	Load(ms *MonitorState) (perMuniState, perMuniSeen, error)
+	Save(ms *MonitorState, st perMuniState, seen perMuniSeen) error
+	// Stamp identifies the stored version.
+	Stamp() (string, error)
+	String() string
+}
+
+// stateStore returns the store for STATE_BACKEND.
+func (c *Config) stateStore() StateStore {
+	if c.StateBackend == stateBackendRedis {
+		return redisStoreFor(c.RedisURL, c.RedisPrefix)
+	}
+	return fileStore{path: c.statePath(), backups: c.StateBackups}
+}
+
+type fileStore struct {
+	path    string
+	backups int // STATE_BACKUPS
+}
+
+func (s fileStore) Load(ms *MonitorState) (perMuniState, perMuniSeen, error) {
+	return loadLastState(ms, s.path, s.backups)
+}
+
+func (s fileStore) Save(ms *MonitorState, st perMuniState, seen perMuniSeen) error {
+	return saveLastState(ms, s.path, s.backups, st, seen)
+}
+
+func (s fileStore) Stamp() (string, error) { return fmt.Sprint(stampStateFile(s.path)), nil }
+
+func (s fileStore) String() string { return s.path }
+
+// stateFileStamp identifies one version of STATE_FILE on disk.
+type stateFileStamp struct {
+	path   string
+	exists bool
+	size   int64
+	mtime  int64 // UnixNano
+}
+
+func stampStateFile(path string) stateFileStamp {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return stateFileStamp{path: path}
+	}
+	return stateFileStamp{path: path, exists: true, size: fi.Size(), mtime: fi.ModTime().UnixNano()}
+}
+
+// loadForCycle returns the state for a new cycle: the in-memory copy, or
+// the store's when there is none yet or it changed under us. A store that
+// cannot be checked or read (Redis down, an unreadable STATE_FILE) leaves
+// the in-memory copy in use until a later cycle reads it. On the first load
+// there is no copy to fall back on, and the error is returned so the cycle
+// neither runs on an empty state nor saves one over the stored state.
+func (ms *MonitorState) loadForCycle(store StateStore) (perMuniState, perMuniSeen, error) {
+	prevSt, prevSeen := ms.cycleState, ms.cycleSeen
+	stamp, err := store.Stamp()
+	if prevSt != nil && (err != nil || stamp == ms.onDisk) {
+		if err != nil {
+			slog.Warn("estado: não foi possível verificar o armazenamento", "store", store.String(), "err", err)
+		}
+		return prevSt, prevSeen, nil
+	}
+	// Load replaces the per-ID maps only once the stored state is read, so
+	// a failed read leaves them as they were.
+	st, seen, err := store.Load(ms)
+	var rec *stateRecoveredError
+	switch {
+	case err == nil:
+	case errors.As(err, &rec):
+		slog.Warn("STATE_FILE danificado; usada a cópia de segurança", "path", rec.path, "from", rec.from, "err", rec.err)
+		ms.recovered = rec
+	case errors.Is(err, os.ErrNotExist):
+		ms.reset() // a fresh start, or the file was removed by hand
+	default:
+		slog.Error("estado: leitura falhou; mantido o estado em memória", "store", store.String(), "err", err)
+		if prevSt == nil {
+			return nil, nil, fmt.Errorf("estado não lido (%s): %w", store, err)
+		}
+		return prevSt, prevSeen, nil
+	}
+	if prevSt != nil {
+		_, shared := store.(stateLocker)
+		switch {
+		case ms.dirty:
+			slog.Warn("estado alterado fora do monitor; alterações ainda por gravar descartadas", "store", store.String())
+		case shared:
+			// the usual case for a replica on standby
+			slog.Debug("estado alterado por outra réplica; recarregado", "store", store.String())
+		default:
+			slog.Warn("estado alterado fora do monitor; recarregado", "store", store.String())
+		}
+	}
+	// a recovered state replaces the damaged file with the next save
+	ms.onDisk, ms.dirty = stamp, rec != nil
+	return st, seen, nil
+}
+
+// takeRecovered returns the alert for a STATE_FILE that loadForCycle had to
+// replace by a backup, which points at a disk or filesystem problem, and
+// clears it. Callers hold the lock and send the alert once they release it,
+// so a slow ntfy server never holds up the state.
+func (ms *MonitorState) takeRecovered() (Notification, bool) {
+	rec := ms.recovered
+	if rec == nil {
+		return Notification{}, false
+	}
+	ms.recovered = nil
+	return Notification{
+		Type:     notifyState,
+		Title:    tr("state.recovered"),
+		Body:     tr("state.rec.body", rec.path, rec.err, rec.from),
+		Tags:     "warning,floppy_disk",
+		Priority: "4",
+	}, true
+}
+
+// flush writes the state when it is dirty and STATE_FLUSH_SECONDS have
+// passed since the last write, or right away when force is set.
+// A shared store is always written right away, so a replica taking over
+// starts from the latest state.
+func (ms *MonitorState) flush(cfg *Config, store StateStore, st perMuniState, seen perMuniSeen, force bool) error {
+	if !ms.dirty {
+		return nil
+	}
+	if _, shared := store.(stateLocker); shared {
+		force = true
+	}
+	every := time.Duration(cfg.StateFlushSeconds) * time.Second
+	if !force && every > 0 && cfg.now().Sub(ms.flushedAt) < every {
+		slog.Debug("estado por gravar; aguarda STATE_FLUSH_SECONDS")
+		return nil
+	}
+	if err := store.Save(ms, st, seen); err != nil {
+		return err
+	}
+	ms.onDisk, _ = store.Stamp()
+	ms.dirty, ms.flushedAt = false, cfg.now()
+	return nil
+}
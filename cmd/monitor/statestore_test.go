@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// breakStateFile replaces STATE_FILE with a directory: it exists, so it is
+// not a fresh start, but it cannot be read.
+func breakStateFile(t *testing.T, path string) {
+	t.Helper()
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunOnceRefusesUnreadableState(t *testing.T) {
+	cfg, srv, _, ms := newTestMonitor(t, nil)
+	srv.setFeed(incident("2025050001", "Em Curso", 20))
+	mustRun(t, cfg, ms)
+	srv.take()
+
+	// a new process that cannot read what the last one saved
+	breakStateFile(t, cfg.statePath())
+	ms = NewMonitorState()
+	if _, err := runOnce(cfg, ms); err == nil {
+		t.Fatal("runOnce ran without its state")
+	}
+	if msgs := srv.take(); len(msgs) != 0 {
+		t.Errorf("announced without the state: %q", titles(msgs))
+	}
+	if fi, err := os.Stat(cfg.statePath()); err != nil || !fi.IsDir() {
+		t.Errorf("unreadable STATE_FILE replaced: %v", err)
+	}
+	if ms.cycleState != nil {
+		t.Error("cycle state set from a failed load")
+	}
+}
+
+func TestLoadForCycleKeepsStateOnReadError(t *testing.T) {
+	cfg, srv, clk, ms := newTestMonitor(t, nil)
+	srv.setFeed(incident("2025050001", "Em Curso", 20))
+	mustRun(t, cfg, ms)
+	srv.take()
+
+	breakStateFile(t, cfg.statePath())
+	clk.advance(time.Minute)
+	mustRun(t, cfg, ms)
+	if msgs := srv.take(); len(msgs) != 0 {
+		t.Errorf("state dropped after a failed reload: %q", titles(msgs))
+	}
+	if s, ok := ms.Status("2025050001"); !ok || s != "Em Curso" {
+		t.Errorf("status after a failed reload = %q, %v", s, ok)
+	}
+}
+
+func TestLoadForCycleFreshStartWhenRemoved(t *testing.T) {
+	cfg, srv, _, ms := newTestMonitor(t, nil)
+	srv.setFeed(incident("2025050001", "Em Curso", 20))
+	mustRun(t, cfg, ms)
+	srv.take()
+
+	if err := os.Remove(cfg.statePath()); err != nil {
+		t.Fatal(err)
+	}
+	st, _, err := ms.loadForCycle(cfg.stateStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st) != 0 {
+		t.Errorf("state after STATE_FILE was removed = %v", st)
+	}
+	if _, ok := ms.Status("2025050001"); ok {
+		t.Error("per-ID maps kept after STATE_FILE was removed")
+	}
+}
+
+func TestDiscardReloadsOnNextCycle(t *testing.T) {
+	cfg, srv, clk, ms := newTestMonitor(t, nil)
+	srv.setFeed(incident("2025050001", "Em Curso", 20))
+	mustRun(t, cfg, ms)
+	srv.take()
+
+	discardInMemoryState(ms)
+	clk.advance(time.Minute)
+	mustRun(t, cfg, ms)
+	if msgs := srv.take(); len(msgs) != 0 {
+		t.Errorf("after a discarded cycle: %q", titles(msgs))
+	}
+}
+
+// lockProbe is a transport that notes the ntfy posts made while ms is
+// locked.
+type lockProbe struct {
+	next   http.RoundTripper
+	ms     *MonitorState
+	locked atomic.Int32
+}
+
+func (p *lockProbe) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Method == http.MethodPost {
+		if p.ms.mu.TryRLock() {
+			p.ms.mu.RUnlock()
+		} else {
+			p.locked.Add(1)
+		}
+	}
+	return p.next.RoundTrip(r)
+}
+
+// TestStateRecoveredAlert: a STATE_FILE read from its backup is reported,
+// and the alert is posted once the state is unlocked.
+func TestStateRecoveredAlert(t *testing.T) {
+	cfg, srv, clk, ms := newTestMonitor(t, nil)
+	srv.setFeed(incident("2025050001", "Em Curso", 20))
+	mustRun(t, cfg, ms)
+	// a second save, so STATE_FILE.1 holds a good copy
+	clk.advance(time.Minute)
+	srv.setFeed(incident("2025050001", "Em Resolução", 20))
+	mustRun(t, cfg, ms)
+	srv.take()
+	b, err := os.ReadFile(cfg.statePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfg.statePath(), b[:len(b)-20], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ms = NewMonitorState()
+	probe := &lockProbe{next: srv.Client().Transport, ms: ms}
+	cfg.useRoundTripper(probe)
+	mustRun(t, cfg, ms)
+	// the backup is one save older, so the last change is announced again
+	if got := titles(srv.take()); !slices.Equal(got, []string{tr("state.recovered"), "Em Curso → Em Resolução — Sertã — Mato"}) {
+		t.Errorf("after the recovery: %q", got)
+	}
+	if n := probe.locked.Load(); n != 0 {
+		t.Errorf("%d posts while the state was locked", n)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// summaryCounts is what a periodic summary reported. The last hourly and
+// daily ones are kept in the state (summary_base) so the next one can show
+// deltas; without one, the first summary has no deltas rather than comparing
+// against zero.
+type summaryCounts struct {
+	Total     int              `json:"total"`
+	Conc      map[string]int   `json:"concelho"`
+	Nat       map[string]int   `json:"natureza"`
+	Sta       map[string]int   `json:"status"`
+	Means     Means            `json:"means"`          // committed across the filtered set
+	ConcMeans map[string]Means `json:"concelho_means"` // the same per concelho
+}
+
+func countSummary(filtered []Feature) *summaryCounts {
+	c := &summaryCounts{Total: len(filtered), Conc: map[string]int{}, Nat: map[string]int{}, Sta: map[string]int{}, ConcMeans: map[string]Means{}}
+	for _, f := range filtered {
+		p := f.Properties
+		c.Conc[getPropStr(p, "concelho")]++
+		c.Nat[getPropStr(p, "natureza")]++
+		c.Sta[getPropStr(p, "status")]++
+		// the same parsing as the means-change messages
+		m := meansFromProps(p)
+		c.Means = c.Means.add(m)
+		c.ConcMeans[getPropStr(p, "concelho")] = c.ConcMeans[getPropStr(p, "concelho")].add(m)
+	}
+	return c
+}
+
+// add is the sum of each kind of means in m and o.
+func (m Means) add(o Means) Means {
+	return Means{Man: m.Man + o.Man, Terrain: m.Terrain + o.Terrain, Aerial: m.Aerial + o.Aerial, Aquatic: m.Aquatic + o.Aquatic}
+}
+
+// meansLines renders the committed means and the operatives of the top
+// limit concelhos, or "" when nothing is committed.
+func (c *summaryCounts) meansLines(limit int, sep string) string {
+	if c.Means == (Means{}) {
+		return ""
+	}
+	line := tr("summary.means", c.Means.Man, c.Means.Terrain, c.Means.Aerial)
+	if c.Means.Aquatic > 0 {
+		line += tr("summary.aquatic", c.Means.Aquatic)
+	}
+	man := map[string]int{}
+	for k, m := range c.ConcMeans {
+		if m.Man > 0 {
+			man[k] = m.Man
+		}
+	}
+	parts := []string{}
+	for _, k := range sortedCounts(man) {
+		if len(parts) >= limit {
+			break
+		}
+		parts = append(parts, tr("summary.conc.man", k, man[k]))
+	}
+	if len(parts) > 0 {
+		line += "\n" + tr("summary.byconc", strings.Join(parts, sep))
+	}
+	return line
+}
+
+// deltaSuffix renders " (+2)" / " (−1)", or "" without a previous summary or change.
+func deltaSuffix(cur, prev int, hasPrev bool) string {
+	switch d := cur - prev; {
+	case !hasPrev || d == 0:
+		return ""
+	case d > 0:
+		return fmt.Sprintf(" (+%d)", d)
+	default:
+		return fmt.Sprintf(" (−%d)", -d)
+	}
+}
+
+// fmtCounts lists the top limit entries by count as "Sertã: 3 (+2)". Entries
+// that dropped out since prev are listed last as "Oleiros: 0 (−1)".
+func fmtCounts(m, prev map[string]int, limit int, sep string) string {
+	parts := []string{}
+	for _, k := range sortedCounts(m) {
+		if len(parts) >= limit {
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%s: %d", k, m[k])+deltaSuffix(m[k], prev[k], prev != nil))
+	}
+	for _, k := range sortedCounts(prev) {
+		if _, ok := m[k]; !ok && len(parts) < limit {
+			parts = append(parts, fmt.Sprintf("%s: 0", k)+deltaSuffix(0, prev[k], true))
+		}
+	}
+	if len(parts) == 0 {
+		return tr("summary.none")
+	}
+	return strings.Join(parts, sep)
+}
+
+// summaryBody renders the active total, the means and the groups, with
+// deltas against prev.
+func (c *summaryCounts) body(prev *summaryCounts, limit int, sep string) string {
+	var pc, pn, ps map[string]int
+	ptotal := 0
+	if prev != nil {
+		pc, pn, ps, ptotal = prev.Conc, prev.Nat, prev.Sta, prev.Total
+	}
+	body := tr("summary.active", c.Total) + deltaSuffix(c.Total, ptotal, prev != nil) + "\n"
+	if ml := c.meansLines(limit, sep); ml != "" {
+		body += ml + "\n"
+	}
+	return body + tr("summary.groups", fmtCounts(c.Conc, pc, limit, sep), fmtCounts(c.Nat, pn, limit, sep), fmtCounts(c.Sta, ps, limit, sep))
+}
+
+// trendTag adds an arrow when the total moved by at least SUMMARY_TREND_MIN.
+func trendTag(cfg *Config, tags string, c, prev *summaryCounts) string {
+	if prev == nil || cfg.SummaryTrendMin <= 0 {
+		return tags
+	}
+	switch d := c.Total - prev.Total; {
+	case d >= cfg.SummaryTrendMin:
+		return addTag(tags, "arrow_up")
+	case -d >= cfg.SummaryTrendMin:
+		return addTag(tags, "arrow_down")
+	}
+	return tags
+}
+
+// summaryNotification renders a summary of cur (deltas against prev) with the
+// base tags minus fire plus tag.
+func summaryNotification(cfg *Config, title string, cur, prev *summaryCounts, limit int, sep, tag string) Notification {
+	tags := addTag(stripTagCSV(cfg.NtfyTags, "fire"), tag)
+	return Notification{Type: notifySummary, Title: title, Body: cur.body(prev, limit, sep), Tags: trendTag(cfg, tags, cur, prev), Priority: "3"}
+}
+
+// summaryRequests asks the poll goroutine for an immediate summary (POST
+// /api/summary, SIGUSR1). One pending request is enough.
+var summaryRequests = make(chan struct{}, 1)
+
+func requestSummary(source string) {
+	select {
+	case summaryRequests <- struct{}{}:
+		slog.Info("sumário pedido", "source", source)
+	default:
+	}
+}
+
+// sendSummaryNow sends the hourly summary for the last cycle's incidents,
+// even with none active, through dispatch like the scheduled one. It runs
+// on the poll goroutine and leaves ms.lastHourlyMark and the delta baseline
+// alone, so the scheduled one still fires.
+func sendSummaryNow(cfg *Config, ms *MonitorState) {
+	cur := countSummary(lastCycleFiltered)
+	title := tr("summary.ondemand", cfg.now().In(cfg.loc).Format("15:04"))
+	prev, _ := ms.SummaryBase()
+	dispatch(cfg.NtfyURL, cfg.NtfyTopic, summaryNotification(cfg, title, cur, prev, 6, ", ", "bar_chart"))
+}
+
+// registerSummaryAPI serves POST /api/summary. It is only registered behind
+// HTTP_AUTH_TOKEN or basic auth, which requireAuth enforces.
+func registerSummaryAPI(mux *http.ServeMux, cfg *Config) {
+	if cfg.HTTPAuthToken == "" && cfg.HTTPBasicUser == "" {
+		return
+	}
+	mux.HandleFunc("POST /api/summary", func(w http.ResponseWriter, r *http.Request) {
+		requestSummary("http")
+		w.WriteHeader(http.StatusAccepted)
+		writeJSON(w, time.Time{}, map[string]any{"queued": true})
+	})
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"flag"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendSummaryNowUsesClockAndDispatch(t *testing.T) {
+	cfg, srv, _, ms := newTestMonitor(t, nil)
+	srv.setFeed(incident("2025050001", "Em Curso", 20))
+	mustRun(t, cfg, ms)
+	srv.take()
+
+	notifyPause.pause(0)
+	sendSummaryNow(cfg, ms)
+	notifyPause.resume()
+	if msgs := srv.take(); len(msgs) != 0 {
+		t.Errorf("sent while paused: %q", titles(msgs))
+	}
+
+	sendSummaryNow(cfg, ms)
+	msgs := srv.take()
+	if len(msgs) != 1 {
+		t.Fatalf("got %q, want one summary", titles(msgs))
+	}
+	// 15:20 UTC on the test clock is 16:20 in Lisbon
+	if msgs[0].Title != "Sumário (16:20)" || !strings.Contains(msgs[0].Message, "Sertã") {
+		t.Errorf("summary %q:\n%s", msgs[0].Title, msgs[0].Message)
+	}
+}
+
+// hourlySummaries returns the hourly summaries among msgs.
+func hourlySummaries(msgs []posted) []posted {
+	var out []posted
+	for _, m := range msgs {
+		if strings.HasPrefix(m.Title, "Sumário horário") {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func TestSummaryBaselineOnlyFromSentSummaries(t *testing.T) {
+	cfg, srv, clk, ms := newTestMonitor(t, map[string]string{"SUMMARY_HOURLY": "1"})
+	srv.setFeed(incident("2025050001", "Em Curso", 20))
+	mustRun(t, cfg, ms)
+	sums := hourlySummaries(srv.take())
+	if len(sums) != 1 || !strings.HasPrefix(sums[0].Message, "Ativos: 1\n") {
+		t.Fatalf("first hour: %v", sums)
+	}
+
+	// an hour with nothing active sends no summary and keeps the baseline
+	clk.advance(time.Hour)
+	srv.setFeed()
+	mustRun(t, cfg, ms)
+	if sums := hourlySummaries(srv.take()); len(sums) != 0 {
+		t.Fatalf("summary with nothing active: %v", sums)
+	}
+	if prev, _ := ms.SummaryBase(); prev == nil || prev.Total != 1 {
+		t.Fatalf("baseline after an hour without a summary = %+v", prev)
+	}
+
+	// and it survives a restart
+	clk.advance(time.Hour)
+	ms = NewMonitorState()
+	srv.setFeed(incident("2025050001", "Em Curso", 20), incident("2025050002", "Despacho", 4))
+	mustRun(t, cfg, ms)
+	sums = hourlySummaries(srv.take())
+	if len(sums) != 1 || !strings.HasPrefix(sums[0].Message, "Ativos: 2 (+1)\n") {
+		t.Fatalf("after a restart: %v", sums)
+	}
+}
+
+// summaryTitles returns the titles of the summaries among msgs that start
+// with prefix.
+func summaryTitles(msgs []posted, prefix string) []string {
+	var out []string
+	for _, m := range msgs {
+		if strings.HasPrefix(m.Title, prefix) {
+			out = append(out, m.Title)
+		}
+	}
+	return out
+}
+
+// pollAt runs one cycle at the UTC time at and returns the titles of the
+// summaries starting with prefix that it sent.
+func pollAt(t *testing.T, cfg *Config, srv *testServer, clk *testClock, ms *MonitorState, at time.Time, prefix string) []string {
+	t.Helper()
+	clk.set(at)
+	mustRun(t, cfg, ms)
+	return summaryTitles(srv.take(), prefix)
+}
+
+// TestDailySummaryAcrossDST: the daily summary goes out from 08:00 on the
+// BOMBEIROS_TZ wall clock, which is 08:00 UTC in winter and 07:00 UTC in
+// summer, on the days the clocks change too.
+func TestDailySummaryAcrossDST(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		before, at time.Time // UTC
+		wantTitle  string
+	}{
+		// 2025-03-30 01:00 UTC: 01:00 WET becomes 02:00 WEST
+		{"spring forward", time.Date(2025, 3, 30, 6, 59, 0, 0, time.UTC), time.Date(2025, 3, 30, 7, 0, 0, 0, time.UTC), "Sumário diário (2025-03-30)"},
+		// 2025-10-26 01:00 UTC: 02:00 WEST becomes 01:00 WET
+		{"fall back", time.Date(2025, 10, 26, 7, 59, 0, 0, time.UTC), time.Date(2025, 10, 26, 8, 0, 0, 0, time.UTC), "Sumário diário (2025-10-26)"},
+		{"day before spring forward", time.Date(2025, 3, 29, 7, 59, 0, 0, time.UTC), time.Date(2025, 3, 29, 8, 0, 0, 0, time.UTC), "Sumário diário (2025-03-29)"},
+		{"day after fall back", time.Date(2025, 10, 27, 7, 59, 0, 0, time.UTC), time.Date(2025, 10, 27, 8, 0, 0, 0, time.UTC), "Sumário diário (2025-10-27)"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cfg, srv, clk, ms := newTestMonitor(t, map[string]string{"SUMMARY_DAILY": "1"})
+			srv.setFeed(incident("2025050001", "Em Curso", 20))
+			// midday the day before, so the mark is set
+			if got := pollAt(t, cfg, srv, clk, ms, c.at.Add(-20*time.Hour), "Sumário diário"); len(got) != 1 {
+				t.Fatalf("day before: %q", got)
+			}
+			if got := pollAt(t, cfg, srv, clk, ms, c.before, "Sumário diário"); len(got) != 0 {
+				t.Errorf("07:59 local: %q", got)
+			}
+			if got := pollAt(t, cfg, srv, clk, ms, c.at, "Sumário diário"); !slices.Equal(got, []string{c.wantTitle}) {
+				t.Errorf("08:00 local: %q, want %q", got, c.wantTitle)
+			}
+			if got := pollAt(t, cfg, srv, clk, ms, c.at.Add(3*time.Hour), "Sumário diário"); len(got) != 0 {
+				t.Errorf("later the same day: %q", got)
+			}
+		})
+	}
+}
+
+// TestHourlySummaryAcrossDST: the skipped hour of spring forward does not
+// block the next one, and the repeated hour of fall back gets one summary.
+func TestHourlySummaryAcrossDST(t *testing.T) {
+	cfg, srv, clk, ms := newTestMonitor(t, map[string]string{"SUMMARY_HOURLY": "1"})
+	srv.setFeed(incident("2025050001", "Em Curso", 20))
+	for _, p := range []struct {
+		at   time.Time // UTC
+		want []string
+	}{
+		{time.Date(2025, 3, 30, 0, 30, 0, 0, time.UTC), []string{"Sumário horário (00:00)"}},  // 00:30 WET
+		{time.Date(2025, 3, 30, 1, 30, 0, 0, time.UTC), []string{"Sumário horário (02:00)"}},  // 02:30 WEST
+		{time.Date(2025, 10, 26, 0, 30, 0, 0, time.UTC), []string{"Sumário horário (01:00)"}}, // 01:30 WEST
+		{time.Date(2025, 10, 26, 1, 30, 0, 0, time.UTC), nil},                                 // 01:30 WET again
+		{time.Date(2025, 10, 26, 2, 5, 0, 0, time.UTC), []string{"Sumário horário (02:00)"}},
+	} {
+		if got := pollAt(t, cfg, srv, clk, ms, p.at, "Sumário horário"); !slices.Equal(got, p.want) {
+			t.Errorf("%s: %q, want %q", p.at.Format(time.RFC3339), got, p.want)
+		}
+	}
+}
+
+func TestBombeirosTZ(t *testing.T) {
+	cfg, _ := testConfig(t, map[string]string{"BOMBEIROS_TZ": "Atlantic/Azores"})
+	// the Azores are UTC-1 in winter
+	winter := time.Date(2025, 1, 14, 15, 20, 0, 0, time.UTC)
+	if got := prettyTime(map[string]any{"sec": float64(winter.Unix())}); got != "14-01 14:20" {
+		t.Errorf("prettyTime = %q", got)
+	}
+	if cfg.loc.String() != "Atlantic/Azores" {
+		t.Errorf("loc = %s", cfg.loc)
+	}
+
+	t.Setenv("BOMBEIROS_TZ", "Europe/Lisboa")
+	_, err := newConfigLoader(flag.NewFlagSet("test", flag.ContinueOnError)).build(true)
+	if err == nil || !strings.Contains(err.Error(), `BOMBEIROS_TZ="Europe/Lisboa"`) {
+		t.Errorf("unknown zone: err = %v", err)
+	}
+}
+
+// TestSummariesOffMinuteZero: polls that never land on minute 0 still get
+// exactly one hourly summary per hour, and the daily one at 08:03.
+func TestSummariesOffMinuteZero(t *testing.T) {
+	cfg, srv, clk, ms := newTestMonitor(t, map[string]string{"SUMMARY_HOURLY": "1", "SUMMARY_DAILY": "1"})
+	srv.setFeed(incident("2025050001", "Em Curso", 20))
+	at := func(h, m int) time.Time { return time.Date(2025, 8, 14, h, m, 0, 0, cfg.loc) }
+	for _, p := range []struct {
+		at      time.Time
+		restart bool
+		want    []string
+	}{
+		{at(8, 3), false, []string{"Sumário horário (08:00)", "Sumário diário (2025-08-14)"}},
+		{at(9, 1), false, []string{"Sumário horário (09:00)"}},
+		{at(9, 31), false, nil},
+		{at(9, 47), true, nil}, // the marks come from the state file
+		{at(10, 2), false, []string{"Sumário horário (10:00)"}},
+		// a three-hour outage: one summary for the hour the polls resume
+		{at(13, 58), false, []string{"Sumário horário (13:00)"}},
+	} {
+		if p.restart {
+			ms = NewMonitorState()
+		}
+		if got := pollAt(t, cfg, srv, clk, ms, p.at, "Sumário"); !slices.Equal(got, p.want) {
+			t.Errorf("%s: %q, want %q", p.at.Format("15:04"), got, p.want)
+		}
+	}
+}
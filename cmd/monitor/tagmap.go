@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// defaultTags maps semantic event keys to the ntfy tags used when TAGS_MAP
+// does not override them.
+var defaultTags = map[string]string{
+	"man_threshold":     "busts_in_silhouette",
+	"terrain_threshold": "deciduous_tree",
+	"aerial":            "small_airplane",
+	"aquatic":           "ocean",
+	"helicopter":        "helicopter",
+	"plane":             "airplane",
+	"important":         "exclamation",
+	"concluded":         "white_check_mark",
+	"reactivated":       "repeat",
+	"road_closed":       "no_entry",
+	"reopened":          "white_check_mark",
+	"source_112":        "telephone",
+	"source_popular":    "busts_in_silhouette",
+}
+
+// loadTagsMap reads TAGS_MAP, a JSON object of event key to tag (a CSV adds
+// several, "" drops the tag). Unknown keys are an error so a typo is caught
+// at startup instead of silently keeping the default.
+func loadTagsMap(path string) (map[string]string, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("TAGS_MAP: %w", err)
+	}
+	var m map[string]string
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("TAGS_MAP %s: %w", path, err)
+	}
+	var unknown []string
+	for k := range m {
+		if _, ok := defaultTags[k]; !ok {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("TAGS_MAP %s: chaves desconhecidas %s (válidas: %s)", path, strings.Join(unknown, ", "), strings.Join(tagKeys(), ", "))
+	}
+	return m, nil
+}
+
+func tagKeys() []string {
+	keys := make([]string, 0, len(defaultTags))
+	for k := range defaultTags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// tagFor returns the tag(s) configured for an event key.
+func tagFor(key string) string {
+	if t, ok := conf().tags[key]; ok {
+		return t
+	}
+	return defaultTags[key]
+}
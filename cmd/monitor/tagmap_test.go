@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTagsMap writes a TAGS_MAP file and returns its path.
+func writeTagsMap(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tags.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadTagsMap(t *testing.T) {
+	m, err := loadTagsMap(writeTagsMap(t, `{"terrain_threshold": "fire_engine", "important": ""}`))
+	if err != nil || m["terrain_threshold"] != "fire_engine" || m["important"] != "" || len(m) != 2 {
+		t.Errorf("valid map: %v, %v", m, err)
+	}
+	if m, err := loadTagsMap(""); m != nil || err != nil {
+		t.Errorf("no TAGS_MAP: %v, %v", m, err)
+	}
+	for _, c := range []struct{ name, content, want string }{
+		{"typo", `{"terain_threshold": "fire_engine", "aerial": "helicopter", "roadclosed": "x"}`, "chaves desconhecidas roadclosed, terain_threshold"},
+		{"not an object", `["aerial"]`, "TAGS_MAP"},
+		{"not a string", `{"aerial": 1}`, "TAGS_MAP"},
+	} {
+		if _, err := loadTagsMap(writeTagsMap(t, c.content)); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: err = %v, want it to mention %q", c.name, err, c.want)
+		}
+	}
+	if _, err := loadTagsMap(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing file: no error")
+	}
+}
+
+func TestTagsMapUnknownKeyFailsStartup(t *testing.T) {
+	testConfig(t, nil)
+	t.Setenv("TAGS_MAP", writeTagsMap(t, `{"helicoptr": "helicopter"}`))
+	_, err := newConfigLoader(flag.NewFlagSet("test", flag.ContinueOnError)).build(true)
+	if err == nil || !strings.Contains(err.Error(), "helicoptr") {
+		t.Errorf("config with a typo in TAGS_MAP: err = %v", err)
+	}
+}
+
+func TestTagsMapApplied(t *testing.T) {
+	path := writeTagsMap(t, `{
+		"terrain_threshold": "fire_engine",
+		"aerial": "helicopter,warning",
+		"important": "",
+		"road_closed": "construction"
+	}`)
+	p := map[string]any{"man": 40, "terrain": 12, "aerial": 2, "important": true}
+	for _, c := range []struct {
+		name     string
+		tagsMap  string
+		wantTags string
+		wantRoad string
+	}{
+		{"defaults", "", "fire,busts_in_silhouette,deciduous_tree,small_airplane,exclamation", "no_entry"},
+		{"mapped", path, "fire,busts_in_silhouette,fire_engine,helicopter,warning", "construction"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			testConfig(t, map[string]string{"TAGS_MAP": c.tagsMap, "MIN_MAN": "30", "MIN_TERRAIN": "10", "MIN_AERIAL": "1"})
+			tags, prio := enrichMeansTagsAndPriority(p, "fire", "3")
+			if tags != c.wantTags {
+				t.Errorf("tags = %q, want %q", tags, c.wantTags)
+			}
+			// a tag mapped to "" is dropped, the priority still goes up
+			if prio != "5" {
+				t.Errorf("priority = %q, want 5", prio)
+			}
+			if got, _ := parseExtraTags("EN2 cortada ao trânsito"); strings.Join(got, ",") != c.wantRoad {
+				t.Errorf("road tags = %q, want %q", got, c.wantRoad)
+			}
+		})
+	}
+}
+
+func TestTagsMapKeysAreUsed(t *testing.T) {
+	var src strings.Builder
+	files, _ := filepath.Glob("*.go")
+	for _, f := range files {
+		if strings.HasSuffix(f, "_test.go") {
+			continue
+		}
+		b, _ := os.ReadFile(f)
+		src.Write(b)
+	}
+	for _, k := range tagKeys() {
+		if !strings.Contains(src.String(), `tagFor("`+k+`")`) {
+			t.Errorf("TAGS_MAP key %q is never looked up", k)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// timelineMax caps the status steps kept per incident; the oldest go first.
+const timelineMax = 30
+
+// statusStep is one entry of an incident's status timeline.
+type statusStep struct {
+	Status string    `json:"status"`
+	At     time.Time `json:"at"`
+}
+
+// recordStatus appends status to the timeline of id unless it is already
+// the latest step, and reports whether it did. The feed's updated time is
+// used when it is plausible, so a slow poll does not shift the step.
+func (ms *MonitorState) recordStatus(id, status string, p map[string]any, now time.Time) bool {
+	steps := ms.timeline[id]
+	if n := len(steps); n > 0 && steps[n-1].Status == status {
+		return false
+	}
+	at := now
+	if t, ok := feedTime(p["updated"]); ok && !t.After(now) {
+		at = t
+	}
+	if n := len(steps); n > 0 && at.Before(steps[n-1].At) {
+		at = steps[n-1].At
+	}
+	steps = append(steps, statusStep{Status: status, At: at.UTC().Truncate(time.Second)})
+	if len(steps) > timelineMax {
+		steps = slices.Delete(steps, 0, len(steps)-timelineMax)
+	}
+	ms.timeline[id] = steps
+	return true
+}
+
+// leftStatus is the status id just left and how long it stayed there, for
+// bombeiros_status_duration_seconds; call it after recordStatus added a
+// step. ok is false when the entry into that status was not seen: there is
+// no earlier step (a state file without a timeline), or the earlier step is
+// the incident's first and not a Despacho, so it was already under way when
+// first seen.
+func (ms *MonitorState) leftStatus(id string) (status string, d time.Duration, ok bool) {
+	steps := ms.timeline[id]
+	n := len(steps)
+	if n < 2 {
+		return "", 0, false
+	}
+	from, to := steps[n-2], steps[n-1]
+	if n == 2 && !strings.Contains(strings.ToLower(stripAccents(from.Status)), "despacho") {
+		return "", 0, false
+	}
+	if d = to.At.Sub(from.At); d <= 0 {
+		return "", 0, false
+	}
+	return from.Status, d, true
+}
+
+// formatTimeline renders "Despacho 14:02 → Em Curso 14:18 → Conclusão
+// 19:05", with the date on steps from another day than the last one.
+func formatTimeline(steps []statusStep, loc *time.Location) string {
+	if len(steps) == 0 {
+		return ""
+	}
+	lastDay := steps[len(steps)-1].At.In(loc).Format("2006-01-02")
+	parts := make([]string, len(steps))
+	for i, s := range steps {
+		t := s.At.In(loc)
+		layout := "15:04"
+		if t.Format("2006-01-02") != lastDay {
+			layout = "02/01 15:04"
+		}
+		parts[i] = s.Status + " " + t.Format(layout)
+	}
+	return strings.Join(parts, " → ")
+}
+
+// timelineLine is the "Cronologia" line of a conclusion notification, or
+// "" for other statuses or an incident seen in one status only.
+func (ms *MonitorState) timelineLine(cfg *Config, id, status string) string {
+	steps := ms.timeline[id]
+	if !isConcludedStatus(status) || len(steps) < 2 {
+		return ""
+	}
+	return tr("timeline.line", formatTimeline(steps, cfg.loc))
+}
+
+// medianDispatchTime is the median time incidents spent in Despacho, over
+// the steps that left it in the 24 hours before now.
+func (ms *MonitorState) medianDispatchTime(now time.Time) (time.Duration, int) {
+	var ds []time.Duration
+	from := now.Add(-24 * time.Hour)
+	for _, steps := range ms.timeline {
+		for i := 0; i+1 < len(steps); i++ {
+			next := steps[i+1]
+			if strings.Contains(strings.ToLower(stripAccents(steps[i].Status)), "despacho") && !next.At.Before(from) {
+				ds = append(ds, next.At.Sub(steps[i].At))
+			}
+		}
+	}
+	if len(ds) == 0 {
+		return 0, 0
+	}
+	slices.Sort(ds)
+	mid := len(ds) / 2
+	if len(ds)%2 == 0 {
+		return (ds[mid-1] + ds[mid]) / 2, len(ds)
+	}
+	return ds[mid], len(ds)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OpenTelemetry traces: one span per poll cycle with children for fetch,
+// parse, filter, state load/save and each notification. Nothing is exported
+// unless OTEL_EXPORTER_OTLP_ENDPOINT (or ..._TRACES_ENDPOINT) is set; until
+// then the global provider is the SDK's no-op and starting a span costs a
+// couple of allocations. The exporter reads the other OTEL_* variables
+// (headers, timeout, TLS) itself.
+
+// tracer picks up the provider installed by setupTracing.
+var tracer = otel.Tracer("github.com/5TUM8L3/bombeiros-serta/cmd/monitor")
+
+// flushTraces sends the spans still buffered and stops the exporter. It is
+// also called before the exits that skip deferred functions.
+var flushTraces = func() {}
+
+// setupTracing installs the OTLP/HTTP exporter when configured.
+func setupTracing() {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return
+	}
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return
+	}
+	proto := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if proto == "" {
+		proto = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	if proto != "" && proto != "http/protobuf" {
+		slog.Warn("OTEL_EXPORTER_OTLP_PROTOCOL não suportado; a usar http/protobuf", "protocol", proto)
+	}
+	ctx := context.Background()
+	exp, err := otlptracehttp.New(ctx)
+	if err != nil {
+		slog.Error("OpenTelemetry: exportador não criado; traces desligados", "err", err)
+		return
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			attribute.String("service.name", "bombeiros-monitor"),
+			attribute.String("service.version", version),
+		),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		slog.Warn("OpenTelemetry: atributos do recurso incompletos", "err", err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Debug("OpenTelemetry", "err", err)
+	}))
+	slog.Info("OpenTelemetry: traces ativos")
+	flushTraces = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			slog.Warn("OpenTelemetry: traces por enviar ao terminar", "err", err)
+		}
+	}
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
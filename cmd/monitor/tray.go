@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// trayControl carries the callbacks the tray menu can trigger in the monitor
+// and the channel of cycle results it displays.
+type trayControl struct {
+	Quit     func()
+	Reload   func()
+	CheckNow func()
+	Pause    func(d time.Duration) // d <= 0 pauses until Resume
+	Resume   func()
+	Updates  <-chan cycleReport
+}
+
+// cycleReport summarizes one poll cycle for the tray.
+type cycleReport struct {
+	At        time.Time
+	Active    int
+	Err       error
+	Incidents []trayIncident // most means first, at most trayMaxIncidents
+}
+
+// trayIncident is one entry of the tray's incident submenu.
+type trayIncident struct {
+	Label string // "Sertã — Mato — Em Curso (34 op.)"
+	URL   string // fogos.pt page, or Google Maps when there is no ID
+}
+
+const trayMaxIncidents = 15
+
+// newCycleReport builds the tray report from the filtered features of the
+// last completed cycle.
+func newCycleReport(filtered []Feature, err error) cycleReport {
+	r := cycleReport{At: conf().now(), Active: len(filtered), Err: err}
+	feats := slices.Clone(filtered)
+	// Severity: more operacionais first, then more aerial means.
+	sort.SliceStable(feats, func(i, j int) bool {
+		a, b := meansFromProps(feats[i].Properties), meansFromProps(feats[j].Properties)
+		if a.Man != b.Man {
+			return a.Man > b.Man
+		}
+		return a.Aerial > b.Aerial
+	})
+	if len(feats) > trayMaxIncidents {
+		feats = feats[:trayMaxIncidents]
+	}
+	for _, f := range feats {
+		p := f.Properties
+		muni := getMunicipio(p)
+		label := strings.Join(nonEmpty(muni, getPropStr(p, "natureza"), getPropStr(p, "status")), " — ")
+		if m := meansFromProps(p).Man; m > 0 {
+			label += fmt.Sprintf(" (%d op.)", m)
+		}
+		u := ""
+		if id := getID(p); id != "" {
+			u = "https://fogos.pt/fogo/" + id
+		} else if lat, lon, ok := getCoords(f.Geometry); ok {
+			u = fmt.Sprintf("https://www.google.com/maps/search/?api=1&query=%f,%f", lat, lon)
+		}
+		r.Incidents = append(r.Incidents, trayIncident{Label: label, URL: u})
+	}
+	return r
+}
+
+func nonEmpty(parts ...string) []string {
+	out := parts[:0]
+	for _, p := range parts {
+		if strings.TrimSpace(p) != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// sendLatest replaces any unread report so the tray only ever sees the newest one
+// and the poll loop never blocks on it.
+func sendLatest(ch chan cycleReport, r cycleReport) {
+	select {
+	case <-ch:
+	default:
+	}
+	select {
+	case ch <- r:
+	default:
+	}
+}
+
+// trayText returns the tray title and tooltip for the last cycle report (zero
+// before the first cycle) and the current notification pause.
+func trayText(r cycleReport) (title, tooltip string) {
+	title = "Bombeiros Monitor"
+	if r.Active > 0 {
+		title = fmt.Sprintf("Bombeiros Monitor (%d)", r.Active)
+	}
+	switch at := r.At.Format("15:04"); {
+	case r.At.IsZero():
+		tooltip = "Monitor de ocorrências — a aguardar a primeira verificação"
+	case r.Err != nil:
+		tooltip = fmt.Sprintf("%d ativos — erro na verificação das %s", r.Active, at)
+	default:
+		tooltip = fmt.Sprintf("%d ativos — última verificação %s", r.Active, at)
+	}
+	if paused, until := notifyPause.status(); paused {
+		if until.IsZero() {
+			tooltip += "\nNotificações em pausa"
+		} else {
+			tooltip += "\nNotificações em pausa até " + until.Format("15:04")
+		}
+	}
+	return title, tooltip
+}
@@ -1,12 +1,16 @@
-//go:build !windows
+//go:build !windows && !(tray && (linux || darwin))
 // +build !windows
+// +build !tray !linux,!darwin
 
 package main
 
-// StartTray is a no-op on non-Windows platforms; present to satisfy cross-platform builds.
-func StartTray(onQuit func()) {
-	// Not supported on this platform. If ever called, just invoke onQuit to exit gracefully.
-	if onQuit != nil {
-		onQuit()
+// trayBuilt is false: this binary was built without the tray (see tray_systray.go).
+const trayBuilt = false
+
+// StartTray is a no-op on platforms built without the tray; present to satisfy cross-platform builds.
+func StartTray(ctl trayControl) {
+	// Not supported on this platform. If ever called, just invoke Quit to exit gracefully.
+	if ctl.Quit != nil {
+		ctl.Quit()
 	}
 }
@@ -0,0 +1,161 @@
+//go:build windows || (tray && (linux || darwin))
+
+package main
+
+import (
+	_ "embed"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+)
+
+// trayBuilt reports whether this binary includes the tray. Windows always
+// does; Linux and macOS need -tags tray (cgo plus GTK/appindicator on Linux).
+const trayBuilt = true
+
+var (
+	//go:embed assets/icon.ico
+	trayIconICO []byte
+	//go:embed assets/icon.png
+	trayIconPNG []byte
+)
+
+// macOS requires the tray's event loop on the main thread; keep main() there.
+func init() {
+	if runtime.GOOS == "darwin" {
+		runtime.LockOSThread()
+	}
+}
+
+// StartTray starts the system tray: live status in the tooltip, a manual
+// check, notification pause/resume, config reload, the log file and quit.
+func StartTray(ctl trayControl) {
+	systray.Run(func() {
+		if runtime.GOOS == "windows" {
+			systray.SetIcon(trayIconICO)
+		} else {
+			systray.SetIcon(trayIconPNG)
+		}
+		systray.SetTitle("Bombeiros Monitor")
+		systray.SetTooltip("Monitor de ocorrências — a correr em segundo plano")
+		mList := systray.AddMenuItem("Ocorrências ativas", "Ocorrências filtradas do último ciclo")
+		mNone := mList.AddSubMenuItem("Nenhuma ocorrência ativa", "")
+		mNone.Disable()
+		// systray cannot delete items, so a fixed set is reused and hidden when unused.
+		items := make([]*systray.MenuItem, trayMaxIncidents)
+		urls := make([]string, trayMaxIncidents)
+		var urlsMu sync.Mutex
+		for i := range items {
+			items[i] = mList.AddSubMenuItem("", "Abrir no browser")
+			items[i].Hide()
+			go func(i int) {
+				for range items[i].ClickedCh {
+					urlsMu.Lock()
+					u := urls[i]
+					urlsMu.Unlock()
+					if u != "" {
+						if err := openURL(u); err != nil {
+							slog.Warn("abrir URL", "url", u, "err", err)
+						}
+					}
+				}
+			}(i)
+		}
+		systray.AddSeparator()
+		mCheck := systray.AddMenuItem("Verificar agora", "Consultar o feed sem esperar pelo próximo ciclo")
+		mPause := systray.AddMenuItem("Pausar notificações", "Suspender o envio de notificações")
+		mPause1h := mPause.AddSubMenuItem("1 hora", "Retomar automaticamente daqui a 1 hora")
+		mPauseIndef := mPause.AddSubMenuItem("Até retomar", "Só retomar manualmente")
+		mResume := systray.AddMenuItem("Retomar notificações", "Voltar a enviar notificações")
+		mResume.Hide()
+		systray.AddSeparator()
+		mReload := systray.AddMenuItem("Recarregar configuração", "Reler o ficheiro de configuração e o ambiente")
+		var logClicked <-chan struct{} // stays nil without a log file
+		if logFile != nil {
+			logClicked = systray.AddMenuItem("Abrir registo", logFile.path).ClickedCh
+		}
+		mQuit := systray.AddMenuItem("Sair", "Fechar o monitor")
+
+		var last cycleReport
+		refresh := func() {
+			title, tip := trayText(last)
+			systray.SetTitle(title)
+			systray.SetTooltip(tip)
+			if paused, _ := notifyPause.status(); paused {
+				mPause.Hide()
+				mResume.Show()
+			} else {
+				mResume.Hide()
+				mPause.Show()
+			}
+		}
+		pause := func(d time.Duration) {
+			if ctl.Pause != nil {
+				ctl.Pause(d)
+			}
+			refresh()
+		}
+		// A timed pause ends on its own; re-check the menu periodically.
+		tick := time.NewTicker(time.Minute)
+		go func() {
+			defer tick.Stop()
+			for {
+				select {
+				case last = <-ctl.Updates:
+					refresh()
+					urlsMu.Lock()
+					for i, it := range items {
+						if i < len(last.Incidents) {
+							urls[i] = last.Incidents[i].URL
+							it.SetTitle(last.Incidents[i].Label)
+							it.Show()
+						} else {
+							urls[i] = ""
+							it.Hide()
+						}
+					}
+					urlsMu.Unlock()
+					if len(last.Incidents) == 0 {
+						mNone.Show()
+					} else {
+						mNone.Hide()
+					}
+				case <-tick.C:
+					refresh()
+				case <-mCheck.ClickedCh:
+					if ctl.CheckNow != nil {
+						ctl.CheckNow()
+					}
+				case <-mPause1h.ClickedCh:
+					pause(time.Hour)
+				case <-mPauseIndef.ClickedCh:
+					pause(0)
+				case <-mResume.ClickedCh:
+					if ctl.Resume != nil {
+						ctl.Resume()
+					}
+					refresh()
+				case <-mReload.ClickedCh:
+					if ctl.Reload != nil {
+						ctl.Reload()
+					}
+				case <-logClicked:
+					if err := openURL(logFile.path); err != nil {
+						slog.Warn("abrir registo", "path", logFile.path, "err", err)
+					}
+				case <-mQuit.ClickedCh:
+					if ctl.Quit != nil {
+						ctl.Quit()
+					}
+					systray.Quit()
+					return
+				}
+			}
+		}()
+	}, func() {
+		slog.Info("Tray terminated")
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+// The first cycle after a start (or after STATE_FILE was reloaded) is a
+// warm-up: every incident in the feed that the persisted state already knows
+// is matched against it. One that is tracked but no longer listed under its
+// municipality key (the key was canonicalized, or the feed now names
+// another concelho) is put back silently instead of being announced as new,
+// so only a status or means change that happened while we were down is
+// notified.
+
+// warmUpEntry is one known incident seen during the warm-up.
+type warmUpEntry struct {
+	id, concelho string
+	from, to     string // status in STATE_FILE and in the feed
+	rekeyed      bool   // was missing from its municipality key
+	meansChanged bool
+}
+
+// warmUpMatch records id as reconciled when the warm-up is running and the
+// persisted state knows it, and reports whether it did.
+func (ms *MonitorState) warmUpMatch(entries *[]warmUpEntry, id string, f Feature, existed bool, cur Means) bool {
+	if ms.warm || !ms.isTracked(id) {
+		return false
+	}
+	prev, ok := ms.means[id]
+	*entries = append(*entries, warmUpEntry{
+		id:           id,
+		concelho:     getMunicipio(f.Properties),
+		from:         ms.status[id],
+		to:           getPropStr(f.Properties, "status"),
+		rekeyed:      !existed,
+		meansChanged: ok && prev != cur,
+	})
+	return true
+}
+
+func logWarmUp(entries []warmUpEntry) {
+	unchanged := 0
+	for _, e := range entries {
+		statusChanged := e.to != "" && e.to != e.from
+		level := slog.LevelInfo
+		if !statusChanged && !e.meansChanged && !e.rekeyed {
+			level = slog.LevelDebug
+		}
+		if !statusChanged && !e.meansChanged {
+			unchanged++
+		}
+		slog.Log(context.Background(), level, "arranque: ocorrência reconciliada", "incident_id", e.id, "concelho", e.concelho,
+			"status", e.to, "status_changed", statusChanged, "means_changed", e.meansChanged, "rekeyed", e.rekeyed)
+	}
+	if len(entries) == 0 {
+		return
+	}
+	slog.Info("arranque: estado reconciliado com o feed", "known", len(entries), "unchanged", unchanged)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRestartMidIncident restarts the monitor while an incident is active
+// and lets the feed move on while it is down.
+func TestRestartMidIncident(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		after   func() map[string]any // the incident when the monitor is back
+		want    []string              // besides the incident that appeared while down
+		wantLog string
+	}{
+		{
+			name:    "nothing changed",
+			after:   func() map[string]any { return incident("2025050001", "Em Curso", 20) },
+			wantLog: "status_changed=false means_changed=false rekeyed=false",
+		},
+		{
+			name:    "status changed while down",
+			after:   func() map[string]any { return incident("2025050001", "Em Resolução", 20) },
+			want:    []string{"Em Curso → Em Resolução — Sertã — Mato"},
+			wantLog: `status="Em Resolução" status_changed=true means_changed=false`,
+		},
+		{
+			name:    "means changed while down",
+			after:   func() map[string]any { return incident("2025050001", "Em Curso", 48) },
+			want:    []string{"Atualização de meios — Sertã"},
+			wantLog: "status_changed=false means_changed=true",
+		},
+		{
+			name: "now listed under another concelho",
+			after: func() map[string]any {
+				f := incident("2025050001", "Em Curso", 20)
+				f["concelho"] = "Oleiros"
+				return f
+			},
+			wantLog: "concelho=Oleiros status=\"Em Curso\" status_changed=false means_changed=false rekeyed=true",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cfg, srv, clk, ms := newTestMonitor(t, map[string]string{"MUNICIPIOS": "Sertã,Oleiros"})
+			srv.setFeed(incident("2025050001", "Despacho", 20))
+			mustRun(t, cfg, ms)
+			clk.advance(time.Minute)
+			srv.setFeed(incident("2025050001", "Em Curso", 20))
+			mustRun(t, cfg, ms)
+			srv.take()
+
+			clk.advance(20 * time.Minute)
+			logs := captureDebugLog(t)
+			ms = NewMonitorState()
+			srv.setFeed(c.after(), incident("2025050002", "Despacho", 4))
+			mustRun(t, cfg, ms)
+			// the incident that appeared while down is announced as usual
+			want := append([]string{"Novo em Sertã — Mato (14-08 16:20)", "Novo → Despacho — Sertã — Mato"}, c.want...)
+			if got := titles(srv.take()); !sameElements(got, want) {
+				t.Errorf("after the restart: %q, want %q", got, want)
+			}
+			if !strings.Contains(logs.String(), `msg="arranque: ocorrência reconciliada" incident_id=2025050001`) || !strings.Contains(logs.String(), c.wantLog) {
+				t.Errorf("reconciliation log lacks %q:\n%s", c.wantLog, logs)
+			}
+			if strings.Contains(logs.String(), `reconciliada" incident_id=2025050002`) {
+				t.Error("the new incident was reconciled")
+			}
+			if first, _ := ms.FirstSeen("2025050001"); !first.Equal(testStart) {
+				t.Errorf("first seen %v, want %v", first, testStart)
+			}
+
+			// the warm-up is over: later changes are ordinary ones
+			clk.advance(time.Minute)
+			srv.setFeed(incident("2025050001", "Conclusão", 0))
+			mustRun(t, cfg, ms)
+			if got := titles(srv.take()); len(got) == 0 || !strings.HasSuffix(got[0], "→ Conclusão — Sertã — Mato") && !strings.HasSuffix(got[0], "→ Conclusão — Oleiros — Mato") {
+				t.Errorf("after the warm-up: %q", got)
+			}
+		})
+	}
+}
+
+// sameElements reports whether a and b hold the same strings in any order.
+func sameElements(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
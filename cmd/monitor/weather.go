@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// openMeteoURL is Open-Meteo's free forecast API; no key needed.
+const openMeteoURL = "https://api.open-meteo.com/v1/forecast"
+
+const (
+	weatherCell = 0.05 // degrees, ~5 km
+	weatherTTL  = 15 * time.Minute
+)
+
+type weatherNow struct {
+	TempC    float64 `json:"temperature_2m"`
+	Humidity float64 `json:"relative_humidity_2m"`
+	WindKmh  float64 `json:"wind_speed_10m"`
+	WindDir  float64 `json:"wind_direction_10m"`
+}
+
+type weatherEntry struct {
+	w  weatherNow
+	at time.Time
+}
+
+// weatherCache is keyed by grid cell and owned by the poll goroutine.
+var weatherCache = map[string]weatherEntry{}
+
+// weatherAt returns current conditions near lat/lon (WEATHER_ENRICH).
+func weatherAt(cfg *Config, lat, lon float64, now time.Time) (weatherNow, bool) {
+	if !cfg.WeatherEnrich {
+		return weatherNow{}, false
+	}
+	clat := math.Round(lat/weatherCell) * weatherCell
+	clon := math.Round(lon/weatherCell) * weatherCell
+	key := fmt.Sprintf("%.2f,%.2f", clat, clon)
+	for k, e := range weatherCache {
+		if now.Sub(e.at) > weatherTTL {
+			delete(weatherCache, k)
+		}
+	}
+	if e, ok := weatherCache[key]; ok {
+		return e.w, true
+	}
+	w, err := fetchWeather(cfg, clat, clon)
+	if err != nil {
+		slog.Warn("Open-Meteo indisponível; meteo omitida", "err", err)
+		return weatherNow{}, false
+	}
+	weatherCache[key] = weatherEntry{w: w, at: now}
+	return w, true
+}
+
+func fetchWeather(cfg *Config, lat, lon float64) (weatherNow, error) {
+	q := url.Values{}
+	q.Set("latitude", strconv.FormatFloat(lat, 'f', 2, 64))
+	q.Set("longitude", strconv.FormatFloat(lon, 'f', 2, 64))
+	q.Set("current", "temperature_2m,relative_humidity_2m,wind_speed_10m,wind_direction_10m")
+	q.Set("wind_speed_unit", "kmh")
+	resp, err := cfg.weatherClient.Get(openMeteoURL + "?" + q.Encode())
+	if err != nil {
+		return weatherNow{}, err
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode >= 400 {
+		return weatherNow{}, fmt.Errorf("http %d: %s", resp.StatusCode, string(b))
+	}
+	var doc struct {
+		Current *weatherNow `json:"current"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return weatherNow{}, err
+	}
+	if doc.Current == nil {
+		return weatherNow{}, fmt.Errorf("resposta sem current")
+	}
+	return *doc.Current, nil
+}
+
+// weatherLine formats conditions as "Meteo: 32°C, HR 18%, vento 25 km/h NW".
+func weatherLine(w weatherNow) string {
+	return tr("weather.line", w.TempC, w.Humidity, w.WindKmh, compass16(w.WindDir))
+}
+
+// weatherEnrich appends the weather line for f to body and applies the wind
+// tag and priority bump. Without coordinates or data it changes nothing.
+func weatherEnrich(cfg *Config, f Feature, body, tags, pr string, now time.Time) (string, string, string) {
+	lat, lon, ok := getCoords(f.Geometry)
+	if !ok {
+		return body, tags, pr
+	}
+	w, ok := weatherAt(cfg, lat, lon, now)
+	if !ok {
+		return body, tags, pr
+	}
+	body += "\n" + weatherLine(w)
+	if cfg.WeatherWindKmh > 0 && w.WindKmh >= cfg.WeatherWindKmh {
+		tags = addTag(tags, "dash")
+		pr = bumpPriority(pr)
+	}
+	return body, tags, pr
+}
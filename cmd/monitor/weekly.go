@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// historyKeep is how long finished incidents are remembered for the weekly
+// summary; a day more than the window so a late poll still sees the week.
+const historyKeep = 8 * 24 * time.Hour
+
+// historyEntry outlives the per-ID state, which forgets an incident as soon
+// as it leaves the feed.
+type historyEntry struct {
+	Concelho  string    `json:"concelho"`
+	Natureza  string    `json:"natureza"`
+	First     time.Time `json:"first"`
+	Concluded time.Time `json:"concluded"`
+	AreaKm2   float64   `json:"area_km2,omitempty"`
+	BurnedHa  float64   `json:"burned_ha,omitempty"` // latest ICNF figure
+}
+
+// weeklySchedule is SUMMARY_WEEKLY_AT parsed.
+type weeklySchedule struct {
+	day          time.Weekday
+	hour, minute int
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "dom": time.Sunday,
+	"mon": time.Monday, "seg": time.Monday,
+	"tue": time.Tuesday, "ter": time.Tuesday,
+	"wed": time.Wednesday, "qua": time.Wednesday,
+	"thu": time.Thursday, "qui": time.Thursday,
+	"fri": time.Friday, "sex": time.Friday,
+	"sat": time.Saturday, "sab": time.Saturday,
+}
+
+// parseWeeklySchedule reads "sun 20:00" (English or Portuguese day, first
+// three letters are enough).
+func parseWeeklySchedule(v string) (weeklySchedule, error) {
+	f := strings.Fields(strings.ToLower(stripAccents(v)))
+	if len(f) != 2 || len(f[0]) < 3 {
+		return weeklySchedule{}, fmt.Errorf("SUMMARY_WEEKLY_AT=%q: esperado dia e hora, ex.: dom 20:00", v)
+	}
+	day, ok := weekdayNames[f[0][:3]]
+	if !ok {
+		return weeklySchedule{}, fmt.Errorf("SUMMARY_WEEKLY_AT=%q: dia da semana desconhecido", v)
+	}
+	t, err := time.Parse("15:04", f[1])
+	if err != nil {
+		return weeklySchedule{}, fmt.Errorf("SUMMARY_WEEKLY_AT=%q: hora inválida", v)
+	}
+	return weeklySchedule{day: day, hour: t.Hour(), minute: t.Minute()}, nil
+}
+
+// lastOccurrence returns the latest scheduled time at or before now.
+func (w weeklySchedule) lastOccurrence(now time.Time) time.Time {
+	back := (int(now.Weekday()) - int(w.day) + 7) % 7
+	d := now.AddDate(0, 0, -back)
+	t := time.Date(d.Year(), d.Month(), d.Day(), w.hour, w.minute, 0, 0, now.Location())
+	if t.After(now) {
+		t = t.AddDate(0, 0, -7)
+	}
+	return t
+}
+
+// recordHistory notes an incident seen this cycle, with its KML area if any.
+func (ms *MonitorState) recordHistory(id string, p map[string]any, now time.Time) {
+	h, ok := ms.history[id]
+	if !ok {
+		h.First = now
+		if t, ok := ms.firstSeen[id]; ok {
+			h.First = t
+		}
+	}
+	h.Concelho = getMunicipio(p)
+	h.Natureza = getPropStr(p, "natureza")
+	if kml := getPropStr(p, "kmlVost", "kml"); kml != "" {
+		if a, _ := kmlAreaPerimeter(kml); a > h.AreaKm2 {
+			h.AreaKm2 = a
+		}
+	}
+	if a, ok := icnfBurnedArea(p); ok {
+		h.BurnedHa = a.Total
+	}
+	ms.history[id] = h
+}
+
+func (ms *MonitorState) recordConcluded(id string, now time.Time) {
+	if h, ok := ms.history[id]; ok {
+		h.Concluded = now
+		ms.history[id] = h
+	}
+}
+
+// recordPeak keeps the day's highest active count and drops old history.
+func (ms *MonitorState) recordPeak(cfg *Config, active int, now time.Time) {
+	day := now.In(cfg.loc).Format("2006-01-02")
+	if active > ms.peaks[day] {
+		ms.peaks[day] = active
+	}
+	cutoff := now.Add(-historyKeep)
+	for d := range ms.peaks {
+		if d < cutoff.In(cfg.loc).Format("2006-01-02") {
+			delete(ms.peaks, d)
+		}
+	}
+	for id, h := range ms.history {
+		if h.First.Before(cutoff) && (h.Concluded.IsZero() || h.Concluded.Before(cutoff)) {
+			if _, tracked := ms.firstSeen[id]; !tracked {
+				delete(ms.history, id)
+			}
+		}
+	}
+	for id, steps := range ms.timeline {
+		if steps[len(steps)-1].At.Before(cutoff) && !ms.isTracked(id) {
+			delete(ms.timeline, id)
+		}
+	}
+}
+
+// weeklyDue reports whether a scheduled weekly summary has not been sent
+// yet, returning its mark. The first run only records the mark.
+func (ms *MonitorState) weeklyDue(cfg *Config, now time.Time) (string, bool) {
+	mark := cfg.weekly.lastOccurrence(now.In(cfg.loc)).Format("2006-01-02")
+	if ms.lastWeeklyMark == "" {
+		ms.lastWeeklyMark = mark
+		return mark, false
+	}
+	return mark, mark > ms.lastWeeklyMark
+}
+
+// buildWeeklySummary aggregates the 7 days before now. It returns the plain
+// body and its markdown version.
+func (ms *MonitorState) buildWeeklySummary(cfg *Config, now time.Time) (title, body, md string) {
+	from := now.Add(-7 * 24 * time.Hour)
+	local := now.In(cfg.loc)
+	title = tr("weekly.title", from.In(cfg.loc).Format("02/01"), local.Format("02/01"))
+
+	byConc, byNat := map[string]int{}, map[string]int{}
+	total, concluded := 0, 0
+	var ttc []time.Duration
+	var largestID string
+	var largest historyEntry
+	for id, h := range ms.history {
+		if !h.First.Before(from) {
+			total++
+			byConc[h.Concelho]++
+			byNat[h.Natureza]++
+		}
+		if !h.Concluded.IsZero() && !h.Concluded.Before(from) {
+			concluded++
+			if h.Concluded.After(h.First) {
+				ttc = append(ttc, h.Concluded.Sub(h.First))
+			}
+		}
+		// ongoing incidents count too, however long ago they started
+		inWeek := !h.First.Before(from) || !h.Concluded.Before(from) || ms.isTracked(id)
+		if inWeek && h.AreaKm2 > largest.AreaKm2 {
+			largest, largestID = h, id
+		}
+	}
+	peak := 0
+	for i := 0; i < 7; i++ {
+		peak = max(peak, ms.peaks[local.AddDate(0, 0, -i).Format("2006-01-02")])
+	}
+
+	var lines, mdLines []string
+	add := func(s string) {
+		lines = append(lines, s)
+		mdLines = append(mdLines, s)
+	}
+	lines = append(lines, tr("weekly.total", total))
+	mdLines = append(mdLines, "**"+tr("weekly.total", total)+"**")
+	if total > 0 {
+		lines = append(lines, tr("weekly.bymuni", countsLine(byConc)), tr("weekly.bynat", countsLine(byNat)))
+	}
+	add(tr("weekly.concluded", concluded))
+	if len(ttc) > 0 {
+		sort.Slice(ttc, func(i, j int) bool { return ttc[i] < ttc[j] })
+		var sum time.Duration
+		for _, d := range ttc {
+			sum += d
+		}
+		p90 := ttc[int(math.Ceil(0.9*float64(len(ttc))))-1]
+		add(tr("weekly.ttc", fmtDuration(sum/time.Duration(len(ttc))), fmtDuration(p90)))
+	}
+	if largest.AreaKm2 > 0 {
+		add(tr("weekly.largest", largest.AreaKm2, largest.Concelho, largestID))
+	}
+	if ha, n := ms.burnedSince(from); n > 0 {
+		add(trn("icnf.summary", n, ha))
+	}
+	add(tr("weekly.peak", peak))
+
+	body = strings.Join(lines, "\n")
+	blocks := []string{strings.Join(mdLines, "  \n")}
+	if total > 0 {
+		blocks = append(blocks, countsTableMD(tr("weekly.muni"), byConc), countsTableMD(tr("weekly.nat"), byNat))
+	}
+	return title, body, strings.Join(blocks, "\n\n")
+}
+
+// sortedCounts orders a count map by count, then name.
+func sortedCounts(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func countsLine(m map[string]int) string {
+	parts := []string{}
+	for _, k := range sortedCounts(m) {
+		parts = append(parts, fmt.Sprintf("%s: %d", k, m[k]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func countsTableMD(header string, m map[string]int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "| %s | %s |\n|---|--:|", header, tr("weekly.count"))
+	for _, k := range sortedCounts(m) {
+		fmt.Fprintf(&b, "\n| %s | %d |", k, m[k])
+	}
+	return b.String()
+}
+
+// fmtDuration renders a duration to the minute, e.g. "2h10m".
+func fmtDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	h, m := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case h == 0:
+		return fmt.Sprintf("%dm", m)
+	case m == 0:
+		return fmt.Sprintf("%dh", h)
+	}
+	return fmt.Sprintf("%dh%02dm", h, m)
+}